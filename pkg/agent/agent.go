@@ -843,7 +843,7 @@ func (c *agentController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 				}
 
 				// Replace certificate-authority-data from admin-kubeconfig
-				servingCert := getServingCert(hc)
+				servingCert := util.GetServingCertName(hc)
 				if servingCert != "" {
 					kubeconfig := hubMirrorSecret.Data["kubeconfig"]
 
@@ -1593,39 +1593,12 @@ func (c *agentController) replaceCertAuthDataInKubeConfig(ctx context.Context, k
 		return nil, err
 	}
 
-	tlsCrt := secret.Data["tls.crt"]
-	if tlsCrt == nil {
-		err := fmt.Errorf("invalid serving certificate secret")
-		c.log.Info(err.Error())
-
-		return nil, err
-	}
-
-	config, err := clientcmd.Load(kubeconfig)
+	updatedConfig, err := util.ReplaceCertAuthDataInKubeConfig(kubeconfig, secret.Data["tls.crt"])
 	if err != nil {
-		return nil, err
-	}
-
-	for _, v := range config.Clusters {
-		v.CertificateAuthorityData = tlsCrt
-	}
+		c.log.Info(err.Error())
 
-	updatedConfig, err := clientcmd.Write(*config)
-	if err != nil {
 		return nil, err
 	}
 
 	return updatedConfig, nil
 }
-
-// Retrieves the first serving certificate
-func getServingCert(hc *hyperv1beta1.HostedCluster) string {
-	if hc.Spec.Configuration != nil &&
-		hc.Spec.Configuration.APIServer != nil &&
-		&hc.Spec.Configuration.APIServer.ServingCerts != nil &&
-		len(hc.Spec.Configuration.APIServer.ServingCerts.NamedCertificates) > 0 {
-		return hc.Spec.Configuration.APIServer.ServingCerts.NamedCertificates[0].ServingCertificate.Name
-	}
-
-	return ""
-}
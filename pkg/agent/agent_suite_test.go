@@ -703,7 +703,7 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
 	// No HC yet, so the zero cluster claim value should be true
-	//zeroClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountZeroClusterClaimKey, metav1.GetOptions{})
+	//zeroClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.ZeroHostedClusterCountClaimKey, metav1.GetOptions{})
 	//suite.Nil(err, "is nil when the hc count zero clusterclaim is found")
 	//suite.Equal(strconv.FormatBool(true), zeroClusterClaim.Spec.Value)
 
@@ -721,17 +721,17 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
 	// Created 4 HCs, max 5 so the full cluster claim value should be false
-	fullClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountFullClusterClaimKey, metav1.GetOptions{})
+	fullClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.FullHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count full clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), fullClusterClaim.Spec.Value)
 
 	// Created 4 HCs, threshold 3 so the threshold cluster claim value should be true
-	thresholdClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(true), thresholdClusterClaim.Spec.Value)
 
 	// Created 4 HCs, so the zero cluster claim value should be false
-	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountZeroClusterClaimKey, metav1.GetOptions{})
+	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.ZeroHostedClusterCountClaimKey, metav1.GetOptions{})
 	//suite.Nil(err, "is nil when the hc count zero clusterclaim is found")
 	//suite.Equal(strconv.FormatBool(false), zeroClusterClaim.Spec.Value)
 
@@ -772,17 +772,17 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
 	// 5 HCs, max 5 so the full cluster claim value should be true
-	fullClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountFullClusterClaimKey, metav1.GetOptions{})
+	fullClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.FullHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the clusterclaim is found")
 	suite.Equal(strconv.FormatBool(true), fullClusterClaim.Spec.Value)
 
 	// Created 5 HCs, threshold 3 so the threshold cluster claim value should be true
-	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(true), thresholdClusterClaim.Spec.Value)
 
 	// Created 5 HCs, so the zero cluster claim value should be false
-	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountZeroClusterClaimKey, metav1.GetOptions{})
+	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.ZeroHostedClusterCountClaimKey, metav1.GetOptions{})
 	//suite.Nil(err, "is nil when the hc count zero clusterclaim is found")
 	//suite.Equal(strconv.FormatBool(false), zeroClusterClaim.Spec.Value)
 
@@ -801,17 +801,17 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	err = suite.controller.SyncAddOnPlacementScore(ctx, false)
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
-	fullClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountFullClusterClaimKey, metav1.GetOptions{})
+	fullClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.FullHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), fullClusterClaim.Spec.Value)
 
 	// Created 4 HCs, threshold 3 so the threshold cluster claim value should be true
-	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(true), thresholdClusterClaim.Spec.Value)
 
 	// Created 4 HCs, so the zero cluster claim value should be false
-	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountZeroClusterClaimKey, metav1.GetOptions{})
+	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.ZeroHostedClusterCountClaimKey, metav1.GetOptions{})
 	//suite.Nil(err, "is nil when the hc count zero clusterclaim is found")
 	//suite.Equal(strconv.FormatBool(false), zeroClusterClaim.Spec.Value)
 
@@ -825,7 +825,7 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
 	// 3 HCs, threshold 3 so the threshold cluster claim value should be true
-	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(true), thresholdClusterClaim.Spec.Value)
 
@@ -835,7 +835,7 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
 	// 2 HCs, threshold 3 so the threshold cluster claim value should be true
-	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), thresholdClusterClaim.Spec.Value)
 
@@ -847,17 +847,17 @@ func (suite *AgentTestSuite) TestHostedClusterCount() {
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
 	// 0 HC, max 5 so the full cluster claim value should be false
-	fullClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountFullClusterClaimKey, metav1.GetOptions{})
+	fullClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.FullHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), fullClusterClaim.Spec.Value)
 
 	// 0 HC, threshold 3 so the threshold cluster claim value should be false
-	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), thresholdClusterClaim.Spec.Value)
 
 	// 0 HC, so the zero cluster claim value should be true
-	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountZeroClusterClaimKey, metav1.GetOptions{})
+	//zeroClusterClaim, err = suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.ZeroHostedClusterCountClaimKey, metav1.GetOptions{})
 	//suite.Nil(err, "is nil when the hc count zero clusterclaim is found")
 	//suite.Equal(strconv.FormatBool(true), zeroClusterClaim.Spec.Value)
 
@@ -872,15 +872,15 @@ func (suite *AgentTestSuite) TestHostedClusterCountStartupErrorCase() {
 	err := suite.controller.SyncAddOnPlacementScore(ctx, true)
 	suite.Nil(err, "err nil when CreateAddOnPlacementScore was successfully")
 
-	clusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountFullClusterClaimKey, metav1.GetOptions{})
+	clusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.FullHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), clusterClaim.Spec.Value)
 
-	thresholdClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountAboveThresholdClusterClaimKey, metav1.GetOptions{})
+	thresholdClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.AboveThresholdHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count at threshold clusterclaim is found")
 	suite.Equal(strconv.FormatBool(false), thresholdClusterClaim.Spec.Value)
 
-	zeroClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hostedClusterCountZeroClusterClaimKey, metav1.GetOptions{})
+	zeroClusterClaim, err := suite.controller.spokeClustersClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.ZeroHostedClusterCountClaimKey, metav1.GetOptions{})
 	suite.Nil(err, "is nil when the hc count zero clusterclaim is found")
 	suite.Equal(strconv.FormatBool(true), zeroClusterClaim.Spec.Value)
 
@@ -1313,7 +1313,7 @@ func (suite *AgentTestSuite) Test_getNameCerts() {
 	}
 	for _, tt := range tests {
 		suite.Run(tt.name, func() {
-			if got := getServingCert(tt.hc); got != tt.want {
+			if got := util.GetServingCertName(tt.hc); got != tt.want {
 				suite.Errorf(nil, "hasNameCerts() = %v, want %v", got, tt.want)
 			}
 		})
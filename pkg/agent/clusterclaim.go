@@ -20,12 +20,6 @@ import (
 const (
 	// labelExcludeBackup is true for the local-cluster will not be backed up into velero
 	labelExcludeBackup = "velero.io/exclude-from-backup"
-
-	hypershiftManagementClusterClaimKey             = "hostingcluster.hypershift.openshift.io"
-	hypershiftHostedClusterClaimKey                 = "hostedcluster.hypershift.openshift.io"
-	hostedClusterCountFullClusterClaimKey           = "full.hostedclustercount.hypershift.openshift.io"
-	hostedClusterCountAboveThresholdClusterClaimKey = "above.threshold.hostedclustercount.hypershift.openshift.io"
-	hostedClusterCountZeroClusterClaimKey           = "zero.hostedclustercount.hypershift.openshift.io"
 )
 
 func newClusterClaim(name, value string) *clusterv1alpha1.ClusterClaim {
@@ -62,7 +56,7 @@ func createOrUpdate(ctx context.Context, client clusterclientset.Interface, newC
 }
 
 func (c *agentController) createManagementClusterClaim(ctx context.Context) error {
-	managementClaim := newClusterClaim(hypershiftManagementClusterClaimKey, "true")
+	managementClaim := newClusterClaim(util.HostingClusterClaimKey, "true")
 	return createOrUpdate(ctx, c.spokeClustersClient, managementClaim)
 }
 
@@ -72,17 +66,17 @@ func (c *agentController) createHostedClusterFullClusterClaim(ctx context.Contex
 	} else {
 		c.log.Info(fmt.Sprintf("the hosted cluster count has not reached the maximum %s yet. current count is %s", strconv.Itoa(c.maxHostedClusterCount), strconv.Itoa(count)))
 	}
-	hcFullClaim := newClusterClaim(hostedClusterCountFullClusterClaimKey, strconv.FormatBool(count >= c.maxHostedClusterCount))
+	hcFullClaim := newClusterClaim(util.FullHostedClusterCountClaimKey, strconv.FormatBool(count >= c.maxHostedClusterCount))
 	return createOrUpdate(ctx, c.spokeClustersClient, hcFullClaim)
 }
 
 func (c *agentController) createHostedClusterThresholdClusterClaim(ctx context.Context, count int) error {
-	hcThresholdClaim := newClusterClaim(hostedClusterCountAboveThresholdClusterClaimKey, strconv.FormatBool(count >= c.thresholdHostedClusterCount))
+	hcThresholdClaim := newClusterClaim(util.AboveThresholdHostedClusterCountClaimKey, strconv.FormatBool(count >= c.thresholdHostedClusterCount))
 	return createOrUpdate(ctx, c.spokeClustersClient, hcThresholdClaim)
 }
 
 func (c *agentController) createHostedClusterZeroClusterClaim(ctx context.Context, count int) error {
-	hcZeroClaim := newClusterClaim(hostedClusterCountZeroClusterClaimKey, strconv.FormatBool(count == 0))
+	hcZeroClaim := newClusterClaim(util.ZeroHostedClusterCountClaimKey, strconv.FormatBool(count == 0))
 	return createOrUpdate(ctx, c.spokeClustersClient, hcZeroClaim)
 }
 
@@ -96,7 +90,7 @@ func (c *agentController) createHostedClusterClaim(ctx context.Context, secret *
 		return fmt.Errorf("failed to create spoke clusters client, err: %w", err)
 	}
 
-	hostedClaim := newClusterClaim(hypershiftHostedClusterClaimKey, "true")
+	hostedClaim := newClusterClaim(util.HostedClusterClaimKey, "true")
 	err = createOrUpdate(ctx, clusterClient, hostedClaim)
 	if err != nil {
 		return err
@@ -21,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	hyperv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
 	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
 	clustercsfake "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
 )
@@ -42,7 +43,7 @@ func TestCreateManagementClusterClaim(t *testing.T) {
 		{
 			name: "create management cluster claim successfully",
 			validateFunc: func(t *testing.T, clusterClient clusterclientset.Interface) {
-				cc, err := clusterClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hypershiftManagementClusterClaimKey, metav1.GetOptions{})
+				cc, err := clusterClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.HostingClusterClaimKey, metav1.GetOptions{})
 				assert.Nil(t, err)
 				assert.Equal(t, "true", cc.Spec.Value)
 			},
@@ -92,7 +93,7 @@ func TestCreateHostedClusterClaim(t *testing.T) {
 				},
 			},
 			validateFunc: func(t *testing.T, runtimeClient ctrlclient.Client, clusterClient clusterclientset.Interface) {
-				cc, err := clusterClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hypershiftHostedClusterClaimKey, metav1.GetOptions{})
+				cc, err := clusterClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.HostedClusterClaimKey, metav1.GetOptions{})
 				assert.Nil(t, err)
 				assert.Equal(t, "true", cc.Spec.Value)
 			},
@@ -103,7 +104,7 @@ func TestCreateHostedClusterClaim(t *testing.T) {
 			hostedclusterNamespace: "clusters",
 			expectErr:              "the secret does not have any data",
 			validateFunc: func(t *testing.T, runtimeClient ctrlclient.Client, clusterClient clusterclientset.Interface) {
-				_, err := clusterClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), hypershiftHostedClusterClaimKey, metav1.GetOptions{})
+				_, err := clusterClient.ClusterV1alpha1().ClusterClaims().Get(context.TODO(), util.HostedClusterClaimKey, metav1.GetOptions{})
 				assert.True(t, errors.IsNotFound(err))
 			},
 		},
@@ -31,10 +31,13 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/metrics"
 )
 
 const (
@@ -43,6 +46,9 @@ const (
 	hcpProxyAPIVersion  = "v1alpha1"
 	hcpProxyResource    = "hostedclusters"
 
+	// hcpProxyGroupVersion is the apiVersion stamped on objects streamed back to callers.
+	hcpProxyGroupVersion = hcpProxyAPIGroup + "/" + hcpProxyAPIVersion
+
 	// In-cluster Service names/ports.
 	// cluster-proxy: operator pod namespace (POD_NAMESPACE / backplane-operator).
 	clusterProxyServiceName = "cluster-proxy-addon-user"
@@ -58,10 +64,15 @@ const (
 	// labelHostedCluster records the owning HostedCluster name on every related resource.
 	labelHostedCluster = "hcp.ocm.io/hostedcluster"
 
+	// annotationHostingCluster is set on objects returned by list/watch so callers
+	// can tell which hosting cluster each HostedCluster lives on.
+	annotationHostingCluster = "hcp.ocm.io/hosting-cluster"
+
 	// Spoke kube-apiserver path prefixes (constants — never built from request input).
 	apiPathPrefix         = "/apis/"
 	apiPathCoreNamespaces = "/api/v1/namespaces"
-	apiPathHSNamespaces   = "/apis/hypershift.openshift.io/v1beta1/namespaces"
+	apiPathHSGroupVersion = "/apis/hypershift.openshift.io/v1beta1"
+	apiPathHSNamespaces   = apiPathHSGroupVersion + "/namespaces"
 
 	headerContentType = "Content-Type"
 	contentTypeJSON   = "application/json"
@@ -71,8 +82,19 @@ const (
 	resourceNodePools      = "nodepools"
 	resourceHostedClusters = "hostedclusters"
 	resourceSecrets        = "secrets"
+	resourceConfigMaps     = "configmaps"
+
+	subresourceScale     = "scale"
+	subresourceResources = "resources"
 )
 
+// proxyResourceKinds maps the hypershift resources served under hcp.ocm.io to
+// their kinds.
+var proxyResourceKinds = map[string]string{
+	resourceHostedClusters: "HostedCluster",
+	resourceNodePools:      "NodePool",
+}
+
 // Overridable in tests.
 var (
 	certFilePath = hcpProxyTLSDir + "/tls.crt"
@@ -83,8 +105,13 @@ var (
 
 // CreateRequest mirrors the output of `hcp create cluster --render`.
 type CreateRequest struct {
-	// HostedCluster is required. spec.pullSecret.name must reference a Secret
-	// in the Secrets list (same as --render output).
+	// Parameters is the compact form of a create. The proxy renders the
+	// other fields from it, which must then be empty.
+	Parameters *ClusterParameters `json:"parameters,omitempty"`
+
+	// HostedCluster is required unless Parameters is set.
+	// spec.pullSecret.name must reference a Secret in the Secrets list (same
+	// as --render output).
 	HostedCluster *hypershiftv1beta1.HostedCluster `json:"hostedCluster"`
 
 	// NodePools is the list of NodePools to create (--render may produce more than one).
@@ -94,16 +121,37 @@ type CreateRequest struct {
 	// and (for cloud platforms) any STS/credential secrets.
 	// Each Secret is created on the spoke before the HostedCluster.
 	Secrets []corev1.Secret `json:"secrets,omitempty"`
+
+	// ConfigMaps the HostedCluster or its NodePools reference: additional
+	// trust bundle, OAuth CAs, NodePool spec.config and spec.tuningConfig, ...
+	// They are created after the Secrets and before the HostedCluster.
+	ConfigMaps []corev1.ConfigMap `json:"configMaps,omitempty"`
 }
 
 // ResourceBundle is the response body for GET/POST/PUT .../hostedclusters/{name}/resources.
 // Secrets are never included — the pull-secret field in HostedCluster.Spec is a
-// LocalObjectReference (name only), so no sensitive data is exposed.
+// LocalObjectReference (name only), so no sensitive data is exposed. The
+// Secrets and ConfigMaps the objects use are listed in References instead.
 type ResourceBundle struct {
+	// HostingCluster is the ManagedCluster the create ran on; set on create
+	// responses so callers using hostingCluster=auto learn the choice.
+	HostingCluster string `json:"hostingCluster,omitempty"`
+	// OperationID identifies a create for GET .../{name}/progress; set on
+	// create responses that are not dry runs.
+	OperationID   string                           `json:"operationID,omitempty"`
 	Namespace     *corev1.Namespace                `json:"namespace,omitempty"`
 	HostedCluster *hypershiftv1beta1.HostedCluster `json:"hostedCluster"`
 	NodePools     []hypershiftv1beta1.NodePool     `json:"nodePools,omitempty"`
 	Warnings      []string                         `json:"warnings,omitempty"`
+	// References names the Secrets and ConfigMaps the HostedCluster and
+	// NodePools use; ignored on PUT.
+	References []corev1.TypedLocalObjectReference `json:"references,omitempty"`
+	// Secrets and ConfigMaps are applied by a PUT, before the HostedCluster,
+	// and must be named in the references of the bundle. Never returned.
+	Secrets    []corev1.Secret    `json:"secrets,omitempty"`
+	ConfigMaps []corev1.ConfigMap `json:"configMaps,omitempty"`
+	// Errors lists the objects the spoke rejected during a dry run.
+	Errors []string `json:"errors,omitempty"`
 }
 
 // hcpProxy holds shared state for the proxy HTTP server.
@@ -114,6 +162,13 @@ type hcpProxy struct {
 	operatorNamespace string
 	clusterProxyURL   string                  // resolved at startup; overridable in tests
 	profileSpec       configv1.TLSProfileSpec // cluster TLS profile applied to server + outbound clients
+	audit             *auditor                // records mutating requests; nil disables auditing
+	migrations        migrationTracker        // migrations started or recovered by this replica
+	deletions         deletionTracker         // deletes with ?wait=true accepted by this replica
+	creates           createTracker           // start times of the creates served by this replica
+	permissions       permissionCache         // caches adminClusters per caller
+	limiter           *rateLimiter            // admission control; nil disables rate limiting
+	authzMode         string                  // authorizationModeUserPermission when empty
 	log               logr.Logger
 }
 
@@ -125,6 +180,12 @@ func StartHCPProxy(
 	hubClient client.Client,
 	log logr.Logger,
 ) error {
+	authzMode, err := authorizationModeFromEnv()
+	if err != nil {
+		return err
+	}
+	log.Info("HCP proxy authorization mode", "mode", authzMode)
+
 	operatorNamespace := resolveOperatorNamespace(ctx, hubClient, log)
 
 	clusterProxyURL := resolveClusterProxyURL(ctx, hubClient, operatorNamespace, log)
@@ -134,6 +195,15 @@ func StartHCPProxy(
 		return fmt.Errorf("failed to create hub dynamic client: %w", err)
 	}
 
+	audit, err := newAuditorFromEnv(hubClient, operatorNamespace, log.WithName("audit"))
+	if err != nil {
+		return err
+	}
+	go audit.run(ctx)
+
+	limiter := newRateLimiter(hubClient, operatorNamespace, log.WithName("ratelimit"))
+	go limiter.run(ctx)
+
 	p := &hcpProxy{
 		hubConfig:         hubConfig,
 		hubClient:         hubClient,
@@ -141,8 +211,15 @@ func StartHCPProxy(
 		operatorNamespace: operatorNamespace,
 		clusterProxyURL:   clusterProxyURL,
 		profileSpec:       profileSpec,
+		audit:             audit,
+		limiter:           limiter,
+		authzMode:         authzMode,
 		log:               log,
 	}
+	if err := p.permissions.watchClusterRoleBindings(ctx, hubConfig, log); err != nil {
+		log.Error(err, "permission cache will rely on its TTL only")
+	}
+	go p.recoverMigrations(ctx)
 
 	// Apply the cluster's APIServer TLS profile (MinVersion + CipherSuites) to the server.
 	tlsConfigFn, unsupported := tlspkg.NewTLSConfigFromProfile(profileSpec)
@@ -165,10 +242,13 @@ func StartHCPProxy(
 	mux.HandleFunc(apiPathPrefix+hcpProxyAPIGroup, p.handleDiscovery)
 	mux.HandleFunc(apiPathPrefix+hcpProxyAPIGroup+"/"+hcpProxyAPIVersion, p.handleDiscovery)
 	mux.HandleFunc(apiPathPrefix+hcpProxyAPIGroup+"/"+hcpProxyAPIVersion+"/", p.handleRoute)
+	mux.HandleFunc(apiPathOpenAPIV2, p.handleOpenAPIV2)
+	mux.HandleFunc(apiPathOpenAPIV3, p.handleOpenAPIV3)
+	mux.HandleFunc(apiPathOpenAPIV3+"/", p.handleOpenAPIV3)
 
 	server := &http.Server{
 		Addr:              hcpProxyListenAddr,
-		Handler:           p.loggingMiddleware(mux),
+		Handler:           p.loggingMiddleware(p.metricsMiddleware(p.auditMiddleware(p.rateLimitMiddleware(mux)))),
 		TLSConfig:         tlsCfg,
 		ReadHeaderTimeout: 30 * time.Second,
 	}
@@ -425,7 +505,7 @@ func (p *hcpProxy) handleDiscovery(w http.ResponseWriter, r *http.Request) {
 				"singularName": "hostedcluster",
 				"namespaced":   true,
 				"kind":         "HostedCluster",
-				"verbs":        []string{"create", "delete", "deletecollection", "get", "list"},
+				"verbs":        []string{"create", "delete", "deletecollection", "get", "list", "patch", "watch"},
 			},
 			{
 				// Alias subresource: same as GET|PUT /{name} but with an explicit /resources suffix.
@@ -435,6 +515,64 @@ func (p *hcpProxy) handleDiscovery(w http.ResponseWriter, r *http.Request) {
 				"kind":       "ResourceBundle",
 				"verbs":      []string{"get", "update"},
 			},
+			{
+				// The admin kubeconfig of the HostedCluster, returned as the
+				// kubeconfig file itself.
+				"name":       hcpProxyResource + "/" + subresourceKubeconfig,
+				"namespaced": true,
+				"group":      "",
+				"version":    "v1",
+				"kind":       "Config",
+				"verbs":      []string{"get"},
+			},
+			{
+				// Moves the HostedCluster to another hosting cluster; GET
+				// reports the progress of the latest migration.
+				"name":       hcpProxyResource + "/" + subresourceMigrate,
+				"namespaced": true,
+				"kind":       "MigrationStatus",
+				"verbs":      []string{"create", "get"},
+			},
+			{
+				// The phases of the create of the HostedCluster.
+				"name":       hcpProxyResource + "/" + subresourceProgress,
+				"namespaced": true,
+				"kind":       "CreateProgress",
+				"verbs":      []string{"get"},
+			},
+			{
+				// The progress of a DELETE with ?wait=true: the wait for the
+				// finalizers and the cleanup after them.
+				"name":       hcpProxyResource + "/" + subresourceDeletion,
+				"namespaced": true,
+				"kind":       "DeletionStatus",
+				"verbs":      []string{"get"},
+			},
+			{
+				// Labels a HostedCluster created directly on the hosting
+				// cluster, and what it uses, for management through the proxy.
+				"name":       hcpProxyResource + "/" + subresourceAdopt,
+				"namespaced": true,
+				"kind":       "AdoptionResult",
+				"verbs":      []string{"create"},
+			},
+			{
+				"name":         resourceNodePools,
+				"singularName": "nodepool",
+				"namespaced":   true,
+				"kind":         "NodePool",
+				"verbs":        []string{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"},
+			},
+			{
+				// Forwarded to the spoke NodePool scale subresource, so kubectl scale
+				// and HPA-style controllers can resize a pool from the hub.
+				"name":       resourceNodePools + "/" + subresourceScale,
+				"namespaced": true,
+				"group":      "autoscaling",
+				"version":    "v1",
+				"kind":       "Scale",
+				"verbs":      []string{"get", "patch", "update"},
+			},
 		},
 	}
 	_ = json.NewEncoder(w).Encode(doc)
@@ -442,32 +580,75 @@ func (p *hcpProxy) handleDiscovery(w http.ResponseWriter, r *http.Request) {
 
 // handleRoute dispatches all /apis/hcp.ocm.io/v1alpha1/... requests.
 func (p *hcpProxy) handleRoute(w http.ResponseWriter, r *http.Request) {
-	// Watch is not supported — the proxy is a stateless pass-through and
-	// cannot maintain long-lived event streams across spoke clusters.
-	if r.URL.Query().Get("watch") == "true" {
-		writeJSONError(w, "watch is not supported by the HCP proxy", http.StatusMethodNotAllowed)
-		return
-	}
-
 	prefix := apiPathPrefix + hcpProxyAPIGroup + "/" + hcpProxyAPIVersion + "/"
 	remaining := strings.TrimPrefix(r.URL.Path, prefix)
 	parts := strings.Split(remaining, "/")
 
 	hostingClusterParam := r.URL.Query().Get("hostingCluster")
 
-	// When hostingCluster is completely absent, the Kubernetes namespace
-	// controller may be sending collection-level GET (list) or DELETE
-	// (delete-collection) requests during namespace cleanup. The same
-	// applies to cluster-wide list calls (e.g. "oc get hostedclusters -A").
-	// Return an empty HostedClusterList so these callers are not blocked.
-	// POST (create) still requires a spoke target → fall through to 400.
+	// When hostingCluster is completely absent, a collection GET (list) is
+	// a fleet-wide query — "oc get hostedclusters -A" or a namespaced list —
+	// and fans out to every hosting cluster the caller administers. The
+	// Kubernetes namespace controller also lists (and delete-collections)
+	// during namespace cleanup; DELETE returns an empty list so it is not
+	// blocked. A collection watch ("oc get hostedclusters -A -w") merges the
+	// watches of the same hosting clusters. POST (create) still requires a
+	// spoke target → fall through to 400.
 	if hostingClusterParam == "" {
-		isNamespacedCollection := len(parts) == 3 && parts[0] == "namespaces" && parts[2] == hcpProxyResource
-		isClusterWideList := len(parts) == 1 && parts[0] == hcpProxyResource
-		if (isNamespacedCollection || isClusterWideList) && (r.Method == http.MethodGet || r.Method == http.MethodDelete) {
-			p.handleEmptyCollection(w, r)
+		resource := parts[len(parts)-1]
+		_, isProxyResource := proxyResourceKinds[resource]
+		isNamespacedCollection := isProxyResource && len(parts) == 3 && parts[0] == "namespaces"
+		isClusterWideList := isProxyResource && len(parts) == 1
+		if isNamespacedCollection || isClusterWideList {
+			ns := ""
+			if isNamespacedCollection {
+				ns = parts[1]
+			}
+			switch {
+			case r.Method == http.MethodGet && isWatchRequest(r):
+				p.handleFanOutWatch(w, r, ns, resource)
+				return
+			case r.Method == http.MethodGet:
+				p.handleFanOutList(w, r, ns, resource)
+				return
+			case r.Method == http.MethodDelete:
+				p.handleEmptyCollection(w, r, resource)
+				return
+			}
+		}
+
+		// kubectl scale and HPA controllers cannot add hostingCluster, so a
+		// named NodePool request without it is sent to the hosting cluster
+		// that has the NodePool.
+		if isNamedNodePoolPath(parts) && !isWatchRequest(r) {
+			username, groups := whoIsTheCaller(r)
+			located, status, err := p.locateNodePool(r.Context(), username, groups, parts[1], parts[3])
+			if err != nil {
+				writeJSONError(w, err.Error(), status)
+				return
+			}
+			hostingClusterParam = located
+		}
+	}
+
+	// POST with hostingCluster=auto (or only a placement) lets the proxy choose
+	// the hosting cluster from the agent's capacity signals. The choice then
+	// goes through the same health and permission checks as an explicit one.
+	if wantsAutoHostingCluster(r) {
+		isCreate := r.Method == http.MethodPost &&
+			len(parts) == 3 && parts[0] == "namespaces" && parts[2] == hcpProxyResource
+		if !isCreate {
+			writeJSONError(w, "hostingCluster=auto and placement are only supported on create", http.StatusBadRequest)
 			return
 		}
+		username, groups := whoIsTheCaller(r)
+		chosen, status, err := p.selectHostingCluster(r.Context(), username, groups, callerExtra(r),
+			r.URL.Query().Get(queryPlacement))
+		if err != nil {
+			writeJSONError(w, err.Error(), status)
+			return
+		}
+		hostingClusterParam = chosen
 	}
 
 	hostingCluster, err := sanitizeProxyName(hostingClusterParam)
@@ -482,9 +663,10 @@ func (p *hcpProxy) handleRoute(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
+	auditRecordFor(r).HostingCluster = hostingCluster
+	requestMetricsFor(r).hostingCluster = hostingCluster
 
-	username, groups := whoIsTheCaller(r)
-	if err := p.checkHubPermission(r.Context(), username, groups, hostingCluster); err != nil {
+	if err := p.authorize(r, hostingCluster); err != nil {
 		writeJSONError(w, err.Error(), http.StatusForbidden)
 		return
 	}
@@ -496,10 +678,27 @@ func (p *hcpProxy) handleRoute(w http.ResponseWriter, r *http.Request) {
 
 	// GET|PUT|DELETE .../namespaces/{ns}/hostedclusters/{name}
 	// GET/PUT also accept the /resources suffix — both operate on the full bundle.
-	isNamed := (len(parts) == 4 || (len(parts) == 5 && parts[4] == "resources")) &&
+	// GET .../{name}/kubeconfig returns the admin kubeconfig.
+	// POST|GET .../{name}/migrate moves it to another hosting cluster.
+	// POST .../{name}/adopt labels it for management through the proxy.
+	isNamed := (len(parts) == 4 || (len(parts) == 5 && isHostedClusterSubresource(parts[4]))) &&
 		parts[0] == "namespaces" && parts[2] == hcpProxyResource
 	if isNamed {
-		p.dispatchNamed(w, r, parts[1], parts[3], hostingCluster)
+		subresource := ""
+		if len(parts) == 5 {
+			subresource = parts[4]
+		}
+		p.dispatchNamed(w, r, parts[1], parts[3], subresource, hostingCluster)
+		return
+	}
+
+	if len(parts) == 3 && parts[0] == "namespaces" && parts[2] == resourceNodePools {
+		p.dispatchNodePoolCollection(w, r, parts[1], hostingCluster)
+		return
+	}
+
+	if isNamedNodePoolPath(parts) {
+		p.dispatchNodePool(w, r, parts[1], parts[3], len(parts) == 5, hostingCluster)
 		return
 	}
 
@@ -513,6 +712,12 @@ func (p *hcpProxy) dispatchCollection(w http.ResponseWriter, r *http.Request, ns
 		return
 	}
 	switch r.Method {
+	case http.MethodGet:
+		if isWatchRequest(r) {
+			p.handleWatch(w, r, ns, resourceHostedClusters, "", hostingCluster)
+			return
+		}
+		p.handleList(w, r, ns, resourceHostedClusters, hostingCluster)
 	case http.MethodPost:
 		p.handleCreate(w, r, ns, hostingCluster)
 	default:
@@ -520,7 +725,9 @@ func (p *hcpProxy) dispatchCollection(w http.ResponseWriter, r *http.Request, ns
 	}
 }
 
-func (p *hcpProxy) dispatchNamed(w http.ResponseWriter, r *http.Request, nsRaw, nameRaw, hostingCluster string) {
+// dispatchNamed serves .../hostedclusters/{name} and its subresource, the
+// fifth path segment (empty for the HostedCluster itself).
+func (p *hcpProxy) dispatchNamed(w http.ResponseWriter, r *http.Request, nsRaw, nameRaw, subresource, hostingCluster string) {
 	ns, err := sanitizeProxyName(nsRaw)
 	if err != nil {
 		writeJSONError(w, "invalid namespace: "+err.Error(), http.StatusBadRequest)
@@ -531,11 +738,59 @@ func (p *hcpProxy) dispatchNamed(w http.ResponseWriter, r *http.Request, nsRaw,
 		writeJSONError(w, "invalid name: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	switch subresource {
+	case subresourceKubeconfig:
+		if r.Method != http.MethodGet {
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.handleKubeconfig(w, r, ns, name, hostingCluster)
+		return
+	case subresourceMigrate:
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.handleMigrate(w, r, ns, name, hostingCluster)
+		return
+	case subresourceProgress:
+		if r.Method != http.MethodGet {
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.handleProgress(w, r, ns, name, hostingCluster)
+		return
+	case subresourceAdopt:
+		if r.Method != http.MethodPost {
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.handleAdopt(w, r, ns, name, hostingCluster)
+		return
+	case subresourceDeletion:
+		if r.Method != http.MethodGet {
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.handleDeletion(w, ns, name, hostingCluster)
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
+		if isWatchRequest(r) {
+			p.handleWatch(w, r, ns, resourceHostedClusters, name, hostingCluster)
+			return
+		}
 		p.handleGetResources(w, r, ns, name, hostingCluster)
 	case http.MethodPut:
 		p.handlePatchResources(w, r, ns, name, hostingCluster)
+	case http.MethodPatch:
+		// PATCH targets the HostedCluster itself; the /resources bundle is PUT-only.
+		if subresource == subresourceResources {
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		p.handlePatch(w, r, ns, resourceHostedClusters, name, hostingCluster)
 	case http.MethodDelete:
 		p.handleDelete(w, r, ns, name, hostingCluster)
 	default:
@@ -543,17 +798,98 @@ func (p *hcpProxy) dispatchNamed(w http.ResponseWriter, r *http.Request, nsRaw,
 	}
 }
 
-// handleEmptyCollection returns an empty success response for collection-level
-// operations (LIST / DELETE-collection) that arrive without a hostingCluster
-// query parameter. The Kubernetes namespace controller sends these during
-// namespace cleanup to enumerate and remove all resources of every registered
-// API type. Since the proxy does not store resources locally (it proxies to
-// spoke clusters identified by hostingCluster), an empty list is correct.
-func (p *hcpProxy) handleEmptyCollection(w http.ResponseWriter, r *http.Request) {
+// isHostedClusterSubresource reports whether sub is served under
+// .../hostedclusters/{name}/.
+func isHostedClusterSubresource(sub string) bool {
+	return sub == subresourceResources || sub == subresourceKubeconfig || sub == subresourceMigrate ||
+		sub == subresourceProgress || sub == subresourceAdopt || sub == subresourceDeletion
+}
+
+// isNamedNodePoolPath matches namespaces/{ns}/nodepools/{name} and its /scale
+// subresource.
+func isNamedNodePoolPath(parts []string) bool {
+	return (len(parts) == 4 || (len(parts) == 5 && parts[4] == subresourceScale)) &&
+		parts[0] == "namespaces" && parts[2] == resourceNodePools
+}
+
+// dispatchNodePoolCollection handles .../namespaces/{ns}/nodepools.
+func (p *hcpProxy) dispatchNodePoolCollection(w http.ResponseWriter, r *http.Request, nsRaw, hostingCluster string) {
+	ns, err := sanitizeProxyName(nsRaw)
+	if err != nil {
+		writeJSONError(w, "invalid namespace: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if isWatchRequest(r) {
+			p.handleWatch(w, r, ns, resourceNodePools, "", hostingCluster)
+			return
+		}
+		p.handleList(w, r, ns, resourceNodePools, hostingCluster)
+	case http.MethodPost:
+		p.handleNodePoolWrite(w, r, ns, "", hostingCluster)
+	default:
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// dispatchNodePool handles .../namespaces/{ns}/nodepools/{name}, and its
+// scale subresource when scale is set.
+func (p *hcpProxy) dispatchNodePool(
+	w http.ResponseWriter,
+	r *http.Request,
+	nsRaw, nameRaw string,
+	scale bool,
+	hostingCluster string,
+) {
+	ns, err := sanitizeProxyName(nsRaw)
+	if err != nil {
+		writeJSONError(w, "invalid namespace: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := sanitizeProxyName(nameRaw)
+	if err != nil {
+		writeJSONError(w, "invalid name: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if scale {
+		switch r.Method {
+		case http.MethodGet, http.MethodPut, http.MethodPatch:
+			p.handleNodePoolScale(w, r, ns, name, hostingCluster)
+		default:
+			writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if isWatchRequest(r) {
+			p.handleWatch(w, r, ns, resourceNodePools, name, hostingCluster)
+			return
+		}
+		p.handleNodePoolGet(w, r, ns, name, hostingCluster)
+	case http.MethodPut:
+		p.handleNodePoolWrite(w, r, ns, name, hostingCluster)
+	case http.MethodPatch:
+		p.handlePatch(w, r, ns, resourceNodePools, name, hostingCluster)
+	case http.MethodDelete:
+		p.handleNodePoolDelete(w, r, ns, name, hostingCluster)
+	default:
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEmptyCollection returns an empty success response for DELETE-collection
+// requests that arrive without a hostingCluster query parameter. The Kubernetes
+// namespace controller sends these during namespace cleanup to remove all
+// resources of every registered API type. Since the proxy does not store
+// resources locally (it proxies to spoke clusters identified by hostingCluster),
+// an empty list is correct.
+func (p *hcpProxy) handleEmptyCollection(w http.ResponseWriter, r *http.Request, resource string) {
 	w.Header().Set(headerContentType, contentTypeJSON)
 	_ = json.NewEncoder(w).Encode(map[string]interface{}{
 		"apiVersion": hcpProxyAPIGroup + "/" + hcpProxyAPIVersion,
-		"kind":       "HostedClusterList",
+		"kind":       proxyResourceKinds[resource] + "List",
 		"metadata":   map[string]interface{}{"resourceVersion": ""},
 		"items":      []interface{}{},
 	})
@@ -587,6 +923,32 @@ func whoIsTheCaller(r *http.Request) (username string, groups []string) {
 
 // checkHubPermission verifies the caller has admin-level access to the hosting cluster
 // via the clusterview UserPermission named "managedcluster:admin".
+func (p *hcpProxy) checkHubPermission(
+	ctx context.Context,
+	username string,
+	groups []string,
+	hostingCluster string,
+) error {
+	clusters, skipped, err := p.adminClusters(ctx, username, groups)
+	if err != nil {
+		reason := denialReasonCheckFailed
+		if username == "" {
+			reason = denialReasonUnauthenticated
+		}
+		metrics.HCPProxyAuthorizationDenials.WithLabelValues(hostingCluster, reason).Inc()
+		return err
+	}
+	if skipped || clusters.Has(hostingCluster) {
+		return nil
+	}
+	metrics.HCPProxyAuthorizationDenials.WithLabelValues(hostingCluster, denialReasonNotAdmin).Inc()
+	return fmt.Errorf("user %q does not have admin access to hosting cluster %q", username, hostingCluster)
+}
+
+// adminClusters returns the ManagedClusters listed in the caller's
+// "managedcluster:admin" UserPermission bindings. skipped is true when the
+// clusterview API is absent and SKIP_HUB_PERMISSION_CHECK=true, i.e. every
+// cluster is allowed.
 //
 // Two-step logic:
 //  1. Probe with the operator's own identity (no impersonation) to confirm the
@@ -595,14 +957,19 @@ func whoIsTheCaller(r *http.Request) (username string, groups []string) {
 //  2. Re-fetch under the caller's impersonated identity. A 404 at this step means
 //     the user does not hold managedcluster:admin on any cluster → hard deny.
 //     (View-only callers have a "managedcluster:view" object, not "managedcluster:admin".)
-func (p *hcpProxy) checkHubPermission(
+func (p *hcpProxy) adminClusters(
 	ctx context.Context,
 	username string,
 	groups []string,
-	hostingCluster string,
-) error {
+) (sets.Set[string], bool, error) {
 	if username == "" {
-		return fmt.Errorf("unauthenticated request")
+		return nil, false, fmt.Errorf("unauthenticated request")
+	}
+
+	key := permissionCacheKey(username, groups)
+	cached, generation, ok := p.permissions.get(key, time.Now())
+	if ok {
+		return cached, false, nil
 	}
 
 	gvr := schema.GroupVersionResource{
@@ -612,27 +979,26 @@ func (p *hcpProxy) checkHubPermission(
 	}
 
 	// Step 1 — probe API availability using the operator's own credentials (cached client).
-	// The userpermissions API is virtual: it returns results scoped to the caller's identity.
-	// The operator SA has no managedcluster:admin bindings, so a regular 404 ("not found")
-	// is expected and means the API exists. Only a 404 with "the server could not find the
-	// requested resource" means the API group itself is absent (kind / non-ACM hub).
-	if _, probeErr := p.hubDynClient.Resource(gvr).Get(ctx, "managedcluster:admin", metav1.GetOptions{}); probeErr != nil {
-		if apierrors.IsNotFound(probeErr) {
-			if strings.Contains(probeErr.Error(), "the server could not find the requested resource") {
-				// API group is not registered — only skip in E2E/kind environments.
-				// On production clusters this could indicate a partial MCE install failure;
-				// skipping would be a security risk.
-				if os.Getenv("SKIP_HUB_PERMISSION_CHECK") == "true" {
-					p.log.Info("clusterview API not installed, skipping hub permission check (SKIP_HUB_PERMISSION_CHECK=true)")
-					return nil
-				}
-				return fmt.Errorf("UserPermission is required in production. Please ensure the cluster has UserPermission configured")
-			}
-			// API exists but the SA has no admin bindings — expected. Proceed to step 2.
-		} else {
-			// Fail closed: network/auth/other probe errors must not bypass authorization.
-			return fmt.Errorf("clusterview permission probe failed: %w", probeErr)
+	// The result is cached for clusterviewProbeTTL: whether the API is installed
+	// does not depend on the caller.
+	probe := p.permissions.cachedProbe(time.Now())
+	if probe == clusterviewUnknown {
+		var err error
+		if probe, err = p.probeClusterview(ctx, gvr); err != nil {
+			return nil, false, err
+		}
+		p.permissions.setProbe(probe, time.Now())
+	}
+	if probe == clusterviewAbsent {
+		// API group is not registered — only skip in E2E/kind environments.
+		// On production clusters this could indicate a partial MCE install failure;
+		// skipping would be a security risk.
+		if os.Getenv("SKIP_HUB_PERMISSION_CHECK") == "true" {
+			p.log.Info("clusterview API not installed, skipping hub permission check (SKIP_HUB_PERMISSION_CHECK=true)")
+			return nil, true, nil
 		}
+		return nil, false, fmt.Errorf(
+			"UserPermission is required in production. Please ensure the cluster has UserPermission configured")
 	}
 
 	// Step 2 — check caller's permissions under impersonation.
@@ -644,33 +1010,56 @@ func (p *hcpProxy) checkHubPermission(
 	}
 	dynClient, err := dynamic.NewForConfig(impConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create impersonated client: %w", err)
+		return nil, false, fmt.Errorf("failed to create impersonated client: %w", err)
 	}
 
+	clusters := sets.New[string]()
 	item, err := dynClient.Resource(gvr).Get(ctx, "managedcluster:admin", metav1.GetOptions{})
 	if err != nil {
 		// API exists but the user cannot see this object → not an admin on any cluster.
-		return fmt.Errorf("user %q does not have admin access to hosting cluster %q", username, hostingCluster)
+		// Only a definite answer is cached; a transient error is retried next time.
+		if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+			p.permissions.put(key, clusters, generation, time.Now())
+		}
+		return clusters, false, nil
 	}
 
-	status, ok := item.Object["status"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("user %q does not have admin access to hosting cluster %q", username, hostingCluster)
-	}
-	bindingList, ok := status["bindings"].([]interface{})
-	if !ok {
-		return fmt.Errorf("user %q does not have admin access to hosting cluster %q", username, hostingCluster)
-	}
+	status, _ := item.Object["status"].(map[string]interface{})
+	bindingList, _ := status["bindings"].([]interface{})
 	for _, b := range bindingList {
 		bMap, ok := b.(map[string]interface{})
 		if !ok {
 			continue
 		}
-		if cluster, _ := bMap["cluster"].(string); cluster == hostingCluster {
-			return nil
+		if cluster, _ := bMap["cluster"].(string); cluster != "" {
+			clusters.Insert(cluster)
 		}
 	}
-	return fmt.Errorf("user %q does not have admin access to hosting cluster %q", username, hostingCluster)
+	p.permissions.put(key, clusters, generation, time.Now())
+	return clusters, false, nil
+}
+
+// probeClusterview reports whether the clusterview API is installed, using the
+// operator's own identity. The userpermissions API is virtual: it returns
+// results scoped to the caller's identity. The operator SA has no
+// managedcluster:admin bindings, so a regular 404 ("not found") is expected and
+// means the API exists. Only a 404 with "the server could not find the
+// requested resource" means the API group itself is absent (kind / non-ACM hub).
+func (p *hcpProxy) probeClusterview(ctx context.Context, gvr schema.GroupVersionResource) (clusterviewProbe, error) {
+	_, err := p.hubDynClient.Resource(gvr).Get(ctx, "managedcluster:admin", metav1.GetOptions{})
+	switch {
+	case err == nil:
+		return clusterviewPresent, nil
+	case apierrors.IsNotFound(err):
+		if strings.Contains(err.Error(), "the server could not find the requested resource") {
+			return clusterviewAbsent, nil
+		}
+		// API exists but the SA has no admin bindings — expected.
+		return clusterviewPresent, nil
+	default:
+		// Fail closed: network/auth/other probe errors must not bypass authorization.
+		return clusterviewUnknown, fmt.Errorf("clusterview permission probe failed: %w", err)
+	}
 }
 
 // sanitizeProxyName rejects empty or non-DNS-1123 names so user-controlled path
@@ -748,7 +1137,7 @@ func (p *hcpProxy) newSpokeRequest(
 			req.Body = io.NopCloser(body)
 		}
 	}
-	return req.WithContext(ctx), nil
+	return req.WithContext(context.WithValue(ctx, spokeNameKey{}, spokeName)), nil
 }
 
 // cancelOnClose cancels a context when the response body is closed so
@@ -767,7 +1156,8 @@ func (c *cancelOnClose) Close() error {
 // doSpokeHTTP executes a pre-validated spoke request via RoundTripper.
 // gosec G704 flags http.Client.Do / Get / Post as SSRF sinks; RoundTrip is not
 // a sink, and the request URL host is always the fixed cluster-proxy base.
-func doSpokeHTTP(client *http.Client, req *http.Request) (*http.Response, error) {
+func doSpokeHTTP(client *http.Client, req *http.Request) (resp *http.Response, err error) {
+	defer func(start time.Time) { observeSpokeRequest(req, resp, start) }(time.Now())
 	rt := http.DefaultTransport
 	if client != nil && client.Transport != nil {
 		rt = client.Transport
@@ -775,7 +1165,7 @@ func doSpokeHTTP(client *http.Client, req *http.Request) (*http.Response, error)
 	if client != nil && client.Timeout > 0 {
 		ctx, cancel := context.WithTimeout(req.Context(), client.Timeout)
 		req = req.WithContext(ctx)
-		resp, err := rt.RoundTrip(req)
+		resp, err = rt.RoundTrip(req)
 		if err != nil {
 			cancel()
 			return nil, err
@@ -794,20 +1184,25 @@ func coreNamespaceAPIPath(ns string) (string, error) {
 	return apiPathCoreNamespaces + "/" + ns, nil
 }
 
+// spokeResourcePaths is the allowlist of namespaced resources the proxy reads
+// and writes on a spoke, with the path of their namespaces.
+var spokeResourcePaths = map[string]string{
+	resourceHostedClusters: apiPathHSNamespaces,
+	resourceNodePools:      apiPathHSNamespaces,
+	resourceSecrets:        apiPathCoreNamespaces,
+	resourceConfigMaps:     apiPathCoreNamespaces,
+}
+
 func hsCollectionAPIPath(ns, resource string) (string, error) {
 	ns, err := sanitizeProxyName(ns)
 	if err != nil {
 		return "", err
 	}
-	switch resource {
-	case resourceHostedClusters, resourceNodePools, resourceSecrets:
-	default:
+	base, ok := spokeResourcePaths[resource]
+	if !ok {
 		return "", fmt.Errorf("unknown resource type: %s", resource)
 	}
-	if resource == resourceSecrets {
-		return apiPathCoreNamespaces + "/" + ns + "/" + resourceSecrets, nil
-	}
-	return apiPathHSNamespaces + "/" + ns + "/" + resource, nil
+	return base + "/" + ns + "/" + resource, nil
 }
 
 func hsNamedAPIPath(ns, resource, name string) (string, error) {
@@ -864,7 +1259,17 @@ func (p *hcpProxy) buildHTTPClient(timeout time.Duration) (*http.Client, error)
 // spokeHTTPClient builds an http.Client that routes through cluster-proxy
 // with Impersonate-User/Group headers for the caller.
 func (p *hcpProxy) spokeHTTPClient(username string, groups []string) (*http.Client, error) {
-	c, err := p.buildHTTPClient(30 * time.Second)
+	return p.impersonatingHTTPClient(30*time.Second, username, groups)
+}
+
+// spokeWatchClient is spokeHTTPClient without the overall client timeout, for
+// long-lived watch streams. The stream lifetime is bounded by the request context.
+func (p *hcpProxy) spokeWatchClient(username string, groups []string) (*http.Client, error) {
+	return p.impersonatingHTTPClient(0, username, groups)
+}
+
+func (p *hcpProxy) impersonatingHTTPClient(timeout time.Duration, username string, groups []string) (*http.Client, error) {
+	c, err := p.buildHTTPClient(timeout)
 	if err != nil {
 		return nil, fmt.Errorf("%s%w", errMsgFailedSpokeClient, err)
 	}
@@ -873,6 +1278,11 @@ func (p *hcpProxy) spokeHTTPClient(username string, groups []string) (*http.Clie
 		username: username,
 		groups:   groups,
 	}
+	if p.limiter != nil {
+		// Without a timeout the client serves watches: their streams must not
+		// hold an in-flight slot.
+		c.Transport = &rateLimitedTransport{wrapped: c.Transport, limiter: p.limiter, stream: timeout == 0}
+	}
 	return c, nil
 }
 
@@ -904,14 +1314,68 @@ func (t *impersonatingTransport) RoundTrip(req *http.Request) (*http.Response, e
 //
 // The response is the full ResourceBundle so the caller gets every created object
 // in one shot without a follow-up GET /resources round-trip.
+//
+// With ?dryRun=All every step is sent with dryRun=All and attempted even when an
+// earlier one is rejected, so a single preflight call reports every admission
+// error. Nothing is persisted; the would-be bundle is returned with 200, or 422
+// when bundle.errors is non-empty.
+//
+// With ?atomic=true the create is all-or-nothing: a failed NodePool is an error
+// rather than a warning, and when any step fails everything this request
+// created is deleted again (see rollbackCreate).
 func (p *hcpProxy) handleCreate(w http.ResponseWriter, r *http.Request, ns, spokeName string) {
+	op := createOperation{startTime: metav1.Now()}
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	atomic, err := isAtomicCreate(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var req CreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSONError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Parameters != nil && !p.renderCreateRequest(w, r, ns, spokeName, &req) {
+		return
+	}
 	if req.HostedCluster == nil {
-		writeJSONError(w, "hostedCluster is required", http.StatusBadRequest)
+		writeJSONError(w, "hostedCluster or parameters is required", http.StatusBadRequest)
+		return
+	}
+	auditRecordFor(r).Name = req.HostedCluster.Name
+
+	entries, err := p.createDefaultsFor(r.Context(), spokeName, ns)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defaultsWarnings, trustBundle, err := applyDefaults(entries, &req)
+	if err != nil {
+		writeJSONError(w, "failed to apply defaults: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if unreferenced := unreferencedInCreate(&req); len(unreferenced) > 0 {
+		writeJSONError(w, "not referenced by the HostedCluster or its NodePools: "+strings.Join(unreferenced, ", "),
+			http.StatusBadRequest)
+		return
+	}
+
+	if !p.enforcePolicy(r.Context(), w, spokeName, "HostedCluster", req.HostedCluster.Name,
+		func(rules []policyRule) field.ErrorList {
+			errs := checkHostedCluster(rules, objectMap(req.HostedCluster), field.NewPath("hostedCluster"))
+			for i, np := range req.NodePools {
+				if np != nil {
+					errs = append(errs, checkNodePool(rules, objectMap(np), field.NewPath("nodePools").Index(i))...)
+				}
+			}
+			return errs
+		}) {
 		return
 	}
 
@@ -921,6 +1385,8 @@ func (p *hcpProxy) handleCreate(w http.ResponseWriter, r *http.Request, ns, spok
 		"spoke", spokeName,
 		"secrets", len(req.Secrets),
 		"nodePools", len(req.NodePools),
+		"dryRun", dryRun,
+		"atomic", atomic,
 	)
 
 	username, groups := whoIsTheCaller(r)
@@ -930,6 +1396,9 @@ func (p *hcpProxy) handleCreate(w http.ResponseWriter, r *http.Request, ns, spok
 		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if dryRun {
+		hcpClient = withDryRun(hcpClient)
+	}
 
 	ctx := r.Context()
 
@@ -945,70 +1414,195 @@ func (p *hcpProxy) handleCreate(w http.ResponseWriter, r *http.Request, ns, spok
 		return labels
 	}
 
+	// Stamp namespace, type and labels up front so a dry run that stops early
+	// still returns the objects as they would have been sent.
+	for i := range req.Secrets {
+		req.Secrets[i].Namespace = ns
+		req.Secrets[i].Labels = addProxyLabels(req.Secrets[i].Labels)
+	}
+	for i := range req.ConfigMaps {
+		req.ConfigMaps[i].Namespace = ns
+		req.ConfigMaps[i].Labels = addProxyLabels(req.ConfigMaps[i].Labels)
+	}
+	if trustBundle != nil {
+		trustBundle.Namespace = ns
+		trustBundle.Labels = addProxyLabels(trustBundle.Labels)
+	}
+	// spec.pullSecret.name / spec.sshKey.name are already set by the caller
+	// (same as --render output) — the proxy does NOT construct those names.
+	req.HostedCluster.Namespace = ns
+	req.HostedCluster.APIVersion = hypershiftv1beta1.GroupVersion.String()
+	req.HostedCluster.Kind = "HostedCluster"
+	req.HostedCluster.Labels = addProxyLabels(req.HostedCluster.Labels)
+	for _, np := range req.NodePools {
+		if np == nil {
+			continue
+		}
+		np.Namespace = ns
+		np.APIVersion = hypershiftv1beta1.GroupVersion.String()
+		np.Kind = "NodePool"
+		if np.Spec.ClusterName == "" {
+			np.Spec.ClusterName = hcName
+		}
+		np.Labels = addProxyLabels(np.Labels)
+	}
+
+	warnings := defaultsWarnings
+	var dryRunErrors []string
+	var created []createdResource
+	// track records an object this request created, for atomic rollback.
+	track := func(kind, resource string, obj metav1.Object) {
+		created = append(created, createdResource{kind: kind, resource: resource, name: obj.GetName(), uid: obj.GetUID()})
+	}
+	// stepFailed records a failed required step. A dry run keeps going so every
+	// rejection is reported at once; a real create stops with a 500, after
+	// rolling back in atomic mode.
+	stepFailed := func(msg string, err error) bool {
+		if dryRun {
+			dryRunErrors = append(dryRunErrors, msg+": "+err.Error())
+			return false
+		}
+		if atomic {
+			p.rollbackCreate(ctx, w, hcpClient, spokeName, ns, hcName, created, msg+": "+err.Error())
+			return true
+		}
+		writeJSONError(w, msg+": "+err.Error(), http.StatusInternalServerError)
+		return true
+	}
+
 	// 0. Ensure Namespace (idempotent — 409 means it already exists)
 	nsObj := buildNamespace(ns, hcName)
-	if err := p.createOnSpoke(ctx, hcpClient, spokeName, ns, "namespaces", nsObj); err != nil && !isAlreadyExists(err) {
-		p.log.Error(err, "failed to ensure namespace", "namespace", ns, "spoke", spokeName)
-		writeJSONError(w, "failed to ensure namespace: "+err.Error(), http.StatusInternalServerError)
+	var existingNamespace *corev1.Namespace
+	if dryRun {
+		if existingNamespace, err = p.fetchNamespace(ctx, hcpClient, ns, spokeName); err != nil {
+			writeStatus(w, spokeWriteStatus(err, "failed to read namespace"))
+			return
+		}
+	}
+	if dryRun && existingNamespace == nil {
+		// A dry-run Namespace is not persisted, so every namespaced dry run
+		// below would fail with NotFound. Validate the Namespace alone.
+		if err := p.createOnSpoke(ctx, hcpClient, spokeName, ns, "namespaces", nsObj); err != nil {
+			stepFailed("failed to ensure namespace", err)
+		}
+		warnings = append(warnings, fmt.Sprintf(
+			"namespace %q does not exist yet; Secrets, HostedCluster and NodePools were not validated", ns))
+		writeDryRunResult(w, &ResourceBundle{
+			HostingCluster: spokeName,
+			Namespace:      nsObj,
+			HostedCluster:  req.HostedCluster,
+			Warnings:       warnings,
+		}, dryRunErrors)
 		return
 	}
+	switch err := p.createOnSpoke(ctx, hcpClient, spokeName, ns, "namespaces", nsObj); {
+	case err == nil:
+		track("Namespace", "namespaces", nsObj)
+	case !isAlreadyExists(err):
+		p.log.Error(err, "failed to ensure namespace", "namespace", ns, "spoke", spokeName)
+		if stepFailed("failed to ensure namespace", err) {
+			return
+		}
+	}
 
 	// 1. Create or update Secrets (pull-secret, ssh-key, STS credentials, …).
 	// A 409 means the secret exists from a previous run — update it in place so
 	// retries are idempotent and credentials are always fresh.
 	for i := range req.Secrets {
-		req.Secrets[i].Namespace = ns
-		req.Secrets[i].Labels = addProxyLabels(req.Secrets[i].Labels)
-		if err := p.createOrUpdateSecretOnSpoke(ctx, hcpClient, spokeName, ns, &req.Secrets[i]); err != nil {
+		secretCreated, err := p.createOrUpdateOnSpoke(ctx, hcpClient, spokeName, ns, resourceSecrets, &req.Secrets[i])
+		if err != nil {
 			p.log.Error(err, "failed to create/update secret", "spoke", spokeName)
-			writeJSONError(w, "failed to create secret: "+err.Error(), http.StatusInternalServerError)
-			return
+			if stepFailed("failed to create secret", err) {
+				return
+			}
+			continue
+		}
+		if secretCreated {
+			track("Secret", resourceSecrets, &req.Secrets[i])
 		}
 	}
 
-	// 2. Create HostedCluster
-	//    spec.pullSecret.name / spec.sshKey.name are already set by the caller
-	//    (same as --render output) — the proxy does NOT construct those names.
-	req.HostedCluster.Namespace = ns
-	req.HostedCluster.APIVersion = hypershiftv1beta1.GroupVersion.String()
-	req.HostedCluster.Kind = "HostedCluster"
-	req.HostedCluster.Labels = addProxyLabels(req.HostedCluster.Labels)
+	// 2. Create or update the ConfigMaps, like the Secrets, then the ConfigMap
+	// of a defaulted additional trust bundle, so one left by an earlier attempt
+	// carries the current bundle.
+	for i := range req.ConfigMaps {
+		cmCreated, err := p.createOrUpdateOnSpoke(ctx, hcpClient, spokeName, ns, resourceConfigMaps, &req.ConfigMaps[i])
+		if err != nil {
+			p.log.Error(err, "failed to create/update ConfigMap", "spoke", spokeName)
+			if stepFailed("failed to create ConfigMap", err) {
+				return
+			}
+			continue
+		}
+		if cmCreated {
+			track("ConfigMap", resourceConfigMaps, &req.ConfigMaps[i])
+		}
+	}
+	if trustBundle != nil {
+		cmCreated, err := p.createOrUpdateOnSpoke(ctx, hcpClient, spokeName, ns, resourceConfigMaps, trustBundle)
+		switch {
+		case err != nil:
+			p.log.Error(err, "failed to create additional trust bundle", "spoke", spokeName)
+			if stepFailed("failed to create additional trust bundle", err) {
+				return
+			}
+		case cmCreated:
+			track("ConfigMap", resourceConfigMaps, trustBundle)
+		}
+	}
+	op.secretsApplied = metav1.Now()
+
+	// 3. Create HostedCluster
 	if err := p.createOnSpoke(ctx, hcpClient, spokeName, ns, resourceHostedClusters, req.HostedCluster); err != nil {
 		p.log.Error(err, "failed to create HostedCluster", "name", hcName, "spoke", spokeName)
-		writeJSONError(w, "failed to create HostedCluster: "+err.Error(), http.StatusInternalServerError)
-		return
+		if stepFailed("failed to create HostedCluster", err) {
+			return
+		}
+	} else {
+		track("HostedCluster", resourceHostedClusters, req.HostedCluster)
+		if !dryRun {
+			p.creates.record(req.HostedCluster.UID, op)
+		}
 	}
 
-	// 3. Create NodePool(s)
+	// 4. Create NodePool(s)
 	var createdNodePools []hypershiftv1beta1.NodePool
-	var warnings []string
-	for i := range req.NodePools {
-		np := req.NodePools[i]
+	for _, np := range req.NodePools {
 		if np == nil {
 			continue
 		}
-		np.Namespace = ns
-		np.APIVersion = hypershiftv1beta1.GroupVersion.String()
-		np.Kind = "NodePool"
-		if np.Spec.ClusterName == "" {
-			np.Spec.ClusterName = hcName
-		}
-		np.Labels = addProxyLabels(np.Labels)
 		if err := p.createOnSpoke(ctx, hcpClient, spokeName, ns, resourceNodePools, np); err != nil {
 			p.log.Error(err, "failed to create NodePool", "name", np.Name)
-			warnings = append(warnings, fmt.Sprintf("NodePool %q creation failed: %s", np.Name, err.Error()))
+			if dryRun || atomic {
+				if stepFailed(fmt.Sprintf("NodePool %q creation failed", np.Name), err) {
+					return
+				}
+			} else {
+				warnings = append(warnings, fmt.Sprintf("NodePool %q creation failed: %s", np.Name, err.Error()))
+			}
 			continue
 		}
+		track("NodePool", resourceNodePools, np)
 		createdNodePools = append(createdNodePools, *np)
 	}
 
 	bundle := &ResourceBundle{
-		Namespace:     nsObj,
-		HostedCluster: req.HostedCluster,
-		NodePools:     createdNodePools,
-		Warnings:      warnings,
+		HostingCluster: spokeName,
+		Namespace:      nsObj,
+		HostedCluster:  req.HostedCluster,
+		NodePools:      createdNodePools,
+		Warnings:       warnings,
+		References:     objectReferences(req.HostedCluster, createdNodePools),
+	}
+
+	if dryRun {
+		p.log.Info("HostedCluster dry-run create finished",
+			"name", hcName, "namespace", ns, "spoke", spokeName, "errors", len(dryRunErrors))
+		writeDryRunResult(w, bundle, dryRunErrors)
+		return
 	}
 
+	bundle.OperationID = string(req.HostedCluster.UID)
 	p.log.Info("HostedCluster created successfully",
 		"name", req.HostedCluster.Name,
 		"namespace", ns,
@@ -1022,7 +1616,17 @@ func (p *hcpProxy) handleCreate(w http.ResponseWriter, r *http.Request, ns, spok
 }
 
 // handleDelete deletes the HostedCluster and all associated NodePools from the spoke.
+// propagationPolicy is passed on to each DELETE. With ?wait=true the proxy
+// answers 202 and, in the background, waits for the HostedCluster finalizers
+// to complete, then removes what it created for the HostedCluster (see
+// trackDeletion and cleanUpAfterDelete).
 func (p *hcpProxy) handleDelete(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	opts, err := parseHostedClusterDelete(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	username, groups := whoIsTheCaller(r)
 	hcpClient, err := p.spokeHTTPClient(username, groups)
 	if err != nil {
@@ -1031,7 +1635,7 @@ func (p *hcpProxy) handleDelete(w http.ResponseWriter, r *http.Request, ns, name
 	}
 
 	ctx := r.Context()
-	p.deleteMatchingNodePools(ctx, hcpClient, ns, name, spokeName)
+	p.deleteMatchingNodePools(ctx, hcpClient, ns, name, spokeName, opts.query)
 
 	// Delete HostedCluster
 	delPath, err := hsNamedAPIPath(ns, resourceHostedClusters, name)
@@ -1044,12 +1648,19 @@ func (p *hcpProxy) handleDelete(w http.ResponseWriter, r *http.Request, ns, name
 		writeJSONError(w, "failed to build delete request: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	delReq.URL.RawQuery = opts.query.Encode()
 	resp, err := doSpokeHTTP(hcpClient, delReq)
 	if err != nil {
 		writeJSONError(w, "spoke request failed: "+err.Error(), http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
+	// A HostedCluster that is already gone still gets its leftovers cleaned up.
+	if opts.wait && (resp.StatusCode < 300 || resp.StatusCode == http.StatusNotFound) {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		p.trackDeletion(w, r, hcpClient, ns, name, spokeName, opts)
+		return
+	}
 	if ct := resp.Header.Get(headerContentType); ct != "" {
 		w.Header().Set(headerContentType, ct)
 	}
@@ -1062,9 +1673,10 @@ func (p *hcpProxy) deleteMatchingNodePools(
 	ctx context.Context,
 	hcpClient *http.Client,
 	ns, hcName, spokeName string,
+	query url.Values,
 ) {
 	for _, np := range p.fetchNodePoolsForHC(ctx, hcpClient, ns, hcName, spokeName) {
-		p.deleteNodePool(ctx, hcpClient, ns, spokeName, np.Name)
+		p.deleteNodePool(ctx, hcpClient, ns, spokeName, np.Name, query)
 	}
 }
 
@@ -1072,6 +1684,7 @@ func (p *hcpProxy) deleteNodePool(
 	ctx context.Context,
 	hcpClient *http.Client,
 	ns, spokeName, npName string,
+	query url.Values,
 ) {
 	delNPPath, err := hsNamedAPIPath(ns, resourceNodePools, npName)
 	if err != nil {
@@ -1083,6 +1696,7 @@ func (p *hcpProxy) deleteNodePool(
 		p.log.Error(err, "failed to build NodePool delete request", "name", npName)
 		return
 	}
+	delNPReq.URL.RawQuery = query.Encode()
 	delNPResp, err := doSpokeHTTP(hcpClient, delNPReq)
 	if err != nil {
 		p.log.Error(err, "failed to delete NodePool", "name", npName)
@@ -1103,12 +1717,40 @@ func (p *hcpProxy) deleteNodePool(
 // The proxy sends a PUT for the HostedCluster and a PUT for each NodePool present
 // in the bundle (identified by metadata.name). Resources absent from the bundle are
 // left untouched. Content-Type must be application/json.
+//
+// With ?dryRun=All each PUT is sent with dryRun=All and the submitted bundle, as
+// the spoke would have stored it, is returned instead of a live re-fetch; 422
+// if any object was rejected (see bundle.errors).
+//
+// Objects carrying metadata.resourceVersion, and an If-Match header with the
+// ETag of a GET, are checked against the live objects before anything is
+// written: a stale bundle gets 409 Conflict (412 for If-Match) with a
+// metav1.Status, and nothing is changed. With If-Match, objects without a
+// resourceVersion are PUT with the live one.
 func (p *hcpProxy) handlePatchResources(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var bundle ResourceBundle
 	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
 		writeJSONError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !p.enforcePolicy(r.Context(), w, spokeName, "HostedCluster", name, func(rules []policyRule) field.ErrorList {
+		var errs field.ErrorList
+		if bundle.HostedCluster != nil {
+			errs = checkHostedCluster(rules, objectMap(bundle.HostedCluster), field.NewPath("hostedCluster"))
+		}
+		for i := range bundle.NodePools {
+			errs = append(errs, checkNodePool(rules, objectMap(&bundle.NodePools[i]), field.NewPath("nodePools").Index(i))...)
+		}
+		return errs
+	}) {
+		return
+	}
 
 	username, groups := whoIsTheCaller(r)
 	hcpClient, err := p.spokeHTTPClient(username, groups)
@@ -1118,6 +1760,28 @@ func (p *hcpProxy) handlePatchResources(w http.ResponseWriter, r *http.Request,
 	}
 
 	ctx := r.Context()
+	if status := p.checkBundlePreconditions(ctx, hcpClient, r, &bundle, ns, name, spokeName); status != nil {
+		writeStatus(w, status)
+		return
+	}
+	if len(bundle.Secrets) > 0 || len(bundle.ConfigMaps) > 0 {
+		if unreferenced := p.unreferencedInBundle(ctx, hcpClient, &bundle, ns, name, spokeName); len(unreferenced) > 0 {
+			writeJSONError(w, "not referenced by the HostedCluster or its NodePools: "+strings.Join(unreferenced, ", "),
+				http.StatusBadRequest)
+			return
+		}
+	}
+	if dryRun {
+		hcpClient = withDryRun(hcpClient)
+	}
+
+	// Secrets and ConfigMaps first, so the objects that use them never see
+	// them missing.
+	status, dryRunErrors := p.applyReferencedObjects(ctx, hcpClient, &bundle, ns, name, spokeName, dryRun)
+	if status != nil {
+		writeStatus(w, status)
+		return
+	}
 
 	// PUT HostedCluster (full replace — same as kubectl edit saves)
 	if bundle.HostedCluster != nil {
@@ -1128,8 +1792,11 @@ func (p *hcpProxy) handlePatchResources(w http.ResponseWriter, r *http.Request,
 			return
 		}
 		if err := p.putOnSpoke(ctx, hcpClient, spokeName, hcPath, bundle.HostedCluster); err != nil {
-			writeJSONError(w, "HostedCluster update failed: "+err.Error(), http.StatusBadGateway)
-			return
+			if !dryRun {
+				writeStatus(w, spokeWriteStatus(err, "HostedCluster update failed"))
+				return
+			}
+			dryRunErrors = append(dryRunErrors, "HostedCluster update failed: "+err.Error())
 		}
 	}
 
@@ -1146,11 +1813,20 @@ func (p *hcpProxy) handlePatchResources(w http.ResponseWriter, r *http.Request,
 			return
 		}
 		if err := p.putOnSpoke(ctx, hcpClient, spokeName, npPath, np); err != nil {
-			writeJSONError(w, fmt.Sprintf("NodePool %q update failed: %s", np.Name, err.Error()), http.StatusBadGateway)
-			return
+			if !dryRun {
+				writeStatus(w, spokeWriteStatus(err, fmt.Sprintf("NodePool %q update failed", np.Name)))
+				return
+			}
+			dryRunErrors = append(dryRunErrors, fmt.Sprintf("NodePool %q update failed: %s", np.Name, err.Error()))
 		}
 	}
 
+	if dryRun {
+		bundle.Secrets = nil
+		writeDryRunResult(w, &bundle, dryRunErrors)
+		return
+	}
+
 	// Re-fetch the full bundle so the response reflects the live server state.
 	p.handleGetResources(w, r, ns, name, spokeName)
 }
@@ -1176,13 +1852,24 @@ func (p *hcpProxy) putOnSpoke(
 		return fmt.Errorf("PUT %s: %w", apiPath, err)
 	}
 	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("spoke returned %d: %s", resp.StatusCode, string(respBody))
+		return newSpokeStatusError(resp.StatusCode, respBody)
 	}
+	decodeSpokeObject(respBody, obj)
 	return nil
 }
 
+// decodeSpokeObject overlays the object the spoke returned from a successful
+// write onto obj, so callers see server-populated fields (uid, resourceVersion,
+// admission defaults). Empty or undecodable bodies leave obj unchanged.
+func decodeSpokeObject(body []byte, obj interface{}) {
+	if len(body) == 0 {
+		return
+	}
+	_ = json.Unmarshal(body, obj)
+}
+
 // handleGetResources returns all K8s resources that make up a HostedCluster:
 //   - Namespace (best-effort — omitted if unreachable)
 //   - HostedCluster (pull-secret is a reference only; no Secret data is exposed)
@@ -1198,8 +1885,11 @@ func (p *hcpProxy) handleGetResources(w http.ResponseWriter, r *http.Request, ns
 	}
 
 	ctx := r.Context()
-	bundle := &ResourceBundle{
-		Namespace: p.fetchNamespaceBestEffort(ctx, hcpClient, ns, spokeName),
+	bundle := &ResourceBundle{}
+	// The Namespace is informational: a caller who may not read it still
+	// gets the bundle, with a warning.
+	if bundle.Namespace, err = p.fetchNamespace(ctx, hcpClient, ns, spokeName); err != nil {
+		bundle.Warnings = append(bundle.Warnings, "failed to read namespace: "+err.Error())
 	}
 
 	hc, status, errMsg := p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
@@ -1209,37 +1899,46 @@ func (p *hcpProxy) handleGetResources(w http.ResponseWriter, r *http.Request, ns
 	}
 	bundle.HostedCluster = hc
 	bundle.NodePools = p.fetchNodePoolsForHC(ctx, hcpClient, ns, name, spokeName)
+	bundle.References = objectReferences(hc, bundle.NodePools)
+	w.Header().Set(headerETag, bundleETag(hc, bundle.NodePools))
+
+	if wantsTable(r) {
+		row, err := unstructuredFromObject(hc, spokeName)
+		if err != nil {
+			writeJSONError(w, "failed to convert HostedCluster: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		npCounts := nodePoolCounts{nodePoolCountKey(spokeName, ns, name): int64(len(bundle.NodePools))}
+		writeTable(w, r, resourceHostedClusters, []unstructured.Unstructured{row}, metav1.ListMeta{}, npCounts)
+		return
+	}
 
 	w.Header().Set(headerContentType, contentTypeJSON)
 	_ = json.NewEncoder(w).Encode(bundle)
 }
 
-func (p *hcpProxy) fetchNamespaceBestEffort(
+// fetchNamespace reads the Namespace ns on the spoke as the caller. A missing
+// Namespace is nil without error; any other failure, such as a caller who may
+// not read Namespaces, is returned.
+func (p *hcpProxy) fetchNamespace(
 	ctx context.Context,
 	hcpClient *http.Client,
 	ns, spokeName string,
-) *corev1.Namespace {
+) (*corev1.Namespace, error) {
 	nsPath, err := coreNamespaceAPIPath(ns)
 	if err != nil {
-		return nil
-	}
-	nsReq, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, nsPath, nil)
-	if err != nil {
-		return nil
-	}
-	nsResp, err := doSpokeHTTP(hcpClient, nsReq)
-	if err != nil {
-		return nil
-	}
-	defer nsResp.Body.Close()
-	if nsResp.StatusCode != http.StatusOK {
-		return nil
+		return nil, err
 	}
-	var namespace corev1.Namespace
-	if json.NewDecoder(nsResp.Body).Decode(&namespace) != nil {
-		return nil
+	namespace := &corev1.Namespace{}
+	err = p.getFromSpoke(ctx, hcpClient, spokeName, nsPath, nil, namespace)
+	var spokeErr *spokeStatusError
+	switch {
+	case errors.As(err, &spokeErr) && spokeErr.code == http.StatusNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, err
 	}
-	return &namespace
+	return namespace, nil
 }
 
 func (p *hcpProxy) fetchHostedCluster(
@@ -1339,27 +2038,29 @@ func isAlreadyExists(err error) bool {
 	return errors.Is(err, errSpokeConflict)
 }
 
-// createOrUpdateSecretOnSpoke POSTs a Secret; if the spoke returns 409 (already
-// exists) it falls back to a PUT so retries are idempotent and credentials stay fresh.
-func (p *hcpProxy) createOrUpdateSecretOnSpoke(
+// createOrUpdateOnSpoke POSTs a Secret or ConfigMap; if the spoke returns 409
+// (already exists) it falls back to a PUT so retries are idempotent and
+// credentials stay fresh. created reports whether the object was new, i.e. is
+// safe to roll back.
+func (p *hcpProxy) createOrUpdateOnSpoke(
 	ctx context.Context,
 	httpClient *http.Client,
-	spokeName, ns string,
-	secret *corev1.Secret,
-) error {
-	err := p.createOnSpoke(ctx, httpClient, spokeName, ns, resourceSecrets, secret)
+	spokeName, ns, resource string,
+	obj metav1.Object,
+) (created bool, err error) {
+	err = p.createOnSpoke(ctx, httpClient, spokeName, ns, resource, obj)
 	if err == nil {
-		return nil
+		return true, nil
 	}
 	if !isAlreadyExists(err) {
-		return err
+		return false, err
 	}
-	// Secret already exists — PUT to update it (keeps data fresh on retries).
-	apiPath, pathErr := hsNamedAPIPath(ns, resourceSecrets, secret.Name)
+	// The object already exists — PUT to update it (keeps data fresh on retries).
+	apiPath, pathErr := hsNamedAPIPath(ns, resource, obj.GetName())
 	if pathErr != nil {
-		return pathErr
+		return false, pathErr
 	}
-	return p.putOnSpoke(ctx, httpClient, spokeName, apiPath, secret)
+	return false, p.putOnSpoke(ctx, httpClient, spokeName, apiPath, obj)
 }
 
 // createOnSpoke POSTs an object to the spoke kube-apiserver via cluster-proxy.
@@ -1371,16 +2072,10 @@ func (p *hcpProxy) createOnSpoke(
 ) error {
 	var apiPath string
 	var err error
-	switch resource {
-	case "namespaces":
+	if resource == "namespaces" {
 		apiPath = apiPathCoreNamespaces // cluster-scoped — no ns prefix
-	case resourceSecrets, resourceHostedClusters, resourceNodePools:
-		apiPath, err = hsCollectionAPIPath(ns, resource)
-		if err != nil {
-			return err
-		}
-	default:
-		return fmt.Errorf("unknown resource type: %s", resource)
+	} else if apiPath, err = hsCollectionAPIPath(ns, resource); err != nil {
+		return err
 	}
 
 	body, err := json.Marshal(obj)
@@ -1399,12 +2094,13 @@ func (p *hcpProxy) createOnSpoke(
 		return fmt.Errorf("POST %s: %w", resource, err)
 	}
 	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(resp.Body)
 		if resp.StatusCode == http.StatusConflict {
 			return fmt.Errorf("%w: spoke returned 409 for %s: %s", errSpokeConflict, resource, string(respBody))
 		}
 		return fmt.Errorf("spoke returned %d for %s: %s", resp.StatusCode, resource, string(respBody))
 	}
+	decodeSpokeObject(respBody, obj)
 	return nil
 }
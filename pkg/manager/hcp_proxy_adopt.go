@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const subresourceAdopt = "adopt"
+
+// AdoptionResult is the response of POST .../hostedclusters/{name}/adopt.
+// Objects are listed as Kind/name.
+type AdoptionResult struct {
+	// DryRun is set when nothing was changed; the lists say what would be.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Adopted lists the objects that were given the proxy labels.
+	Adopted []string `json:"adopted"`
+	// Unchanged lists the objects that already carried them.
+	Unchanged []string `json:"unchanged,omitempty"`
+	// Skipped lists the objects left alone, with the reason.
+	Skipped []string `json:"skipped,omitempty"`
+	// Errors lists the objects the hosting cluster refused to label.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// adoptee is one object an adoption labels.
+type adoptee struct {
+	kind, resource, name string
+	labels               map[string]string
+}
+
+func (a adoptee) String() string {
+	return a.kind + "/" + a.name
+}
+
+// handleAdopt stamps the created-via and hostedcluster labels onto a
+// HostedCluster created directly on the hosting cluster, its NodePools and the
+// Secrets and ConfigMaps it references, so the proxy manages it like one it
+// created. The Namespace is not labelled: it stays when the HostedCluster is
+// deleted. With ?dryRun=All each label patch is sent as a dry run and the
+// result lists what would be adopted.
+//
+// A referenced object is skipped when it is labelled for another HostedCluster
+// or another HostedCluster in the namespace references it too, so deleting one
+// cluster never cleans up what the other uses.
+func (p *hcpProxy) handleAdopt(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	hc, code, msg := p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
+	if hc == nil {
+		writeJSONError(w, msg, code)
+		return
+	}
+	nodePools := p.fetchNodePoolsForHC(ctx, hcpClient, ns, name, spokeName)
+	shared, err := p.referencesOfOtherClusters(ctx, hcpClient, ns, name, spokeName)
+	if err != nil {
+		writeJSONError(w, "failed to read the other HostedClusters in the namespace: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	result := AdoptionResult{DryRun: dryRun, Adopted: []string{}}
+	patchClient := hcpClient
+	if dryRun {
+		patchClient = withDryRun(hcpClient)
+	}
+	p.adopt(ctx, patchClient, spokeName, ns, name, &result,
+		adoptee{kind: "HostedCluster", resource: resourceHostedClusters, name: hc.Name, labels: hc.Labels})
+	for i := range nodePools {
+		p.adopt(ctx, patchClient, spokeName, ns, name, &result, adoptee{
+			kind: "NodePool", resource: resourceNodePools, name: nodePools[i].Name, labels: nodePools[i].Labels,
+		})
+	}
+	for _, ref := range objectReferences(hc, nodePools) {
+		obj := adoptee{kind: ref.Kind, resource: resourceSecrets, name: ref.Name}
+		if ref.Kind == kindConfigMap {
+			obj.resource = resourceConfigMaps
+		}
+		if other, ok := shared[ref]; ok {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: also referenced by HostedCluster/%s", obj, other))
+			continue
+		}
+		labels, err := p.spokeObjectLabels(ctx, hcpClient, spokeName, ns, obj.resource, obj.name)
+		var statusErr *spokeStatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound:
+			result.Skipped = append(result.Skipped, obj.String()+": not found")
+			continue
+		case err != nil:
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", obj, err))
+			continue
+		}
+		if owner := labels[labelHostedCluster]; owner != "" && owner != name {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: labelled for HostedCluster/%s", obj, owner))
+			continue
+		}
+		obj.labels = labels
+		p.adopt(ctx, patchClient, spokeName, ns, name, &result, obj)
+	}
+
+	p.log.Info("adopted HostedCluster",
+		"name", name, "namespace", ns, "spoke", spokeName, "dryRun", dryRun,
+		"adopted", len(result.Adopted), "skipped", len(result.Skipped), "errors", len(result.Errors))
+	code = http.StatusOK
+	if len(result.Errors) > 0 {
+		code = http.StatusInternalServerError
+		if dryRun {
+			code = http.StatusUnprocessableEntity
+		}
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// adopt merge-patches the proxy labels onto obj unless it already has them.
+func (p *hcpProxy) adopt(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, ns, hcName string,
+	result *AdoptionResult,
+	obj adoptee,
+) {
+	if obj.labels[labelCreatedVia] == labelCreatedViaValue && obj.labels[labelHostedCluster] == hcName {
+		result.Unchanged = append(result.Unchanged, obj.String())
+		return
+	}
+	apiPath, err := hsNamedAPIPath(ns, obj.resource, obj.name)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", obj, err))
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{labelCreatedVia: labelCreatedViaValue, labelHostedCluster: hcName},
+		},
+	})
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", obj, err))
+		return
+	}
+	if err := p.mergePatchOnSpoke(ctx, hcpClient, spokeName, apiPath, patch); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", obj, err))
+		return
+	}
+	result.Adopted = append(result.Adopted, obj.String())
+}
+
+// spokeObjectLabels reads the labels of a Secret or ConfigMap on the spoke.
+func (p *hcpProxy) spokeObjectLabels(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, ns, resource, name string,
+) (map[string]string, error) {
+	apiPath, err := hsNamedAPIPath(ns, resource, name)
+	if err != nil {
+		return nil, err
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	if err := p.getFromSpoke(ctx, hcpClient, spokeName, apiPath, nil, obj); err != nil {
+		return nil, err
+	}
+	return obj.Labels, nil
+}
+
+// referencesOfOtherClusters maps each Secret and ConfigMap referenced by
+// another HostedCluster in ns, or by its NodePools, to the name of that
+// HostedCluster.
+func (p *hcpProxy) referencesOfOtherClusters(
+	ctx context.Context,
+	hcpClient *http.Client,
+	ns, name, spokeName string,
+) (map[corev1.TypedLocalObjectReference]string, error) {
+	hcPath, err := hsCollectionAPIPath(ns, resourceHostedClusters)
+	if err != nil {
+		return nil, err
+	}
+	hostedClusters := &hypershiftv1beta1.HostedClusterList{}
+	if err := p.getFromSpoke(ctx, hcpClient, spokeName, hcPath, nil, hostedClusters); err != nil {
+		return nil, err
+	}
+	npPath, err := hsCollectionAPIPath(ns, resourceNodePools)
+	if err != nil {
+		return nil, err
+	}
+	nodePools := &hypershiftv1beta1.NodePoolList{}
+	if err := p.getFromSpoke(ctx, hcpClient, spokeName, npPath, nil, nodePools); err != nil {
+		return nil, err
+	}
+	byCluster := map[string][]hypershiftv1beta1.NodePool{}
+	for _, np := range nodePools.Items {
+		byCluster[np.Spec.ClusterName] = append(byCluster[np.Spec.ClusterName], np)
+	}
+
+	shared := map[corev1.TypedLocalObjectReference]string{}
+	for i := range hostedClusters.Items {
+		other := &hostedClusters.Items[i]
+		if other.Name == name {
+			continue
+		}
+		for _, ref := range objectReferences(other, byCluster[other.Name]) {
+			if _, ok := shared[ref]; !ok {
+				shared[ref] = other.Name
+			}
+		}
+	}
+	return shared, nil
+}
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func adoptRequest(method, name, query string) *http.Request {
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/" + name + "/adopt?hostingCluster=spoke-1" + query
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+// seedBrownfield puts the migration source on spoke-1 without proxy labels,
+// referencing a missing ConfigMap and an SSH key Secret shared with other-hc.
+func seedBrownfield(s *migrationSpoke) {
+	seedMigrationSource(s)
+	s.objects[migrateHCPath]["spec"] = map[string]interface{}{
+		"pullSecret":            map[string]interface{}{"name": "my-hc-pull-secret"},
+		"sshKey":                map[string]interface{}{"name": "shared-ssh"},
+		"additionalTrustBundle": map[string]interface{}{"name": "missing-ca"},
+	}
+	s.put("/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters/other-hc", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "other-hc", "namespace": "clusters"},
+		"spec":     map[string]interface{}{"sshKey": map[string]interface{}{"name": "shared-ssh"}},
+	})
+	s.put("/spoke-1"+apiPathCoreNamespaces+"/clusters/secrets/shared-ssh", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "shared-ssh", "namespace": "clusters"},
+	})
+}
+
+func objectLabels(s *migrationSpoke, path string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels, _ := s.objects[path]["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	return labels
+}
+
+func decodeAdoption(t *testing.T, w *httptest.ResponseRecorder) AdoptionResult {
+	t.Helper()
+	var result AdoptionResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return result
+}
+
+func Test_handleAdopt_WhenClusterCreatedOnHostingCluster_ItShouldLabelWhatItUses(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	seedBrownfield(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, adoptRequest(http.MethodPost, "my-hc", ""))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	result := decodeAdoption(t, w)
+	assert.Equal(t, []string{"HostedCluster/my-hc", "NodePool/my-hc-pool", "Secret/my-hc-pull-secret"}, result.Adopted)
+	assert.Equal(t, []string{
+		"Secret/shared-ssh: also referenced by HostedCluster/other-hc",
+		"ConfigMap/missing-ca: not found",
+	}, result.Skipped)
+	assert.Empty(t, result.Errors)
+	for _, path := range []string{migrateHCPath, migrateNPPath, migrateSecretPath} {
+		assert.Equal(t, labelCreatedViaValue, objectLabels(spoke, path)[labelCreatedVia], path)
+		assert.Equal(t, "my-hc", objectLabels(spoke, path)[labelHostedCluster], path)
+	}
+	assert.Empty(t, objectLabels(spoke, "/spoke-1"+apiPathCoreNamespaces+"/clusters/secrets/shared-ssh"))
+
+	w = httptest.NewRecorder()
+	p.handleRoute(w, adoptRequest(http.MethodPost, "my-hc", ""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	result = decodeAdoption(t, w)
+	assert.Empty(t, result.Adopted, "adopting again changes nothing")
+	assert.Equal(t, []string{"HostedCluster/my-hc", "NodePool/my-hc-pool", "Secret/my-hc-pull-secret"}, result.Unchanged)
+}
+
+func Test_handleAdopt_WhenDryRun_ItShouldListWithoutLabelling(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	seedBrownfield(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, adoptRequest(http.MethodPost, "my-hc", "&dryRun=All"))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	result := decodeAdoption(t, w)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []string{"HostedCluster/my-hc", "NodePool/my-hc-pool", "Secret/my-hc-pull-secret"}, result.Adopted)
+	assert.Empty(t, spoke.patches)
+	assert.Empty(t, objectLabels(spoke, migrateHCPath))
+}
+
+func Test_handleAdopt_WhenInvalidRequest_ItShouldRejectIt(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	seedBrownfield(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	for _, tc := range []struct {
+		r    *http.Request
+		code int
+	}{
+		{adoptRequest(http.MethodPost, "missing-hc", ""), http.StatusNotFound},
+		{adoptRequest(http.MethodPost, "my-hc", "&dryRun=Sometimes"), http.StatusBadRequest},
+		{adoptRequest(http.MethodGet, "my-hc", ""), http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		p.handleRoute(w, tc.r)
+		assert.Equal(t, tc.code, w.Code, tc.r.URL.String())
+	}
+	assert.Empty(t, spoke.patches)
+}
@@ -0,0 +1,361 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// auditFileEnvVar names a file that receives every audit record as one JSON
+	// line, in addition to the hub Events. Unset disables the file sink.
+	auditFileEnvVar = "HCP_PROXY_AUDIT_FILE"
+
+	// annotationAuditRecord carries the full JSON audit record on each Event.
+	annotationAuditRecord = "hcp.ocm.io/audit-record"
+
+	auditQueueSize    = 1024
+	auditWriteTimeout = 10 * time.Second
+
+	auditOutcomeSuccess = "success"
+	auditOutcomeDenied  = "denied"
+	auditOutcomeFailure = "failure"
+)
+
+// auditRecord is one mutating request (or kubeconfig retrieval) handled by the
+// proxy.
+type auditRecord struct {
+	Timestamp      time.Time `json:"timestamp"`
+	User           string    `json:"user"`
+	Groups         []string  `json:"groups,omitempty"`
+	Verb           string    `json:"verb"`
+	Resource       string    `json:"resource"`
+	Subresource    string    `json:"subresource,omitempty"`
+	HostingCluster string    `json:"hostingCluster,omitempty"`
+	Namespace      string    `json:"namespace,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	DryRun         bool      `json:"dryRun,omitempty"`
+	Outcome        string    `json:"outcome"`
+	StatusCode     int       `json:"statusCode"`
+	DurationMillis int64     `json:"durationMs"`
+}
+
+type auditRecordKey struct{}
+
+// auditRecordFor returns the audit record of an audited request so handlers
+// can fill in what only they know (the chosen hosting cluster, the name of a
+// created object). For requests that are not audited it returns a throwaway
+// record, so callers never need to check.
+func auditRecordFor(r *http.Request) *auditRecord {
+	if rec, ok := r.Context().Value(auditRecordKey{}).(*auditRecord); ok {
+		return rec
+	}
+	return &auditRecord{}
+}
+
+// auditSink persists audit records.
+type auditSink interface {
+	write(ctx context.Context, rec auditRecord) error
+}
+
+// auditor hands audit records to its sinks from a single background worker so
+// a slow hub API server never delays a proxied request. Records are dropped,
+// with an error log, if the queue is full.
+type auditor struct {
+	sinks   []auditSink
+	records chan auditRecord
+	log     logr.Logger
+}
+
+func newAuditor(log logr.Logger, sinks ...auditSink) *auditor {
+	return &auditor{sinks: sinks, records: make(chan auditRecord, auditQueueSize), log: log}
+}
+
+// newAuditorFromEnv builds the auditor used by StartHCPProxy: hub Events,
+// plus the HCP_PROXY_AUDIT_FILE sink when set.
+func newAuditorFromEnv(hubClient client.Client, operatorNamespace string, log logr.Logger) (*auditor, error) {
+	sinks := []auditSink{&hubEventSink{client: hubClient, fallbackNamespace: operatorNamespace}}
+	if path := os.Getenv(auditFileEnvVar); path != "" {
+		fileSink, err := newFileAuditSink(path)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, fileSink)
+		log.Info("writing HCP proxy audit records to file", "path", path)
+	}
+	return newAuditor(log, sinks...), nil
+}
+
+// run writes queued records until ctx is done.
+func (a *auditor) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rec := <-a.records:
+			a.writeAll(ctx, rec)
+		}
+	}
+}
+
+func (a *auditor) writeAll(ctx context.Context, rec auditRecord) {
+	for _, sink := range a.sinks {
+		wctx, cancel := context.WithTimeout(ctx, auditWriteTimeout)
+		if err := sink.write(wctx, rec); err != nil {
+			a.log.Error(err, "failed to write audit record", "sink", fmt.Sprintf("%T", sink),
+				"user", rec.User, "verb", rec.Verb, "resource", rec.Resource,
+				"namespace", rec.Namespace, "name", rec.Name)
+		}
+		cancel()
+	}
+}
+
+func (a *auditor) record(rec auditRecord) {
+	if a == nil {
+		return
+	}
+	select {
+	case a.records <- rec:
+	default:
+		a.log.Error(fmt.Errorf("audit queue full"), "dropping audit record",
+			"user", rec.User, "verb", rec.Verb, "resource", rec.Resource,
+			"namespace", rec.Namespace, "name", rec.Name, "statusCode", rec.StatusCode)
+	}
+}
+
+// auditMiddleware records every create, update, patch and delete under
+// hcp.ocm.io, and every kubeconfig retrieval. Reads are not audited.
+func (p *hcpProxy) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, audited := newAuditRecord(r)
+		if !audited || p.audit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), auditRecordKey{}, rec)))
+
+		rec.StatusCode = sw.status
+		rec.DurationMillis = time.Since(start).Milliseconds()
+		switch {
+		case sw.status < 400:
+			rec.Outcome = auditOutcomeSuccess
+		case sw.status == http.StatusUnauthorized || sw.status == http.StatusForbidden:
+			rec.Outcome = auditOutcomeDenied
+		default:
+			rec.Outcome = auditOutcomeFailure
+		}
+		p.audit.record(*rec)
+	})
+}
+
+// newAuditRecord starts the audit record for r from its method and path.
+// audited is false for requests that are not recorded.
+func newAuditRecord(r *http.Request) (rec *auditRecord, audited bool) {
+	prefix := apiPathPrefix + hcpProxyGroupVersion + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		return nil, false
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	// HostingCluster names the namespace of the hub Event, so it is left to
+	// handleRoute to fill in once the ManagedCluster is known to exist.
+	rec = &auditRecord{Timestamp: time.Now().UTC()}
+	if len(parts) >= 2 && parts[0] == "namespaces" {
+		rec.Namespace = parts[1]
+		parts = parts[2:]
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		return nil, false
+	}
+	rec.Resource = parts[0]
+	if len(parts) > 1 {
+		rec.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		rec.Subresource = parts[2]
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		rec.Verb = "create"
+	case http.MethodPut:
+		rec.Verb = "update"
+	case http.MethodPatch:
+		rec.Verb = "patch"
+	case http.MethodDelete:
+		rec.Verb = "delete"
+		if rec.Name == "" {
+			rec.Verb = "deletecollection"
+		}
+	case http.MethodGet:
+		if rec.Subresource != subresourceKubeconfig {
+			return nil, false
+		}
+		rec.Verb = "get"
+	default:
+		return nil, false
+	}
+	rec.User, rec.Groups = whoIsTheCaller(r)
+	rec.DryRun = r.URL.Query().Get("dryRun") == dryRunAll
+	return rec, true
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// hubEventSink records each audit record as an Event on the hub in the hosting
+// cluster's namespace, involving its ManagedCluster. Records without a known
+// hosting cluster go to fallbackNamespace.
+type hubEventSink struct {
+	client            client.Client
+	fallbackNamespace string
+}
+
+func (s *hubEventSink) write(ctx context.Context, rec auditRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	namespace, involved := s.fallbackNamespace, s.fallbackNamespace
+	if rec.HostingCluster != "" {
+		namespace, involved = rec.HostingCluster, rec.HostingCluster
+	}
+	eventType := corev1.EventTypeNormal
+	if rec.Outcome != auditOutcomeSuccess {
+		eventType = corev1.EventTypeWarning
+	}
+	now := metav1.NewTime(rec.Timestamp)
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s.%x", involved, rec.Timestamp.UnixNano()),
+			Namespace:   namespace,
+			Annotations: map[string]string{annotationAuditRecord: string(raw)},
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: clusterv1.GroupVersion.String(),
+			Kind:       "ManagedCluster",
+			Name:       involved,
+		},
+		Reason:              auditEventReason(rec),
+		Message:             auditEventMessage(rec),
+		Type:                eventType,
+		Source:              corev1.EventSource{Component: hcpProxyServiceName},
+		ReportingController: hcpProxyServiceName,
+		ReportingInstance:   hcpProxyServiceName,
+		Action:              rec.Verb,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	if rec.HostingCluster == "" {
+		event.InvolvedObject = corev1.ObjectReference{Kind: "Namespace", Name: namespace, APIVersion: "v1"}
+	}
+	return s.client.Create(ctx, event)
+}
+
+// auditEventReason is e.g. HostedClusterCreateSucceeded or NodePoolDeleteFailed.
+func auditEventReason(rec auditRecord) string {
+	kind := proxyResourceKinds[rec.Resource]
+	if kind == "" {
+		kind = "Resource"
+	}
+	if rec.Subresource == subresourceKubeconfig {
+		kind += "Kubeconfig"
+	} else if rec.Subresource == subresourceScale {
+		kind += "Scale"
+	} else if rec.Subresource == subresourceMigrate {
+		kind += "Migration"
+	} else if rec.Subresource == subresourceAdopt {
+		kind += "Adoption"
+	}
+	verb := map[string]string{
+		"create": "Create", "update": "Update", "patch": "Patch",
+		"delete": "Delete", "deletecollection": "DeleteCollection", "get": "Get",
+	}[rec.Verb]
+	switch rec.Outcome {
+	case auditOutcomeSuccess:
+		return kind + verb + "Succeeded"
+	case auditOutcomeDenied:
+		return kind + verb + "Denied"
+	default:
+		return kind + verb + "Failed"
+	}
+}
+
+func auditEventMessage(rec auditRecord) string {
+	target := rec.Resource
+	if rec.Subresource != "" {
+		target += "/" + rec.Subresource
+	}
+	name := rec.Name
+	if rec.Namespace != "" {
+		name = rec.Namespace + "/" + name
+	}
+	dryRun := ""
+	if rec.DryRun {
+		dryRun = " (dry run)"
+	}
+	return fmt.Sprintf("%s %s %s %s on hosting cluster %q%s: HTTP %d in %dms",
+		rec.User, rec.Verb, target, name, rec.HostingCluster, dryRun, rec.StatusCode, rec.DurationMillis)
+}
+
+// fileAuditSink appends each audit record as one JSON line.
+type fileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileAuditSink(path string) (*fileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file %s: %w", path, err)
+	}
+	return &fileAuditSink{file: f}, nil
+}
+
+func (s *fileAuditSink) write(_ context.Context, rec auditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
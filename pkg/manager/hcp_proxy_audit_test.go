@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nextAuditRecord returns the next queued record, failing if none arrives.
+func nextAuditRecord(t *testing.T, a *auditor) auditRecord {
+	t.Helper()
+	select {
+	case rec := <-a.records:
+		return rec
+	case <-time.After(5 * time.Second):
+		t.Fatal("no audit record queued")
+		return auditRecord{}
+	}
+}
+
+func Test_auditMiddleware_WhenCreate_ItShouldRecordCallerTargetAndOutcome(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer spokeSrv.Close()
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, availableManagedCluster("spoke-1"))
+	p.audit = newAuditor(p.log)
+
+	body, _ := json.Marshal(CreateRequest{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc"}},
+	})
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters?hostingCluster=spoke-1"
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	r.Header.Add("X-Remote-Group", "platform-team")
+	w := httptest.NewRecorder()
+	p.auditMiddleware(http.HandlerFunc(p.handleRoute)).ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	rec := nextAuditRecord(t, p.audit)
+	assert.Equal(t, "alice", rec.User)
+	assert.Equal(t, []string{"platform-team"}, rec.Groups)
+	assert.Equal(t, "create", rec.Verb)
+	assert.Equal(t, resourceHostedClusters, rec.Resource)
+	assert.Equal(t, "clusters", rec.Namespace)
+	assert.Equal(t, "my-hc", rec.Name)
+	assert.Equal(t, "spoke-1", rec.HostingCluster)
+	assert.Equal(t, auditOutcomeSuccess, rec.Outcome)
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+}
+
+func Test_auditMiddleware_WhenForbidden_ItShouldRecordDenied(t *testing.T) {
+	p := newTestProxy(t, availableManagedCluster("spoke-1"))
+	p.audit = newAuditor(p.log)
+
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc?hostingCluster=spoke-1"
+	r := httptest.NewRequest(http.MethodDelete, path, nil)
+	w := httptest.NewRecorder()
+	p.auditMiddleware(http.HandlerFunc(p.handleRoute)).ServeHTTP(w, r)
+
+	rec := nextAuditRecord(t, p.audit)
+	assert.Equal(t, "delete", rec.Verb)
+	assert.Equal(t, "my-hc", rec.Name)
+	assert.Equal(t, auditOutcomeDenied, rec.Outcome)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
+
+func Test_auditMiddleware_WhenHostingClusterUnknown_ItShouldNotNameANamespace(t *testing.T) {
+	p := newTestProxy(t, availableManagedCluster("spoke-1"))
+	p.audit = newAuditor(p.log)
+
+	for _, hostingCluster := range []string{"kube-system", "Not_A_Name"} {
+		path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc?hostingCluster=" + hostingCluster
+		r := httptest.NewRequest(http.MethodDelete, path, nil)
+		r.Header.Set("X-Remote-User", "alice")
+		p.auditMiddleware(http.HandlerFunc(p.handleRoute)).ServeHTTP(httptest.NewRecorder(), r)
+
+		rec := nextAuditRecord(t, p.audit)
+		assert.Empty(t, rec.HostingCluster, "the Event goes to the fallback namespace")
+		assert.Equal(t, auditOutcomeFailure, rec.Outcome)
+	}
+}
+
+func Test_auditMiddleware_WhenRead_ItShouldNotRecord(t *testing.T) {
+	p := newTestProxy(t)
+	p.audit = newAuditor(p.log)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{
+		"/namespaces/clusters/hostedclusters/my-hc",
+		"/namespaces/clusters/hostedclusters",
+		"/hostedclusters",
+	} {
+		r := httptest.NewRequest(http.MethodGet, apiPathPrefix+hcpProxyGroupVersion+path, nil)
+		p.auditMiddleware(next).ServeHTTP(httptest.NewRecorder(), r)
+	}
+	assert.Empty(t, p.audit.records)
+}
+
+func Test_newAuditRecord_WhenKubeconfigGET_ItShouldBeAudited(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/clusters/hostedclusters/my-hc/kubeconfig?hostingCluster=spoke-1", nil)
+	rec, audited := newAuditRecord(r)
+	require.True(t, audited)
+	assert.Equal(t, "get", rec.Verb)
+	assert.Equal(t, subresourceKubeconfig, rec.Subresource)
+	assert.Equal(t, "my-hc", rec.Name)
+}
+
+func Test_hubEventSink_WhenWritten_ItShouldCreateEventInHostingClusterNamespace(t *testing.T) {
+	p := newTestProxy(t)
+	sink := &hubEventSink{client: p.hubClient, fallbackNamespace: "multicluster-engine"}
+	rec := auditRecord{
+		Timestamp: time.Now(), User: "alice", Verb: "delete", Resource: resourceHostedClusters,
+		HostingCluster: "spoke-1", Namespace: "clusters", Name: "my-hc",
+		Outcome: auditOutcomeFailure, StatusCode: http.StatusBadGateway,
+	}
+	require.NoError(t, sink.write(context.Background(), rec))
+
+	events := &corev1.EventList{}
+	require.NoError(t, p.hubClient.List(context.Background(), events, client.InNamespace("spoke-1")))
+	require.Len(t, events.Items, 1)
+	ev := events.Items[0]
+	assert.Equal(t, corev1.EventTypeWarning, ev.Type)
+	assert.Equal(t, "HostedClusterDeleteFailed", ev.Reason)
+	assert.Equal(t, "ManagedCluster", ev.InvolvedObject.Kind)
+	assert.Contains(t, ev.Message, "alice delete hostedclusters clusters/my-hc")
+
+	var stored auditRecord
+	require.NoError(t, json.Unmarshal([]byte(ev.Annotations[annotationAuditRecord]), &stored))
+	assert.Equal(t, "my-hc", stored.Name)
+	assert.Equal(t, http.StatusBadGateway, stored.StatusCode)
+}
+
+func Test_fileAuditSink_WhenWritten_ItShouldAppendJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := newFileAuditSink(path)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.write(context.Background(), auditRecord{User: "alice", Verb: "create"}))
+	require.NoError(t, sink.write(context.Background(), auditRecord{User: "bob", Verb: "delete"}))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var users []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		users = append(users, rec.User)
+	}
+	assert.Equal(t, []string{"alice", "bob"}, users)
+}
+
+func Test_auditor_WhenQueueFull_ItShouldDropWithoutBlocking(t *testing.T) {
+	p := newTestProxy(t)
+	a := &auditor{records: make(chan auditRecord, 1), log: p.log}
+	a.record(auditRecord{User: "alice"})
+	a.record(auditRecord{User: "bob"})
+	assert.Len(t, a.records, 1)
+
+	var nilAuditor *auditor
+	nilAuditor.record(auditRecord{User: "carol"})
+}
@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/metrics"
+)
+
+const (
+	// authorizationModeEnvVar selects how the proxy authorizes callers on the
+	// hub. Unset means authorizationModeUserPermission.
+	authorizationModeEnvVar = "HCP_PROXY_AUTHORIZATION_MODE"
+
+	// authorizationModeUserPermission requires managedcluster:admin on the
+	// hosting cluster, through the clusterview UserPermission API.
+	authorizationModeUserPermission = "UserPermission"
+	// authorizationModeSubjectAccessReview asks the hub, with a
+	// SubjectAccessReview, whether the caller may perform the request's verb on
+	// the hcp.ocm.io resource in its namespace.
+	authorizationModeSubjectAccessReview = "SubjectAccessReview"
+
+	// headerRemoteExtraPrefix prefixes the caller's extra attributes, set by
+	// the kube-apiserver alongside X-Remote-User.
+	headerRemoteExtraPrefix = "X-Remote-Extra-"
+)
+
+// authorizationModeFromEnv returns the mode named by HCP_PROXY_AUTHORIZATION_MODE.
+func authorizationModeFromEnv() (string, error) {
+	switch mode := os.Getenv(authorizationModeEnvVar); mode {
+	case "", authorizationModeUserPermission:
+		return authorizationModeUserPermission, nil
+	case authorizationModeSubjectAccessReview:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%s: unknown authorization mode %q, expected %s or %s", authorizationModeEnvVar, mode,
+			authorizationModeUserPermission, authorizationModeSubjectAccessReview)
+	}
+}
+
+func (p *hcpProxy) usesAccessReview() bool {
+	return p.authzMode == authorizationModeSubjectAccessReview
+}
+
+// accessAttributes is what a request asks to do on hcp.ocm.io, in RBAC terms.
+type accessAttributes struct {
+	verb        string
+	resource    string
+	subresource string
+	namespace   string
+	name        string
+}
+
+// accessAttributesFor parses the method and path of a request under
+// /apis/hcp.ocm.io/v1alpha1/.
+func accessAttributesFor(r *http.Request) accessAttributes {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, apiPathPrefix+hcpProxyGroupVersion+"/"), "/")
+	var attrs accessAttributes
+	if len(parts) >= 2 && parts[0] == "namespaces" {
+		attrs.namespace = parts[1]
+		parts = parts[2:]
+	}
+	if len(parts) > 0 {
+		attrs.resource = parts[0]
+	}
+	if len(parts) > 1 {
+		attrs.name = parts[1]
+	}
+	if len(parts) > 2 {
+		attrs.subresource = parts[2]
+	}
+	attrs.verb = requestVerb(r, attrs.resource)
+	return attrs
+}
+
+// callerExtra returns the extra attributes of the authenticated user, such as
+// the scopes of an OpenShift OAuth token, from the X-Remote-Extra-* headers.
+func callerExtra(r *http.Request) map[string]authorizationv1.ExtraValue {
+	var extra map[string]authorizationv1.ExtraValue
+	for header, values := range r.Header {
+		if !strings.HasPrefix(header, headerRemoteExtraPrefix) {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimPrefix(header, headerRemoteExtraPrefix))
+		if err != nil {
+			continue
+		}
+		if extra == nil {
+			extra = map[string]authorizationv1.ExtraValue{}
+		}
+		key = strings.ToLower(key)
+		extra[key] = append(extra[key], values...)
+	}
+	return extra
+}
+
+// authorize decides whether the caller of r may send it to hostingCluster,
+// with the configured authorization mode. In SubjectAccessReview mode the
+// decision depends on the namespace, not on the hosting cluster.
+func (p *hcpProxy) authorize(r *http.Request, hostingCluster string) error {
+	username, groups := whoIsTheCaller(r)
+	if p.usesAccessReview() {
+		return p.checkAccessReview(r.Context(), username, groups, callerExtra(r), accessAttributesFor(r), hostingCluster)
+	}
+	return p.checkHubPermission(r.Context(), username, groups, hostingCluster)
+}
+
+// checkAccessReview asks the hub whether the caller may perform attrs on
+// hcp.ocm.io. The result is not cached: the hub authorizer answers from its
+// RBAC cache, and a revoked binding applies on the next request.
+func (p *hcpProxy) checkAccessReview(
+	ctx context.Context,
+	username string,
+	groups []string,
+	extra map[string]authorizationv1.ExtraValue,
+	attrs accessAttributes,
+	hostingCluster string,
+) error {
+	if username == "" {
+		metrics.HCPProxyAuthorizationDenials.WithLabelValues(hostingCluster, denialReasonUnauthenticated).Inc()
+		return fmt.Errorf("unauthenticated request")
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   username,
+			Groups: groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Group:       hcpProxyAPIGroup,
+				Version:     hcpProxyAPIVersion,
+				Resource:    attrs.resource,
+				Subresource: attrs.subresource,
+				Namespace:   attrs.namespace,
+				Name:        attrs.name,
+				Verb:        attrs.verb,
+			},
+		},
+	}
+	if err := p.hubClient.Create(ctx, review); err != nil {
+		metrics.HCPProxyAuthorizationDenials.WithLabelValues(hostingCluster, denialReasonCheckFailed).Inc()
+		return fmt.Errorf("failed to review access of user %q: %w", username, err)
+	}
+	if review.Status.Allowed && !review.Status.Denied {
+		return nil
+	}
+
+	metrics.HCPProxyAuthorizationDenials.WithLabelValues(hostingCluster, denialReasonAccessReviewDenied).Inc()
+	resource := attrs.resource
+	if attrs.subresource != "" {
+		resource += "/" + attrs.subresource
+	}
+	msg := fmt.Sprintf("user %q cannot %s resource %q in API group %q", username, attrs.verb, resource, hcpProxyAPIGroup)
+	if attrs.namespace != "" {
+		msg += fmt.Sprintf(" in the namespace %q", attrs.namespace)
+	}
+	if review.Status.Reason != "" {
+		msg += ": " + review.Status.Reason
+	}
+	return errors.New(msg)
+}
+
+// candidateHostingClusters returns the hosting clusters the caller may target
+// when the proxy picks them (fan-out lists, NodePool lookup, hostingCluster=auto).
+// all is true when every hosting cluster is a candidate: in SubjectAccessReview
+// mode, where the namespace decides, and when the hub permission check is
+// skipped.
+func (p *hcpProxy) candidateHostingClusters(
+	ctx context.Context,
+	username string,
+	groups []string,
+) (clusters sets.Set[string], all bool, err error) {
+	if p.usesAccessReview() {
+		if username == "" {
+			return nil, false, fmt.Errorf("unauthenticated request")
+		}
+		return nil, true, nil
+	}
+	return p.adminClusters(ctx, username, groups)
+}
@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/metrics"
+)
+
+// Overridable in tests.
+var (
+	// permissionCacheTTL is how long a caller's admin clusters are reused.
+	permissionCacheTTL = 30 * time.Second
+	// permissionCacheNegativeTTL is how long a caller with no admin clusters
+	// stays denied without asking the hub again.
+	permissionCacheNegativeTTL = 10 * time.Second
+	// clusterviewProbeTTL is how long the result of the clusterview API probe
+	// is reused.
+	clusterviewProbeTTL = 5 * time.Minute
+)
+
+const (
+	permissionCacheName = "permission"
+	probeCacheName      = "probe"
+)
+
+// clusterviewProbe is the cached outcome of probing the clusterview API with
+// the operator identity.
+type clusterviewProbe int
+
+const (
+	clusterviewUnknown clusterviewProbe = iota
+	clusterviewPresent
+	clusterviewAbsent
+)
+
+type permissionEntry struct {
+	clusters sets.Set[string]
+	expires  time.Time
+}
+
+// permissionCache remembers the "managedcluster:admin" bindings of each
+// caller (user and groups) so checkHubPermission, the fan-out list and
+// hosting cluster selection do not ask the hub on every request. Callers
+// with no admin clusters are cached for a shorter time. Failed lookups are
+// never cached. Any ClusterRoleBinding change on the hub flushes everything.
+// The zero value is ready to use.
+type permissionCache struct {
+	mu      sync.Mutex
+	entries map[string]permissionEntry
+	probe   clusterviewProbe
+	probeAt time.Time
+	// generation is bumped on every flush so a lookup that started before it
+	// does not store a stale result after it.
+	generation uint64
+}
+
+// permissionCacheKey identifies a caller. Groups are sorted so the order the
+// kube-apiserver sends them in does not matter.
+func permissionCacheKey(username string, groups []string) string {
+	sorted := slices.Clone(groups)
+	slices.Sort(sorted)
+	return username + "\x00" + strings.Join(sorted, "\x00")
+}
+
+// get returns a copy of the cached admin clusters of key, and the generation
+// to pass to put after a miss.
+func (c *permissionCache) get(key string, now time.Time) (sets.Set[string], uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && now.Before(entry.expires) {
+		metrics.HCPProxyPermissionCacheLookups.WithLabelValues(permissionCacheName, "hit").Inc()
+		return entry.clusters.Clone(), c.generation, true
+	}
+	if ok {
+		delete(c.entries, key)
+	}
+	metrics.HCPProxyPermissionCacheLookups.WithLabelValues(permissionCacheName, "miss").Inc()
+	return nil, c.generation, false
+}
+
+// put stores the admin clusters of key unless the cache was flushed since
+// generation was read.
+func (c *permissionCache) put(key string, clusters sets.Set[string], generation uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if c.entries == nil {
+		c.entries = map[string]permissionEntry{}
+	}
+	ttl := permissionCacheTTL
+	if clusters.Len() == 0 {
+		ttl = permissionCacheNegativeTTL
+	}
+	c.entries[key] = permissionEntry{clusters: clusters.Clone(), expires: now.Add(ttl)}
+}
+
+// cachedProbe returns the clusterview probe result if it is still fresh.
+func (c *permissionCache) cachedProbe(now time.Time) clusterviewProbe {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.probe != clusterviewUnknown && now.Sub(c.probeAt) < clusterviewProbeTTL {
+		metrics.HCPProxyPermissionCacheLookups.WithLabelValues(probeCacheName, "hit").Inc()
+		return c.probe
+	}
+	metrics.HCPProxyPermissionCacheLookups.WithLabelValues(probeCacheName, "miss").Inc()
+	return clusterviewUnknown
+}
+
+func (c *permissionCache) setProbe(probe clusterviewProbe, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probe = probe
+	c.probeAt = now
+}
+
+// invalidate drops every cached decision. The probe result is kept: RBAC
+// changes do not install or remove the clusterview API.
+func (c *permissionCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.generation++
+	metrics.HCPProxyPermissionCacheInvalidations.Inc()
+}
+
+// watchClusterRoleBindings flushes the cache whenever a ClusterRoleBinding is
+// added, changed or removed on the hub, until ctx is done. Only object
+// metadata is watched. If the watch cannot be established the TTLs still
+// bound how long a revoked permission is honoured.
+func (c *permissionCache) watchClusterRoleBindings(ctx context.Context, hubConfig *rest.Config, log logr.Logger) error {
+	metaClient, err := metadata.NewForConfig(hubConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create hub metadata client: %w", err)
+	}
+	factory := metadatainformer.NewSharedInformerFactory(metaClient, 0)
+	informer := factory.ForResource(rbacv1.SchemeGroupVersion.WithResource("clusterrolebindings")).Informer()
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(_ interface{}, isInInitialList bool) {
+			if !isInInitialList {
+				c.invalidate()
+			}
+		},
+		UpdateFunc: func(_, _ interface{}) { c.invalidate() },
+		DeleteFunc: func(_ interface{}) { c.invalidate() },
+	}); err != nil {
+		return fmt.Errorf("failed to watch ClusterRoleBindings: %w", err)
+	}
+	factory.Start(ctx.Done())
+	log.Info("watching ClusterRoleBindings to invalidate the permission cache")
+	return nil
+}
@@ -0,0 +1,192 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/metrics"
+)
+
+// countingHub serves the clusterview API: the operator probe succeeds, and an
+// impersonated GET returns adminOf[user] as bindings, or 404 if the user has
+// none. It counts both kinds of request.
+type countingHub struct {
+	mu           sync.Mutex
+	adminOf      map[string][]string
+	failNext     bool
+	probes       int
+	impersonated int
+}
+
+func newCountingHub(t *testing.T, adminOf map[string][]string) (*countingHub, *httptest.Server) {
+	t.Helper()
+	h := &countingHub{adminOf: adminOf}
+	srv := httptest.NewServer(http.HandlerFunc(h.serve))
+	t.Cleanup(srv.Close)
+	return h, srv
+}
+
+func (h *countingHub) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Header().Set(headerContentType, contentTypeJSON)
+	if !strings.Contains(r.URL.Path, "userpermissions/managedcluster:admin") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	user := r.Header.Get("Impersonate-User")
+	if user == "" {
+		h.probes++
+	} else {
+		h.impersonated++
+	}
+	if h.failNext {
+		h.failNext = false
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","code":500}`)
+		return
+	}
+	clusters, ok := h.adminOf[user]
+	if user != "" && !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound",`+
+			`"message":"userpermissions.clusterview.open-cluster-management.io \"managedcluster:admin\" not found","code":404}`)
+		return
+	}
+	bindings := []interface{}{}
+	for _, c := range clusters {
+		bindings = append(bindings, map[string]interface{}{"cluster": c})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"apiVersion": "clusterview.open-cluster-management.io/v1alpha1",
+		"kind":       "UserPermission",
+		"metadata":   map[string]interface{}{"name": "managedcluster:admin"},
+		"status":     map[string]interface{}{"bindings": bindings},
+	})
+}
+
+func (h *countingHub) counts() (int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probes, h.impersonated
+}
+
+func Test_checkHubPermission_WhenCalledTwice_ItShouldAskTheHubOnce(t *testing.T) {
+	hub, srv := newCountingHub(t, map[string][]string{"alice": {"spoke-1", "spoke-2"}})
+	p := newTestProxyWithHubServer(t, srv.URL)
+	hits := testutil.ToFloat64(metrics.HCPProxyPermissionCacheLookups.WithLabelValues(permissionCacheName, "hit"))
+
+	require.NoError(t, p.checkHubPermission(context.Background(), "alice", []string{"dev", "ops"}, "spoke-1"))
+	require.NoError(t, p.checkHubPermission(context.Background(), "alice", []string{"ops", "dev"}, "spoke-2"))
+	err := p.checkHubPermission(context.Background(), "alice", []string{"dev", "ops"}, "spoke-3")
+	assert.ErrorContains(t, err, "does not have admin access")
+
+	probes, impersonated := hub.counts()
+	assert.Equal(t, 1, probes)
+	assert.Equal(t, 1, impersonated, "group order should not matter")
+	assert.Equal(t, hits+2,
+		testutil.ToFloat64(metrics.HCPProxyPermissionCacheLookups.WithLabelValues(permissionCacheName, "hit")))
+}
+
+func Test_checkHubPermission_WhenDifferentGroups_ItShouldNotShareTheDecision(t *testing.T) {
+	hub, srv := newCountingHub(t, map[string][]string{"alice": {"spoke-1"}})
+	p := newTestProxyWithHubServer(t, srv.URL)
+
+	require.NoError(t, p.checkHubPermission(context.Background(), "alice", []string{"dev"}, "spoke-1"))
+	require.NoError(t, p.checkHubPermission(context.Background(), "alice", []string{"admins"}, "spoke-1"))
+
+	_, impersonated := hub.counts()
+	assert.Equal(t, 2, impersonated)
+}
+
+func Test_checkHubPermission_WhenDenied_ItShouldCacheForTheNegativeTTL(t *testing.T) {
+	old := permissionCacheNegativeTTL
+	permissionCacheNegativeTTL = 50 * time.Millisecond
+	t.Cleanup(func() { permissionCacheNegativeTTL = old })
+
+	hub, srv := newCountingHub(t, map[string][]string{})
+	p := newTestProxyWithHubServer(t, srv.URL)
+
+	require.Error(t, p.checkHubPermission(context.Background(), "viewer", nil, "spoke-1"))
+	require.Error(t, p.checkHubPermission(context.Background(), "viewer", nil, "spoke-1"))
+	_, impersonated := hub.counts()
+	assert.Equal(t, 1, impersonated)
+
+	hub.mu.Lock()
+	hub.adminOf["viewer"] = []string{"spoke-1"}
+	hub.mu.Unlock()
+	time.Sleep(60 * time.Millisecond)
+	assert.NoError(t, p.checkHubPermission(context.Background(), "viewer", nil, "spoke-1"))
+}
+
+func Test_checkHubPermission_WhenHubFails_ItShouldNotCacheTheFailure(t *testing.T) {
+	hub, srv := newCountingHub(t, map[string][]string{"alice": {"spoke-1"}})
+	p := newTestProxyWithHubServer(t, srv.URL)
+
+	// bob is not an admin; his request only warms the probe cache.
+	require.Error(t, p.checkHubPermission(context.Background(), "bob", nil, "spoke-1"))
+	hub.mu.Lock()
+	hub.failNext = true
+	hub.mu.Unlock()
+
+	assert.Error(t, p.checkHubPermission(context.Background(), "alice", nil, "spoke-1"))
+	assert.NoError(t, p.checkHubPermission(context.Background(), "alice", nil, "spoke-1"))
+	_, impersonated := hub.counts()
+	assert.Equal(t, 3, impersonated)
+}
+
+func Test_permissionCache_WhenInvalidated_ItShouldAskTheHubAgainButKeepTheProbe(t *testing.T) {
+	hub, srv := newCountingHub(t, map[string][]string{"alice": {"spoke-1"}})
+	p := newTestProxyWithHubServer(t, srv.URL)
+
+	require.NoError(t, p.checkHubPermission(context.Background(), "alice", nil, "spoke-1"))
+	hub.mu.Lock()
+	delete(hub.adminOf, "alice")
+	hub.mu.Unlock()
+	p.permissions.invalidate()
+
+	assert.Error(t, p.checkHubPermission(context.Background(), "alice", nil, "spoke-1"),
+		"a revoked binding should apply right after the flush")
+	probes, impersonated := hub.counts()
+	assert.Equal(t, 1, probes)
+	assert.Equal(t, 2, impersonated)
+}
+
+func Test_permissionCache_WhenFlushedDuringLookup_ItShouldDropTheStaleResult(t *testing.T) {
+	var c permissionCache
+	now := time.Now()
+	_, generation, ok := c.get("alice", now)
+	require.False(t, ok)
+
+	c.invalidate()
+	c.put("alice", sets.New("spoke-1"), generation, now)
+
+	_, _, ok = c.get("alice", now)
+	assert.False(t, ok)
+}
+
+func Test_permissionCache_WhenHit_ItShouldReturnACopy(t *testing.T) {
+	var c permissionCache
+	now := time.Now()
+	_, generation, _ := c.get("alice", now)
+	c.put("alice", sets.New("spoke-1"), generation, now)
+
+	got, _, ok := c.get("alice", now)
+	require.True(t, ok)
+	got.Insert("spoke-2")
+
+	again, _, _ := c.get("alice", now)
+	assert.Equal(t, []string{"spoke-1"}, again.UnsortedList())
+}
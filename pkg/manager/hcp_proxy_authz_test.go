@@ -0,0 +1,211 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reviewingClient answers SubjectAccessReviews with allow and records their
+// specs. Every other call goes to the wrapped client.
+type reviewingClient struct {
+	client.Client
+	allow func(spec authorizationv1.SubjectAccessReviewSpec) (bool, error)
+
+	mu      sync.Mutex
+	reviews []authorizationv1.SubjectAccessReviewSpec
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	review, ok := obj.(*authorizationv1.SubjectAccessReview)
+	if !ok {
+		return c.Client.Create(ctx, obj, opts...)
+	}
+	c.mu.Lock()
+	c.reviews = append(c.reviews, review.Spec)
+	c.mu.Unlock()
+	allowed, err := c.allow(review.Spec)
+	if err != nil {
+		return err
+	}
+	review.Status.Allowed = allowed
+	if !allowed {
+		review.Status.Reason = "no RBAC policy matched"
+	}
+	return nil
+}
+
+// withAccessReviews switches p to SubjectAccessReview mode with reviews
+// answered by allow.
+func withAccessReviews(p *hcpProxy, allow func(spec authorizationv1.SubjectAccessReviewSpec) (bool, error)) *reviewingClient {
+	c := &reviewingClient{Client: p.hubClient, allow: allow}
+	p.hubClient = c
+	p.authzMode = authorizationModeSubjectAccessReview
+	return c
+}
+
+// allowNamespace allows every verb in ns only.
+func allowNamespace(ns string) func(spec authorizationv1.SubjectAccessReviewSpec) (bool, error) {
+	return func(spec authorizationv1.SubjectAccessReviewSpec) (bool, error) {
+		return spec.ResourceAttributes.Namespace == ns, nil
+	}
+}
+
+func Test_authorizationModeFromEnv_WhenSet_ItShouldValidateIt(t *testing.T) {
+	t.Setenv(authorizationModeEnvVar, "")
+	mode, err := authorizationModeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, authorizationModeUserPermission, mode)
+
+	t.Setenv(authorizationModeEnvVar, authorizationModeSubjectAccessReview)
+	mode, err = authorizationModeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, authorizationModeSubjectAccessReview, mode)
+
+	t.Setenv(authorizationModeEnvVar, "RBAC")
+	_, err = authorizationModeFromEnv()
+	assert.ErrorContains(t, err, "unknown authorization mode")
+}
+
+func Test_accessAttributesFor_WhenPathsVary_ItShouldMapToRBACAttributes(t *testing.T) {
+	gv := apiPathPrefix + hcpProxyGroupVersion
+	for _, tc := range []struct {
+		method, path string
+		want         accessAttributes
+	}{
+		{http.MethodPost, gv + "/namespaces/team-a/hostedclusters",
+			accessAttributes{verb: "create", resource: "hostedclusters", namespace: "team-a"}},
+		{http.MethodGet, gv + "/namespaces/team-a/hostedclusters/hc-1/kubeconfig",
+			accessAttributes{verb: "get", resource: "hostedclusters", subresource: "kubeconfig", namespace: "team-a", name: "hc-1"}},
+		{http.MethodPatch, gv + "/namespaces/team-a/nodepools/np-1/scale",
+			accessAttributes{verb: "patch", resource: "nodepools", subresource: "scale", namespace: "team-a", name: "np-1"}},
+		{http.MethodGet, gv + "/namespaces/team-a/nodepools?watch=true",
+			accessAttributes{verb: "watch", resource: "nodepools", namespace: "team-a"}},
+		{http.MethodDelete, gv + "/namespaces/team-a/hostedclusters/hc-1",
+			accessAttributes{verb: "delete", resource: "hostedclusters", namespace: "team-a", name: "hc-1"}},
+	} {
+		assert.Equal(t, tc.want, accessAttributesFor(httptest.NewRequest(tc.method, tc.path, nil)), tc.path)
+	}
+}
+
+func Test_callerExtra_WhenExtraHeadersSet_ItShouldDecodeKeys(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Add("X-Remote-Extra-Scopes.authorization.openshift.io", "user:info")
+	r.Header.Add("X-Remote-Extra-Scopes.authorization.openshift.io", "user:check-access")
+	r.Header.Add("X-Remote-Extra-Acme.com%2Fproject", "a")
+	r.Header.Set("X-Remote-User", "alice")
+
+	assert.Equal(t, map[string]authorizationv1.ExtraValue{
+		"scopes.authorization.openshift.io": {"user:info", "user:check-access"},
+		"acme.com/project":                  {"a"},
+	}, callerExtra(r))
+	assert.Nil(t, callerExtra(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+func Test_handleRoute_WhenAccessReviewAllows_ItShouldProxyWithoutUserPermission(t *testing.T) {
+	var spokeCalls atomic.Int32
+	spoke := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		spokeCalls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(spoke.Close)
+	// The hub dynamic client of newTestProxy reaches no server, so
+	// UserPermission mode would refuse every request.
+	p := newTestProxy(t, availableManagedCluster("spoke-1"))
+	p.clusterProxyURL = spoke.URL
+	reviewer := withAccessReviews(p, allowNamespace("team-a"))
+
+	r := httptest.NewRequest(http.MethodGet,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/team-a/hostedclusters/hc-1?hostingCluster=spoke-1", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	r.Header.Add("X-Remote-Group", "team-a-admins")
+	w := httptest.NewRecorder()
+	p.handleRoute(w, r)
+
+	assert.NotEqual(t, http.StatusForbidden, w.Code)
+	assert.Positive(t, spokeCalls.Load())
+	require.Len(t, reviewer.reviews, 1)
+	assert.Equal(t, "alice", reviewer.reviews[0].User)
+	assert.Equal(t, []string{"team-a-admins"}, reviewer.reviews[0].Groups)
+	assert.Equal(t, &authorizationv1.ResourceAttributes{
+		Group: hcpProxyAPIGroup, Version: hcpProxyAPIVersion, Resource: "hostedclusters",
+		Namespace: "team-a", Name: "hc-1", Verb: "get",
+	}, reviewer.reviews[0].ResourceAttributes)
+}
+
+func Test_handleRoute_WhenAccessReviewDenies_ItShouldReturn403(t *testing.T) {
+	p := newTestProxy(t, availableManagedCluster("spoke-1"))
+	p.clusterProxyURL = "http://unused"
+	withAccessReviews(p, allowNamespace("team-a"))
+
+	r := httptest.NewRequest(http.MethodPost,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/team-b/hostedclusters?hostingCluster=spoke-1",
+		http.NoBody)
+	r.Header.Set("X-Remote-User", "alice")
+	w := httptest.NewRecorder()
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusForbidden, w.Code)
+	body, _ := io.ReadAll(w.Body)
+	assert.Contains(t, string(body),
+		`user \"alice\" cannot create resource \"hostedclusters\" in API group \"hcp.ocm.io\" in the namespace \"team-b\"`)
+}
+
+func Test_checkAccessReview_WhenHubFails_ItShouldDeny(t *testing.T) {
+	p := newTestProxy(t)
+	withAccessReviews(p, func(authorizationv1.SubjectAccessReviewSpec) (bool, error) {
+		return false, errors.New("connection refused")
+	})
+	err := p.checkAccessReview(context.Background(), "alice", nil, nil,
+		accessAttributes{verb: "get", resource: "hostedclusters", namespace: "team-a"}, "spoke-1")
+	assert.ErrorContains(t, err, "connection refused")
+
+	err = p.checkAccessReview(context.Background(), "", nil, nil,
+		accessAttributes{verb: "get", resource: "hostedclusters", namespace: "team-a"}, "spoke-1")
+	assert.ErrorContains(t, err, "unauthenticated")
+}
+
+func Test_handleFanOutList_WhenAccessReviewMode_ItShouldReviewTheListOnce(t *testing.T) {
+	spoke := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_, _ = io.WriteString(w, hcListBody("team-a", "hc-1"))
+	}))
+	t.Cleanup(spoke.Close)
+	p := newTestProxy(t, hostingManagedCluster("spoke-1"), hostingManagedCluster("spoke-2"))
+	p.clusterProxyURL = spoke.URL
+	reviewer := withAccessReviews(p, allowNamespace("team-a"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleFanOutList(w, r, "team-a", resourceHostedClusters)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeHCList(t, w.Body.Bytes()), 2, "every hosting cluster is queried")
+	require.Len(t, reviewer.reviews, 1)
+	assert.Equal(t, "list", reviewer.reviews[0].ResourceAttributes.Verb)
+
+	w = httptest.NewRecorder()
+	p.handleFanOutList(w, r, "team-b", resourceHostedClusters)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeHCList(t, w.Body.Bytes()))
+	assert.Contains(t, w.Header().Get("Warning"), `cannot list resource \"hostedclusters\"`)
+}
+
+func Test_selectHostingCluster_WhenAccessReviewMode_ItShouldConsiderEveryHostingCluster(t *testing.T) {
+	p := newTestProxy(t, hostingManagedCluster("spoke-1"))
+	withAccessReviews(p, allowNamespace("team-a"))
+
+	chosen, _, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "spoke-1", chosen)
+}
@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	headerETag    = "ETag"
+	headerIfMatch = "If-Match"
+)
+
+// spokeStatusError is a non-2xx response from the spoke. status is the
+// metav1.Status the spoke answered with, if any.
+type spokeStatusError struct {
+	code   int
+	status *metav1.Status
+	body   string
+}
+
+func (e *spokeStatusError) Error() string {
+	return fmt.Sprintf("spoke returned %d: %s", e.code, e.body)
+}
+
+func newSpokeStatusError(code int, body []byte) *spokeStatusError {
+	e := &spokeStatusError{code: code, body: string(body)}
+	status := &metav1.Status{}
+	if json.Unmarshal(body, status) == nil && status.Kind == "Status" {
+		e.status = status
+	}
+	return e
+}
+
+// bundleETag identifies the live state of a ResourceBundle: the
+// resourceVersions of the HostedCluster and of its NodePools. It changes
+// whenever any of them is modified, added or removed.
+func bundleETag(hc *hypershiftv1beta1.HostedCluster, nodePools []hypershiftv1beta1.NodePool) string {
+	versions := make([]string, 0, len(nodePools))
+	for _, np := range nodePools {
+		versions = append(versions, np.Name+"="+np.ResourceVersion)
+	}
+	sort.Strings(versions)
+	sum := sha256.Sum256([]byte(hc.ResourceVersion + ";" + strings.Join(versions, ",")))
+	return fmt.Sprintf(`"%x"`, sum[:12])
+}
+
+// ifMatchSatisfied reports whether an If-Match header value matches etag.
+// "*" matches any existing bundle.
+func ifMatchSatisfied(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchesETag reports whether an If-Match header value names etag itself,
+// rather than matching it through "*".
+func ifMatchesETag(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBundlePreconditions compares a submitted ResourceBundle with the live
+// objects before anything is written, so a stale bundle is rejected as a
+// whole instead of half-applied. It only reads the spoke when the request
+// carries If-Match or the bundle carries resourceVersions. On failure it
+// returns the Status to answer with.
+//
+// Once If-Match names the live ETag, its resourceVersions are stamped into the
+// bundle objects that carry none, so a change made before the PUTs that
+// follow is rejected by the spoke with 409 instead of overwritten.
+func (p *hcpProxy) checkBundlePreconditions(
+	ctx context.Context,
+	hcpClient *http.Client,
+	r *http.Request,
+	bundle *ResourceBundle,
+	ns, name, spokeName string,
+) *metav1.Status {
+	ifMatch := r.Header.Get(headerIfMatch)
+	hasVersions := bundle.HostedCluster != nil && bundle.HostedCluster.ResourceVersion != ""
+	for i := range bundle.NodePools {
+		hasVersions = hasVersions || bundle.NodePools[i].ResourceVersion != ""
+	}
+	if ifMatch == "" && !hasVersions {
+		return nil
+	}
+
+	gr := schema.GroupResource{Group: hcpProxyAPIGroup, Resource: resourceHostedClusters}
+	live, code, msg := p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
+	if live == nil {
+		if code == http.StatusNotFound && ifMatch != "" {
+			return preconditionFailed(name, "HostedCluster "+name+" does not exist")
+		}
+		return &metav1.Status{Status: metav1.StatusFailure, Code: int32(code), Message: msg}
+	}
+	liveNodePools := p.fetchNodePoolsForHC(ctx, hcpClient, ns, name, spokeName)
+
+	etag := bundleETag(live, liveNodePools)
+	if ifMatch != "" && !ifMatchSatisfied(ifMatch, etag) {
+		return preconditionFailed(name, "the HostedCluster or its NodePools have changed since the bundle was read")
+	}
+
+	var causes []metav1.StatusCause
+	if hc := bundle.HostedCluster; hc != nil && hc.ResourceVersion != "" && hc.ResourceVersion != live.ResourceVersion {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Field:   "hostedCluster.metadata.resourceVersion",
+			Message: fmt.Sprintf("HostedCluster %s is at resourceVersion %s, not %s", name, live.ResourceVersion, hc.ResourceVersion),
+		})
+	}
+	liveVersions := make(map[string]string, len(liveNodePools))
+	for _, np := range liveNodePools {
+		liveVersions[np.Name] = np.ResourceVersion
+	}
+	for i, np := range bundle.NodePools {
+		if np.ResourceVersion == "" {
+			continue
+		}
+		current, exists := liveVersions[np.Name]
+		switch {
+		case !exists:
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Field:   fmt.Sprintf("nodePools[%d].metadata.resourceVersion", i),
+				Message: fmt.Sprintf("NodePool %s no longer exists", np.Name),
+			})
+		case current != np.ResourceVersion:
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Field:   fmt.Sprintf("nodePools[%d].metadata.resourceVersion", i),
+				Message: fmt.Sprintf("NodePool %s is at resourceVersion %s, not %s", np.Name, current, np.ResourceVersion),
+			})
+		}
+	}
+	if len(causes) > 0 {
+		status := apierrors.NewConflict(gr, name,
+			errors.New("the object has been modified; please apply your changes to the latest version and try again")).ErrStatus
+		status.Details.Causes = causes
+		return &status
+	}
+
+	if ifMatchesETag(ifMatch, etag) {
+		if hc := bundle.HostedCluster; hc != nil && hc.ResourceVersion == "" {
+			hc.ResourceVersion = live.ResourceVersion
+		}
+		for i := range bundle.NodePools {
+			if np := &bundle.NodePools[i]; np.ResourceVersion == "" {
+				np.ResourceVersion = liveVersions[np.Name]
+			}
+		}
+	}
+	return nil
+}
+
+// preconditionFailed is the 412 answer to an If-Match that no longer holds.
+// Its reason is Conflict so clients retry it like a resourceVersion conflict.
+func preconditionFailed(name, msg string) *metav1.Status {
+	return &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusPreconditionFailed,
+		Reason:  metav1.StatusReasonConflict,
+		Message: fmt.Sprintf("If-Match precondition failed for hostedclusters.%s %q: %s", hcpProxyAPIGroup, name, msg),
+		Details: &metav1.StatusDetails{Name: name, Group: hcpProxyAPIGroup, Kind: resourceHostedClusters},
+	}
+}
+
+// spokeWriteStatus turns a failed spoke write into the Status to answer with.
+// Client errors the spoke reported (409 Conflict, 422 Invalid, 404, 403) keep
+// their code and reason under the hcp.ocm.io group; anything else is a 502.
+func spokeWriteStatus(err error, msg string) *metav1.Status {
+	var spokeErr *spokeStatusError
+	if !errors.As(err, &spokeErr) || spokeErr.code < 400 || spokeErr.code >= 500 {
+		return &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusBadGateway, Message: msg + ": " + err.Error()}
+	}
+	status := metav1.Status{Status: metav1.StatusFailure, Code: int32(spokeErr.code), Message: msg + ": " + spokeErr.body}
+	if spokeErr.status != nil {
+		status = *spokeErr.status
+		status.Message = msg + ": " + status.Message
+		if status.Details != nil {
+			status.Details.Group = hcpProxyAPIGroup
+		}
+	}
+	return &status
+}
+
+// writeStatus writes a metav1.Status error response with its code.
+func writeStatus(w http.ResponseWriter, status *metav1.Status) {
+	status.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+	status.Status = metav1.StatusFailure
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(int(status.Code))
+	_ = json.NewEncoder(w).Encode(status)
+}
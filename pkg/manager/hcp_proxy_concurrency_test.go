@@ -0,0 +1,206 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// versionedSpoke serves HostedCluster clusters/my-hc at resourceVersion 5 with
+// NodePool my-hc-pool at 7, and answers PUTs with putCode/putBody. It records
+// the path and metadata.resourceVersion of every PUT.
+type versionedSpoke struct {
+	mu          sync.Mutex
+	putPaths    []string
+	putVersions []string
+	putCode     int
+	putBody     string
+}
+
+func (s *versionedSpoke) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	hc, _ := json.Marshal(hypershiftv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-hc", Namespace: "clusters", ResourceVersion: "5"},
+	})
+	nps, _ := json.Marshal(hypershiftv1beta1.NodePoolList{Items: []hypershiftv1beta1.NodePool{{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool", Namespace: "clusters", ResourceVersion: "7"},
+		Spec:       hypershiftv1beta1.NodePoolSpec{ClusterName: "my-hc"},
+	}}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		if r.Method == http.MethodPut {
+			var obj metav1.PartialObjectMetadata
+			_ = json.NewDecoder(r.Body).Decode(&obj)
+			s.mu.Lock()
+			s.putPaths = append(s.putPaths, r.URL.Path)
+			s.putVersions = append(s.putVersions, obj.ResourceVersion)
+			s.mu.Unlock()
+			code := s.putCode
+			if code == 0 {
+				code = http.StatusOK
+			}
+			w.WriteHeader(code)
+			_, _ = io.WriteString(w, s.putBody)
+			return
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/hostedclusters/my-hc"):
+			_, _ = w.Write(hc)
+		case strings.HasSuffix(r.URL.Path, "/nodepools"):
+			_, _ = w.Write(nps)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func putBundleRequest(t *testing.T, bundle ResourceBundle, ifMatch string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	if ifMatch != "" {
+		r.Header.Set(headerIfMatch, ifMatch)
+	}
+	return r
+}
+
+func decodeStatus(t *testing.T, body []byte) metav1.Status {
+	t.Helper()
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(body, &status))
+	assert.Equal(t, "Status", status.Kind)
+	return status
+}
+
+func Test_handlePatchResources_WhenResourceVersionStale_ItShouldReturn409WithoutWriting(t *testing.T) {
+	spoke := &versionedSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handlePatchResources(w, putBundleRequest(t, ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc", ResourceVersion: "5"}},
+		NodePools: []hypershiftv1beta1.NodePool{
+			{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool", ResourceVersion: "6"}},
+		},
+	}, ""), "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	assert.Empty(t, spoke.putPaths)
+	status := decodeStatus(t, w.Body.Bytes())
+	assert.Equal(t, metav1.StatusReasonConflict, status.Reason)
+	require.NotNil(t, status.Details)
+	assert.Equal(t, hcpProxyAPIGroup, status.Details.Group)
+	require.Len(t, status.Details.Causes, 1)
+	assert.Equal(t, "nodePools[0].metadata.resourceVersion", status.Details.Causes[0].Field)
+}
+
+func Test_handlePatchResources_WhenIfMatchStale_ItShouldReturn412(t *testing.T) {
+	spoke := &versionedSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handlePatchResources(w, putBundleRequest(t, ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc"}},
+	}, `"stale"`), "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Empty(t, spoke.putPaths)
+	assert.Equal(t, metav1.StatusReasonConflict, decodeStatus(t, w.Body.Bytes()).Reason)
+}
+
+func Test_handlePatchResources_WhenIfMatchFromGET_ItShouldApply(t *testing.T) {
+	spoke := &versionedSpoke{putBody: `{}`}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t).URL, availableManagedCluster("spoke-1"))
+
+	get := httptest.NewRecorder()
+	p.handleGetResources(get, putBundleRequest(t, ResourceBundle{}, ""), "clusters", "my-hc", "spoke-1")
+	require.Equal(t, http.StatusOK, get.Code)
+	etag := get.Header().Get(headerETag)
+	require.NotEmpty(t, etag)
+
+	w := httptest.NewRecorder()
+	p.handlePatchResources(w, putBundleRequest(t, ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc", ResourceVersion: "5"}},
+	}, etag), "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, spoke.putPaths, 1)
+	assert.Equal(t, etag, w.Header().Get(headerETag))
+}
+
+func Test_handlePatchResources_WhenIfMatchWithoutResourceVersions_ItShouldSendTheLiveOnes(t *testing.T) {
+	spoke := &versionedSpoke{putBody: `{}`}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t).URL, availableManagedCluster("spoke-1"))
+
+	get := httptest.NewRecorder()
+	p.handleGetResources(get, putBundleRequest(t, ResourceBundle{}, ""), "clusters", "my-hc", "spoke-1")
+	require.Equal(t, http.StatusOK, get.Code)
+
+	w := httptest.NewRecorder()
+	p.handlePatchResources(w, putBundleRequest(t, ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc"}},
+		NodePools:     []hypershiftv1beta1.NodePool{{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool"}}},
+	}, get.Header().Get(headerETag)), "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"5", "7"}, spoke.putVersions,
+		"the PUTs should carry the resourceVersions If-Match was checked against")
+}
+
+func Test_handlePatchResources_WhenSpokeReturnsConflict_ItShouldReturn409Status(t *testing.T) {
+	spoke := &versionedSpoke{
+		putCode: http.StatusConflict,
+		putBody: `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Conflict","code":409,` +
+			`"message":"the object has been modified",` +
+			`"details":{"name":"my-hc","group":"hypershift.openshift.io","kind":"hostedclusters"}}`,
+	}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handlePatchResources(w, putBundleRequest(t, ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc", ResourceVersion: "5"}},
+	}, ""), "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusConflict, w.Code)
+	status := decodeStatus(t, w.Body.Bytes())
+	assert.Equal(t, metav1.StatusReasonConflict, status.Reason)
+	assert.Equal(t, hcpProxyAPIGroup, status.Details.Group)
+	assert.Contains(t, status.Message, "the object has been modified")
+}
+
+func Test_handlePatchResources_WhenSpokeFailsWith500_ItShouldReturn502(t *testing.T) {
+	spoke := &versionedSpoke{putCode: http.StatusInternalServerError, putBody: "boom"}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handlePatchResources(w, putBundleRequest(t, ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc"}},
+	}, ""), "clusters", "my-hc", "spoke-1")
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func Test_bundleETag_WhenNodePoolOrderDiffers_ItShouldBeStable(t *testing.T) {
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{ResourceVersion: "5"}}
+	a := hypershiftv1beta1.NodePool{ObjectMeta: metav1.ObjectMeta{Name: "a", ResourceVersion: "1"}}
+	b := hypershiftv1beta1.NodePool{ObjectMeta: metav1.ObjectMeta{Name: "b", ResourceVersion: "2"}}
+
+	assert.Equal(t, bundleETag(hc, []hypershiftv1beta1.NodePool{a, b}), bundleETag(hc, []hypershiftv1beta1.NodePool{b, a}))
+	assert.NotEqual(t, bundleETag(hc, []hypershiftv1beta1.NodePool{a}), bundleETag(hc, []hypershiftv1beta1.NodePool{a, b}))
+	assert.True(t, ifMatchSatisfied(`"x", `+bundleETag(hc, nil), bundleETag(hc, nil)))
+	assert.True(t, ifMatchSatisfied("*", bundleETag(hc, nil)))
+}
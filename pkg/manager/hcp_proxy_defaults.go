@@ -0,0 +1,397 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// defaultsConfigMapName is the optional ConfigMap in the operator namespace
+	// holding the defaults merged into every create.
+	defaultsConfigMapName = "hcp-proxy-defaults"
+	defaultsConfigMapKey  = "defaults.yaml"
+
+	// trustBundleConfigMapKey is the key hypershift reads from the ConfigMap
+	// named by spec.additionalTrustBundle.
+	trustBundleConfigMapKey    = "ca-bundle.crt"
+	trustBundleConfigMapSuffix = "-additional-trust-bundle"
+
+	etcdManagementTypeManaged       = "Managed"
+	etcdStorageTypePersistentVolume = "PersistentVolume"
+)
+
+// createDefaults is the content of the defaults ConfigMap.
+type createDefaults struct {
+	Defaults []defaultsEntry `json:"defaults"`
+}
+
+// defaultsEntry holds defaults for the creates it selects: those on one of
+// HostingClusters, those in one of Namespaces, or every create when both are
+// empty.
+type defaultsEntry struct {
+	Name            string   `json:"name"`
+	HostingClusters []string `json:"hostingClusters,omitempty"`
+	Namespaces      []string `json:"namespaces,omitempty"`
+
+	// Labels and Annotations are added to the HostedCluster and its NodePools.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// NodeSelector and Tolerations place the control plane pods on the hosting
+	// cluster.
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	NodePools    *nodePoolDefaults   `json:"nodePools,omitempty"`
+	Networking   *networkDefaults    `json:"networking,omitempty"`
+	// EtcdStorageClassName is used for managed etcd on persistent volumes.
+	EtcdStorageClassName string `json:"etcdStorageClassName,omitempty"`
+	// AdditionalTrustBundle is PEM. It is stored in a ConfigMap created next to
+	// the HostedCluster.
+	AdditionalTrustBundle string `json:"additionalTrustBundle,omitempty"`
+}
+
+// nodePoolDefaults apply to the nodes of every NodePool in the create.
+type nodePoolDefaults struct {
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+	Taints     []corev1.Taint    `json:"taints,omitempty"`
+}
+
+// networkDefaults fill spec.networking, in the HostedCluster format.
+type networkDefaults struct {
+	ClusterNetwork []networkEntry `json:"clusterNetwork,omitempty"`
+	ServiceNetwork []networkEntry `json:"serviceNetwork,omitempty"`
+	MachineNetwork []networkEntry `json:"machineNetwork,omitempty"`
+}
+
+type networkEntry struct {
+	CIDR       string `json:"cidr"`
+	HostPrefix int32  `json:"hostPrefix,omitempty"`
+}
+
+// parseDefaults parses and validates the defaults YAML. Unknown fields are
+// errors so a typo cannot silently drop a default.
+func parseDefaults(data string) (*createDefaults, error) {
+	raw, err := yaml.YAMLToJSON([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	defaults := &createDefaults{}
+	if err := dec.Decode(defaults); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range defaults.Defaults {
+		entry := &defaults.Defaults[i]
+		if entry.Name == "" {
+			return nil, fmt.Errorf("defaults[%d]: name is required", i)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("defaults[%d]: duplicate name %q", i, entry.Name)
+		}
+		names[entry.Name] = true
+		if n := entry.Networking; n != nil {
+			for _, cidrs := range [][]networkEntry{n.ClusterNetwork, n.ServiceNetwork, n.MachineNetwork} {
+				for _, e := range cidrs {
+					if _, _, err := net.ParseCIDR(e.CIDR); err != nil {
+						return nil, fmt.Errorf("defaults %q: %w", entry.Name, err)
+					}
+				}
+			}
+		}
+		if entry.AdditionalTrustBundle != "" {
+			if block, _ := pem.Decode([]byte(entry.AdditionalTrustBundle)); block == nil || block.Type != "CERTIFICATE" {
+				return nil, fmt.Errorf("defaults %q: additionalTrustBundle is not a PEM certificate", entry.Name)
+			}
+		}
+	}
+	return defaults, nil
+}
+
+func (entry *defaultsEntry) appliesTo(hostingCluster, ns string) bool {
+	if len(entry.HostingClusters) == 0 && len(entry.Namespaces) == 0 {
+		return true
+	}
+	return slices.Contains(entry.HostingClusters, hostingCluster) || slices.Contains(entry.Namespaces, ns)
+}
+
+// createDefaultsFor returns the defaults entries that apply to a create in ns
+// on hostingCluster, in ConfigMap order. Like the policy, the ConfigMap is
+// read on every create; a missing one means no defaults and an invalid one is
+// an error.
+func (p *hcpProxy) createDefaultsFor(ctx context.Context, hostingCluster, ns string) ([]defaultsEntry, error) {
+	cm := &corev1.ConfigMap{}
+	err := p.hubClient.Get(ctx, types.NamespacedName{Namespace: p.operatorNamespace, Name: defaultsConfigMapName}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read defaults ConfigMap: %w", err)
+	}
+	defaults, err := parseDefaults(cm.Data[defaultsConfigMapKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid defaults ConfigMap %s/%s: %w", p.operatorNamespace, defaultsConfigMapName, err)
+	}
+	var entries []defaultsEntry
+	for _, entry := range defaults.Defaults {
+		if entry.appliesTo(hostingCluster, ns) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// applyDefaults merges entries, in order, into the HostedCluster and NodePools
+// of req. A field that is already set, by the caller or by an earlier entry,
+// is never replaced; labels, annotations and node labels are merged per key.
+// It returns one warning per entry listing the fields it set and, when the
+// trust bundle was defaulted, the ConfigMap that must be created with the
+// HostedCluster.
+func applyDefaults(entries []defaultsEntry, req *CreateRequest) ([]string, *corev1.ConfigMap, error) {
+	if len(entries) == 0 {
+		return nil, nil, nil
+	}
+	hc, err := toJSONMap(req.HostedCluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodePools := make([]map[string]interface{}, len(req.NodePools))
+	for i, np := range req.NodePools {
+		if np == nil {
+			continue
+		}
+		if nodePools[i], err = toJSONMap(np); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var warnings []string
+	var trustBundle *corev1.ConfigMap
+	for i := range entries {
+		entry := &entries[i]
+		d := &defaulter{}
+		if d.applyToHostedCluster(entry, hc, field.NewPath("hostedCluster")) {
+			trustBundle = &corev1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Name: req.HostedCluster.Name + trustBundleConfigMapSuffix},
+				Data:       map[string]string{trustBundleConfigMapKey: entry.AdditionalTrustBundle},
+			}
+		}
+		for j, np := range nodePools {
+			if np != nil {
+				d.applyToNodePool(entry, np, field.NewPath("nodePools").Index(j))
+			}
+		}
+		if len(d.applied) > 0 {
+			warnings = append(warnings, fmt.Sprintf("defaults %q set %s", entry.Name, strings.Join(d.applied, ", ")))
+		}
+	}
+
+	if err := fromJSONMap(hc, req.HostedCluster); err != nil {
+		return nil, nil, err
+	}
+	for i, np := range nodePools {
+		if np == nil {
+			continue
+		}
+		if err := fromJSONMap(np, req.NodePools[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return warnings, trustBundle, nil
+}
+
+// applyNodePoolDefaults merges entries, in order, into a NodePool created on
+// its own, the same way applyDefaults does for the NodePools of a create. It
+// returns one warning per entry listing the fields it set.
+func applyNodePoolDefaults(entries []defaultsEntry, np map[string]interface{}) []string {
+	var warnings []string
+	for i := range entries {
+		entry := &entries[i]
+		d := &defaulter{}
+		d.applyToNodePool(entry, np, field.NewPath("nodePool"))
+		if len(d.applied) > 0 {
+			warnings = append(warnings, fmt.Sprintf("defaults %q set %s", entry.Name, strings.Join(d.applied, ", ")))
+		}
+	}
+	return warnings
+}
+
+// defaulter sets fields that are not set yet and records their paths.
+type defaulter struct {
+	applied []string
+}
+
+// applyToHostedCluster reports whether it set spec.additionalTrustBundle.
+func (d *defaulter) applyToHostedCluster(entry *defaultsEntry, hc map[string]interface{}, path *field.Path) bool {
+	spec := path.Child("spec")
+	d.mergeStrings(hc, entry.Labels, path.Child("metadata", "labels"), "metadata", "labels")
+	d.mergeStrings(hc, entry.Annotations, path.Child("metadata", "annotations"), "metadata", "annotations")
+	if len(entry.NodeSelector) > 0 {
+		d.setIfUnset(hc, entry.NodeSelector, spec.Child("nodeSelector"), "spec", "nodeSelector")
+	}
+	if len(entry.Tolerations) > 0 {
+		d.setIfUnset(hc, entry.Tolerations, spec.Child("tolerations"), "spec", "tolerations")
+	}
+	if n := entry.Networking; n != nil {
+		networking := spec.Child("networking")
+		for _, list := range []struct {
+			name    string
+			entries []networkEntry
+		}{
+			{"clusterNetwork", n.ClusterNetwork},
+			{"serviceNetwork", n.ServiceNetwork},
+			{"machineNetwork", n.MachineNetwork},
+		} {
+			if len(list.entries) > 0 {
+				d.setIfUnset(hc, list.entries, networking.Child(list.name), "spec", "networking", list.name)
+			}
+		}
+	}
+	if entry.EtcdStorageClassName != "" {
+		managementType, _, _ := unstructured.NestedString(hc, "spec", "etcd", "managementType")
+		storageType, _, _ := unstructured.NestedString(hc, "spec", "etcd", "managed", "storage", "type")
+		if managementType == etcdManagementTypeManaged && storageType == etcdStorageTypePersistentVolume {
+			d.setIfUnset(hc, entry.EtcdStorageClassName,
+				spec.Child("etcd", "managed", "storage", "persistentVolume", "storageClassName"),
+				"spec", "etcd", "managed", "storage", "persistentVolume", "storageClassName")
+		}
+	}
+	if entry.AdditionalTrustBundle == "" {
+		return false
+	}
+	name, _, _ := unstructured.NestedString(hc, "metadata", "name")
+	return d.setIfUnset(hc, map[string]string{"name": name + trustBundleConfigMapSuffix},
+		spec.Child("additionalTrustBundle"), "spec", "additionalTrustBundle")
+}
+
+func (d *defaulter) applyToNodePool(entry *defaultsEntry, np map[string]interface{}, path *field.Path) {
+	d.mergeStrings(np, entry.Labels, path.Child("metadata", "labels"), "metadata", "labels")
+	d.mergeStrings(np, entry.Annotations, path.Child("metadata", "annotations"), "metadata", "annotations")
+	if entry.NodePools == nil {
+		return
+	}
+	spec := path.Child("spec")
+	d.mergeStrings(np, entry.NodePools.NodeLabels, spec.Child("nodeLabels"), "spec", "nodeLabels")
+	if len(entry.NodePools.Taints) > 0 {
+		d.setIfUnset(np, entry.NodePools.Taints, spec.Child("taints"), "spec", "taints")
+	}
+}
+
+// setIfUnset sets obj.fields to value unless it holds a non-empty value.
+// It reports whether it set it.
+func (d *defaulter) setIfUnset(obj map[string]interface{}, value interface{}, path *field.Path, fields ...string) bool {
+	if current, found, _ := unstructured.NestedFieldNoCopy(obj, fields...); found && !isEmptyJSONValue(current) {
+		return false
+	}
+	v, err := jsonValue(value)
+	if err != nil {
+		return false
+	}
+	if err := unstructured.SetNestedField(obj, v, fields...); err != nil {
+		return false
+	}
+	d.applied = append(d.applied, path.String())
+	return true
+}
+
+// mergeStrings adds the keys of values that obj.fields does not have yet.
+func (d *defaulter) mergeStrings(obj map[string]interface{}, values map[string]string, path *field.Path, fields ...string) {
+	if len(values) == 0 {
+		return
+	}
+	current, found, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	merged, ok := current.(map[string]interface{})
+	if found && current != nil && !ok {
+		return
+	}
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var added bool
+	for _, k := range keys {
+		if _, exists := merged[k]; exists {
+			continue
+		}
+		merged[k] = values[k]
+		d.applied = append(d.applied, path.Key(k).String())
+		added = true
+	}
+	if added {
+		_ = unstructured.SetNestedField(obj, merged, fields...)
+	}
+}
+
+func isEmptyJSONValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// jsonValue converts v to the generic form encoding/json decodes into.
+func jsonValue(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(raw, &out)
+	return out, err
+}
+
+// toJSONMap converts a typed object through its JSON form, so fields left out
+// by omitempty stay absent and count as unset.
+func toJSONMap(obj interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	err = json.Unmarshal(raw, &out)
+	return out, err
+}
+
+// fromJSONMap replaces the content of the typed object out with m.
+func fromJSONMap[T any](m map[string]interface{}, out *T) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var fresh T
+	if err := json.Unmarshal(raw, &fresh); err != nil {
+		return err
+	}
+	*out = fresh
+	return nil
+}
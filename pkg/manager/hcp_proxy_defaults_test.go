@@ -0,0 +1,230 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testTrustBundle = "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"
+
+const testDefaults = `
+defaults:
+- name: team-a
+  namespaces: [team-a]
+  labels:
+    cost-center: "1234"
+    org: team-a
+- name: org
+  labels:
+    org: acme
+  annotations:
+    owner: platform
+  nodeSelector:
+    node-role.kubernetes.io/infra: ""
+  tolerations:
+  - key: node-role.kubernetes.io/infra
+    operator: Exists
+  nodePools:
+    nodeLabels:
+      org: acme
+    taints:
+    - key: dedicated
+      value: acme
+      effect: NoSchedule
+  networking:
+    serviceNetwork: [{cidr: 172.31.0.0/16}]
+  etcdStorageClassName: fast-ssd
+  additionalTrustBundle: |
+    -----BEGIN CERTIFICATE-----
+    AAAA
+    -----END CERTIFICATE-----
+`
+
+// defaultsCreateRequest has a caller-set node selector and a managed etcd on
+// persistent volumes without a storage class.
+const defaultsCreateRequest = `{
+  "hostedCluster": {
+    "metadata": {"name": "my-hc", "labels": {"org": "mine"}},
+    "spec": {
+      "nodeSelector": {"zone": "a"},
+      "networking": {"clusterNetwork": [{"cidr": "10.132.0.0/14"}]},
+      "etcd": {"managementType": "Managed", "managed": {"storage": {"type": "PersistentVolume",
+        "persistentVolume": {"size": "8Gi"}}}}
+    }
+  },
+  "nodePools": [{"metadata": {"name": "my-hc-pool"}, "spec": {"nodeLabels": {"tier": "web"}}}]
+}`
+
+func defaultsConfigMap(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: defaultsConfigMapName, Namespace: "multicluster-engine"},
+		Data:       map[string]string{defaultsConfigMapKey: data},
+	}
+}
+
+func Test_parseDefaults_WhenInvalid_ItShouldFail(t *testing.T) {
+	for _, tc := range []struct{ data, err string }{
+		{"defaults:\n- name: a\n  nodeSelectors: {a: b}\n", "unknown field"},
+		{"defaults:\n- name: a\n- name: a\n", "duplicate name"},
+		{"defaults:\n- labels: {a: b}\n", "name is required"},
+		{"defaults:\n- name: a\n  networking:\n    serviceNetwork: [{cidr: 172.31.0.0}]\n", "invalid CIDR"},
+		{"defaults:\n- name: a\n  additionalTrustBundle: not a certificate\n", "not a PEM certificate"},
+	} {
+		_, err := parseDefaults(tc.data)
+		assert.ErrorContains(t, err, tc.err, tc.data)
+	}
+
+	defaults, err := parseDefaults(testDefaults)
+	require.NoError(t, err)
+	assert.Len(t, defaults.Defaults, 2)
+}
+
+func Test_createDefaultsFor_WhenEntriesSelectCreates_ItShouldMatchNamespaceOrHostingCluster(t *testing.T) {
+	p := newTestProxy(t, defaultsConfigMap(`
+defaults:
+- name: team-a
+  namespaces: [team-a]
+- name: spoke-1
+  hostingClusters: [spoke-1]
+- name: everywhere
+`))
+	names := func(hostingCluster, ns string) []string {
+		entries, err := p.createDefaultsFor(context.Background(), hostingCluster, ns)
+		require.NoError(t, err)
+		var out []string
+		for _, entry := range entries {
+			out = append(out, entry.Name)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"team-a", "spoke-1", "everywhere"}, names("spoke-1", "team-a"))
+	assert.Equal(t, []string{"everywhere"}, names("spoke-2", "team-b"))
+}
+
+func Test_applyDefaults_WhenCallerSetFields_ItShouldKeepThem(t *testing.T) {
+	defaults, err := parseDefaults(testDefaults)
+	require.NoError(t, err)
+	var req CreateRequest
+	require.NoError(t, json.Unmarshal([]byte(defaultsCreateRequest), &req))
+
+	warnings, trustBundle, err := applyDefaults(defaults.Defaults, &req)
+	require.NoError(t, err)
+
+	hc := req.HostedCluster
+	assert.Equal(t, map[string]string{"org": "mine", "cost-center": "1234"}, hc.Labels)
+	assert.Equal(t, map[string]string{"owner": "platform"}, hc.Annotations)
+	assert.Equal(t, map[string]string{"zone": "a"}, hc.Spec.NodeSelector)
+	require.Len(t, hc.Spec.Tolerations, 1)
+	assert.Equal(t, "node-role.kubernetes.io/infra", hc.Spec.Tolerations[0].Key)
+	require.Len(t, hc.Spec.Networking.ClusterNetwork, 1)
+	assert.Equal(t, "10.132.0.0/14", hc.Spec.Networking.ClusterNetwork[0].CIDR.String())
+	require.Len(t, hc.Spec.Networking.ServiceNetwork, 1)
+	assert.Equal(t, "172.31.0.0/16", hc.Spec.Networking.ServiceNetwork[0].CIDR.String())
+	require.NotNil(t, hc.Spec.Etcd.Managed.Storage.PersistentVolume.StorageClassName)
+	assert.Equal(t, "fast-ssd", *hc.Spec.Etcd.Managed.Storage.PersistentVolume.StorageClassName)
+	require.NotNil(t, hc.Spec.AdditionalTrustBundle)
+	assert.Equal(t, "my-hc-additional-trust-bundle", hc.Spec.AdditionalTrustBundle.Name)
+
+	np := req.NodePools[0]
+	assert.Equal(t, map[string]string{"cost-center": "1234", "org": "team-a"}, np.Labels)
+	assert.Equal(t, map[string]string{"tier": "web", "org": "acme"}, np.Spec.NodeLabels)
+	require.Len(t, np.Spec.Taints, 1)
+	assert.Equal(t, "dedicated", np.Spec.Taints[0].Key)
+
+	require.NotNil(t, trustBundle)
+	assert.Equal(t, "my-hc-additional-trust-bundle", trustBundle.Name)
+	assert.Equal(t, testTrustBundle, trustBundle.Data[trustBundleConfigMapKey])
+
+	require.Len(t, warnings, 2)
+	assert.Equal(t, `defaults "team-a" set hostedCluster.metadata.labels[cost-center], `+
+		`nodePools[0].metadata.labels[cost-center], nodePools[0].metadata.labels[org]`, warnings[0])
+	assert.NotContains(t, warnings[1], "hostedCluster.spec.nodeSelector")
+	assert.NotContains(t, warnings[1], "clusterNetwork")
+	assert.Contains(t, warnings[1], "hostedCluster.spec.networking.serviceNetwork")
+	assert.Contains(t, warnings[1], "hostedCluster.spec.additionalTrustBundle")
+}
+
+func Test_applyDefaults_WhenEtcdIsNotOnPersistentVolumes_ItShouldNotSetAStorageClass(t *testing.T) {
+	var req CreateRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"hostedCluster": {"metadata": {"name": "my-hc"},
+		"spec": {"etcd": {"managementType": "Unmanaged"}}}}`), &req))
+
+	warnings, trustBundle, err := applyDefaults([]defaultsEntry{{Name: "org", EtcdStorageClassName: "fast-ssd"}}, &req)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Nil(t, trustBundle)
+	assert.Nil(t, req.HostedCluster.Spec.Etcd.Managed)
+}
+
+func Test_handleCreate_WhenDefaultsApply_ItShouldCreateTheTrustBundleAndReportThem(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL,
+		defaultsConfigMap(testDefaults), availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(defaultsCreateRequest))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "team-a", "spoke-1")
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, []string{
+		"POST /spoke-1" + apiPathCoreNamespaces,
+		"POST /spoke-1" + apiPathCoreNamespaces + "/team-a/configmaps",
+		"POST /spoke-1" + apiPathHSNamespaces + "/team-a/hostedclusters",
+		"POST /spoke-1" + apiPathHSNamespaces + "/team-a/nodepools",
+	}, spoke.writes)
+
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	require.Len(t, bundle.Warnings, 2)
+	assert.Contains(t, bundle.Warnings[0], `defaults "team-a" set`)
+	assert.Equal(t, "1234", bundle.HostedCluster.Labels["cost-center"])
+	assert.Equal(t, labelCreatedViaValue, bundle.HostedCluster.Labels[labelCreatedVia])
+}
+
+func Test_handleCreate_WhenDefaultsInvalid_ItShouldFailTheCreate(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL,
+		defaultsConfigMap("defaults: [{name: a, lables: {a: b}}]"), availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(defaultsCreateRequest))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "team-a", "spoke-1")
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid defaults ConfigMap")
+	assert.Empty(t, spoke.writes)
+}
+
+func Test_handleRoute_WhenNodePoolCreatedWithDefaults_ItShouldApplyThemAndWarn(t *testing.T) {
+	spoke := &patchSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusCreated, spokeNodePool).URL,
+		defaultsConfigMap(testDefaults), availableManagedCluster("spoke-1"))
+
+	body := `{"metadata":{"name":"np-1","labels":{"org":"mine"}},"spec":{"clusterName":"my-hc","nodeLabels":{"tier":"web"}}}`
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodPost, "/namespaces/clusters/nodepools?hostingCluster=spoke-1", body))
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, w.Header().Values("Warning"), 1)
+	assert.Contains(t, w.Header().Get("Warning"), `defaults \"org\" set`)
+
+	var sent map[string]interface{}
+	require.NoError(t, json.Unmarshal(spoke.body, &sent))
+	md := sent["metadata"].(map[string]interface{})
+	assert.Equal(t, "mine", md["labels"].(map[string]interface{})["org"])
+	assert.Equal(t, "platform", md["annotations"].(map[string]interface{})["owner"])
+	spec := sent["spec"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"tier": "web", "org": "acme"}, spec["nodeLabels"])
+	assert.Len(t, spec["taints"], 1)
+}
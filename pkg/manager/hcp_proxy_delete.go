@@ -0,0 +1,565 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// subresourceDeletion reports the progress of a DELETE with ?wait=true.
+	subresourceDeletion = "deletion"
+
+	defaultDeleteWaitTimeout = 10 * time.Minute
+	maxDeleteWaitTimeout     = time.Hour
+
+	// deletionRetention is how long finished deletions stay readable.
+	deletionRetention = 24 * time.Hour
+)
+
+// Overridable in tests.
+var (
+	// deletePollInterval is how often the HostedCluster is read while waiting
+	// for its finalizers to complete.
+	deletePollInterval = 5 * time.Second
+)
+
+// namespaceDefaultConfigMaps are the ConfigMaps the cluster puts in every
+// namespace; they do not keep a proxy-created Namespace alive.
+var namespaceDefaultConfigMaps = map[string]bool{
+	"kube-root-ca.crt":         true,
+	"openshift-service-ca.crt": true,
+}
+
+// namespacePlumbing are the namespaced resources, as resource.group, whose
+// objects do not keep a proxy-created Namespace alive: the cluster creates
+// them in every namespace, or, for packagemanifests, lists the catalog in
+// every namespace.
+var namespacePlumbing = map[string]bool{
+	"events":                                 true,
+	"events.events.k8s.io":                   true,
+	"serviceaccounts":                        true,
+	"rolebindings.rbac.authorization.k8s.io": true,
+	"packagemanifests.packages.operators.coreos.com": true,
+}
+
+// hostedClusterDelete holds the options of a HostedCluster DELETE.
+type hostedClusterDelete struct {
+	// query is passed on to the NodePool and HostedCluster DELETEs.
+	query   url.Values
+	wait    bool
+	timeout time.Duration
+	// deleteNamespace opts in to deleting the Namespace after the cleanup.
+	deleteNamespace bool
+}
+
+// DeletionPhase is the step a tracked HostedCluster delete is in.
+type DeletionPhase string
+
+const (
+	DeletionWaitingForFinalizers DeletionPhase = "WaitingForFinalizers"
+	DeletionCleaningUp           DeletionPhase = "CleaningUp"
+	DeletionSucceeded            DeletionPhase = "Succeeded"
+	DeletionFailed               DeletionPhase = "Failed"
+)
+
+// DeletionStatus is the response body of a DELETE with ?wait=true and of GET
+// .../hostedclusters/{name}/deletion.
+type DeletionStatus struct {
+	Namespace      string        `json:"namespace"`
+	Name           string        `json:"name"`
+	HostingCluster string        `json:"hostingCluster"`
+	Phase          DeletionPhase `json:"phase"`
+	// Message is set when the HostedCluster was not gone in time; nothing was cleaned up then.
+	Message        string       `json:"message,omitempty"`
+	StartTime      metav1.Time  `json:"startTime"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Deleted lists, as Kind/name, the HostedCluster and the objects removed after its finalizers completed.
+	Deleted []string `json:"deleted"`
+	// Retained lists the objects the cleanup left in place, with the reason.
+	Retained []string `json:"retained,omitempty"`
+	// CleanupErrors lists objects that could not be deleted and need manual cleanup.
+	CleanupErrors []string `json:"cleanupErrors,omitempty"`
+}
+
+func (s *DeletionStatus) finished() bool {
+	return s.Phase == DeletionSucceeded || s.Phase == DeletionFailed
+}
+
+// deletionTracker holds the deletes with ?wait=true this proxy replica
+// accepted, keyed by hosting cluster, namespace and name. The zero value is
+// ready to use.
+type deletionTracker struct {
+	mu        sync.Mutex
+	deletions map[string]*DeletionStatus
+}
+
+func deletionKey(spokeName, ns, name string) string {
+	return spokeName + "/" + ns + "/" + name
+}
+
+// begin records a new deletion. It returns false if one is already running
+// for the same HostedCluster.
+func (t *deletionTracker) begin(status *DeletionStatus) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.deletions == nil {
+		t.deletions = map[string]*DeletionStatus{}
+	}
+	for key, existing := range t.deletions {
+		if existing.finished() && time.Since(existing.CompletionTime.Time) > deletionRetention {
+			delete(t.deletions, key)
+		}
+	}
+	key := deletionKey(status.HostingCluster, status.Namespace, status.Name)
+	if existing, ok := t.deletions[key]; ok && !existing.finished() {
+		return false
+	}
+	t.deletions[key] = status
+	return true
+}
+
+// get returns a copy of the latest deletion of ns/name on spokeName.
+func (t *deletionTracker) get(spokeName, ns, name string) (DeletionStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status, ok := t.deletions[deletionKey(spokeName, ns, name)]
+	if !ok {
+		return DeletionStatus{}, false
+	}
+	out := *status
+	out.Deleted = append([]string{}, status.Deleted...)
+	out.Retained = append([]string(nil), status.Retained...)
+	out.CleanupErrors = append([]string(nil), status.CleanupErrors...)
+	return out, true
+}
+
+func (t *deletionTracker) update(spokeName, ns, name string, fn func(*DeletionStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if status, ok := t.deletions[deletionKey(spokeName, ns, name)]; ok {
+		fn(status)
+	}
+}
+
+// parseHostedClusterDelete reads ?propagationPolicy=, ?wait= and, with wait,
+// ?timeoutSeconds= and ?deleteNamespace=.
+func parseHostedClusterDelete(r *http.Request) (hostedClusterDelete, error) {
+	opts := hostedClusterDelete{query: url.Values{}}
+	if policy := r.URL.Query().Get("propagationPolicy"); policy != "" {
+		switch metav1.DeletionPropagation(policy) {
+		case metav1.DeletePropagationOrphan, metav1.DeletePropagationBackground, metav1.DeletePropagationForeground:
+		default:
+			return opts, fmt.Errorf("invalid propagationPolicy value %q", policy)
+		}
+		opts.query.Set("propagationPolicy", policy)
+	}
+	if raw := r.URL.Query().Get("wait"); raw != "" {
+		wait, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid wait value %q", raw)
+		}
+		opts.wait = wait
+	}
+	if raw := r.URL.Query().Get("deleteNamespace"); raw != "" {
+		deleteNamespace, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid deleteNamespace value %q", raw)
+		}
+		opts.deleteNamespace = deleteNamespace
+	}
+	if !opts.wait {
+		if opts.deleteNamespace {
+			return opts, errors.New("deleteNamespace requires wait=true")
+		}
+		return opts, nil
+	}
+	timeout, err := parseTimeoutSeconds(r, defaultDeleteWaitTimeout, maxDeleteWaitTimeout)
+	if err != nil {
+		return opts, err
+	}
+	opts.timeout = timeout
+	return opts, nil
+}
+
+// trackDeletion answers a DELETE with ?wait=true whose HostedCluster delete
+// the spoke accepted: 202 with a DeletionStatus, while the wait and the
+// cleanup run in the background, detached from the request. kube-apiserver
+// does not treat a DELETE as long-running and would cut the request off long
+// before the finalizers of a HostedCluster complete. A repeated DELETE while
+// the deletion runs gets its current status.
+func (p *hcpProxy) trackDeletion(
+	w http.ResponseWriter,
+	r *http.Request,
+	hcpClient *http.Client,
+	ns, name, spokeName string,
+	opts hostedClusterDelete,
+) {
+	now := metav1.Now()
+	status := &DeletionStatus{
+		Namespace:      ns,
+		Name:           name,
+		HostingCluster: spokeName,
+		Phase:          DeletionWaitingForFinalizers,
+		StartTime:      now,
+		Deleted:        []string{},
+	}
+	if p.deletions.begin(status) {
+		go p.waitAndCleanUp(context.WithoutCancel(r.Context()), hcpClient, ns, name, spokeName, opts)
+	}
+	snapshot, _ := p.deletions.get(spokeName, ns, name)
+
+	w.Header().Set("Location", r.URL.Path+"/"+subresourceDeletion+"?hostingCluster="+url.QueryEscape(spokeName))
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(snapshot)
+}
+
+// handleDeletion serves GET .../hostedclusters/{name}/deletion: the status of
+// the latest DELETE with ?wait=true accepted by this replica.
+func (p *hcpProxy) handleDeletion(w http.ResponseWriter, ns, name, spokeName string) {
+	status, ok := p.deletions.get(spokeName, ns, name)
+	if !ok {
+		writeJSONError(w, "no deletion of HostedCluster "+name+" is recorded", http.StatusNotFound)
+		return
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// waitAndCleanUp waits for the deleted HostedCluster to be gone, then cleans
+// up after it. The deletion fails, with nothing cleaned up, if the
+// HostedCluster is still there when opts.timeout passes; it succeeds once the
+// HostedCluster is gone, even if some cleanup failed (see CleanupErrors).
+func (p *hcpProxy) waitAndCleanUp(
+	ctx context.Context,
+	hcpClient *http.Client,
+	ns, name, spokeName string,
+	opts hostedClusterDelete,
+) {
+	if err := p.waitForHostedClusterGone(ctx, hcpClient, ns, name, spokeName, opts.timeout); err != nil {
+		p.finishDeletion(spokeName, ns, name, DeletionFailed, err.Error(), nil)
+		return
+	}
+	p.deletions.update(spokeName, ns, name, func(s *DeletionStatus) {
+		s.Phase = DeletionCleaningUp
+		s.Deleted = append(s.Deleted, "HostedCluster/"+name)
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, rollbackTimeout)
+	defer cancel()
+	report := &DeletionStatus{}
+	p.cleanUpAfterDelete(ctx, hcpClient, ns, name, spokeName, opts.deleteNamespace, report)
+	p.log.Info("cleaned up after HostedCluster delete",
+		"name", name, "namespace", ns, "spoke", spokeName,
+		"deleted", len(report.Deleted)+1, "retained", len(report.Retained), "cleanupErrors", len(report.CleanupErrors))
+	p.finishDeletion(spokeName, ns, name, DeletionSucceeded, "", report)
+}
+
+// finishDeletion records the outcome of a deletion and what its cleanup did.
+func (p *hcpProxy) finishDeletion(spokeName, ns, name string, phase DeletionPhase, msg string, report *DeletionStatus) {
+	now := metav1.Now()
+	p.deletions.update(spokeName, ns, name, func(s *DeletionStatus) {
+		s.Phase = phase
+		s.Message = msg
+		s.CompletionTime = &now
+		if report != nil {
+			s.Deleted = append(s.Deleted, report.Deleted...)
+			s.Retained = report.Retained
+			s.CleanupErrors = report.CleanupErrors
+		}
+	})
+}
+
+// waitForHostedClusterGone polls the HostedCluster until the spoke no longer
+// has it, i.e. its finalizers have completed, or timeout passes.
+func (p *hcpProxy) waitForHostedClusterGone(
+	ctx context.Context,
+	hcpClient *http.Client,
+	ns, name, spokeName string,
+	timeout time.Duration,
+) error {
+	hcPath, err := hsNamedAPIPath(ns, resourceHostedClusters, name)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	lastMessage := ""
+	for {
+		hc := &metav1.PartialObjectMetadata{}
+		err := p.getFromSpoke(ctx, hcpClient, spokeName, hcPath, nil, hc)
+		var statusErr *spokeStatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound:
+			return nil
+		case ctx.Err() != nil:
+			// Keep the last answer of the spoke rather than the timeout.
+		case err != nil:
+			lastMessage = err.Error()
+		default:
+			lastMessage = "finalizers pending: " + strings.Join(hc.Finalizers, ", ")
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the HostedCluster was not deleted within %s: %s", timeout, lastMessage)
+		case <-time.After(deletePollInterval):
+		}
+	}
+}
+
+// cleanUpAfterDelete removes the Secrets and ConfigMaps labeled as created by
+// the proxy for the HostedCluster. With deleteNamespace it then removes the
+// Namespace too, if the proxy created it for the HostedCluster and it holds
+// nothing else (see namespaceContents).
+//
+// A create updates an existing Secret with the labels of the latest
+// HostedCluster, so objects another HostedCluster in the namespace still
+// references are kept whatever their labels say.
+func (p *hcpProxy) cleanUpAfterDelete(
+	ctx context.Context,
+	hcpClient *http.Client,
+	ns, name, spokeName string,
+	deleteNamespace bool,
+	report *DeletionStatus,
+) {
+	shared, err := p.referencesOfOtherClusters(ctx, hcpClient, ns, name, spokeName)
+	if err != nil {
+		report.CleanupErrors = append(report.CleanupErrors,
+			fmt.Sprintf("reading the other HostedClusters in the namespace: %v", err))
+		return
+	}
+	selector := labelCreatedVia + "=" + labelCreatedViaValue + "," + labelHostedCluster + "=" + name
+	for _, res := range []struct{ kind, resource string }{
+		{kindSecret, resourceSecrets},
+		{kindConfigMap, resourceConfigMaps},
+	} {
+		objects, err := p.listMetadataOnSpoke(ctx, hcpClient, spokeName, ns, res.resource, selector)
+		if err != nil {
+			report.CleanupErrors = append(report.CleanupErrors, fmt.Sprintf("listing %s: %v", res.resource, err))
+			continue
+		}
+		for i := range objects {
+			ref := corev1.TypedLocalObjectReference{Kind: res.kind, Name: objects[i].Name}
+			if other, ok := shared[ref]; ok {
+				report.Retained = append(report.Retained,
+					fmt.Sprintf("%s/%s: referenced by HostedCluster/%s", res.kind, objects[i].Name, other))
+				continue
+			}
+			p.cleanUp(ctx, hcpClient, spokeName, ns, name, report, createdResource{
+				kind: res.kind, resource: res.resource, name: objects[i].Name, uid: objects[i].UID,
+			})
+		}
+	}
+
+	if !deleteNamespace {
+		return
+	}
+	namespace, err := p.fetchNamespace(ctx, hcpClient, ns, spokeName)
+	if err != nil {
+		report.CleanupErrors = append(report.CleanupErrors, fmt.Sprintf("Namespace/%s: %v", ns, err))
+		return
+	}
+	if namespace == nil {
+		return
+	}
+	if namespace.Labels[labelCreatedVia] != labelCreatedViaValue || namespace.Labels[labelHostedCluster] != name {
+		report.Retained = append(report.Retained, "Namespace/"+ns+": not created by the proxy for "+name)
+		return
+	}
+	left, err := p.namespaceContents(ctx, hcpClient, ns, spokeName)
+	if err != nil {
+		report.CleanupErrors = append(report.CleanupErrors, fmt.Sprintf("Namespace/%s: %v", ns, err))
+		return
+	}
+	if len(left) > 0 {
+		report.Retained = append(report.Retained, "Namespace/"+ns+": still holds "+strings.Join(left, ", "))
+		return
+	}
+	p.cleanUp(ctx, hcpClient, spokeName, ns, name, report, createdResource{
+		kind: "Namespace", resource: "namespaces", name: ns, uid: namespace.UID,
+	})
+}
+
+// cleanUp deletes one object left behind by a deleted HostedCluster and
+// records the result.
+func (p *hcpProxy) cleanUp(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, ns, hcName string,
+	report *DeletionStatus,
+	res createdResource,
+) {
+	if err := p.deleteCreatedResource(ctx, hcpClient, spokeName, ns, hcName, res); err != nil {
+		p.log.Error(err, "cleanup failed", "resource", res.String(), "spoke", spokeName)
+		report.CleanupErrors = append(report.CleanupErrors, fmt.Sprintf("%s: %v", res, err))
+		return
+	}
+	report.Deleted = append(report.Deleted, res.String())
+}
+
+// namespaceContents returns, as Kind/name, the objects left in ns, of every
+// namespaced resource the spoke serves and can list. It leaves out objects
+// owned by another object (reported through their owner), the
+// namespacePlumbing, and the service account Secrets and CA ConfigMaps the
+// cluster puts in every namespace. A resource it cannot list is an error, so
+// a Namespace is never deleted unchecked.
+func (p *hcpProxy) namespaceContents(
+	ctx context.Context,
+	hcpClient *http.Client,
+	ns, spokeName string,
+) ([]string, error) {
+	resources, err := p.namespacedResources(ctx, hcpClient, spokeName)
+	if err != nil {
+		return nil, err
+	}
+	var left []string
+	for _, res := range resources {
+		apiPath, err := namespacedCollectionAPIPath(res.groupVersion, ns, res.resource)
+		if err != nil {
+			return nil, err
+		}
+		list := &metav1.PartialObjectMetadataList{}
+		if err := p.getFromSpoke(ctx, hcpClient, spokeName, apiPath, nil, list); err != nil {
+			return nil, fmt.Errorf("listing %s: %w", res.qualifiedResource(), err)
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			switch {
+			case len(obj.OwnerReferences) > 0:
+			case res.kind == kindSecret && obj.Annotations[corev1.ServiceAccountNameKey] != "":
+			case res.kind == kindConfigMap && res.groupVersion == "v1" && namespaceDefaultConfigMaps[obj.Name]:
+			default:
+				left = append(left, res.kind+"/"+obj.Name)
+			}
+		}
+	}
+	return left, nil
+}
+
+// discoveredResource is a namespaced resource served by a spoke.
+type discoveredResource struct {
+	groupVersion string // "v1" for the core group
+	resource     string
+	kind         string
+}
+
+// qualifiedResource is resource.group, or resource for the core group.
+func (r discoveredResource) qualifiedResource() string {
+	group, _, found := strings.Cut(r.groupVersion, "/")
+	if !found {
+		return r.resource
+	}
+	return r.resource + "." + group
+}
+
+// namespacedResources discovers the namespaced resources the spoke can list,
+// in the preferred version of each group, leaving out subresources and the
+// namespacePlumbing.
+func (p *hcpProxy) namespacedResources(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName string,
+) ([]discoveredResource, error) {
+	groupVersions := []string{"v1"}
+	groups := &metav1.APIGroupList{}
+	if err := p.getFromSpoke(ctx, hcpClient, spokeName, "/apis", nil, groups); err != nil {
+		return nil, fmt.Errorf("discovering API groups: %w", err)
+	}
+	for _, g := range groups.Groups {
+		if g.PreferredVersion.GroupVersion != "" {
+			groupVersions = append(groupVersions, g.PreferredVersion.GroupVersion)
+		}
+	}
+
+	var out []discoveredResource
+	for _, gv := range groupVersions {
+		apiPath, err := groupVersionAPIPath(gv)
+		if err != nil {
+			return nil, err
+		}
+		list := &metav1.APIResourceList{}
+		if err := p.getFromSpoke(ctx, hcpClient, spokeName, apiPath, nil, list); err != nil {
+			return nil, fmt.Errorf("discovering the resources of %s: %w", gv, err)
+		}
+		for _, res := range list.APIResources {
+			if !res.Namespaced || strings.Contains(res.Name, "/") || !slices.Contains(res.Verbs, "list") {
+				continue
+			}
+			dr := discoveredResource{groupVersion: gv, resource: res.Name, kind: res.Kind}
+			if !namespacePlumbing[dr.qualifiedResource()] {
+				out = append(out, dr)
+			}
+		}
+	}
+	return out, nil
+}
+
+// groupVersionAPIPath is the discovery path of a group version, e.g. "v1" or
+// "hypershift.openshift.io/v1beta1", as read from the spoke.
+func groupVersionAPIPath(groupVersion string) (string, error) {
+	if groupVersion == "v1" {
+		return "/api/v1", nil
+	}
+	group, version, found := strings.Cut(groupVersion, "/")
+	if !found {
+		return "", fmt.Errorf("invalid group version %q", groupVersion)
+	}
+	if _, err := sanitizeProxyName(group); err != nil {
+		return "", fmt.Errorf("invalid group %q: %w", group, err)
+	}
+	if _, err := sanitizeProxyName(version); err != nil {
+		return "", fmt.Errorf("invalid version %q: %w", version, err)
+	}
+	return apiPathPrefix + group + "/" + version, nil
+}
+
+// namespacedCollectionAPIPath is the collection path of a discovered
+// namespaced resource in ns.
+func namespacedCollectionAPIPath(groupVersion, ns, resource string) (string, error) {
+	base, err := groupVersionAPIPath(groupVersion)
+	if err != nil {
+		return "", err
+	}
+	if _, err := sanitizeProxyName(resource); err != nil {
+		return "", fmt.Errorf("invalid resource %q: %w", resource, err)
+	}
+	ns, err = sanitizeProxyName(ns)
+	if err != nil {
+		return "", err
+	}
+	return base + "/namespaces/" + ns + "/" + resource, nil
+}
+
+// listMetadataOnSpoke lists the metadata of a namespaced resource on the
+// spoke, filtered by selector when it is set.
+func (p *hcpProxy) listMetadataOnSpoke(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, ns, resource, selector string,
+) ([]metav1.PartialObjectMetadata, error) {
+	apiPath, err := hsCollectionAPIPath(ns, resource)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if selector != "" {
+		query.Set("labelSelector", selector)
+	}
+	list := &metav1.PartialObjectMetadataList{}
+	if err := p.getFromSpoke(ctx, hcpClient, spokeName, apiPath, query, list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
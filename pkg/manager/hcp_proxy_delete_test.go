@@ -0,0 +1,276 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deleteNamespacePath = "/spoke-1" + apiPathCoreNamespaces + "/clusters"
+
+func setFastDeletePoll(t *testing.T) {
+	t.Helper()
+	old := deletePollInterval
+	deletePollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { deletePollInterval = old })
+}
+
+func deleteRequest(query string) *http.Request {
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc?hostingCluster=spoke-1" + query
+	r := httptest.NewRequest(http.MethodDelete, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+// waitForDeletion polls GET .../deletion until the deletion finishes.
+func waitForDeletion(t *testing.T, p *hcpProxy) DeletionStatus {
+	t.Helper()
+	var status DeletionStatus
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, apiPathPrefix+hcpProxyGroupVersion+
+			"/namespaces/clusters/hostedclusters/my-hc/deletion?hostingCluster=spoke-1", nil)
+		r.Header.Set("X-Remote-User", "alice")
+		p.handleRoute(w, r)
+		if w.Code != http.StatusOK {
+			return false
+		}
+		status = DeletionStatus{}
+		return json.Unmarshal(w.Body.Bytes(), &status) == nil && status.finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return status
+}
+
+// acceptDelete sends a DELETE with query and checks it was accepted.
+func acceptDelete(t *testing.T, p *hcpProxy, query string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	p.handleRoute(w, deleteRequest(query))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.Equal(t, apiPathPrefix+hcpProxyGroupVersion+
+		"/namespaces/clusters/hostedclusters/my-hc/deletion?hostingCluster=spoke-1", w.Header().Get("Location"))
+}
+
+// seedDiscovery serves the discovery documents of spoke-1: core Secrets,
+// ConfigMaps, PVCs, Pods, Events and ServiceAccounts, and the hypershift
+// resources.
+func seedDiscovery(s *migrationSpoke) {
+	resource := func(name, kind string, namespaced bool) map[string]interface{} {
+		return map[string]interface{}{"name": name, "kind": kind, "namespaced": namespaced,
+			"verbs": []interface{}{"get", "list", "delete"}}
+	}
+	s.put("/spoke-1/api/v1", map[string]interface{}{"groupVersion": "v1", "resources": []interface{}{
+		resource("namespaces", "Namespace", false),
+		resource(resourceSecrets, kindSecret, true),
+		resource(resourceConfigMaps, kindConfigMap, true),
+		resource("persistentvolumeclaims", "PersistentVolumeClaim", true),
+		resource("pods", "Pod", true),
+		resource("pods/log", "Pod", true),
+		resource("events", "Event", true),
+		resource("serviceaccounts", "ServiceAccount", true),
+	}})
+	s.put("/spoke-1/apis", map[string]interface{}{"groups": []interface{}{
+		map[string]interface{}{"name": "hypershift.openshift.io", "preferredVersion": map[string]interface{}{
+			"groupVersion": "hypershift.openshift.io/v1beta1", "version": "v1beta1",
+		}},
+	}})
+	s.put("/spoke-1"+apiPathHSGroupVersion, map[string]interface{}{
+		"groupVersion": "hypershift.openshift.io/v1beta1", "resources": []interface{}{
+			resource(resourceHostedClusters, "HostedCluster", true),
+			resource(resourceNodePools, "NodePool", true),
+		}})
+}
+
+// seedProxyCreated puts an object carrying the labels handleCreate stamps on spoke-1.
+func seedProxyCreated(s *migrationSpoke, path, kind, name string) {
+	s.put(path, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata": map[string]interface{}{"name": name, "namespace": "clusters", "labels": map[string]interface{}{
+			labelCreatedVia: labelCreatedViaValue, labelHostedCluster: "my-hc",
+		}},
+	})
+}
+
+func Test_handleDelete_WhenWaitRequested_ItShouldCleanUpWhatTheProxyCreated(t *testing.T) {
+	setFastDeletePoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	seedProxyCreated(spoke, deleteNamespacePath, "Namespace", "clusters")
+	proxyConfigMap := deleteNamespacePath + "/configmaps/user-ca-bundle"
+	seedProxyCreated(spoke, migrateSecretPath, kindSecret, "my-hc-pull-secret")
+	seedProxyCreated(spoke, proxyConfigMap, kindConfigMap, "user-ca-bundle")
+	spoke.put(deleteNamespacePath+"/configmaps/kube-root-ca.crt", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "kube-root-ca.crt"},
+	})
+	spoke.put(deleteNamespacePath+"/secrets/default-token", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "default-token", "annotations": map[string]interface{}{
+			"kubernetes.io/service-account.name": "default",
+		}},
+	})
+	seedDiscovery(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	acceptDelete(t, p, "&wait=true&deleteNamespace=true")
+
+	report := waitForDeletion(t, p)
+	assert.Equal(t, DeletionSucceeded, report.Phase)
+	assert.Equal(t, []string{
+		"HostedCluster/my-hc",
+		"Secret/my-hc-pull-secret",
+		"ConfigMap/user-ca-bundle",
+		"Namespace/clusters",
+	}, report.Deleted)
+	assert.Empty(t, report.Retained)
+	assert.Empty(t, report.CleanupErrors)
+	assert.False(t, spoke.has(migrateNPPath))
+	assert.False(t, spoke.has(proxyConfigMap))
+	assert.False(t, spoke.has(deleteNamespacePath))
+}
+
+func Test_handleDelete_WhenNamespaceHoldsOtherObjects_ItShouldRetainIt(t *testing.T) {
+	setFastDeletePoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	seedDiscovery(spoke)
+	seedProxyCreated(spoke, deleteNamespacePath, "Namespace", "clusters")
+	seedProxyCreated(spoke, migrateSecretPath, kindSecret, "my-hc-pull-secret")
+	spoke.put(deleteNamespacePath+"/persistentvolumeclaims/data", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "data"},
+	})
+	spoke.put(deleteNamespacePath+"/pods/web-1", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web-1", "ownerReferences": []interface{}{
+			map[string]interface{}{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "web", "uid": "rs-1"},
+		}},
+	})
+	spoke.put(deleteNamespacePath+"/events/web-1.1", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web-1.1"},
+	})
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	acceptDelete(t, p, "&wait=true&deleteNamespace=true")
+
+	report := waitForDeletion(t, p)
+	assert.Equal(t, []string{"HostedCluster/my-hc", "Secret/my-hc-pull-secret"}, report.Deleted)
+	assert.Equal(t, []string{"Namespace/clusters: still holds PersistentVolumeClaim/data"}, report.Retained,
+		"owned objects and events do not count")
+	assert.True(t, spoke.has(deleteNamespacePath))
+}
+
+func Test_handleDelete_WhenAResourceCannotBeDiscovered_ItShouldKeepTheNamespace(t *testing.T) {
+	setFastDeletePoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	seedDiscovery(spoke)
+	spoke.put("/spoke-1/apis", map[string]interface{}{"groups": []interface{}{
+		map[string]interface{}{"name": "metrics.k8s.io", "preferredVersion": map[string]interface{}{
+			"groupVersion": "metrics.k8s.io/v1beta1", "version": "v1beta1",
+		}},
+	}})
+	seedProxyCreated(spoke, deleteNamespacePath, "Namespace", "clusters")
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	acceptDelete(t, p, "&wait=true&deleteNamespace=true")
+
+	report := waitForDeletion(t, p)
+	assert.Equal(t, DeletionSucceeded, report.Phase)
+	require.Len(t, report.CleanupErrors, 1)
+	assert.Contains(t, report.CleanupErrors[0], "discovering the resources of metrics.k8s.io/v1beta1")
+	assert.True(t, spoke.has(deleteNamespacePath))
+}
+
+func Test_handleDelete_WhenDeleteNamespaceNotRequested_ItShouldKeepTheNamespace(t *testing.T) {
+	setFastDeletePoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	seedProxyCreated(spoke, deleteNamespacePath, "Namespace", "clusters")
+	seedProxyCreated(spoke, migrateSecretPath, kindSecret, "my-hc-pull-secret")
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	acceptDelete(t, p, "&wait=true")
+
+	report := waitForDeletion(t, p)
+	assert.Equal(t, []string{"HostedCluster/my-hc", "Secret/my-hc-pull-secret"}, report.Deleted)
+	assert.True(t, spoke.has(deleteNamespacePath))
+}
+
+func Test_handleDelete_WhenAnotherClusterReferencesASecret_ItShouldRetainIt(t *testing.T) {
+	setFastDeletePoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	seedProxyCreated(spoke, migrateSecretPath, kindSecret, "my-hc-pull-secret")
+	spoke.put("/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters/older-hc", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "older-hc", "namespace": "clusters"},
+		"spec":     map[string]interface{}{"pullSecret": map[string]interface{}{"name": "my-hc-pull-secret"}},
+	})
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	acceptDelete(t, p, "&wait=true")
+
+	report := waitForDeletion(t, p)
+	assert.Equal(t, []string{"HostedCluster/my-hc"}, report.Deleted)
+	assert.Equal(t, []string{"Secret/my-hc-pull-secret: referenced by HostedCluster/older-hc"}, report.Retained)
+	assert.True(t, spoke.has(migrateSecretPath))
+}
+
+func Test_handleDelete_WhenFinalizersDoNotComplete_ItShouldFailAndCleanNothing(t *testing.T) {
+	setFastDeletePoll(t)
+	var mu sync.Mutex
+	var deletes []string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		switch {
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			deletes = append(deletes, r.URL.Path+"?"+r.URL.RawQuery)
+			mu.Unlock()
+			_, _ = io.WriteString(w, `{}`)
+		case strings.HasSuffix(r.URL.Path, "/nodepools"):
+			_, _ = io.WriteString(w, `{"items": [{"metadata": {"name": "my-hc-pool"}, "spec": {"clusterName": "my-hc"}}]}`)
+		default:
+			_, _ = io.WriteString(w, `{"metadata": {"name": "my-hc", "finalizers": ["hypershift.openshift.io/finalizer"]}}`)
+		}
+	}))
+	defer spokeSrv.Close()
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, availableManagedCluster("spoke-1"))
+
+	acceptDelete(t, p, "&wait=true&timeoutSeconds=1&propagationPolicy=Foreground")
+
+	report := waitForDeletion(t, p)
+	assert.Equal(t, DeletionFailed, report.Phase)
+	assert.Empty(t, report.Deleted)
+	assert.Contains(t, report.Message, "finalizers pending: hypershift.openshift.io/finalizer")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"/spoke-1" + apiPathHSNamespaces + "/clusters/nodepools/my-hc-pool?propagationPolicy=Foreground",
+		"/spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters/my-hc?propagationPolicy=Foreground",
+	}, deletes, "only the NodePools and the HostedCluster are deleted")
+}
+
+func Test_parseHostedClusterDelete_WhenInvalid_ItShouldFail(t *testing.T) {
+	for _, query := range []string{
+		"&propagationPolicy=Sometimes",
+		"&wait=maybe",
+		"&wait=true&timeoutSeconds=0",
+		"&wait=true&timeoutSeconds=7200",
+		"&wait=true&deleteNamespace=maybe",
+		"&deleteNamespace=true",
+	} {
+		_, err := parseHostedClusterDelete(deleteRequest(query))
+		assert.Error(t, err, query)
+	}
+
+	opts, err := parseHostedClusterDelete(deleteRequest("&timeoutSeconds=0"))
+	require.NoError(t, err, "timeoutSeconds only applies with wait")
+	assert.False(t, opts.wait)
+	assert.Empty(t, opts.query)
+}
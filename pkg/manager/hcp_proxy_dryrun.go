@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// dryRunAll is the only dryRun value the Kubernetes API accepts.
+const dryRunAll = "All"
+
+// parseDryRun reports whether the caller asked for ?dryRun=All. Any other
+// non-empty value is rejected, matching the kube-apiserver.
+func parseDryRun(r *http.Request) (bool, error) {
+	switch v := r.URL.Query().Get("dryRun"); v {
+	case "":
+		return false, nil
+	case dryRunAll:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid dryRun value %q: only %q is supported", v, dryRunAll)
+	}
+}
+
+// withDryRun returns a copy of c whose mutating requests carry dryRun=All, so
+// the spoke runs validation and admission without persisting anything.
+func withDryRun(c *http.Client) *http.Client {
+	out := *c
+	rt := c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	out.Transport = &dryRunTransport{wrapped: rt}
+	return &out
+}
+
+// dryRunTransport adds dryRun=All to every POST/PUT/PATCH/DELETE.
+type dryRunTransport struct {
+	wrapped http.RoundTripper
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		req = req.Clone(req.Context())
+		q := req.URL.Query()
+		q.Set("dryRun", dryRunAll)
+		req.URL.RawQuery = q.Encode()
+	}
+	return t.wrapped.RoundTrip(req)
+}
+
+// writeDryRunResult responds to a dry-run create or update with the would-be
+// bundle. Any step the spoke rejected is listed in bundle.Errors and turns the
+// response into a 422 so pipelines can gate on the status code alone.
+func writeDryRunResult(w http.ResponseWriter, bundle *ResourceBundle, errs []string) {
+	bundle.Errors = errs
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusUnprocessableEntity
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(bundle)
+}
@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dryRunSpoke serves an existing "clusters" namespace and answers writes with
+// 201, or with 422 for paths containing rejectPath. It records the dryRun
+// query value of every write.
+type dryRunSpoke struct {
+	mu           sync.Mutex
+	writes       []string
+	dryRunValues []string
+}
+
+func (s *dryRunSpoke) server(t *testing.T, namespaceExists bool, rejectPath string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		if r.Method == http.MethodGet {
+			if namespaceExists {
+				_, _ = io.WriteString(w, `{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"clusters"}}`)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.mu.Lock()
+		s.writes = append(s.writes, r.Method+" "+r.URL.Path)
+		s.dryRunValues = append(s.dryRunValues, r.URL.Query().Get("dryRun"))
+		s.mu.Unlock()
+		if rejectPath != "" && strings.Contains(r.URL.Path, rejectPath) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = io.WriteString(w, `{"kind":"Status","message":"admission webhook denied the request"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"metadata":{"uid":"would-be-uid"}}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dryRunCreateBody(t *testing.T) []byte {
+	t.Helper()
+	body, err := json.Marshal(CreateRequest{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-hc"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				PullSecret: corev1.LocalObjectReference{Name: "my-hc-pull-secret"},
+			},
+		},
+		NodePools: []*hypershiftv1beta1.NodePool{
+			{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool"}},
+		},
+		Secrets: []corev1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pull-secret"}},
+		},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+func Test_handleCreate_WhenDryRun_ItShouldSendEveryStepWithDryRun(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?dryRun=All", bytes.NewReader(dryRunCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	// namespace + secret + hostedcluster + nodepool
+	require.Len(t, spoke.writes, 4)
+	for _, v := range spoke.dryRunValues {
+		assert.Equal(t, dryRunAll, v)
+	}
+
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	assert.Empty(t, bundle.Errors)
+	require.NotNil(t, bundle.HostedCluster)
+	assert.Equal(t, "would-be-uid", string(bundle.HostedCluster.UID))
+	assert.Equal(t, labelCreatedViaValue, bundle.HostedCluster.Labels[labelCreatedVia])
+	require.Len(t, bundle.NodePools, 1)
+	assert.Equal(t, "my-hc", bundle.NodePools[0].Spec.ClusterName)
+}
+
+func Test_handleCreate_WhenDryRunRejected_ItShouldReportAllErrorsWith422(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "/hostedclusters").URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?dryRun=All", bytes.NewReader(dryRunCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	// The NodePool is still validated after the HostedCluster is rejected.
+	assert.Len(t, spoke.writes, 4)
+
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	require.Len(t, bundle.Errors, 1)
+	assert.Contains(t, bundle.Errors[0], "admission webhook denied")
+}
+
+func Test_handleCreate_WhenDryRunAndNamespaceMissing_ItShouldOnlyValidateNamespace(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, false, "").URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?dryRun=All", bytes.NewReader(dryRunCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"POST /spoke-1" + apiPathCoreNamespaces}, spoke.writes)
+
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	require.Len(t, bundle.Warnings, 1)
+	assert.Contains(t, bundle.Warnings[0], "were not validated")
+}
+
+func Test_handleCreate_WhenDryRunAndNamespaceUnreadable_ItShouldReturnTheSpokeError(t *testing.T) {
+	var writes int
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		if r.Method != http.MethodGet {
+			writes++
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden",`+
+			`"message":"namespaces \"clusters\" is forbidden","code":403}`)
+	}))
+	defer spokeSrv.Close()
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?dryRun=All", bytes.NewReader(dryRunCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "failed to read namespace")
+	assert.Zero(t, writes, "a namespace that cannot be read is not taken as missing")
+}
+
+func Test_handleCreate_WhenDryRunValueInvalid_ItShouldReturn400(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?dryRun=true", bytes.NewReader(dryRunCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_handlePatchResources_WhenDryRun_ItShouldReturnSubmittedBundle(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "/nodepools/").URL)
+
+	body, _ := json.Marshal(ResourceBundle{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc"}},
+		NodePools:     []hypershiftv1beta1.NodePool{{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool"}}},
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/?dryRun=All", bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handlePatchResources(w, r, "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, []string{dryRunAll, dryRunAll}, spoke.dryRunValues)
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	require.NotNil(t, bundle.HostedCluster)
+	assert.Equal(t, "would-be-uid", string(bundle.HostedCluster.UID))
+	require.Len(t, bundle.Errors, 1)
+	assert.Contains(t, bundle.Errors[0], "my-hc-pool")
+}
+
+func Test_dryRunTransport_WhenGET_ItShouldNotAddDryRun(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+	}))
+	defer srv.Close()
+
+	c := withDryRun(&http.Client{})
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"?a=b", nil)
+	require.NoError(t, err)
+	resp, err := c.Transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "a=b", query)
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	subresourceKubeconfig = "kubeconfig"
+
+	// queryRewriteCA=true replaces certificate-authority-data with the
+	// HostedCluster's named serving certificate, as the agent does for the
+	// admin kubeconfig it mirrors to the hub.
+	queryRewriteCA = "rewriteCA"
+
+	contentTypeYAML = "application/yaml"
+)
+
+// handleKubeconfig returns the admin kubeconfig of a HostedCluster. The
+// HostedCluster, the Secret named in status.kubeconfig and, with rewriteCA,
+// the serving certificate Secret are all read on the hosting cluster under the
+// caller's identity, so the caller needs read access to Secrets in the
+// HostedCluster namespace there.
+//
+// The body is the kubeconfig file itself. Every attempt is recorded by
+// auditMiddleware.
+func (p *hcpProxy) handleKubeconfig(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	username, groups := whoIsTheCaller(r)
+
+	rewriteCA := false
+	if raw := r.URL.Query().Get(queryRewriteCA); raw != "" {
+		var err error
+		if rewriteCA, err = strconv.ParseBool(raw); err != nil {
+			writeJSONError(w, fmt.Sprintf("invalid %s value %q", queryRewriteCA, raw), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+
+	hc, code, msg := p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
+	if hc == nil {
+		writeJSONError(w, msg, code)
+		return
+	}
+	if hc.Status.KubeConfig == nil || hc.Status.KubeConfig.Name == "" {
+		writeJSONError(w, "the kubeconfig of HostedCluster "+name+" is not available yet", http.StatusNotFound)
+		return
+	}
+
+	secret, code, msg := p.fetchSpokeSecret(ctx, hcpClient, spokeName, ns, hc.Status.KubeConfig.Name)
+	if secret == nil {
+		writeJSONError(w, msg, code)
+		return
+	}
+	kubeconfig := secret.Data["kubeconfig"]
+	if len(kubeconfig) == 0 {
+		writeJSONError(w, "secret "+secret.Name+" has no kubeconfig key", http.StatusBadGateway)
+		return
+	}
+
+	if rewriteCA {
+		certName := util.GetServingCertName(hc)
+		if certName == "" {
+			writeJSONError(w, "HostedCluster "+name+" has no named serving certificate to rewrite the CA with", http.StatusBadRequest)
+			return
+		}
+		cert, code, msg := p.fetchSpokeSecret(ctx, hcpClient, spokeName, ns, certName)
+		if cert == nil {
+			writeJSONError(w, msg, code)
+			return
+		}
+		if kubeconfig, err = util.ReplaceCertAuthDataInKubeConfig(kubeconfig, cert.Data["tls.crt"]); err != nil {
+			writeJSONError(w, "failed to rewrite certificate-authority-data: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set(headerContentType, contentTypeYAML)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = w.Write(kubeconfig)
+}
+
+// fetchSpokeSecret reads one Secret on the spoke. On failure it returns nil with
+// the HTTP status and message to answer with.
+func (p *hcpProxy) fetchSpokeSecret(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, ns, name string,
+) (*corev1.Secret, int, string) {
+	apiPath, err := hsNamedAPIPath(ns, resourceSecrets, name)
+	if err != nil {
+		return nil, http.StatusBadRequest, err.Error()
+	}
+	req, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "failed to build spoke request: " + err.Error()
+	}
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return nil, http.StatusBadGateway, "spoke request failed: " + err.Error()
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, http.StatusNotFound, "secret " + name + " not found"
+	case http.StatusForbidden:
+		return nil, http.StatusForbidden, "not allowed to read secret " + name + " on the hosting cluster"
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, http.StatusBadGateway, fmt.Sprintf("spoke returned %d: %s", resp.StatusCode, string(body))
+	}
+	var secret corev1.Secret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, http.StatusInternalServerError, "failed to decode secret: " + err.Error()
+	}
+	return &secret, http.StatusOK, ""
+}
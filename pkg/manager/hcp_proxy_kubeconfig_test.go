@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://api.my-hc.example.com:6443
+    certificate-authority-data: b3JpZ2luYWw=
+contexts:
+- name: admin
+  context:
+    cluster: cluster
+    user: admin
+current-context: admin
+users:
+- name: admin
+  user:
+    token: secret-token
+`
+
+// kubeconfigSpoke serves the HostedCluster clusters/my-hc and the given
+// Secrets; anything else is 404.
+func kubeconfigSpoke(t *testing.T, hc *hypershiftv1beta1.HostedCluster, secrets ...*corev1.Secret) *httptest.Server {
+	t.Helper()
+	byPath := map[string]interface{}{
+		"/spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters/my-hc": hc,
+	}
+	for _, s := range secrets {
+		byPath["/spoke-1"+apiPathCoreNamespaces+"/clusters/secrets/"+s.Name] = s
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		obj, ok := byPath[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_ = json.NewEncoder(w).Encode(obj)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func kubeconfigHC(servingCert string) *hypershiftv1beta1.HostedCluster {
+	hc := &hypershiftv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-hc", Namespace: "clusters"},
+		Status: hypershiftv1beta1.HostedClusterStatus{
+			KubeConfig: &corev1.LocalObjectReference{Name: "my-hc-admin-kubeconfig"},
+		},
+	}
+	if servingCert != "" {
+		hc.Spec.Configuration = &hypershiftv1beta1.ClusterConfiguration{
+			APIServer: &configv1.APIServerSpec{
+				ServingCerts: configv1.APIServerServingCerts{
+					NamedCertificates: []configv1.APIServerNamedServingCert{
+						{ServingCertificate: configv1.SecretNameReference{Name: servingCert}},
+					},
+				},
+			},
+		}
+	}
+	return hc
+}
+
+func kubeconfigSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-hc-admin-kubeconfig", Namespace: "clusters"},
+		Data:       map[string][]byte{"kubeconfig": []byte(testKubeconfig)},
+	}
+}
+
+func kubeconfigRequest(query string) *http.Request {
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc/kubeconfig?hostingCluster=spoke-1" + query
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+func Test_handleRoute_WhenKubeconfigRequested_ItShouldReturnAdminKubeconfig(t *testing.T) {
+	srv := kubeconfigSpoke(t, kubeconfigHC(""), kubeconfigSecret())
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, kubeconfigRequest(""))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, testKubeconfig, w.Body.String())
+	assert.Equal(t, contentTypeYAML, w.Header().Get(headerContentType))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+}
+
+func Test_handleRoute_WhenHostedClusterNamedKubeconfig_ItShouldReturnItsBundle(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	spoke.put("/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters/kubeconfig", map[string]interface{}{
+		"apiVersion": "hypershift.openshift.io/v1beta1",
+		"kind":       "HostedCluster",
+		"metadata":   map[string]interface{}{"name": "kubeconfig", "namespace": "clusters"},
+	})
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	r := httptest.NewRequest(http.MethodGet,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/clusters/hostedclusters/kubeconfig?hostingCluster=spoke-1", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	w := httptest.NewRecorder()
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	require.NotNil(t, bundle.HostedCluster)
+	assert.Equal(t, "kubeconfig", bundle.HostedCluster.Name)
+}
+
+func Test_handleRoute_WhenKubeconfigWithRewriteCA_ItShouldUseServingCert(t *testing.T) {
+	cert := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-serving-cert", Namespace: "clusters"},
+		Data:       map[string][]byte{"tls.crt": []byte("serving-ca")},
+	}
+	srv := kubeconfigSpoke(t, kubeconfigHC("my-serving-cert"), kubeconfigSecret(), cert)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, kubeconfigRequest("&rewriteCA=true"))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	config, err := clientcmd.Load(w.Body.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("serving-ca"), config.Clusters["cluster"].CertificateAuthorityData)
+	assert.Equal(t, "secret-token", config.AuthInfos["admin"].Token)
+}
+
+func Test_handleRoute_WhenRewriteCAWithoutServingCert_ItShouldReturn400(t *testing.T) {
+	srv := kubeconfigSpoke(t, kubeconfigHC(""), kubeconfigSecret())
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, kubeconfigRequest("&rewriteCA=true"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_handleRoute_WhenKubeconfigNotPublishedYet_ItShouldReturn404(t *testing.T) {
+	hc := kubeconfigHC("")
+	hc.Status.KubeConfig = nil
+	srv := kubeconfigSpoke(t, hc)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, kubeconfigRequest(""))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "not available yet")
+}
+
+func Test_handleRoute_WhenKubeconfigPUT_ItShouldReturn405(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", availableManagedCluster("spoke-1"))
+	r := kubeconfigRequest("")
+	r.Method = http.MethodPut
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, r)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,396 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+const (
+	// fanOutConcurrency bounds how many hosting clusters are queried at once
+	// for a fleet-wide list.
+	fanOutConcurrency = 10
+
+	// queryCreatedViaProxy=true narrows a list to objects created through this
+	// proxy (hcp.ocm.io/created-via=hcp-from-hub).
+	queryCreatedViaProxy = "createdViaProxy"
+)
+
+// fanOutQueryParams are the list parameters forwarded to every hosting cluster.
+// limit/continue are not: a continue token is only meaningful to the spoke
+// that issued it.
+var fanOutQueryParams = []string{"labelSelector", "fieldSelector"}
+
+// listQueryParams are the list parameters forwarded on a single-cluster list.
+var listQueryParams = []string{
+	"labelSelector",
+	"fieldSelector",
+	"limit",
+	"continue",
+	"resourceVersion",
+	"resourceVersionMatch",
+}
+
+// buildListQuery copies the allowlisted keys from in and, when
+// createdViaProxy=true, ANDs the created-via label onto the label selector.
+func buildListQuery(in url.Values, keys []string) (url.Values, error) {
+	out := url.Values{}
+	for _, key := range keys {
+		if v := in.Get(key); v != "" {
+			out.Set(key, v)
+		}
+	}
+	if raw := in.Get(queryCreatedViaProxy); raw != "" {
+		createdVia, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", queryCreatedViaProxy, raw)
+		}
+		if createdVia {
+			selector := labelCreatedVia + "=" + labelCreatedViaValue
+			if ls := out.Get("labelSelector"); ls != "" {
+				selector = ls + "," + selector
+			}
+			out.Set("labelSelector", selector)
+		}
+	}
+	return out, nil
+}
+
+// handleList lists the HostedClusters or NodePools in ns on one hosting
+// cluster under the caller's identity. Selectors and pagination (limit/continue) are passed
+// through and the spoke's list metadata is kept, so chunked client-go lists
+// work. Non-200 spoke responses are forwarded as-is.
+func (p *hcpProxy) handleList(w http.ResponseWriter, r *http.Request, ns, resource, spokeName string) {
+	query, err := buildListQuery(r.URL.Query(), listQueryParams)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	apiPath, err := hsCollectionAPIPath(ns, resource)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req, err := p.newSpokeRequest(r.Context(), http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		writeJSONError(w, "failed to build list request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		writeJSONError(w, "spoke request failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeJSONError(w, "failed to read spoke response: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		// e.g. 410 Gone for an expired continue token — client-go relists on it.
+		if ct := resp.Header.Get(headerContentType); ct != "" {
+			w.Header().Set(headerContentType, ct)
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = w.Write(body)
+		return
+	}
+
+	list := &unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(body); err != nil {
+		writeJSONError(w, "failed to decode spoke list: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	list.SetAPIVersion(hcpProxyGroupVersion)
+	list.SetKind(proxyResourceKinds[resource] + "List")
+	for i := range list.Items {
+		asProxyObject(&list.Items[i], spokeName)
+	}
+	if wantsTable(r) {
+		var npCounts nodePoolCounts
+		if resource == resourceHostedClusters {
+			npPath, _ := hsCollectionAPIPath(ns, resourceNodePools)
+			npCounts = p.countNodePools(r.Context(), hcpClient, spokeName, npPath)
+		}
+		listMeta := metav1.ListMeta{
+			ResourceVersion:    list.GetResourceVersion(),
+			Continue:           list.GetContinue(),
+			RemainingItemCount: list.GetRemainingItemCount(),
+		}
+		writeTable(w, r, resource, list.Items, listMeta, npCounts)
+		return
+	}
+	out, err := list.MarshalJSON()
+	if err != nil {
+		writeJSONError(w, "failed to encode list: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	_, _ = w.Write(out)
+}
+
+// fanOutResult is the outcome of listing one resource on one hosting cluster.
+type fanOutResult struct {
+	spoke string
+	items []unstructured.Unstructured
+	err   error
+}
+
+// handleFanOutList serves a HostedCluster or NodePool list that arrived without a
+// hostingCluster parameter by querying every hosting cluster the caller
+// administers (all hosting clusters when the hub permission check is skipped,
+// or after a SubjectAccessReview for the list in SubjectAccessReview mode)
+// and merging the results. ns is empty for a cluster-wide list.
+//
+// The merged list is always 200 so fleet-wide tooling and the namespace
+// controller are never blocked by one bad cluster: unreachable or failing
+// clusters are reported as HTTP Warning headers instead, and each item is
+// annotated with the hosting cluster it came from.
+func (p *hcpProxy) handleFanOutList(w http.ResponseWriter, r *http.Request, nsRaw, resource string) {
+	apiPath, err := fanOutAPIPath(nsRaw, resource)
+	if err != nil {
+		writeJSONError(w, "invalid namespace: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, err := buildListQuery(r.URL.Query(), fanOutQueryParams)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, groups := whoIsTheCaller(r)
+	spokes, warnings := p.fanOutSpokes(r, "list", nsRaw, resource)
+
+	var items []unstructured.Unstructured
+	for _, res := range p.listOnSpokes(r.Context(), username, groups, spokes, apiPath, query) {
+		if res.err != nil {
+			warnings = append(warnings, fmt.Sprintf("hosting cluster %q: %v", res.spoke, res.err))
+			continue
+		}
+		items = append(items, res.items...)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].GetNamespace() != items[j].GetNamespace() {
+			return items[i].GetNamespace() < items[j].GetNamespace()
+		}
+		if items[i].GetName() != items[j].GetName() {
+			return items[i].GetName() < items[j].GetName()
+		}
+		return items[i].GetAnnotations()[annotationHostingCluster] < items[j].GetAnnotations()[annotationHostingCluster]
+	})
+	objects := make([]interface{}, 0, len(items))
+	for i := range items {
+		objects = append(objects, items[i].Object)
+	}
+
+	var npCounts nodePoolCounts
+	if wantsTable(r) && resource == resourceHostedClusters {
+		npPath, _ := fanOutAPIPath(nsRaw, resourceNodePools)
+		npCounts = nodePoolCounts{}
+		for _, res := range p.listOnSpokes(r.Context(), username, groups, spokes, npPath, url.Values{}) {
+			if res.err != nil {
+				warnings = append(warnings, fmt.Sprintf("hosting cluster %q: NodePools not counted: %v", res.spoke, res.err))
+				continue
+			}
+			npCounts.add(res.spoke, res.items)
+		}
+	}
+
+	for _, msg := range warnings {
+		w.Header().Add("Warning", "299 - "+strconv.Quote(msg))
+	}
+	if wantsTable(r) {
+		writeTable(w, r, resource, items, metav1.ListMeta{}, npCounts)
+		return
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"apiVersion": hcpProxyGroupVersion,
+		"kind":       proxyResourceKinds[resource] + "List",
+		// A merged list has no single resourceVersion to resume from.
+		"metadata": map[string]interface{}{"resourceVersion": ""},
+		"items":    objects,
+	})
+}
+
+// countNodePools counts the NodePools at npPath on one hosting cluster for the
+// NodePools column of a HostedCluster table. It returns nil, which renders as
+// <unknown>, if they cannot be listed.
+func (p *hcpProxy) countNodePools(ctx context.Context, hcpClient *http.Client, spokeName, npPath string) nodePoolCounts {
+	nodePools, err := p.listOnSpoke(ctx, hcpClient, spokeName, npPath, url.Values{})
+	if err != nil {
+		return nil
+	}
+	counts := nodePoolCounts{}
+	counts.add(spokeName, nodePools)
+	return counts
+}
+
+// fanOutAPIPath is the spoke path of resource in nsRaw, or across all
+// namespaces when nsRaw is empty.
+func fanOutAPIPath(nsRaw, resource string) (string, error) {
+	if nsRaw == "" {
+		return apiPathHSGroupVersion + "/" + resource, nil
+	}
+	return hsCollectionAPIPath(nsRaw, resource)
+}
+
+// fanOutSpokes returns the hosting clusters a fan-out request for verb on
+// resource is sent to, plus warnings for those that were skipped.
+func (p *hcpProxy) fanOutSpokes(r *http.Request, verb, nsRaw, resource string) ([]string, []string) {
+	username, groups := whoIsTheCaller(r)
+	spokes, warnings := p.fanOutTargets(r.Context(), username, groups)
+	if p.usesAccessReview() {
+		// The hub decides once for the whole request; hosting clusters are
+		// not filtered per caller in this mode.
+		attrs := accessAttributes{verb: verb, resource: resource, namespace: nsRaw}
+		if err := p.checkAccessReview(r.Context(), username, groups, callerExtra(r), attrs, ""); err != nil {
+			return nil, []string{"no hosting clusters queried: " + err.Error()}
+		}
+	}
+	return spokes, warnings
+}
+
+// fanOutTargets returns the Available hosting clusters the caller may list
+// from, plus warnings for clusters that were skipped. An authorization failure
+// yields no targets rather than an error so the list degrades to empty.
+func (p *hcpProxy) fanOutTargets(ctx context.Context, username string, groups []string) ([]string, []string) {
+	allowed, all, err := p.candidateHostingClusters(ctx, username, groups)
+	if err != nil {
+		return nil, []string{"no hosting clusters queried: " + err.Error()}
+	}
+
+	mcList := &clusterv1.ManagedClusterList{}
+	if err := p.hubClient.List(ctx, mcList); err != nil {
+		return nil, []string{"failed to list managed clusters: " + err.Error()}
+	}
+
+	var spokes, warnings []string
+	for i := range mcList.Items {
+		mc := &mcList.Items[i]
+		if !all && !allowed.Has(mc.Name) {
+			continue
+		}
+		if !isHostingCluster(mc) {
+			continue
+		}
+		if !meta.IsStatusConditionTrue(mc.Status.Conditions, clusterv1.ManagedClusterConditionAvailable) {
+			warnings = append(warnings, fmt.Sprintf("hosting cluster %q skipped: not available", mc.Name))
+			continue
+		}
+		spokes = append(spokes, mc.Name)
+	}
+	sort.Strings(spokes)
+	return spokes, warnings
+}
+
+// isHostingCluster reports whether the agent has claimed the cluster as a
+// HyperShift management cluster.
+func isHostingCluster(mc *clusterv1.ManagedCluster) bool {
+	return clusterClaimValue(mc, util.HostingClusterClaimKey) == "true"
+}
+
+// listOnSpokes lists apiPath on every spoke in parallel, bounded by
+// fanOutConcurrency. Results are returned in the order of spokes.
+func (p *hcpProxy) listOnSpokes(
+	ctx context.Context,
+	username string,
+	groups []string,
+	spokes []string,
+	apiPath string,
+	query url.Values,
+) []fanOutResult {
+	results := make([]fanOutResult, len(spokes))
+	if len(spokes) == 0 {
+		return results
+	}
+
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		for i, spoke := range spokes {
+			results[i] = fanOutResult{spoke: spoke, err: err}
+		}
+		return results
+	}
+
+	sem := make(chan struct{}, fanOutConcurrency)
+	var wg sync.WaitGroup
+	for i, spoke := range spokes {
+		wg.Add(1)
+		go func(i int, spoke string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			items, err := p.listOnSpoke(ctx, hcpClient, spoke, apiPath, query)
+			results[i] = fanOutResult{spoke: spoke, items: items, err: err}
+		}(i, spoke)
+	}
+	wg.Wait()
+	return results
+}
+
+// listOnSpoke lists apiPath on one spoke and returns the items as proxy
+// objects. A 404 means the hypershift CRDs are not installed there, which is
+// an empty result rather than a failure.
+func (p *hcpProxy) listOnSpoke(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, apiPath string,
+	query url.Values,
+) ([]unstructured.Unstructured, error) {
+	req, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("list returned HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(body); err != nil {
+		return nil, fmt.Errorf("failed to decode list: %w", err)
+	}
+	for i := range list.Items {
+		asProxyObject(&list.Items[i], spokeName)
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,362 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+// apiPathHSClusterWide is the spoke path of a cluster-wide HostedCluster list.
+const apiPathHSClusterWide = apiPathHSGroupVersion + "/" + resourceHostedClusters
+
+// hostingManagedCluster is an Available ManagedCluster carrying the hosting-cluster claim.
+func hostingManagedCluster(name string) *clusterv1.ManagedCluster {
+	mc := availableManagedCluster(name)
+	mc.Status.ClusterClaims = []clusterv1.ManagedClusterClaim{
+		{Name: util.HostingClusterClaimKey, Value: "true"},
+	}
+	return mc
+}
+
+// hcListBody is a spoke HostedClusterList with one item per name.
+func hcListBody(ns string, names ...string) string {
+	items := make([]string, 0, len(names))
+	for _, n := range names {
+		items = append(items, fmt.Sprintf(`{"apiVersion":"hypershift.openshift.io/v1beta1",`+
+			`"kind":"HostedCluster","metadata":{"name":%q,"namespace":%q}}`, n, ns))
+	}
+	return `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedClusterList",` +
+		`"metadata":{"resourceVersion":"42"},"items":[` + strings.Join(items, ",") + `]}`
+}
+
+func decodeHCList(t *testing.T, body []byte) []map[string]interface{} {
+	t.Helper()
+	var doc struct {
+		Kind       string                   `json:"kind"`
+		APIVersion string                   `json:"apiVersion"`
+		Items      []map[string]interface{} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(body, &doc))
+	assert.Equal(t, "HostedClusterList", doc.Kind)
+	assert.Equal(t, hcpProxyGroupVersion, doc.APIVersion)
+	return doc.Items
+}
+
+func itemHostingCluster(item map[string]interface{}) string {
+	md, _ := item["metadata"].(map[string]interface{})
+	annotations, _ := md["annotations"].(map[string]interface{})
+	v, _ := annotations[annotationHostingCluster].(string)
+	return v
+}
+
+func Test_handleRoute_WhenClusterWideGETWithoutHostingCluster_ItShouldFanOut(t *testing.T) {
+	var mu sync.Mutex
+	var labelSelectors []string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		labelSelectors = append(labelSelectors, r.URL.Query().Get("labelSelector"))
+		mu.Unlock()
+		w.Header().Set(headerContentType, contentTypeJSON)
+		switch r.URL.Path {
+		case "/spoke-1" + apiPathHSClusterWide:
+			_, _ = io.WriteString(w, hcListBody("clusters", "b-hc"))
+		case "/spoke-2" + apiPathHSClusterWide:
+			_, _ = io.WriteString(w, hcListBody("clusters", "a-hc"))
+		default:
+			t.Errorf("unexpected spoke request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer spokeSrv.Close()
+
+	down := hostingManagedCluster("spoke-down")
+	down.Status.Conditions[0].Status = metav1.ConditionFalse
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL,
+		hostingManagedCluster("spoke-1"),
+		hostingManagedCluster("spoke-2"),
+		down,
+		availableManagedCluster("not-a-hosting-cluster"),
+	)
+
+	w := httptest.NewRecorder()
+	path := apiPathPrefix + hcpProxyGroupVersion + "/hostedclusters?labelSelector=env%3Dprod"
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	items := decodeHCList(t, w.Body.Bytes())
+	require.Len(t, items, 2)
+	assert.Equal(t, "a-hc", items[0]["metadata"].(map[string]interface{})["name"])
+	assert.Equal(t, "spoke-2", itemHostingCluster(items[0]))
+	assert.Equal(t, "spoke-1", itemHostingCluster(items[1]))
+	assert.Equal(t, hcpProxyGroupVersion, items[0]["apiVersion"])
+	assert.Equal(t, []string{"env=prod", "env=prod"}, labelSelectors)
+
+	warnings := w.Header().Values("Warning")
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "spoke-down")
+}
+
+func Test_handleRoute_WhenNamespacedGETWithoutHostingCluster_ItShouldListThatNamespace(t *testing.T) {
+	var spokePath string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spokePath = r.URL.Path
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_, _ = io.WriteString(w, hcListBody("clusters", "my-hc"))
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, hostingManagedCluster("spoke-1"))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, apiPathPrefix+hcpProxyGroupVersion+"/namespaces/clusters/hostedclusters", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters", spokePath)
+	assert.Len(t, decodeHCList(t, w.Body.Bytes()), 1)
+}
+
+func Test_handleFanOutList_WhenOneSpokeFails_ItShouldWarnAndReturnTheRest(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/spoke-1/"):
+			w.Header().Set(headerContentType, contentTypeJSON)
+			_, _ = io.WriteString(w, hcListBody("clusters", "my-hc"))
+		case strings.HasPrefix(r.URL.Path, "/spoke-2/"):
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			// spoke-3 has no HostedCluster CRD.
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL,
+		hostingManagedCluster("spoke-1"), hostingManagedCluster("spoke-2"), hostingManagedCluster("spoke-3"))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleFanOutList(w, r, "", resourceHostedClusters)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	items := decodeHCList(t, w.Body.Bytes())
+	require.Len(t, items, 1)
+	assert.Equal(t, "spoke-1", itemHostingCluster(items[0]))
+
+	warnings := w.Header().Values("Warning")
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], `spoke-2`)
+	assert.Contains(t, warnings[0], "HTTP 500")
+}
+
+func Test_handleFanOutList_WhenUserIsAdminOnSomeClusters_ItShouldOnlyQueryThose(t *testing.T) {
+	adminUP := map[string]interface{}{
+		"apiVersion": "clusterview.open-cluster-management.io/v1alpha1",
+		"kind":       "UserPermission",
+		"metadata":   map[string]interface{}{"name": "managedcluster:admin"},
+		"status": map[string]interface{}{
+			"bindings": []interface{}{map[string]interface{}{"cluster": "spoke-1"}},
+		},
+	}
+	hubSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "userpermissions/managedcluster:admin") {
+			w.Header().Set(headerContentType, contentTypeJSON)
+			_ = json.NewEncoder(w).Encode(adminUP)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer hubSrv.Close()
+
+	var mu sync.Mutex
+	var queried []string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		queried = append(queried, strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0])
+		mu.Unlock()
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_, _ = io.WriteString(w, hcListBody("clusters", "my-hc"))
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithHubServer(t, hubSrv.URL, hostingManagedCluster("spoke-1"), hostingManagedCluster("spoke-2"))
+	p.clusterProxyURL = spokeSrv.URL
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleFanOutList(w, r, "", resourceHostedClusters)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"spoke-1"}, queried)
+	assert.Len(t, decodeHCList(t, w.Body.Bytes()), 1)
+}
+
+func Test_handleFanOutList_WhenUnauthenticated_ItShouldReturnEmptyListWithWarning(t *testing.T) {
+	p := newTestProxy(t, hostingManagedCluster("spoke-1"))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	p.handleFanOutList(w, r, "", resourceHostedClusters)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, decodeHCList(t, w.Body.Bytes()))
+	assert.Contains(t, w.Header().Get("Warning"), "unauthenticated request")
+}
+
+func Test_handleFanOutList_WhenNamespaceInvalid_ItShouldReturn400(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	p.handleFanOutList(w, r, "Bad_NS", resourceHostedClusters)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_adminClusters_WhenBindingsPresent_ItShouldReturnThem(t *testing.T) {
+	adminUP := map[string]interface{}{
+		"apiVersion": "clusterview.open-cluster-management.io/v1alpha1",
+		"kind":       "UserPermission",
+		"metadata":   map[string]interface{}{"name": "managedcluster:admin"},
+		"status": map[string]interface{}{
+			"bindings": []interface{}{
+				map[string]interface{}{"cluster": "spoke-1"},
+				map[string]interface{}{"cluster": "spoke-2"},
+			},
+		},
+	}
+	hubSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_ = json.NewEncoder(w).Encode(adminUP)
+	}))
+	defer hubSrv.Close()
+
+	p := newTestProxyWithHubServer(t, hubSrv.URL)
+	clusters, skipped, err := p.adminClusters(context.Background(), "alice", nil)
+	require.NoError(t, err)
+	assert.False(t, skipped)
+	assert.ElementsMatch(t, []string{"spoke-1", "spoke-2"}, clusters.UnsortedList())
+}
+
+func Test_handleRoute_WhenListWithHostingCluster_ItShouldPassThroughAndKeepListMeta(t *testing.T) {
+	var spokePath string
+	var spokeQuery url.Values
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spokePath = r.URL.Path
+		spokeQuery = r.URL.Query()
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_, _ = io.WriteString(w, `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedClusterList",`+
+			`"metadata":{"resourceVersion":"42","continue":"tok-2","remainingItemCount":3},"items":[`+
+			`{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedCluster",`+
+			`"metadata":{"name":"my-hc","namespace":"clusters"}}]}`)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, availableManagedCluster("spoke-1"))
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters?hostingCluster=spoke-1" +
+		"&labelSelector=env%3Dprod&fieldSelector=metadata.name%3Dmy-hc&limit=1&continue=tok-1"
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters", spokePath)
+	assert.Equal(t, "env=prod", spokeQuery.Get("labelSelector"))
+	assert.Equal(t, "metadata.name=my-hc", spokeQuery.Get("fieldSelector"))
+	assert.Equal(t, "1", spokeQuery.Get("limit"))
+	assert.Equal(t, "tok-1", spokeQuery.Get("continue"))
+	assert.Empty(t, spokeQuery.Get("hostingCluster"))
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "HostedClusterList", doc["kind"])
+	assert.Equal(t, hcpProxyGroupVersion, doc["apiVersion"])
+	md := doc["metadata"].(map[string]interface{})
+	assert.Equal(t, "42", md["resourceVersion"])
+	assert.Equal(t, "tok-2", md["continue"])
+	assert.EqualValues(t, 3, md["remainingItemCount"])
+	items := doc["items"].([]interface{})
+	require.Len(t, items, 1)
+	item := items[0].(map[string]interface{})
+	assert.Equal(t, hcpProxyGroupVersion, item["apiVersion"])
+	assert.Equal(t, "spoke-1", itemHostingCluster(item))
+}
+
+func Test_handleList_WhenSpokeReturnsEmptyList_ItShouldEncodeEmptyItems(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_, _ = io.WriteString(w, hcListBody("clusters"))
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleList(w, r, "clusters", resourceHostedClusters, "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"items":[]`)
+}
+
+func Test_handleList_WhenContinueTokenExpired_ItShouldForward410(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusGone)
+		_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","reason":"Expired","code":410}`)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?continue=stale", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleList(w, r, "clusters", resourceHostedClusters, "spoke-1")
+
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "Expired")
+}
+
+func Test_buildListQuery_WhenCreatedViaProxy_ItShouldAppendLabelSelector(t *testing.T) {
+	in := url.Values{
+		"labelSelector":      []string{"env=prod"},
+		queryCreatedViaProxy: []string{"true"},
+		"hostingCluster":     []string{"spoke-1"},
+	}
+	q, err := buildListQuery(in, listQueryParams)
+	require.NoError(t, err)
+	assert.Equal(t, "env=prod,"+labelCreatedVia+"="+labelCreatedViaValue, q.Get("labelSelector"))
+	assert.Empty(t, q.Get("hostingCluster"))
+	assert.Empty(t, q.Get(queryCreatedViaProxy))
+}
+
+func Test_buildListQuery_WhenCreatedViaProxyFalse_ItShouldLeaveSelectorAlone(t *testing.T) {
+	q, err := buildListQuery(url.Values{queryCreatedViaProxy: []string{"false"}}, listQueryParams)
+	require.NoError(t, err)
+	assert.Empty(t, q.Get("labelSelector"))
+}
+
+func Test_buildListQuery_WhenCreatedViaProxyInvalid_ItShouldError(t *testing.T) {
+	_, err := buildListQuery(url.Values{queryCreatedViaProxy: []string{"maybe"}}, listQueryParams)
+	assert.Error(t, err)
+}
+
+func Test_buildListQuery_WhenFanOut_ItShouldDropPagination(t *testing.T) {
+	q, err := buildListQuery(url.Values{"limit": []string{"5"}, "continue": []string{"tok"}}, fanOutQueryParams)
+	require.NoError(t, err)
+	assert.Empty(t, q)
+}
@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/metrics"
+)
+
+const (
+	// Reasons recorded by metrics.HCPProxyAuthorizationDenials.
+	denialReasonNotAdmin           = "not_admin"
+	denialReasonAccessReviewDenied = "access_review_denied"
+	denialReasonUnauthenticated    = "unauthenticated"
+	denialReasonCheckFailed        = "check_failed"
+
+	// spokeCodeError is the code label of a spoke request that got no response.
+	spokeCodeError = "error"
+)
+
+// requestMetrics is filled in by handlers while a request is served and read
+// by metricsMiddleware once it is done.
+type requestMetrics struct {
+	// hostingCluster is set only once the hosting cluster is known to be an
+	// available ManagedCluster, so request input cannot grow the label set.
+	hostingCluster string
+}
+
+type requestMetricsKey struct{}
+
+// requestMetricsFor returns the metrics of r. For requests that are not
+// measured it returns a throwaway value, so callers never need to check.
+func requestMetricsFor(r *http.Request) *requestMetrics {
+	if m, ok := r.Context().Value(requestMetricsKey{}).(*requestMetrics); ok {
+		return m
+	}
+	return &requestMetrics{}
+}
+
+// metricsMiddleware counts and times every request for the hcp.ocm.io API
+// and its OpenAPI documents. Health probes are not measured. Watches are
+// counted, and in flight while open, but stay out of the latency histogram.
+func (p *hcpProxy) metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource, measured := metricsResource(r.URL.Path)
+		if !measured {
+			next.ServeHTTP(w, r)
+			return
+		}
+		verb := requestVerb(r, resource)
+
+		metrics.HCPProxyInFlightRequests.Inc()
+		defer metrics.HCPProxyInFlightRequests.Dec()
+
+		m := &requestMetrics{}
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestMetricsKey{}, m)))
+
+		metrics.HCPProxyRequestsTotal.WithLabelValues(verb, resource, m.hostingCluster, strconv.Itoa(sw.status)).Inc()
+		if verb != "watch" {
+			metrics.HCPProxyRequestDuration.WithLabelValues(verb, resource, m.hostingCluster).
+				Observe(time.Since(start).Seconds())
+		}
+	})
+}
+
+// metricsResource returns the resource label for path: the resource, with
+// "/subresource" appended when there is one, "discovery" or "openapi".
+// measured is false for paths outside the API.
+func metricsResource(urlPath string) (resource string, measured bool) {
+	if urlPath == apiPathOpenAPIV2 || urlPath == apiPathOpenAPIV3 || strings.HasPrefix(urlPath, apiPathOpenAPIV3+"/") {
+		return "openapi", true
+	}
+	group := apiPathPrefix + hcpProxyAPIGroup
+	if urlPath == group || urlPath == group+"/"+hcpProxyAPIVersion {
+		return "discovery", true
+	}
+	prefix := apiPathPrefix + hcpProxyGroupVersion + "/"
+	if !strings.HasPrefix(urlPath, prefix) {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(urlPath, prefix), "/")
+	if len(parts) >= 2 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	// Only known resources become label values; anything else is a 404.
+	if len(parts) == 0 || parts[0] == "" {
+		return "unknown", true
+	}
+	if _, ok := proxyResourceKinds[parts[0]]; !ok {
+		return "unknown", true
+	}
+	resource = parts[0]
+	switch {
+	case len(parts) <= 2:
+		return resource, true
+	case len(parts) == 3 && resource == hcpProxyResource && isHostedClusterSubresource(parts[2]),
+		len(parts) == 3 && resource == resourceNodePools && parts[2] == subresourceScale:
+		return resource + "/" + parts[2], true
+	default:
+		return resource + "/unknown", true
+	}
+}
+
+// requestVerb maps the method and path of r to a Kubernetes verb.
+func requestVerb(r *http.Request, resource string) string {
+	named := false
+	if prefix := apiPathPrefix + hcpProxyGroupVersion + "/"; strings.HasPrefix(r.URL.Path, prefix) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		if len(parts) >= 2 && parts[0] == "namespaces" {
+			parts = parts[2:]
+		}
+		named = len(parts) > 1
+	}
+	switch r.Method {
+	case http.MethodGet:
+		switch {
+		case isWatchRequest(r):
+			return "watch"
+		case named || resource == "discovery" || resource == "openapi":
+			return "get"
+		default:
+			return "list"
+		}
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		if named {
+			return "delete"
+		}
+		return "deletecollection"
+	default:
+		return "unknown"
+	}
+}
+
+type spokeNameKey struct{}
+
+// observeSpokeRequest records one round trip of req to its hosting cluster.
+// resp is nil when the round trip failed.
+func observeSpokeRequest(req *http.Request, resp *http.Response, start time.Time) {
+	spokeName, _ := req.Context().Value(spokeNameKey{}).(string)
+	code := spokeCodeError
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.HCPProxySpokeRequestDuration.WithLabelValues(spokeName, req.Method).Observe(time.Since(start).Seconds())
+	metrics.HCPProxySpokeRequestsTotal.WithLabelValues(spokeName, req.Method, code).Inc()
+}
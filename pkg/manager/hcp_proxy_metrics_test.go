@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/metrics"
+)
+
+func Test_metricsResourceAndVerb_WhenPathsVary_ItShouldUseKubernetesNames(t *testing.T) {
+	gv := apiPathPrefix + hcpProxyGroupVersion
+	for _, tc := range []struct {
+		method, path, resource, verb string
+	}{
+		{http.MethodGet, apiPathPrefix + hcpProxyAPIGroup, "discovery", "get"},
+		{http.MethodGet, gv, "discovery", "get"},
+		{http.MethodGet, apiPathOpenAPIV2, "openapi", "get"},
+		{http.MethodGet, apiPathOpenAPIV3 + "/" + "apis/" + hcpProxyGroupVersion, "openapi", "get"},
+		{http.MethodGet, gv + "/hostedclusters", "hostedclusters", "list"},
+		{http.MethodGet, gv + "/namespaces/clusters/hostedclusters?watch=true", "hostedclusters", "watch"},
+		{http.MethodPost, gv + "/namespaces/clusters/hostedclusters", "hostedclusters", "create"},
+		{http.MethodGet, gv + "/namespaces/clusters/hostedclusters/hc-1", "hostedclusters", "get"},
+		{http.MethodPut, gv + "/namespaces/clusters/hostedclusters/hc-1/resources", "hostedclusters/resources", "update"},
+		{http.MethodPost, gv + "/namespaces/clusters/hostedclusters/hc-1/migrate", "hostedclusters/migrate", "create"},
+		{http.MethodGet, gv + "/namespaces/clusters/hostedclusters/hc-1/progress", "hostedclusters/progress", "get"},
+		{http.MethodPost, gv + "/namespaces/clusters/hostedclusters/hc-1/adopt", "hostedclusters/adopt", "create"},
+		{http.MethodGet, gv + "/namespaces/clusters/hostedclusters/hc-1/deletion", "hostedclusters/deletion", "get"},
+		{http.MethodDelete, gv + "/namespaces/clusters/hostedclusters", "hostedclusters", "deletecollection"},
+		{http.MethodDelete, gv + "/namespaces/clusters/nodepools/np-1", "nodepools", "delete"},
+		{http.MethodPatch, gv + "/namespaces/clusters/nodepools/np-1/scale", "nodepools/scale", "patch"},
+		{http.MethodGet, gv + "/namespaces/clusters/hostedclusters/hc-1/anything", "hostedclusters/unknown", "get"},
+		{http.MethodGet, gv + "/namespaces/clusters/secrets", "unknown", "list"},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		resource, measured := metricsResource(r.URL.Path)
+		require.True(t, measured, tc.path)
+		assert.Equal(t, tc.resource, resource, tc.path)
+		assert.Equal(t, tc.verb, requestVerb(r, resource), tc.path)
+	}
+
+	_, measured := metricsResource("/healthz")
+	assert.False(t, measured)
+}
+
+func Test_metricsMiddleware_WhenRequestServed_ItShouldCountItWithTheHandlersHostingCluster(t *testing.T) {
+	p := newTestProxy(t)
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters"
+	counter := metrics.HCPProxyRequestsTotal.WithLabelValues("create", "hostedclusters", "spoke-m1", "201")
+	before := testutil.ToFloat64(counter)
+
+	h := p.metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 1.0, testutil.ToFloat64(metrics.HCPProxyInFlightRequests))
+		requestMetricsFor(r).hostingCluster = "spoke-m1"
+		w.WriteHeader(http.StatusCreated)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.HCPProxyInFlightRequests))
+}
+
+func Test_handleRoute_WhenHostingClusterUnknown_ItShouldNotUseItAsALabel(t *testing.T) {
+	p := newTestProxy(t)
+	counter := metrics.HCPProxyRequestsTotal.WithLabelValues("get", "hostedclusters", "", "503")
+	before := testutil.ToFloat64(counter)
+
+	r := httptest.NewRequest(http.MethodGet,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/clusters/hostedclusters/hc-1?hostingCluster=no-such-cluster", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	w := httptest.NewRecorder()
+	p.metricsMiddleware(http.HandlerFunc(p.handleRoute)).ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func Test_handleRoute_WhenProxied_ItShouldRecordTheSpokeRoundTrip(t *testing.T) {
+	spoke := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(spoke.Close)
+	p := newTestProxyWithSpokeURL(t, spoke.URL, availableManagedCluster("spoke-m2"))
+	spokeCounter := metrics.HCPProxySpokeRequestsTotal.WithLabelValues("spoke-m2", http.MethodGet, "404")
+	before := testutil.ToFloat64(spokeCounter)
+
+	r := httptest.NewRequest(http.MethodGet,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/clusters/hostedclusters/hc-1?hostingCluster=spoke-m2", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	w := httptest.NewRecorder()
+	p.metricsMiddleware(http.HandlerFunc(p.handleRoute)).ServeHTTP(w, r)
+
+	assert.Greater(t, testutil.ToFloat64(spokeCounter), before)
+	assert.Equal(t, 1.0, testutil.ToFloat64(
+		metrics.HCPProxyRequestsTotal.WithLabelValues("get", "hostedclusters", "spoke-m2", strconv.Itoa(w.Code))))
+}
+
+func Test_doSpokeHTTP_WhenSpokeUnreachable_ItShouldCountAnError(t *testing.T) {
+	spoke := httptest.NewServer(http.NotFoundHandler())
+	p := newTestProxy(t)
+	p.clusterProxyURL = spoke.URL
+	spoke.Close()
+	counter := metrics.HCPProxySpokeRequestsTotal.WithLabelValues("spoke-m3", http.MethodGet, spokeCodeError)
+	before := testutil.ToFloat64(counter)
+
+	req, err := p.newSpokeRequest(context.Background(), http.MethodGet, "spoke-m3", "/api/v1/namespaces", nil)
+	require.NoError(t, err)
+	_, err = doSpokeHTTP(&http.Client{}, req)
+
+	require.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func Test_checkHubPermission_WhenDenied_ItShouldCountTheReason(t *testing.T) {
+	_, srv := newCountingHub(t, map[string][]string{"alice": {"spoke-m4"}})
+	p := newTestProxyWithHubServer(t, srv.URL)
+	notAdmin := metrics.HCPProxyAuthorizationDenials.WithLabelValues("spoke-m5", denialReasonNotAdmin)
+	unauthenticated := metrics.HCPProxyAuthorizationDenials.WithLabelValues("spoke-m4", denialReasonUnauthenticated)
+	beforeNotAdmin, beforeUnauthenticated := testutil.ToFloat64(notAdmin), testutil.ToFloat64(unauthenticated)
+
+	require.NoError(t, p.checkHubPermission(context.Background(), "alice", nil, "spoke-m4"))
+	require.Error(t, p.checkHubPermission(context.Background(), "alice", nil, "spoke-m5"))
+	require.Error(t, p.checkHubPermission(context.Background(), "", nil, "spoke-m4"))
+
+	assert.Equal(t, beforeNotAdmin+1, testutil.ToFloat64(notAdmin))
+	assert.Equal(t, beforeUnauthenticated+1, testutil.ToFloat64(unauthenticated))
+	assert.Equal(t, 0.0, testutil.ToFloat64(
+		metrics.HCPProxyAuthorizationDenials.WithLabelValues("spoke-m4", denialReasonNotAdmin)))
+}
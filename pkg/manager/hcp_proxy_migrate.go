@@ -0,0 +1,880 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	subresourceMigrate = "migrate"
+
+	// queryMigrateTarget names the ManagedCluster a migration moves to.
+	queryMigrateTarget = "target"
+
+	// queryAcknowledgeDataLoss must be true for a migration to start: the
+	// copy on the target starts without the control plane data of the source.
+	queryAcknowledgeDataLoss = "acknowledgeDataLoss"
+
+	// annotationMigratedFrom is set on the copies a migration creates and
+	// names the hosting cluster they were copied from.
+	annotationMigratedFrom = "hcp.ocm.io/migrated-from"
+
+	defaultMigrationAvailableTimeout = 30 * time.Minute
+	maxMigrationAvailableTimeout     = 2 * time.Hour
+
+	// migrationRetention is how long finished migrations stay readable.
+	migrationRetention = 24 * time.Hour
+)
+
+// Overridable in tests.
+var (
+	// migrationPollInterval is how often the target HostedCluster is read while
+	// waiting for it to become Available.
+	migrationPollInterval = 15 * time.Second
+)
+
+// MigrationPhase is the step a migration is in.
+type MigrationPhase string
+
+const (
+	MigrationPausingSource       MigrationPhase = "PausingSource"
+	MigrationCopyingResources    MigrationPhase = "CopyingResources"
+	MigrationWaitingForAvailable MigrationPhase = "WaitingForAvailable"
+	MigrationTearingDownSource   MigrationPhase = "TearingDownSource"
+	MigrationSucceeded           MigrationPhase = "Succeeded"
+	MigrationFailed              MigrationPhase = "Failed"
+)
+
+// MigrationStatus is the response body of POST and GET
+// .../hostedclusters/{name}/migrate.
+type MigrationStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Source and Target are the hosting clusters the HostedCluster moves from and to.
+	Source string         `json:"source"`
+	Target string         `json:"target"`
+	Phase  MigrationPhase `json:"phase"`
+	// Message explains the current phase, e.g. the Available condition message
+	// of the target while waiting, or why the migration failed.
+	Message        string       `json:"message,omitempty"`
+	StartTime      metav1.Time  `json:"startTime"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Steps lists every phase entered so far, oldest first.
+	Steps []MigrationStep `json:"steps"`
+	// Copied lists the objects written to the target, as Kind/name.
+	Copied []string `json:"copied,omitempty"`
+	// RolledBack lists the copies deleted from the target after a failure.
+	RolledBack []string `json:"rolledBack,omitempty"`
+	// RollbackErrors lists copies that could not be deleted and need manual cleanup.
+	RollbackErrors []string `json:"rollbackErrors,omitempty"`
+}
+
+// MigrationStep records when a migration entered and left a phase.
+type MigrationStep struct {
+	Phase          MigrationPhase `json:"phase"`
+	StartTime      metav1.Time    `json:"startTime"`
+	CompletionTime *metav1.Time   `json:"completionTime,omitempty"`
+}
+
+func (s *MigrationStatus) finished() bool {
+	return s.Phase == MigrationSucceeded || s.Phase == MigrationFailed
+}
+
+// migrationTracker holds the migrations this proxy replica started or
+// recovered, keyed by namespace/name. The zero value is ready to use.
+type migrationTracker struct {
+	mu         sync.Mutex
+	migrations map[string]*MigrationStatus
+}
+
+func migrationKey(ns, name string) string {
+	return ns + "/" + name
+}
+
+// begin records a new migration. It returns false if one is already running
+// for the same HostedCluster.
+func (t *migrationTracker) begin(status *MigrationStatus) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.migrations == nil {
+		t.migrations = map[string]*MigrationStatus{}
+	}
+	for key, existing := range t.migrations {
+		if existing.finished() && time.Since(existing.CompletionTime.Time) > migrationRetention {
+			delete(t.migrations, key)
+		}
+	}
+	key := migrationKey(status.Namespace, status.Name)
+	if existing, ok := t.migrations[key]; ok && !existing.finished() {
+		return false
+	}
+	t.migrations[key] = status
+	return true
+}
+
+// get returns a copy of the latest migration of ns/name.
+func (t *migrationTracker) get(ns, name string) (MigrationStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status, ok := t.migrations[migrationKey(ns, name)]
+	if !ok {
+		return MigrationStatus{}, false
+	}
+	out := *status
+	out.Steps = append([]MigrationStep(nil), status.Steps...)
+	out.Copied = append([]string(nil), status.Copied...)
+	out.RolledBack = append([]string(nil), status.RolledBack...)
+	out.RollbackErrors = append([]string(nil), status.RollbackErrors...)
+	return out, true
+}
+
+func (t *migrationTracker) update(ns, name string, fn func(*MigrationStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if status, ok := t.migrations[migrationKey(ns, name)]; ok {
+		fn(status)
+	}
+}
+
+// handleMigrate serves .../hostedclusters/{name}/migrate on the source
+// hosting cluster (hostingCluster). POST starts moving the HostedCluster to
+// ?target= and answers 202 with a MigrationStatus; GET returns the status of
+// the latest migration. The migration runs in the background under the
+// caller's identity, which needs the same rights on both hosting clusters.
+//
+// The HostedCluster is recreated on the target from its spec: its control
+// plane data (etcd) is not carried over and its nodes are replaced, so the
+// caller must pass ?acknowledgeDataLoss=true.
+func (p *hcpProxy) handleMigrate(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	if r.Method == http.MethodGet {
+		status, ok := p.migrations.get(ns, name)
+		if !ok {
+			status, ok = p.recordedMigration(r, ns, name, spokeName)
+		}
+		if !ok || (status.Source != spokeName && status.Target != spokeName) {
+			writeJSONError(w, "no migration of HostedCluster "+name+" is recorded", http.StatusNotFound)
+			return
+		}
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_ = json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	if r.URL.Query().Get("dryRun") != "" {
+		writeJSONError(w, "dryRun is not supported for migrate", http.StatusBadRequest)
+		return
+	}
+	target, err := sanitizeProxyName(r.URL.Query().Get(queryMigrateTarget))
+	if err != nil {
+		writeJSONError(w, "target query parameter is required and must be a valid DNS-1123 subdomain",
+			http.StatusBadRequest)
+		return
+	}
+	if target == spokeName {
+		writeJSONError(w, "target must differ from hostingCluster", http.StatusBadRequest)
+		return
+	}
+	availableTimeout, err := parseTimeoutSeconds(r, defaultMigrationAvailableTimeout, maxMigrationAvailableTimeout)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if acknowledged, _ := strconv.ParseBool(r.URL.Query().Get(queryAcknowledgeDataLoss)); !acknowledged {
+		writeJSONError(w, queryAcknowledgeDataLoss+"=true is required: the HostedCluster is recreated on the "+
+			"target without its control plane data (etcd) and its nodes are replaced", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if err := p.checkSpokeHealth(ctx, target); err != nil {
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err := p.authorize(r, target); err != nil {
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sourceHC, code, msg := p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
+	if sourceHC == nil {
+		writeJSONError(w, msg, code)
+		return
+	}
+	if record := migrationRecordOf(sourceHC); record != nil && !record.finished() {
+		writeJSONError(w, fmt.Sprintf("a migration of HostedCluster %s to %s is in progress", name, record.Target),
+			http.StatusConflict)
+		return
+	}
+	switch _, code, msg := p.fetchHostedCluster(ctx, hcpClient, ns, name, target); code {
+	case http.StatusNotFound:
+	case http.StatusOK:
+		writeJSONError(w, fmt.Sprintf("HostedCluster %s already exists on %s", name, target), http.StatusConflict)
+		return
+	default:
+		writeJSONError(w, "checking the target: "+msg, code)
+		return
+	}
+
+	m := &migration{
+		p:                p,
+		client:           hcpClient,
+		ns:               ns,
+		name:             name,
+		source:           spokeName,
+		target:           target,
+		availableTimeout: availableTimeout,
+	}
+	// The copies must satisfy the policy of the target. Checking it before the
+	// source is paused leaves nothing to roll back.
+	rules, err := p.policyRulesFor(ctx, target)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rules) > 0 {
+		nodePools, err := m.sourceNodePools(ctx)
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		errs := checkHostedCluster(rules, objectMap(sourceHC), field.NewPath("hostedCluster"))
+		for i := range nodePools {
+			errs = append(errs, checkNodePool(rules, nodePools[i].Object, field.NewPath("nodePools").Index(i))...)
+		}
+		if !p.rejectViolations(w, target, "HostedCluster", name, errs) {
+			return
+		}
+	}
+
+	now := metav1.Now()
+	status := &MigrationStatus{
+		Namespace: ns,
+		Name:      name,
+		Source:    spokeName,
+		Target:    target,
+		Phase:     MigrationPausingSource,
+		StartTime: now,
+		Steps:     []MigrationStep{{Phase: MigrationPausingSource, StartTime: now}},
+	}
+	if !p.migrations.begin(status) {
+		writeJSONError(w, "a migration of HostedCluster "+name+" is already running", http.StatusConflict)
+		return
+	}
+	// The index lets a restarted proxy find the migration and act as the caller.
+	entry := &migrationIndexEntry{Source: spokeName, Namespace: ns, Name: name, User: username, Groups: groups}
+	if err := p.updateMigrationIndex(ctx, migrationIndexKey(spokeName, ns, name), entry); err != nil {
+		m.finish(ctx, MigrationFailed, "recording the migration on the hub: "+err.Error())
+		writeJSONError(w, "failed to record the migration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	snapshot, _ := p.migrations.get(ns, name)
+
+	p.log.Info("starting HostedCluster migration",
+		"name", name, "namespace", ns, "source", spokeName, "target", target, "user", username)
+	go m.run(context.WithoutCancel(ctx))
+
+	w.Header().Set("Location", r.URL.Path+"?hostingCluster="+url.QueryEscape(spokeName))
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(snapshot)
+}
+
+// parseTimeoutSeconds reads ?timeoutSeconds=: for a migration the time the
+// target is given to become Available, for a delete the time the HostedCluster
+// finalizers are given to complete.
+func parseTimeoutSeconds(r *http.Request, defaultTimeout, maxTimeout time.Duration) (time.Duration, error) {
+	raw := r.URL.Query().Get("timeoutSeconds")
+	if raw == "" {
+		return defaultTimeout, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid timeoutSeconds value %q", raw)
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxTimeout {
+		return 0, fmt.Errorf("timeoutSeconds must not exceed %d", int(maxTimeout.Seconds()))
+	}
+	return timeout, nil
+}
+
+// migration moves one HostedCluster from source to target.
+type migration struct {
+	p                *hcpProxy
+	client           *http.Client
+	ns, name         string
+	source, target   string
+	availableTimeout time.Duration
+	// created lists the copies a rollback deletes, oldest first.
+	created []createdResource
+}
+
+// run pauses the source, copies it to the target, waits for the target to
+// become Available and only then deletes the source. A failure before the
+// target is Available deletes the copies and unpauses the source. Each phase
+// and each copy is recorded on the source before the migration goes on.
+func (m *migration) run(ctx context.Context) {
+	if err := m.persist(ctx); err != nil {
+		m.fail(ctx, err.Error())
+		return
+	}
+	if err := m.setPaused(ctx, true); err != nil {
+		m.fail(ctx, "pausing the source: "+err.Error())
+		return
+	}
+
+	if err := m.advance(ctx, MigrationCopyingResources); err != nil {
+		m.fail(ctx, err.Error())
+		return
+	}
+	if err := m.copyToTarget(ctx); err != nil {
+		m.fail(ctx, "copying to the target: "+err.Error())
+		return
+	}
+
+	if err := m.advance(ctx, MigrationWaitingForAvailable); err != nil {
+		m.fail(ctx, err.Error())
+		return
+	}
+	if err := m.waitForAvailable(ctx); err != nil {
+		m.fail(ctx, err.Error())
+		return
+	}
+
+	// The target is serving: from here on a failure must not roll it back.
+	if err := m.advance(ctx, MigrationTearingDownSource); err != nil {
+		m.fail(ctx, err.Error())
+		return
+	}
+	m.completeTearDown(ctx)
+}
+
+// advance enters phase and records it on the source.
+func (m *migration) advance(ctx context.Context, phase MigrationPhase) error {
+	m.enter(phase, "")
+	return m.persist(ctx)
+}
+
+// completeTearDown deletes the source and finishes the migration.
+func (m *migration) completeTearDown(ctx context.Context) {
+	if err := m.tearDownSource(ctx); err != nil {
+		m.finish(ctx, MigrationFailed, "the target is Available but tearing down the source failed: "+err.Error())
+		return
+	}
+	m.finish(ctx, MigrationSucceeded, "")
+}
+
+// enter completes the current step and starts phase.
+func (m *migration) enter(phase MigrationPhase, msg string) {
+	now := metav1.Now()
+	m.p.migrations.update(m.ns, m.name, func(s *MigrationStatus) {
+		if n := len(s.Steps); n > 0 && s.Steps[n-1].CompletionTime == nil {
+			s.Steps[n-1].CompletionTime = &now
+		}
+		s.Phase = phase
+		s.Message = msg
+		if phase != MigrationSucceeded && phase != MigrationFailed {
+			s.Steps = append(s.Steps, MigrationStep{Phase: phase, StartTime: now})
+		}
+	})
+}
+
+// finish completes the migration, records the outcome on the source while it
+// exists and removes the migration from the index.
+func (m *migration) finish(ctx context.Context, phase MigrationPhase, msg string) {
+	m.enter(phase, msg)
+	m.p.migrations.update(m.ns, m.name, func(s *MigrationStatus) {
+		now := metav1.Now()
+		s.CompletionTime = &now
+	})
+	var spokeErr *spokeStatusError
+	if err := m.persist(ctx); err != nil && !(errors.As(err, &spokeErr) && spokeErr.code == http.StatusNotFound) {
+		m.p.log.Error(err, "failed to record the migration outcome on the source",
+			"name", m.name, "namespace", m.ns, "source", m.source)
+	}
+	if err := m.p.updateMigrationIndex(ctx, migrationIndexKey(m.source, m.ns, m.name), nil); err != nil {
+		m.p.log.Error(err, "failed to remove the migration from the index", "name", m.name, "namespace", m.ns)
+	}
+	m.p.log.Info("HostedCluster migration finished",
+		"name", m.name, "namespace", m.ns, "source", m.source, "target", m.target, "phase", phase, "message", msg)
+}
+
+// fail deletes the copies made on the target, newest first, unpauses the
+// source and marks the migration Failed.
+func (m *migration) fail(ctx context.Context, cause string) {
+	ctx, cancel := context.WithTimeout(ctx, rollbackTimeout)
+	defer cancel()
+
+	var rolledBack, rollbackErrors []string
+	for i := len(m.created) - 1; i >= 0; i-- {
+		res := m.created[i]
+		if err := m.p.deleteCreatedResource(ctx, m.client, m.target, m.ns, m.name, res); err != nil {
+			m.p.log.Error(err, "migration rollback failed", "resource", res.String(), "spoke", m.target)
+			rollbackErrors = append(rollbackErrors, fmt.Sprintf("%s: %v", res, err))
+			continue
+		}
+		rolledBack = append(rolledBack, res.String())
+	}
+	if err := m.setPaused(ctx, false); err != nil {
+		cause += "; unpausing the source failed: " + err.Error()
+	}
+	m.p.migrations.update(m.ns, m.name, func(s *MigrationStatus) {
+		s.RolledBack = rolledBack
+		s.RollbackErrors = rollbackErrors
+	})
+	m.finish(ctx, MigrationFailed, cause)
+}
+
+// setPaused sets (or clears) spec.pausedUntil on the source HostedCluster and
+// its NodePools, which stops (or resumes) their reconciliation. Objects that
+// are gone are skipped when unpausing.
+func (m *migration) setPaused(ctx context.Context, paused bool) error {
+	patch := []byte(`{"spec":{"pausedUntil":null}}`)
+	if paused {
+		patch = []byte(`{"spec":{"pausedUntil":"true"}}`)
+	}
+	nodePools, err := m.sourceNodePools(ctx)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(nodePools)+1)
+	hcPath, err := hsNamedAPIPath(m.ns, resourceHostedClusters, m.name)
+	if err != nil {
+		return err
+	}
+	paths = append(paths, hcPath)
+	for i := range nodePools {
+		npPath, err := hsNamedAPIPath(m.ns, resourceNodePools, nodePools[i].GetName())
+		if err != nil {
+			return err
+		}
+		paths = append(paths, npPath)
+	}
+	for _, apiPath := range paths {
+		err := m.p.mergePatchOnSpoke(ctx, m.client, m.source, apiPath, patch)
+		var spokeErr *spokeStatusError
+		if !paused && errors.As(err, &spokeErr) && spokeErr.code == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sourceNodePools returns the NodePools of the HostedCluster on the source.
+func (m *migration) sourceNodePools(ctx context.Context) ([]unstructured.Unstructured, error) {
+	npPath, err := hsCollectionAPIPath(m.ns, resourceNodePools)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	if err := m.p.getFromSpoke(ctx, m.client, m.source, npPath, nil, list); err != nil {
+		return nil, fmt.Errorf("listing NodePools: %w", err)
+	}
+	var out []unstructured.Unstructured
+	for _, np := range list.Items {
+		if clusterName, _, _ := unstructured.NestedString(np.Object, "spec", "clusterName"); clusterName == m.name {
+			out = append(out, np)
+		}
+	}
+	return out, nil
+}
+
+// copyToTarget writes the Namespace, the Secrets and ConfigMaps the
+// HostedCluster needs, the HostedCluster and its NodePools to the target. What it creates is kept in
+// m.created even on error, so the caller can roll it back.
+func (m *migration) copyToTarget(ctx context.Context) error {
+	hcPath, err := hsNamedAPIPath(m.ns, resourceHostedClusters, m.name)
+	if err != nil {
+		return err
+	}
+	hc := &unstructured.Unstructured{}
+	if err := m.p.getFromSpoke(ctx, m.client, m.source, hcPath, nil, hc); err != nil {
+		return fmt.Errorf("reading HostedCluster: %w", err)
+	}
+	nodePools, err := m.sourceNodePools(ctx)
+	if err != nil {
+		return err
+	}
+	secrets, configMaps, err := m.sourceObjects(ctx, hc, nodePools)
+	if err != nil {
+		return err
+	}
+
+	namespace := buildNamespace(m.ns, m.name)
+	if err := m.p.createOnSpoke(ctx, m.client, m.target, m.ns, "namespaces", namespace); err == nil {
+		res := createdResource{kind: "Namespace", resource: "namespaces", name: m.ns, uid: namespace.UID}
+		if err := m.recordCreated(ctx, res); err != nil {
+			return err
+		}
+	} else if !isAlreadyExists(err) {
+		return fmt.Errorf("creating Namespace %s: %w", m.ns, err)
+	}
+
+	for i := range secrets {
+		secret := &secrets[i]
+		isNew, err := m.p.createOrUpdateOnSpoke(ctx, m.client, m.target, m.ns, resourceSecrets, secret)
+		if err != nil {
+			return fmt.Errorf("copying Secret %s: %w", secret.Name, err)
+		}
+		res := createdResource{kind: kindSecret, resource: resourceSecrets, name: secret.Name, uid: secret.UID}
+		m.copied(res)
+		if isNew {
+			if err := m.recordCreated(ctx, res); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range configMaps {
+		cm := &configMaps[i]
+		isNew, err := m.p.createOrUpdateOnSpoke(ctx, m.client, m.target, m.ns, resourceConfigMaps, cm)
+		if err != nil {
+			return fmt.Errorf("copying ConfigMap %s: %w", cm.Name, err)
+		}
+		res := createdResource{kind: kindConfigMap, resource: resourceConfigMaps, name: cm.Name, uid: cm.UID}
+		m.copied(res)
+		if isNew {
+			if err := m.recordCreated(ctx, res); err != nil {
+				return err
+			}
+		}
+	}
+
+	unstructured.RemoveNestedField(hc.Object, "spec", "pausedUntil")
+	m.prepareCopy(hc)
+	if err := m.p.createOnSpoke(ctx, m.client, m.target, m.ns, resourceHostedClusters, hc); err != nil {
+		return fmt.Errorf("creating HostedCluster: %w", err)
+	}
+	res := createdResource{kind: "HostedCluster", resource: resourceHostedClusters, name: m.name, uid: hc.GetUID()}
+	m.copied(res)
+	if err := m.recordCreated(ctx, res); err != nil {
+		return err
+	}
+
+	for i := range nodePools {
+		np := &nodePools[i]
+		unstructured.RemoveNestedField(np.Object, "spec", "pausedUntil")
+		m.prepareCopy(np)
+		if err := m.p.createOnSpoke(ctx, m.client, m.target, m.ns, resourceNodePools, np); err != nil {
+			return fmt.Errorf("creating NodePool %s: %w", np.GetName(), err)
+		}
+		res := createdResource{kind: "NodePool", resource: resourceNodePools, name: np.GetName(), uid: np.GetUID()}
+		m.copied(res)
+		if err := m.recordCreated(ctx, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migration) copied(res createdResource) {
+	m.p.migrations.update(m.ns, m.name, func(s *MigrationStatus) {
+		s.Copied = append(s.Copied, res.String())
+	})
+}
+
+// recordCreated adds res to the copies a rollback deletes and records it on
+// the source before anything else is written, so that a restarted proxy can
+// delete it too.
+func (m *migration) recordCreated(ctx context.Context, res createdResource) error {
+	m.created = append(m.created, res)
+	return m.persist(ctx)
+}
+
+// prepareCopy strips the server-owned fields of a source object and stamps
+// the labels rollback checks for and the migrated-from annotation.
+func (m *migration) prepareCopy(obj *unstructured.Unstructured) {
+	for _, field := range []string{
+		"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields",
+		"ownerReferences", "finalizers", "deletionTimestamp", "deletionGracePeriodSeconds", "selfLink",
+	} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "status")
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[labelCreatedVia] = labelCreatedViaValue
+	labels[labelHostedCluster] = m.name
+	obj.SetLabels(labels)
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotationMigratedFrom] = m.source
+	delete(annotations, annotationMigration)
+	obj.SetAnnotations(annotations)
+}
+
+// sourceObjects reads the Secrets and ConfigMaps to copy: those the
+// HostedCluster and its NodePools reference (see objectReferences) and those
+// labeled hcp.ocm.io/hostedcluster=<name>.
+func (m *migration) sourceObjects(
+	ctx context.Context,
+	hc *unstructured.Unstructured,
+	nodePools []unstructured.Unstructured,
+) ([]corev1.Secret, []corev1.ConfigMap, error) {
+	typedHC := &hypershiftv1beta1.HostedCluster{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(hc.Object, typedHC); err != nil {
+		return nil, nil, fmt.Errorf("decoding HostedCluster: %w", err)
+	}
+	typedNodePools := make([]hypershiftv1beta1.NodePool, len(nodePools))
+	for i := range nodePools {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(nodePools[i].Object, &typedNodePools[i]); err != nil {
+			return nil, nil, fmt.Errorf("decoding NodePool %s: %w", nodePools[i].GetName(), err)
+		}
+	}
+
+	var secrets []corev1.Secret
+	var configMaps []corev1.ConfigMap
+	seen := map[corev1.TypedLocalObjectReference]bool{}
+	for _, ref := range objectReferences(typedHC, typedNodePools) {
+		seen[ref] = true
+		resource, out := resourceSecrets, interface{}(&corev1.Secret{})
+		if ref.Kind == kindConfigMap {
+			resource, out = resourceConfigMaps, &corev1.ConfigMap{}
+		}
+		apiPath, err := hsNamedAPIPath(m.ns, resource, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := m.p.getFromSpoke(ctx, m.client, m.source, apiPath, nil, out); err != nil {
+			return nil, nil, fmt.Errorf("reading %s %s: %w", ref.Kind, ref.Name, err)
+		}
+		switch obj := out.(type) {
+		case *corev1.Secret:
+			secrets = append(secrets, *obj)
+		case *corev1.ConfigMap:
+			configMaps = append(configMaps, *obj)
+		}
+	}
+
+	query := url.Values{"labelSelector": []string{labelHostedCluster + "=" + m.name}}
+	secretsPath, err := hsCollectionAPIPath(m.ns, resourceSecrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	labeledSecrets := &corev1.SecretList{}
+	if err := m.p.getFromSpoke(ctx, m.client, m.source, secretsPath, query, labeledSecrets); err != nil {
+		return nil, nil, fmt.Errorf("listing Secrets: %w", err)
+	}
+	for _, secret := range labeledSecrets.Items {
+		if ref := (corev1.TypedLocalObjectReference{Kind: kindSecret, Name: secret.Name}); !seen[ref] {
+			seen[ref] = true
+			secrets = append(secrets, secret)
+		}
+	}
+	configMapsPath, err := hsCollectionAPIPath(m.ns, resourceConfigMaps)
+	if err != nil {
+		return nil, nil, err
+	}
+	labeledConfigMaps := &corev1.ConfigMapList{}
+	if err := m.p.getFromSpoke(ctx, m.client, m.source, configMapsPath, query, labeledConfigMaps); err != nil {
+		return nil, nil, fmt.Errorf("listing ConfigMaps: %w", err)
+	}
+	for _, cm := range labeledConfigMaps.Items {
+		if ref := (corev1.TypedLocalObjectReference{Kind: kindConfigMap, Name: cm.Name}); !seen[ref] {
+			seen[ref] = true
+			configMaps = append(configMaps, cm)
+		}
+	}
+
+	for i := range secrets {
+		secrets[i].TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: kindSecret}
+		secrets[i].ObjectMeta = m.copyMeta(secrets[i].ObjectMeta)
+	}
+	for i := range configMaps {
+		configMaps[i].TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: kindConfigMap}
+		configMaps[i].ObjectMeta = m.copyMeta(configMaps[i].ObjectMeta)
+	}
+	return secrets, configMaps, nil
+}
+
+// copyMeta keeps the name, labels and annotations of a source Secret or
+// ConfigMap and stamps the labels rollback checks for.
+func (m *migration) copyMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	labels := map[string]string{}
+	for k, v := range meta.Labels {
+		labels[k] = v
+	}
+	labels[labelCreatedVia] = labelCreatedViaValue
+	labels[labelHostedCluster] = m.name
+	return metav1.ObjectMeta{Name: meta.Name, Namespace: m.ns, Labels: labels, Annotations: meta.Annotations}
+}
+
+// hostedClusterSecretRefs are the spec fields of a HostedCluster that name a
+// Secret in its namespace.
+var hostedClusterSecretRefs = [][]string{
+	{"spec", "pullSecret", "name"},
+	{"spec", "sshKey", "name"},
+	{"spec", "auditWebhook", "name"},
+	{"spec", "secretEncryption", "aescbc", "activeKey", "name"},
+	{"spec", "secretEncryption", "aescbc", "backupKey", "name"},
+	{"spec", "platform", "kubevirt", "credentials", "infraKubeConfigSecret", "name"},
+	{"spec", "platform", "openstack", "identityRef", "name"},
+}
+
+// referencedSecretNames returns the Secrets named in the HostedCluster spec,
+// including the named serving certificates of its API server and the
+// Secrets of its OAuth identity providers.
+func referencedSecretNames(hc *unstructured.Unstructured) []string {
+	var names []string
+	for _, fields := range hostedClusterSecretRefs {
+		if name, _, _ := unstructured.NestedString(hc.Object, fields...); name != "" {
+			names = append(names, name)
+		}
+	}
+	oauthSecrets, _ := identityProviderReferences(hc)
+	names = append(names, oauthSecrets...)
+	named, _, _ := unstructured.NestedSlice(hc.Object,
+		"spec", "configuration", "apiServer", "servingCerts", "namedCertificates")
+	for _, entry := range named {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(m, "servingCertificate", "name"); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// waitForAvailable polls the target HostedCluster until its Available
+// condition is True or availableTimeout passes.
+func (m *migration) waitForAvailable(ctx context.Context) error {
+	hcPath, err := hsNamedAPIPath(m.ns, resourceHostedClusters, m.name)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.availableTimeout)
+	defer cancel()
+	lastMessage := ""
+	for {
+		hc := &unstructured.Unstructured{}
+		if err := m.p.getFromSpoke(ctx, m.client, m.target, hcPath, nil, hc); err != nil {
+			lastMessage = err.Error()
+		} else {
+			available, message := conditionCell(hc, "Available")
+			if available == string(metav1.ConditionTrue) {
+				return nil
+			}
+			lastMessage = message
+			m.p.migrations.update(m.ns, m.name, func(s *MigrationStatus) { s.Message = message })
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("the target did not become Available within %s: %s", m.availableTimeout, lastMessage)
+		case <-time.After(migrationPollInterval):
+		}
+	}
+}
+
+// tearDownSource deletes the source NodePools and HostedCluster, then
+// unpauses them so their finalizers run.
+func (m *migration) tearDownSource(ctx context.Context) error {
+	nodePools, err := m.sourceNodePools(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range nodePools {
+		m.p.deleteNodePool(ctx, m.client, m.ns, m.source, nodePools[i].GetName(), nil)
+	}
+	hcPath, err := hsNamedAPIPath(m.ns, resourceHostedClusters, m.name)
+	if err != nil {
+		return err
+	}
+	req, err := m.p.newSpokeRequest(ctx, http.MethodDelete, m.source, hcPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doSpokeHTTP(m.client, req)
+	if err != nil {
+		return err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return newSpokeStatusError(resp.StatusCode, body)
+	}
+	return m.setPaused(ctx, false)
+}
+
+// getFromSpoke GETs apiPath on the spoke and decodes the response into out.
+// Non-200 responses are returned as a *spokeStatusError.
+func (p *hcpProxy) getFromSpoke(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, apiPath string,
+	query url.Values,
+	out interface{},
+) error {
+	req, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = query.Encode()
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newSpokeStatusError(resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// mergePatchOnSpoke sends a JSON merge patch to apiPath on the spoke.
+func (p *hcpProxy) mergePatchOnSpoke(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, apiPath string,
+	patch []byte,
+) error {
+	req, err := p.newSpokeRequest(ctx, http.MethodPatch, spokeName, apiPath, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerContentType, contentTypeMergePatch)
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return newSpokeStatusError(resp.StatusCode, body)
+	}
+	return nil
+}
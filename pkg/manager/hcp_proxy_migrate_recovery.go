@@ -0,0 +1,324 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// annotationMigration is set on the source HostedCluster of a migration and
+	// holds its migrationRecord, so that a restarted proxy can finish it.
+	annotationMigration = "hcp.ocm.io/migration"
+
+	// migrationIndexConfigMapName is the ConfigMap in the operator namespace
+	// that lists the migrations in progress and who started them.
+	migrationIndexConfigMapName = "hcp-proxy-migrations"
+
+	// migrationRecoveryInterval is how often migrations that could not be
+	// recovered at startup, e.g. because a hosting cluster was unreachable,
+	// are retried.
+	migrationRecoveryInterval = time.Minute
+)
+
+// migrationRecord is the value of the hcp.ocm.io/migration annotation.
+type migrationRecord struct {
+	Target         string             `json:"target"`
+	Phase          MigrationPhase     `json:"phase"`
+	Message        string             `json:"message,omitempty"`
+	StartTime      metav1.Time        `json:"startTime"`
+	CompletionTime *metav1.Time       `json:"completionTime,omitempty"`
+	Copied         []string           `json:"copied,omitempty"`
+	Created        []recordedResource `json:"created,omitempty"`
+}
+
+// recordedResource is a copy the migration created on the target and a
+// rollback deletes.
+type recordedResource struct {
+	Kind     string    `json:"kind"`
+	Resource string    `json:"resource"`
+	Name     string    `json:"name"`
+	UID      types.UID `json:"uid"`
+}
+
+func (r *migrationRecord) finished() bool {
+	return r.Phase == MigrationSucceeded || r.Phase == MigrationFailed
+}
+
+// status rebuilds the MigrationStatus of a migration read from its source.
+// The steps before the recorded phase are not kept.
+func (r *migrationRecord) status(ns, name, source string) MigrationStatus {
+	status := MigrationStatus{
+		Namespace:      ns,
+		Name:           name,
+		Source:         source,
+		Target:         r.Target,
+		Phase:          r.Phase,
+		Message:        r.Message,
+		StartTime:      r.StartTime,
+		CompletionTime: r.CompletionTime,
+		Steps:          []MigrationStep{},
+		Copied:         r.Copied,
+	}
+	if !r.finished() {
+		status.Steps = append(status.Steps, MigrationStep{Phase: r.Phase, StartTime: r.StartTime})
+	}
+	return status
+}
+
+func (r *migrationRecord) createdResources() []createdResource {
+	created := make([]createdResource, 0, len(r.Created))
+	for _, res := range r.Created {
+		created = append(created, createdResource{kind: res.Kind, resource: res.Resource, name: res.Name, uid: res.UID})
+	}
+	return created
+}
+
+// migrationRecordOf returns the migration recorded on a source HostedCluster,
+// or nil if there is none or it cannot be read.
+func migrationRecordOf(hc *hypershiftv1beta1.HostedCluster) *migrationRecord {
+	raw, ok := hc.GetAnnotations()[annotationMigration]
+	if !ok {
+		return nil
+	}
+	record := &migrationRecord{}
+	if err := json.Unmarshal([]byte(raw), record); err != nil || record.Target == "" {
+		return nil
+	}
+	return record
+}
+
+// persist writes the migration to the hcp.ocm.io/migration annotation of the
+// source HostedCluster.
+func (m *migration) persist(ctx context.Context) error {
+	status, ok := m.p.migrations.get(m.ns, m.name)
+	if !ok {
+		return nil
+	}
+	record := migrationRecord{
+		Target:         m.target,
+		Phase:          status.Phase,
+		Message:        status.Message,
+		StartTime:      status.StartTime,
+		CompletionTime: status.CompletionTime,
+		Copied:         status.Copied,
+	}
+	for _, res := range m.created {
+		record.Created = append(record.Created, recordedResource{
+			Kind: res.kind, Resource: res.resource, Name: res.name, UID: res.uid,
+		})
+	}
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annotationMigration: string(raw)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	hcPath, err := hsNamedAPIPath(m.ns, resourceHostedClusters, m.name)
+	if err != nil {
+		return err
+	}
+	if err := m.p.mergePatchOnSpoke(ctx, m.client, m.source, hcPath, patch); err != nil {
+		return fmt.Errorf("recording the migration on the source: %w", err)
+	}
+	return nil
+}
+
+// migrationIndexEntry is one value of the hcp-proxy-migrations ConfigMap. The
+// identity a migration runs as is kept on the hub rather than in the
+// annotation, so that whoever can edit the source HostedCluster cannot choose
+// who the proxy acts as when it recovers the migration.
+type migrationIndexEntry struct {
+	Source    string   `json:"source"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	User      string   `json:"user"`
+	Groups    []string `json:"groups,omitempty"`
+}
+
+// migrationIndexKey is the ConfigMap key of a migration. "_" cannot appear in
+// the names it joins.
+func migrationIndexKey(source, ns, name string) string {
+	return source + "_" + ns + "_" + name
+}
+
+// migrationIndex returns the migrations listed in the hcp-proxy-migrations
+// ConfigMap. Entries that cannot be decoded are skipped.
+func (p *hcpProxy) migrationIndex(ctx context.Context) ([]migrationIndexEntry, error) {
+	cm := &corev1.ConfigMap{}
+	err := p.hubClient.Get(ctx, types.NamespacedName{Namespace: p.operatorNamespace, Name: migrationIndexConfigMapName}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]migrationIndexEntry, 0, len(cm.Data))
+	for key, value := range cm.Data {
+		var entry migrationIndexEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			p.log.Error(err, "skipping invalid migration index entry", "key", key)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// updateMigrationIndex adds entry to the hcp-proxy-migrations ConfigMap under
+// key, or removes key when entry is nil.
+func (p *hcpProxy) updateMigrationIndex(ctx context.Context, key string, entry *migrationIndexEntry) error {
+	var value string
+	if entry != nil {
+		raw, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		value = string(raw)
+	}
+	retriable := func(err error) bool { return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) }
+	return retry.OnError(retry.DefaultBackoff, retriable, func() error {
+		cm := &corev1.ConfigMap{}
+		err := p.hubClient.Get(ctx, types.NamespacedName{Namespace: p.operatorNamespace, Name: migrationIndexConfigMapName}, cm)
+		switch {
+		case apierrors.IsNotFound(err):
+			if entry == nil {
+				return nil
+			}
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: p.operatorNamespace, Name: migrationIndexConfigMapName},
+				Data:       map[string]string{key: value},
+			}
+			return p.hubClient.Create(ctx, cm)
+		case err != nil:
+			return err
+		}
+		if entry == nil {
+			if _, ok := cm.Data[key]; !ok {
+				return nil
+			}
+			delete(cm.Data, key)
+		} else {
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[key] = value
+		}
+		return p.hubClient.Update(ctx, cm)
+	})
+}
+
+// recoverMigrations finishes the migrations a previous run of the proxy left
+// in progress: those interrupted while tearing down the source are completed,
+// the others are rolled back. Migrations that cannot be recovered yet are
+// retried every migrationRecoveryInterval until ctx is done.
+func (p *hcpProxy) recoverMigrations(ctx context.Context) {
+	for !p.recoverMigrationsOnce(ctx) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(migrationRecoveryInterval):
+		}
+	}
+}
+
+// recoverMigrationsOnce recovers every migration in the index that this
+// process is not running. It returns false if any is left to retry.
+func (p *hcpProxy) recoverMigrationsOnce(ctx context.Context) bool {
+	entries, err := p.migrationIndex(ctx)
+	if err != nil {
+		p.log.Error(err, "failed to read the migration index", "namespace", p.operatorNamespace,
+			"name", migrationIndexConfigMapName)
+		return false
+	}
+	done := true
+	for _, entry := range entries {
+		if status, ok := p.migrations.get(entry.Namespace, entry.Name); ok && !status.finished() {
+			continue
+		}
+		if err := p.recoverMigration(ctx, entry); err != nil {
+			p.log.Error(err, "failed to recover HostedCluster migration, will retry",
+				"name", entry.Name, "namespace", entry.Namespace, "source", entry.Source)
+			done = false
+		}
+	}
+	return done
+}
+
+// recoverMigration reads the migration recorded on the source HostedCluster
+// and finishes it as the user who started it.
+func (p *hcpProxy) recoverMigration(ctx context.Context, entry migrationIndexEntry) error {
+	key := migrationIndexKey(entry.Source, entry.Namespace, entry.Name)
+	hcpClient, err := p.spokeHTTPClient(entry.User, entry.Groups)
+	if err != nil {
+		return err
+	}
+	hc, code, msg := p.fetchHostedCluster(ctx, hcpClient, entry.Namespace, entry.Name, entry.Source)
+	if code == http.StatusNotFound {
+		return p.updateMigrationIndex(ctx, key, nil)
+	}
+	if hc == nil {
+		return errors.New(msg)
+	}
+	record := migrationRecordOf(hc)
+	if record == nil || record.finished() {
+		return p.updateMigrationIndex(ctx, key, nil)
+	}
+
+	status := record.status(entry.Namespace, entry.Name, entry.Source)
+	if !p.migrations.begin(&status) {
+		return nil
+	}
+	m := &migration{
+		p:       p,
+		client:  hcpClient,
+		ns:      entry.Namespace,
+		name:    entry.Name,
+		source:  entry.Source,
+		target:  record.Target,
+		created: record.createdResources(),
+	}
+	p.log.Info("recovering HostedCluster migration", "name", m.name, "namespace", m.ns,
+		"source", m.source, "target", m.target, "phase", record.Phase, "user", entry.User)
+	if record.Phase == MigrationTearingDownSource {
+		m.completeTearDown(ctx)
+		return nil
+	}
+	m.fail(ctx, fmt.Sprintf("the HCP proxy restarted while the migration was in phase %s", record.Phase))
+	return nil
+}
+
+// recordedMigration returns the migration recorded on the source
+// HostedCluster, for GET .../migrate after the proxy restarted.
+func (p *hcpProxy) recordedMigration(r *http.Request, ns, name, spokeName string) (MigrationStatus, bool) {
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		return MigrationStatus{}, false
+	}
+	hc, _, _ := p.fetchHostedCluster(r.Context(), hcpClient, ns, name, spokeName)
+	if hc == nil {
+		return MigrationStatus{}, false
+	}
+	record := migrationRecordOf(hc)
+	if record == nil {
+		return MigrationStatus{}, false
+	}
+	return record.status(ns, name, spokeName), true
+}
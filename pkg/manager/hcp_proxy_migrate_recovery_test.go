@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// migrationIndexData returns the data of the hcp-proxy-migrations ConfigMap.
+func migrationIndexData(t *testing.T, p *hcpProxy) map[string]string {
+	t.Helper()
+	cm := &corev1.ConfigMap{}
+	err := p.hubClient.Get(context.Background(),
+		types.NamespacedName{Namespace: p.operatorNamespace, Name: migrationIndexConfigMapName}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	return cm.Data
+}
+
+// recordedOn decodes the hcp.ocm.io/migration annotation of a spoke object.
+func recordedOn(t *testing.T, obj map[string]interface{}) migrationRecord {
+	t.Helper()
+	annotations, _ := obj["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	raw, ok := annotations[annotationMigration].(string)
+	require.True(t, ok, "no migration recorded")
+	var record migrationRecord
+	require.NoError(t, json.Unmarshal([]byte(raw), &record))
+	return record
+}
+
+// interruptMigration leaves the spoke and the hub as a proxy that stopped
+// during phase would: the source paused and recording the migration, its
+// copies on spoke-2 and the index entry.
+func interruptMigration(t *testing.T, spoke *migrationSpoke, p *hcpProxy, phase MigrationPhase) {
+	t.Helper()
+	seedMigrationSource(spoke)
+	copyLabels := map[string]interface{}{labelCreatedVia: labelCreatedViaValue, labelHostedCluster: "my-hc"}
+	spoke.put("/spoke-2"+apiPathCoreNamespaces+"/clusters", map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "clusters", "uid": "dst-ns", "labels": copyLabels},
+	})
+	spoke.put(strings.Replace(migrateHCPath, "/spoke-1", "/spoke-2", 1), map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "my-hc", "namespace": "clusters", "uid": "dst-hc", "labels": copyLabels},
+	})
+
+	record, err := json.Marshal(migrationRecord{
+		Target:    "spoke-2",
+		Phase:     phase,
+		StartTime: metav1.Now(),
+		Copied:    []string{"HostedCluster/my-hc"},
+		Created: []recordedResource{
+			{Kind: "Namespace", Resource: "namespaces", Name: "clusters", UID: "dst-ns"},
+			{Kind: "HostedCluster", Resource: resourceHostedClusters, Name: "my-hc", UID: "dst-hc"},
+		},
+	})
+	require.NoError(t, err)
+	spoke.mu.Lock()
+	for _, path := range []string{migrateHCPath, migrateNPPath} {
+		spoke.objects[path]["spec"].(map[string]interface{})["pausedUntil"] = "true"
+	}
+	spoke.objects[migrateHCPath]["metadata"].(map[string]interface{})["annotations"] = map[string]interface{}{
+		annotationMigration: string(record),
+	}
+	spoke.mu.Unlock()
+
+	require.NoError(t, p.updateMigrationIndex(context.Background(), migrationIndexKey("spoke-1", "clusters", "my-hc"),
+		&migrationIndexEntry{Source: "spoke-1", Namespace: "clusters", Name: "my-hc", User: "alice"}))
+}
+
+func Test_recoverMigrations_WhenInterruptedBeforeAvailable_ItShouldRollBackAndUnpause(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+	interruptMigration(t, spoke, p, MigrationWaitingForAvailable)
+
+	require.True(t, p.recoverMigrationsOnce(context.Background()))
+
+	assert.True(t, spoke.has(migrateHCPath), "source HostedCluster should be kept")
+	assert.False(t, spoke.has(strings.Replace(migrateHCPath, "/spoke-1", "/spoke-2", 1)))
+	assert.False(t, spoke.has("/spoke-2"+apiPathCoreNamespaces+"/clusters"))
+	assert.Empty(t, migrationIndexData(t, p))
+
+	status := waitForMigration(t, p)
+	assert.Equal(t, MigrationFailed, status.Phase)
+	assert.Contains(t, status.Message, "restarted")
+	assert.Equal(t, []string{"HostedCluster/my-hc", "Namespace/clusters"}, status.RolledBack)
+
+	spoke.mu.Lock()
+	defer spoke.mu.Unlock()
+	assert.NotContains(t, spoke.objects[migrateHCPath]["spec"], "pausedUntil", "source should be unpaused")
+	assert.NotContains(t, spoke.objects[migrateNPPath]["spec"], "pausedUntil", "source should be unpaused")
+	assert.Equal(t, MigrationFailed, recordedOn(t, spoke.objects[migrateHCPath]).Phase)
+}
+
+func Test_recoverMigrations_WhenInterruptedDuringTearDown_ItShouldDeleteTheSource(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+	interruptMigration(t, spoke, p, MigrationTearingDownSource)
+
+	require.True(t, p.recoverMigrationsOnce(context.Background()))
+
+	assert.False(t, spoke.has(migrateHCPath), "source HostedCluster should be deleted")
+	assert.False(t, spoke.has(migrateNPPath), "source NodePool should be deleted")
+	assert.True(t, spoke.has(strings.Replace(migrateHCPath, "/spoke-1", "/spoke-2", 1)), "the target should be kept")
+	assert.Empty(t, migrationIndexData(t, p))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodGet, ""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var status MigrationStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, MigrationSucceeded, status.Phase)
+}
+
+func Test_recoverMigrations_WhenSourceIsGone_ItShouldDropTheIndexEntry(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+	require.NoError(t, p.updateMigrationIndex(context.Background(), migrationIndexKey("spoke-1", "clusters", "my-hc"),
+		&migrationIndexEntry{Source: "spoke-1", Namespace: "clusters", Name: "my-hc", User: "alice"}))
+
+	require.True(t, p.recoverMigrationsOnce(context.Background()))
+	assert.Empty(t, migrationIndexData(t, p))
+	assert.Empty(t, spoke.deletes)
+}
+
+func Test_handleRoute_WhenMigrationOnlyRecordedOnTheSource_ItShouldReturnIt(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+	interruptMigration(t, spoke, p, MigrationCopyingResources)
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodGet, ""))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var status MigrationStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, MigrationCopyingResources, status.Phase)
+	assert.Equal(t, "spoke-2", status.Target)
+	assert.Equal(t, []string{"HostedCluster/my-hc"}, status.Copied)
+}
+
+func Test_handleRoute_WhenSourceRecordsAMigrationInProgress_ItShouldReturn409(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-3"))
+	interruptMigration(t, spoke, p, MigrationWaitingForAvailable)
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodPost, "&target=spoke-3&acknowledgeDataLoss=true"))
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "spoke-2")
+}
@@ -0,0 +1,437 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// migrationSpoke is an in-memory store behind every hosting cluster of a
+// migration test, keyed by request path (which starts with /{cluster}).
+// HostedClusters created on a cluster are reported Available unless that
+// cluster is listed in neverAvailable.
+type migrationSpoke struct {
+	mu             sync.Mutex
+	objects        map[string]map[string]interface{}
+	neverAvailable map[string]bool
+	failCreateOn   string
+	patches        []string
+	deletes        []string
+	seq            int
+}
+
+func newMigrationSpoke(t *testing.T) (*migrationSpoke, *httptest.Server) {
+	t.Helper()
+	s := &migrationSpoke{objects: map[string]map[string]interface{}{}, neverAvailable: map[string]bool{}}
+	srv := httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *migrationSpoke) put(path string, obj map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[path] = obj
+}
+
+func (s *migrationSpoke) has(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[path]
+	return ok
+}
+
+func (s *migrationSpoke) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set(headerContentType, contentTypeJSON)
+	switch r.Method {
+	case http.MethodGet:
+		if obj, ok := s.objects[r.URL.Path]; ok {
+			_ = json.NewEncoder(w).Encode(obj)
+			return
+		}
+		if isMigrationSpokeCollection(r.URL.Path) {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": s.list(r.URL.Path, r.URL.Query().Get("labelSelector"))})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case http.MethodPost:
+		if s.failCreateOn != "" && strings.Contains(r.URL.Path, s.failCreateOn) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"kind":"Status","message":"denied"}`)
+			return
+		}
+		var obj map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&obj)
+		md := obj["metadata"].(map[string]interface{})
+		key := r.URL.Path + "/" + md["name"].(string)
+		if _, ok := s.objects[key]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.seq++
+		md["uid"] = fmt.Sprintf("uid-%d", s.seq)
+		cluster := strings.Split(r.URL.Path, "/")[1]
+		if strings.HasSuffix(r.URL.Path, "/hostedclusters") && !s.neverAvailable[cluster] {
+			obj["status"] = map[string]interface{}{"conditions": []interface{}{
+				map[string]interface{}{"type": "Available", "status": "True"},
+			}}
+		}
+		s.objects[key] = obj
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(obj)
+	case http.MethodPut:
+		var obj map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&obj)
+		s.objects[r.URL.Path] = obj
+		_ = json.NewEncoder(w).Encode(obj)
+	case http.MethodPatch:
+		obj, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("dryRun") != "" {
+			_ = json.NewEncoder(w).Encode(obj)
+			return
+		}
+		raw, _ := io.ReadAll(r.Body)
+		s.patches = append(s.patches, r.URL.Path+" "+string(raw))
+		var patch struct {
+			Metadata map[string]map[string]interface{} `json:"metadata"`
+			Spec     map[string]interface{}            `json:"spec"`
+		}
+		_ = json.Unmarshal(raw, &patch)
+		for _, field := range []string{"labels", "annotations"} {
+			if len(patch.Metadata[field]) == 0 {
+				continue
+			}
+			md := obj["metadata"].(map[string]interface{})
+			values, _ := md[field].(map[string]interface{})
+			if values == nil {
+				values = map[string]interface{}{}
+				md[field] = values
+			}
+			for k, v := range patch.Metadata[field] {
+				values[k] = v
+			}
+		}
+		if patch.Spec != nil {
+			spec, _ := obj["spec"].(map[string]interface{})
+			if spec == nil {
+				spec = map[string]interface{}{}
+				obj["spec"] = spec
+			}
+			if until := patch.Spec["pausedUntil"]; until == nil {
+				delete(spec, "pausedUntil")
+			} else {
+				spec["pausedUntil"] = until
+			}
+		}
+		_ = json.NewEncoder(w).Encode(obj)
+	case http.MethodDelete:
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		s.deletes = append(s.deletes, r.URL.Path)
+		_, _ = io.WriteString(w, `{}`)
+	}
+}
+
+func isMigrationSpokeCollection(path string) bool {
+	for _, resource := range []string{
+		resourceHostedClusters, resourceNodePools, resourceSecrets, resourceConfigMaps,
+		"persistentvolumeclaims", "pods", "events",
+	} {
+		if strings.HasSuffix(path, "/"+resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the objects directly under collection that match a label
+// selector of comma-separated key=value pairs.
+func (s *migrationSpoke) list(collection, selector string) []interface{} {
+	items := []interface{}{}
+	for path, obj := range s.objects {
+		name := strings.TrimPrefix(path, collection+"/")
+		if name == path || strings.Contains(name, "/") {
+			continue
+		}
+		if matchesSelector(obj, selector) {
+			items = append(items, obj)
+		}
+	}
+	return items
+}
+
+func matchesSelector(obj map[string]interface{}, selector string) bool {
+	labels, _ := obj["metadata"].(map[string]interface{})["labels"].(map[string]interface{})
+	for _, requirement := range strings.Split(selector, ",") {
+		if key, value, ok := strings.Cut(requirement, "="); ok && labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	migrateHCPath     = "/spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters/my-hc"
+	migrateNPPath     = "/spoke-1" + apiPathHSNamespaces + "/clusters/nodepools/my-hc-pool"
+	migrateSecretPath = "/spoke-1" + apiPathCoreNamespaces + "/clusters/secrets/my-hc-pull-secret"
+)
+
+// seedMigrationSource puts clusters/my-hc, its NodePool and pull secret on spoke-1.
+func seedMigrationSource(s *migrationSpoke) {
+	s.put(migrateHCPath, map[string]interface{}{
+		"apiVersion": "hypershift.openshift.io/v1beta1",
+		"kind":       "HostedCluster",
+		"metadata":   map[string]interface{}{"name": "my-hc", "namespace": "clusters", "uid": "src-hc", "resourceVersion": "7"},
+		"spec":       map[string]interface{}{"pullSecret": map[string]interface{}{"name": "my-hc-pull-secret"}},
+		"status":     map[string]interface{}{"version": map[string]interface{}{}},
+	})
+	s.put(migrateNPPath, map[string]interface{}{
+		"apiVersion": "hypershift.openshift.io/v1beta1",
+		"kind":       "NodePool",
+		"metadata":   map[string]interface{}{"name": "my-hc-pool", "namespace": "clusters", "uid": "src-np"},
+		"spec":       map[string]interface{}{"clusterName": "my-hc", "replicas": 2},
+	})
+	s.put(migrateSecretPath, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "my-hc-pull-secret", "namespace": "clusters", "uid": "src-secret"},
+		"data":       map[string]interface{}{".dockerconfigjson": "e30="},
+	})
+}
+
+func migrateRequest(method, query string) *http.Request {
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc/migrate?hostingCluster=spoke-1" + query
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+func setFastMigrationPoll(t *testing.T) {
+	t.Helper()
+	old := migrationPollInterval
+	migrationPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { migrationPollInterval = old })
+}
+
+// waitForMigration polls GET .../migrate until the migration finishes.
+func waitForMigration(t *testing.T, p *hcpProxy) MigrationStatus {
+	t.Helper()
+	var status MigrationStatus
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		p.handleRoute(w, migrateRequest(http.MethodGet, ""))
+		if w.Code != http.StatusOK {
+			return false
+		}
+		status = MigrationStatus{}
+		return json.Unmarshal(w.Body.Bytes(), &status) == nil && status.finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return status
+}
+
+func Test_handleRoute_WhenMigrateSucceeds_ItShouldMoveEverythingAndTearDownSource(t *testing.T) {
+	setFastMigrationPoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodPost, "&target=spoke-2&acknowledgeDataLoss=true"))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var accepted MigrationStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, MigrationPausingSource, accepted.Phase)
+	assert.Equal(t, "spoke-2", accepted.Target)
+
+	status := waitForMigration(t, p)
+	require.Equal(t, MigrationSucceeded, status.Phase, status.Message)
+	assert.Equal(t, []string{"Secret/my-hc-pull-secret", "HostedCluster/my-hc", "NodePool/my-hc-pool"}, status.Copied)
+	phases := make([]MigrationPhase, 0, len(status.Steps))
+	for _, step := range status.Steps {
+		phases = append(phases, step.Phase)
+		assert.NotNil(t, step.CompletionTime)
+	}
+	assert.Equal(t, []MigrationPhase{
+		MigrationPausingSource, MigrationCopyingResources, MigrationWaitingForAvailable, MigrationTearingDownSource,
+	}, phases)
+	assert.NotNil(t, status.CompletionTime)
+
+	assert.False(t, spoke.has(migrateHCPath), "source HostedCluster should be deleted")
+	assert.False(t, spoke.has(migrateNPPath), "source NodePool should be deleted")
+	targetHC := strings.Replace(migrateHCPath, "/spoke-1", "/spoke-2", 1)
+	require.True(t, spoke.has(targetHC))
+	spoke.mu.Lock()
+	hc := spoke.objects[targetHC]
+	spoke.mu.Unlock()
+	md := hc["metadata"].(map[string]interface{})
+	assert.Equal(t, "spoke-1", md["annotations"].(map[string]interface{})[annotationMigratedFrom])
+	assert.NotContains(t, md["annotations"], annotationMigration)
+	assert.Equal(t, labelCreatedViaValue, md["labels"].(map[string]interface{})[labelCreatedVia])
+	assert.NotContains(t, md, "resourceVersion")
+	assert.NotContains(t, hc["spec"], "pausedUntil")
+	assert.True(t, spoke.has(strings.Replace(migrateSecretPath, "/spoke-1", "/spoke-2", 1)))
+	assert.True(t, spoke.has(strings.Replace(migrateNPPath, "/spoke-1", "/spoke-2", 1)))
+	assert.Empty(t, migrationIndexData(t, p), "the migration should leave the index")
+}
+
+func Test_handleRoute_WhenMigrateReferencesConfigMaps_ItShouldCopyThem(t *testing.T) {
+	setFastMigrationPoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	spoke.mu.Lock()
+	spoke.objects[migrateHCPath]["spec"].(map[string]interface{})["additionalTrustBundle"] = map[string]interface{}{"name": "my-hc-ca"}
+	spoke.objects[migrateNPPath]["spec"].(map[string]interface{})["config"] = []interface{}{
+		map[string]interface{}{"name": "my-hc-machineconfig"},
+	}
+	spoke.mu.Unlock()
+	configMapsPath := "/spoke-1" + apiPathCoreNamespaces + "/clusters/configmaps/"
+	for _, name := range []string{"my-hc-ca", "my-hc-machineconfig"} {
+		spoke.put(configMapsPath+name, map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": name, "namespace": "clusters", "uid": "src-" + name},
+			"data":       map[string]interface{}{"key": "value"},
+		})
+	}
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodPost, "&target=spoke-2&acknowledgeDataLoss=true"))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	status := waitForMigration(t, p)
+	require.Equal(t, MigrationSucceeded, status.Phase, status.Message)
+	assert.Equal(t, []string{
+		"Secret/my-hc-pull-secret", "ConfigMap/my-hc-ca", "ConfigMap/my-hc-machineconfig",
+		"HostedCluster/my-hc", "NodePool/my-hc-pool",
+	}, status.Copied)
+	for _, name := range []string{"my-hc-ca", "my-hc-machineconfig"} {
+		targetPath := strings.Replace(configMapsPath, "/spoke-1", "/spoke-2", 1) + name
+		require.True(t, spoke.has(targetPath), name)
+		spoke.mu.Lock()
+		md := spoke.objects[targetPath]["metadata"].(map[string]interface{})
+		spoke.mu.Unlock()
+		assert.Equal(t, labelCreatedViaValue, md["labels"].(map[string]interface{})[labelCreatedVia])
+		assert.NotEqual(t, "src-"+name, md["uid"])
+	}
+}
+
+func Test_handleRoute_WhenMigrateTargetNeverAvailable_ItShouldRollBackAndUnpause(t *testing.T) {
+	setFastMigrationPoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	spoke.neverAvailable["spoke-2"] = true
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodPost, "&target=spoke-2&timeoutSeconds=1&acknowledgeDataLoss=true"))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	status := waitForMigration(t, p)
+	require.Equal(t, MigrationFailed, status.Phase)
+	assert.Contains(t, status.Message, "did not become Available")
+	assert.Equal(t, []string{
+		"NodePool/my-hc-pool", "HostedCluster/my-hc", "Secret/my-hc-pull-secret", "Namespace/clusters",
+	}, status.RolledBack)
+	assert.Empty(t, status.RollbackErrors)
+
+	assert.True(t, spoke.has(migrateHCPath), "source HostedCluster should be kept")
+	assert.False(t, spoke.has(strings.Replace(migrateHCPath, "/spoke-1", "/spoke-2", 1)))
+	spoke.mu.Lock()
+	defer spoke.mu.Unlock()
+	assert.NotContains(t, spoke.objects[migrateHCPath]["spec"], "pausedUntil", "source should be unpaused")
+	assert.NotContains(t, spoke.objects[migrateNPPath]["spec"], "pausedUntil", "source should be unpaused")
+	record := recordedOn(t, spoke.objects[migrateHCPath])
+	assert.Equal(t, MigrationFailed, record.Phase)
+	assert.Equal(t, "spoke-2", record.Target)
+}
+
+func Test_handleRoute_WhenMigrateCopyFails_ItShouldKeepSource(t *testing.T) {
+	setFastMigrationPoll(t)
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	spoke.failCreateOn = "/spoke-2" + apiPathHSNamespaces + "/clusters/nodepools"
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodPost, "&target=spoke-2&acknowledgeDataLoss=true"))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	status := waitForMigration(t, p)
+	require.Equal(t, MigrationFailed, status.Phase)
+	assert.Contains(t, status.Message, "creating NodePool my-hc-pool")
+	assert.Contains(t, status.RolledBack, "HostedCluster/my-hc")
+	assert.True(t, spoke.has(migrateHCPath))
+	assert.True(t, spoke.has(migrateNPPath))
+}
+
+func Test_handleRoute_WhenMigrateTargetHasHostedCluster_ItShouldReturn409(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	spoke.put(strings.Replace(migrateHCPath, "/spoke-1", "/spoke-2", 1), map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "my-hc", "namespace": "clusters"},
+	})
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"), availableManagedCluster("spoke-2"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodPost, "&target=spoke-2&acknowledgeDataLoss=true"))
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	assert.Empty(t, spoke.patches, "the source should not be paused")
+}
+
+func Test_handleRoute_WhenMigrateRequestInvalid_ItShouldReturn400(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", availableManagedCluster("spoke-1"))
+	for name, query := range map[string]string{
+		"missing target":   "",
+		"same cluster":     "&target=spoke-1",
+		"bad timeout":      "&target=spoke-2&timeoutSeconds=-1",
+		"dry run":          "&target=spoke-2&dryRun=All&acknowledgeDataLoss=true",
+		"not acknowledged": "&target=spoke-2",
+		"bad acknowledge":  "&target=spoke-2&acknowledgeDataLoss=maybe",
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			p.handleRoute(w, migrateRequest(http.MethodPost, query))
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+		})
+	}
+}
+
+func Test_handleRoute_WhenNoMigrationRecorded_ItShouldReturn404(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", availableManagedCluster("spoke-1"))
+	w := httptest.NewRecorder()
+	p.handleRoute(w, migrateRequest(http.MethodGet, ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_migrationTracker_WhenMigrationRunning_ItShouldRefuseAnother(t *testing.T) {
+	var tracker migrationTracker
+	now := metav1.Now()
+	require.True(t, tracker.begin(&MigrationStatus{Namespace: "clusters", Name: "my-hc", Phase: MigrationPausingSource}))
+	assert.False(t, tracker.begin(&MigrationStatus{Namespace: "clusters", Name: "my-hc", Phase: MigrationPausingSource}))
+
+	tracker.update("clusters", "my-hc", func(s *MigrationStatus) {
+		s.Phase = MigrationFailed
+		s.CompletionTime = &now
+	})
+	assert.True(t, tracker.begin(&MigrationStatus{Namespace: "clusters", Name: "my-hc", Phase: MigrationPausingSource}))
+}
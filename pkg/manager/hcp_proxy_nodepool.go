@@ -0,0 +1,301 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// writeQueryParams are the create/update options forwarded to the spoke.
+var writeQueryParams = []string{"dryRun", "fieldManager", "fieldValidation"}
+
+// deleteQueryParams are the delete options forwarded to the spoke.
+var deleteQueryParams = []string{"dryRun", "gracePeriodSeconds", "propagationPolicy"}
+
+// handleNodePoolGet returns one NodePool from the spoke as an hcp.ocm.io object,
+// or as a one-row Table when the caller asks for one.
+func (p *hcpProxy) handleNodePoolGet(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	apiPath, err := hsNamedAPIPath(ns, resourceNodePools, name)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !wantsTable(r) {
+		p.forwardToSpoke(w, r, http.MethodGet, spokeName, apiPath, url.Values{}, "", nil, true)
+		return
+	}
+
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	np, code, msg := p.fetchNodePool(r.Context(), hcpClient, ns, name, spokeName)
+	if np == nil {
+		writeJSONError(w, msg, code)
+		return
+	}
+	writeTable(w, r, resourceNodePools, []unstructured.Unstructured{*np}, metav1.ListMeta{}, nil)
+}
+
+// fetchNodePool reads one NodePool on the spoke as a proxy object. On failure
+// it returns nil with the HTTP status and message to answer with.
+func (p *hcpProxy) fetchNodePool(
+	ctx context.Context,
+	hcpClient *http.Client,
+	ns, name, spokeName string,
+) (*unstructured.Unstructured, int, string) {
+	apiPath, err := hsNamedAPIPath(ns, resourceNodePools, name)
+	if err != nil {
+		return nil, http.StatusBadRequest, err.Error()
+	}
+	req, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "failed to build spoke request: " + err.Error()
+	}
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return nil, http.StatusBadGateway, "spoke request failed: " + err.Error()
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, http.StatusBadGateway, "failed to read spoke response: " + err.Error()
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, http.StatusNotFound, "NodePool " + name + " not found"
+	case http.StatusForbidden:
+		return nil, http.StatusForbidden, "not allowed to read NodePool " + name + " on the hosting cluster"
+	default:
+		return nil, http.StatusBadGateway, fmt.Sprintf("spoke returned %d: %s", resp.StatusCode, string(body))
+	}
+	np := &unstructured.Unstructured{}
+	if err := np.UnmarshalJSON(body); err != nil {
+		return nil, http.StatusInternalServerError, "failed to decode NodePool: " + err.Error()
+	}
+	asProxyObject(np, spokeName)
+	return np, http.StatusOK, ""
+}
+
+// handleNodePoolWrite creates (name == "") or replaces a single NodePool. The
+// body is a NodePool in either the hcp.ocm.io or the hypershift apiVersion; it
+// is sent to the spoke as a hypershift object and the spoke's response is
+// returned as-is apart from the apiVersion.
+//
+// A create gets the created-via and hostedcluster labels and the organization
+// defaults, like the NodePools of a HostedCluster create; the fields the
+// defaults set are reported as Warning headers. An update is a plain full
+// replace: metadata.resourceVersion guards it the same way as on the spoke.
+func (p *hcpProxy) handleNodePoolWrite(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return
+	}
+	np, err := decodeNodePool(body, ns, name)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var defaultsWarnings []string
+	if name == "" {
+		entries, err := p.createDefaultsFor(r.Context(), spokeName, ns)
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defaultsWarnings = applyNodePoolDefaults(entries, np.Object)
+	}
+	if !p.enforcePolicy(r.Context(), w, spokeName, "NodePool", np.GetName(), func(rules []policyRule) field.ErrorList {
+		return checkNodePool(rules, np.Object, nil)
+	}) {
+		return
+	}
+
+	method := http.MethodPut
+	var apiPath string
+	if name == "" {
+		method = http.MethodPost
+		labels := np.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[labelCreatedVia] = labelCreatedViaValue
+		if clusterName, _, _ := unstructured.NestedString(np.Object, "spec", "clusterName"); clusterName != "" {
+			labels[labelHostedCluster] = clusterName
+		}
+		np.SetLabels(labels)
+		auditRecordFor(r).Name = np.GetName()
+		apiPath, err = hsCollectionAPIPath(ns, resourceNodePools)
+	} else {
+		apiPath, err = hsNamedAPIPath(ns, resourceNodePools, name)
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, msg := range defaultsWarnings {
+		w.Header().Add("Warning", "299 - "+strconv.Quote(msg))
+	}
+	out, err := np.MarshalJSON()
+	if err != nil {
+		writeJSONError(w, "failed to encode NodePool: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.forwardToSpoke(w, r, method, spokeName, apiPath, forwardedQuery(r, writeQueryParams), contentTypeJSON, out, true)
+}
+
+// decodeNodePool parses a NodePool request body and maps it onto the spoke's
+// hypershift apiVersion. The namespace, and on update the name, must be empty
+// or match the request path.
+func decodeNodePool(body []byte, ns, name string) (*unstructured.Unstructured, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("invalid NodePool: %w", err)
+	}
+	np := &unstructured.Unstructured{Object: raw}
+
+	switch np.GetAPIVersion() {
+	case "", hcpProxyGroupVersion, hypershiftv1beta1.GroupVersion.String():
+	default:
+		return nil, fmt.Errorf("unsupported apiVersion %q for NodePool", np.GetAPIVersion())
+	}
+	if kind := np.GetKind(); kind != "" && kind != "NodePool" {
+		return nil, fmt.Errorf("expected kind NodePool, got %q", kind)
+	}
+	np.SetAPIVersion(hypershiftv1beta1.GroupVersion.String())
+	np.SetKind("NodePool")
+
+	if objNS := np.GetNamespace(); objNS != "" && objNS != ns {
+		return nil, fmt.Errorf("the namespace of the object (%s) does not match the namespace on the request (%s)", objNS, ns)
+	}
+	np.SetNamespace(ns)
+
+	if name != "" {
+		if objName := np.GetName(); objName != "" && objName != name {
+			return nil, fmt.Errorf("the name of the object (%s) does not match the name on the URL (%s)", objName, name)
+		}
+		np.SetName(name)
+	}
+	return np, nil
+}
+
+// handleNodePoolDelete deletes a single NodePool. DeleteOptions in the body
+// (preconditions, propagationPolicy) are forwarded unchanged.
+func (p *hcpProxy) handleNodePoolDelete(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	body, ok := readRequestBody(w, r)
+	if !ok {
+		return
+	}
+	if len(body) == 0 {
+		body = nil
+	}
+	apiPath, err := hsNamedAPIPath(ns, resourceNodePools, name)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.forwardToSpoke(w, r, http.MethodDelete, spokeName, apiPath, forwardedQuery(r, deleteQueryParams), contentTypeJSON, body, true)
+}
+
+// handleNodePoolScale forwards GET, PUT and PATCH of the NodePool scale
+// subresource to the spoke. Request and response bodies are autoscaling/v1
+// Scale objects and pass through unchanged. The spoke rejects a replica count
+// on a NodePool that has autoscaling enabled.
+func (p *hcpProxy) handleNodePoolScale(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	apiPath, err := hsNamedAPIPath(ns, resourceNodePools, name)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	apiPath += "/" + subresourceScale
+
+	switch r.Method {
+	case http.MethodGet:
+		p.forwardToSpoke(w, r, http.MethodGet, spokeName, apiPath, url.Values{}, "", nil, false)
+	case http.MethodPut:
+		body, ok := readRequestBody(w, r)
+		if !ok {
+			return
+		}
+		if !p.enforcePolicy(r.Context(), w, spokeName, "NodePool", name, func(rules []policyRule) field.ErrorList {
+			var scale map[string]interface{}
+			if err := json.Unmarshal(body, &scale); err != nil {
+				// Malformed bodies are left for the spoke to reject.
+				return nil
+			}
+			return checkScale(rules, scale)
+		}) {
+			return
+		}
+		p.forwardToSpoke(w, r, http.MethodPut, spokeName, apiPath,
+			forwardedQuery(r, writeQueryParams), contentTypeJSON, body, false)
+	case http.MethodPatch:
+		mediaType, query, body, ok := readPatchRequest(w, r, resourceNodePools+"/"+subresourceScale)
+		if !ok {
+			return
+		}
+		if !p.enforcePolicyOnPatch(w, r, spokeName, "NodePool", name, apiPath, query, mediaType, body, checkScale) {
+			return
+		}
+		p.forwardToSpoke(w, r, http.MethodPatch, spokeName, apiPath, query, mediaType, body, false)
+	default:
+		writeJSONError(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// locateNodePool finds the hosting cluster of the NodePool ns/name among the
+// hosting clusters the caller administers, for clients that cannot add the
+// hostingCluster parameter (kubectl scale, HPA). On failure the returned
+// status is the HTTP code to answer with: 404 when no cluster has it, 409 when
+// several do.
+func (p *hcpProxy) locateNodePool(
+	ctx context.Context,
+	username string,
+	groups []string,
+	nsRaw, nameRaw string,
+) (string, int, error) {
+	apiPath, err := hsNamedAPIPath(nsRaw, resourceNodePools, nameRaw)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	apiPath = path.Dir(apiPath)
+	query := url.Values{"fieldSelector": []string{"metadata.name=" + nameRaw}}
+
+	spokes, _ := p.fanOutTargets(ctx, username, groups)
+	var found, failed []string
+	for _, res := range p.listOnSpokes(ctx, username, groups, spokes, apiPath, query) {
+		switch {
+		case res.err != nil:
+			failed = append(failed, res.spoke)
+		case len(res.items) > 0:
+			found = append(found, res.spoke)
+		}
+	}
+	switch {
+	case len(found) == 1:
+		return found[0], http.StatusOK, nil
+	case len(found) > 1:
+		return "", http.StatusConflict, fmt.Errorf("nodepool %s/%s exists on several hosting clusters (%s); set hostingCluster",
+			nsRaw, nameRaw, strings.Join(found, ", "))
+	case len(failed) > 0:
+		return "", http.StatusServiceUnavailable, fmt.Errorf("nodepool %s/%s not found; hosting clusters %s could not be queried",
+			nsRaw, nameRaw, strings.Join(failed, ", "))
+	default:
+		return "", http.StatusNotFound, fmt.Errorf("nodepool %s/%s not found on any hosting cluster", nsRaw, nameRaw)
+	}
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const spokeNodePool = `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"NodePool",` +
+	`"metadata":{"name":"np-1","namespace":"clusters"},"spec":{"clusterName":"my-hc","replicas":2}}`
+
+func nodePoolRequest(method, path, body string) *http.Request {
+	r := httptest.NewRequest(method, apiPathPrefix+hcpProxyGroupVersion+path, strings.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+func Test_handleRoute_WhenNodePoolGet_ItShouldReturnProxyObject(t *testing.T) {
+	spoke := &patchSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, spokeNodePool).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodGet, "/namespaces/clusters/nodepools/np-1?hostingCluster=spoke-1", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/nodepools/np-1", spoke.path)
+	var obj map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &obj))
+	assert.Equal(t, hcpProxyGroupVersion, obj["apiVersion"])
+	assert.Equal(t, "spoke-1", obj["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})[annotationHostingCluster])
+}
+
+func Test_handleRoute_WhenNodePoolList_ItShouldReturnNodePoolList(t *testing.T) {
+	spoke := &patchSpoke{}
+	list := `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"NodePoolList","metadata":{"resourceVersion":"7"},"items":[` +
+		spokeNodePool + `]}`
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, list).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodGet, "/namespaces/clusters/nodepools?hostingCluster=spoke-1&limit=5", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/nodepools", spoke.path)
+	assert.Equal(t, "5", spoke.query.Get("limit"))
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "NodePoolList", doc["kind"])
+	assert.Len(t, doc["items"], 1)
+}
+
+func Test_handleRoute_WhenNodePoolCreate_ItShouldTranslateAndLabel(t *testing.T) {
+	spoke := &patchSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusCreated, spokeNodePool).URL, availableManagedCluster("spoke-1"))
+
+	body := `{"apiVersion":"hcp.ocm.io/v1alpha1","kind":"NodePool","metadata":{"name":"np-1"},"spec":{"clusterName":"my-hc"}}`
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodPost, "/namespaces/clusters/nodepools?hostingCluster=spoke-1&dryRun=All", body))
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.MethodPost, spoke.method)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/nodepools", spoke.path)
+	assert.Equal(t, "All", spoke.query.Get("dryRun"))
+
+	var sent map[string]interface{}
+	require.NoError(t, json.Unmarshal(spoke.body, &sent))
+	assert.Equal(t, "hypershift.openshift.io/v1beta1", sent["apiVersion"])
+	md := sent["metadata"].(map[string]interface{})
+	assert.Equal(t, "clusters", md["namespace"])
+	labels := md["labels"].(map[string]interface{})
+	assert.Equal(t, labelCreatedViaValue, labels[labelCreatedVia])
+	assert.Equal(t, "my-hc", labels[labelHostedCluster])
+}
+
+func Test_handleRoute_WhenNodePoolUpdateNameMismatch_ItShouldReturn400(t *testing.T) {
+	spoke := &patchSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, spokeNodePool).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodPut, "/namespaces/clusters/nodepools/np-1?hostingCluster=spoke-1",
+		`{"metadata":{"name":"np-2"}}`))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, spoke.method, "nothing should reach the spoke")
+}
+
+func Test_handleRoute_WhenNodePoolUpdate_ItShouldPUTFullObject(t *testing.T) {
+	spoke := &patchSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, spokeNodePool).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodPut, "/namespaces/clusters/nodepools/np-1?hostingCluster=spoke-1",
+		`{"metadata":{"resourceVersion":"7"},"spec":{"replicas":4}}`))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.MethodPut, spoke.method)
+	var sent map[string]interface{}
+	require.NoError(t, json.Unmarshal(spoke.body, &sent))
+	md := sent["metadata"].(map[string]interface{})
+	assert.Equal(t, "np-1", md["name"])
+	assert.Equal(t, "7", md["resourceVersion"])
+	assert.Nil(t, md["labels"], "an update must not add labels")
+}
+
+func Test_handleRoute_WhenNodePoolDelete_ItShouldForwardStatus(t *testing.T) {
+	spoke := &patchSpoke{}
+	status := `{"apiVersion":"v1","kind":"Status","status":"Success"}`
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, status).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodDelete,
+		"/namespaces/clusters/nodepools/np-1?hostingCluster=spoke-1&propagationPolicy=Foreground", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.MethodDelete, spoke.method)
+	assert.Equal(t, "Foreground", spoke.query.Get("propagationPolicy"))
+	assert.JSONEq(t, status, w.Body.String())
+}
+
+func Test_handleRoute_WhenNodePoolScaleGet_ItShouldPassScaleThrough(t *testing.T) {
+	spoke := &patchSpoke{}
+	scale := `{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"np-1"},"spec":{"replicas":2}}`
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, scale).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodGet, "/namespaces/clusters/nodepools/np-1/scale?hostingCluster=spoke-1", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/nodepools/np-1/scale", spoke.path)
+	assert.JSONEq(t, scale, w.Body.String())
+}
+
+func Test_handleRoute_WhenNodePoolScalePatch_ItShouldForwardMergePatch(t *testing.T) {
+	spoke := &patchSpoke{}
+	scale := `{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"np-1"},"spec":{"replicas":5}}`
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, scale).URL, availableManagedCluster("spoke-1"))
+
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/nodepools/np-1/scale?hostingCluster=spoke-1"
+	w := httptest.NewRecorder()
+	p.handleRoute(w, patchRequest(path, contentTypeMergePatch, `{"spec":{"replicas":5}}`))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.MethodPatch, spoke.method)
+	assert.Equal(t, contentTypeMergePatch, spoke.contentType)
+	assert.JSONEq(t, `{"spec":{"replicas":5}}`, string(spoke.body))
+	assert.JSONEq(t, scale, w.Body.String())
+}
+
+func Test_handleRoute_WhenNodePoolScaleDelete_ItShouldReturn405(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", availableManagedCluster("spoke-1"))
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodDelete, "/namespaces/clusters/nodepools/np-1/scale?hostingCluster=spoke-1", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func Test_handleRoute_WhenNodePoolCollectionDeleteWithoutHostingCluster_ItShouldReturnEmptyList(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodDelete, "/namespaces/clusters/nodepools", ""))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "NodePoolList", doc["kind"])
+}
+
+// nodePoolLocator serves a one-item NodePoolList on the spokes in has and an
+// empty one elsewhere, and records every scale request.
+func nodePoolLocator(t *testing.T, has ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var scaled []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		spoke := strings.Split(r.URL.Path, "/")[1]
+		if strings.HasSuffix(r.URL.Path, "/scale") {
+			mu.Lock()
+			scaled = append(scaled, spoke)
+			mu.Unlock()
+			_, _ = io.WriteString(w, `{"apiVersion":"autoscaling/v1","kind":"Scale","spec":{"replicas":3}}`)
+			return
+		}
+		assert.Equal(t, "metadata.name=np-1", r.URL.Query().Get("fieldSelector"))
+		items := ""
+		for _, h := range has {
+			if h == spoke {
+				items = spokeNodePool
+			}
+		}
+		_, _ = io.WriteString(w, `{"kind":"NodePoolList","metadata":{},"items":[`+items+`]}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &scaled
+}
+
+func Test_handleRoute_WhenScaleWithoutHostingCluster_ItShouldLocateNodePool(t *testing.T) {
+	srv, scaled := nodePoolLocator(t, "spoke-2")
+	p := newTestProxyWithSpokeURL(t, srv.URL, hostingManagedCluster("spoke-1"), hostingManagedCluster("spoke-2"))
+
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/nodepools/np-1/scale"
+	w := httptest.NewRecorder()
+	p.handleRoute(w, patchRequest(path, contentTypeMergePatch, `{"spec":{"replicas":3}}`))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"spoke-2"}, *scaled)
+}
+
+func Test_handleRoute_WhenNodePoolOnSeveralHostingClusters_ItShouldReturn409(t *testing.T) {
+	srv, scaled := nodePoolLocator(t, "spoke-1", "spoke-2")
+	p := newTestProxyWithSpokeURL(t, srv.URL, hostingManagedCluster("spoke-1"), hostingManagedCluster("spoke-2"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodGet, "/namespaces/clusters/nodepools/np-1/scale", ""))
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "spoke-1, spoke-2")
+	assert.Empty(t, *scaled)
+}
+
+func Test_handleRoute_WhenNodePoolOnNoHostingCluster_ItShouldReturn404(t *testing.T) {
+	srv, _ := nodePoolLocator(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, hostingManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, nodePoolRequest(http.MethodGet, "/namespaces/clusters/nodepools/np-1", ""))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,436 @@
+package manager
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	apiPathOpenAPIV2 = "/openapi/v2"
+	apiPathOpenAPIV3 = "/openapi/v3"
+
+	// openAPIGroupVersionPath is the key of hcp.ocm.io/v1alpha1 in the OpenAPI
+	// v3 discovery document, as the kube-apiserver names group versions there.
+	openAPIGroupVersionPath = "apis/" + hcpProxyGroupVersion
+
+	// openAPIDefinitionPrefix names the hcp.ocm.io top-level schemas; nested
+	// types keep the REST-friendly name of their Go package.
+	openAPIDefinitionPrefix = "io.ocm.hcp." + hcpProxyAPIVersion + "."
+
+	// quantityPattern matches the string form of a resource.Quantity, as in the
+	// schemas controller-gen writes for CRDs.
+	quantityPattern = `^(\+|-)?(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\+|-)?(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))))?$`
+)
+
+// openAPIKinds are the types served as hcp.ocm.io/v1alpha1 kinds. Their
+// schemas carry x-kubernetes-group-version-kind so kubectl explain and
+// client-side validation find them.
+var openAPIKinds = map[reflect.Type]string{
+	reflect.TypeOf(hypershiftv1beta1.HostedCluster{}):     "HostedCluster",
+	reflect.TypeOf(hypershiftv1beta1.HostedClusterList{}): "HostedClusterList",
+	reflect.TypeOf(hypershiftv1beta1.NodePool{}):          "NodePool",
+	reflect.TypeOf(hypershiftv1beta1.NodePoolList{}):      "NodePoolList",
+	reflect.TypeOf(ResourceBundle{}):                      "ResourceBundle",
+}
+
+// openAPIDocs holds the OpenAPI documents. They only depend on Go types, so
+// they are built once on first request.
+var openAPIDocs struct {
+	once   sync.Once
+	v2     []byte
+	v3     []byte
+	v2Hash string
+	v3Hash string
+	err    error
+}
+
+func loadOpenAPIDocs() error {
+	openAPIDocs.once.Do(func() {
+		if openAPIDocs.v2, openAPIDocs.err = json.Marshal(buildOpenAPIDoc(false)); openAPIDocs.err != nil {
+			return
+		}
+		if openAPIDocs.v3, openAPIDocs.err = json.Marshal(buildOpenAPIDoc(true)); openAPIDocs.err != nil {
+			return
+		}
+		openAPIDocs.v2Hash = fmt.Sprintf("%X", sha512.Sum512(openAPIDocs.v2))
+		openAPIDocs.v3Hash = fmt.Sprintf("%X", sha512.Sum512(openAPIDocs.v3))
+	})
+	return openAPIDocs.err
+}
+
+// handleOpenAPIV2 serves the swagger 2.0 document the aggregator merges into
+// the cluster-wide /openapi/v2.
+func (p *hcpProxy) handleOpenAPIV2(w http.ResponseWriter, r *http.Request) {
+	if err := loadOpenAPIDocs(); err != nil {
+		writeJSONError(w, "failed to build OpenAPI document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeOpenAPI(w, r, openAPIDocs.v2, openAPIDocs.v2Hash)
+}
+
+// handleOpenAPIV3 serves the OpenAPI v3 discovery document on /openapi/v3 and
+// the hcp.ocm.io/v1alpha1 document on /openapi/v3/apis/hcp.ocm.io/v1alpha1.
+func (p *hcpProxy) handleOpenAPIV3(w http.ResponseWriter, r *http.Request) {
+	if err := loadOpenAPIDocs(); err != nil {
+		writeJSONError(w, "failed to build OpenAPI document: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case apiPathOpenAPIV3:
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.Header().Set("Cache-Control", "no-cache, private")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"paths": map[string]interface{}{
+				openAPIGroupVersionPath: map[string]string{
+					"serverRelativeURL": apiPathOpenAPIV3 + "/" + openAPIGroupVersionPath + "?hash=" + openAPIDocs.v3Hash,
+				},
+			},
+		})
+	case apiPathOpenAPIV3 + "/" + openAPIGroupVersionPath:
+		writeOpenAPI(w, r, openAPIDocs.v3, openAPIDocs.v3Hash)
+	default:
+		writeJSONError(w, "not found", http.StatusNotFound)
+	}
+}
+
+// writeOpenAPI writes doc with an ETag. As on the kube-apiserver, a request
+// carrying the current ?hash may cache the document forever.
+func writeOpenAPI(w http.ResponseWriter, r *http.Request, doc []byte, hash string) {
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+	if r.URL.Query().Get("hash") == hash {
+		w.Header().Set("Cache-Control", "public, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache, private")
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	_, _ = w.Write(doc)
+}
+
+// buildOpenAPIDoc returns the swagger 2.0 (v3 false) or OpenAPI 3.0 document
+// of hcp.ocm.io/v1alpha1. Schemas are derived from the Go types by reflection,
+// so they follow the vendored hypershift API exactly but carry no field
+// descriptions.
+func buildOpenAPIDoc(v3 bool) map[string]interface{} {
+	b := &openAPISchemaBuilder{v3: v3, definitions: map[string]interface{}{}, refPrefix: "#/definitions/"}
+	if v3 {
+		b.refPrefix = "#/components/schemas/"
+	}
+
+	hc := b.schemaFor(reflect.TypeOf(hypershiftv1beta1.HostedCluster{}))
+	hcList := b.schemaFor(reflect.TypeOf(hypershiftv1beta1.HostedClusterList{}))
+	np := b.schemaFor(reflect.TypeOf(hypershiftv1beta1.NodePool{}))
+	npList := b.schemaFor(reflect.TypeOf(hypershiftv1beta1.NodePoolList{}))
+	bundle := b.schemaFor(reflect.TypeOf(ResourceBundle{}))
+	createReq := b.schemaFor(reflect.TypeOf(CreateRequest{}))
+	migration := b.schemaFor(reflect.TypeOf(MigrationStatus{}))
+	progress := b.schemaFor(reflect.TypeOf(CreateProgress{}))
+	deletion := b.schemaFor(reflect.TypeOf(DeletionStatus{}))
+	adoption := b.schemaFor(reflect.TypeOf(AdoptionResult{}))
+	scale := b.schemaFor(reflect.TypeOf(autoscalingv1.Scale{}))
+	status := b.schemaFor(reflect.TypeOf(metav1.Status{}))
+
+	base := "/apis/" + hcpProxyGroupVersion + "/namespaces/{namespace}/"
+	namespaced := []string{"namespace"}
+	named := []string{"namespace", "name"}
+	paths := map[string]interface{}{
+		"/apis/" + hcpProxyGroupVersion + "/" + resourceHostedClusters: b.pathItem(nil, map[string]interface{}{
+			"get": b.operation("listHostedClusterForAllNamespaces", nil, hcList),
+		}),
+		"/apis/" + hcpProxyGroupVersion + "/" + resourceNodePools: b.pathItem(nil, map[string]interface{}{
+			"get": b.operation("listNodePoolForAllNamespaces", nil, npList),
+		}),
+		base + resourceHostedClusters: b.pathItem(namespaced, map[string]interface{}{
+			"get":  b.operation("listNamespacedHostedCluster", nil, hcList),
+			"post": b.operation("createNamespacedHostedCluster", createReq, bundle),
+		}),
+		base + resourceHostedClusters + "/{name}": b.pathItem(named, map[string]interface{}{
+			"get":    b.operation("readNamespacedHostedCluster", nil, bundle),
+			"put":    b.operation("replaceNamespacedHostedCluster", bundle, bundle),
+			"patch":  b.operation("patchNamespacedHostedCluster", hc, hc),
+			"delete": b.operation("deleteNamespacedHostedCluster", nil, status),
+		}),
+		base + resourceHostedClusters + "/{name}/resources": b.pathItem(named, map[string]interface{}{
+			"get": b.operation("readNamespacedHostedClusterResources", nil, bundle),
+			"put": b.operation("replaceNamespacedHostedClusterResources", bundle, bundle),
+		}),
+		base + resourceHostedClusters + "/{name}/" + subresourceMigrate: b.pathItem(named, map[string]interface{}{
+			"get":  b.operation("readNamespacedHostedClusterMigration", nil, migration),
+			"post": b.operation("createNamespacedHostedClusterMigration", nil, migration),
+		}),
+		base + resourceHostedClusters + "/{name}/" + subresourceProgress: b.pathItem(named, map[string]interface{}{
+			"get": b.operation("readNamespacedHostedClusterProgress", nil, progress),
+		}),
+		base + resourceHostedClusters + "/{name}/" + subresourceDeletion: b.pathItem(named, map[string]interface{}{
+			"get": b.operation("readNamespacedHostedClusterDeletion", nil, deletion),
+		}),
+		base + resourceHostedClusters + "/{name}/" + subresourceAdopt: b.pathItem(named, map[string]interface{}{
+			"post": b.operation("createNamespacedHostedClusterAdoption", nil, adoption),
+		}),
+		base + resourceNodePools: b.pathItem(namespaced, map[string]interface{}{
+			"get":  b.operation("listNamespacedNodePool", nil, npList),
+			"post": b.operation("createNamespacedNodePool", np, np),
+		}),
+		base + resourceNodePools + "/{name}": b.pathItem(named, map[string]interface{}{
+			"get":    b.operation("readNamespacedNodePool", nil, np),
+			"put":    b.operation("replaceNamespacedNodePool", np, np),
+			"patch":  b.operation("patchNamespacedNodePool", np, np),
+			"delete": b.operation("deleteNamespacedNodePool", nil, np),
+		}),
+		base + resourceNodePools + "/{name}/" + subresourceScale: b.pathItem(named, map[string]interface{}{
+			"get":   b.operation("readNamespacedNodePoolScale", nil, scale),
+			"put":   b.operation("replaceNamespacedNodePoolScale", scale, scale),
+			"patch": b.operation("patchNamespacedNodePoolScale", scale, scale),
+		}),
+	}
+
+	info := map[string]interface{}{"title": hcpProxyAPIGroup, "version": hcpProxyAPIVersion}
+	if v3 {
+		return map[string]interface{}{
+			"openapi":    "3.0.0",
+			"info":       info,
+			"paths":      paths,
+			"components": map[string]interface{}{"schemas": b.definitions},
+		}
+	}
+	return map[string]interface{}{
+		"swagger":     "2.0",
+		"info":        info,
+		"paths":       paths,
+		"definitions": b.definitions,
+	}
+}
+
+// openAPISchemaBuilder turns Go types into OpenAPI schemas following their
+// JSON encoding. Named structs become definitions referenced by $ref.
+type openAPISchemaBuilder struct {
+	v3          bool
+	refPrefix   string
+	definitions map[string]interface{}
+}
+
+// pathItem wraps operations with the parameters shared by every hcp.ocm.io
+// path: its path parameters and hostingCluster.
+func (b *openAPISchemaBuilder) pathItem(pathParams []string, ops map[string]interface{}) map[string]interface{} {
+	params := []interface{}{b.parameter("hostingCluster", "query", false)}
+	for _, name := range pathParams {
+		params = append(params, b.parameter(name, "path", true))
+	}
+	item := map[string]interface{}{"parameters": params}
+	for method, op := range ops {
+		item[method] = op
+	}
+	return item
+}
+
+func (b *openAPISchemaBuilder) parameter(name, in string, required bool) map[string]interface{} {
+	param := map[string]interface{}{"name": name, "in": in, "required": required}
+	if b.v3 {
+		param["schema"] = map[string]interface{}{"type": "string"}
+	} else {
+		param["type"] = "string"
+	}
+	return param
+}
+
+// operation describes one method; body and response are $ref schemas.
+func (b *openAPISchemaBuilder) operation(id string, body, response map[string]interface{}) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": id,
+		"tags":        []string{"hcpOcmIo_" + hcpProxyAPIVersion},
+	}
+	if b.v3 {
+		op["responses"] = map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content":     map[string]interface{}{contentTypeJSON: map[string]interface{}{"schema": response}},
+			},
+		}
+		if body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{contentTypeJSON: map[string]interface{}{"schema": body}},
+			}
+		}
+		return op
+	}
+	op["consumes"] = []string{contentTypeJSON}
+	op["produces"] = []string{contentTypeJSON}
+	op["responses"] = map[string]interface{}{"200": map[string]interface{}{"description": "OK", "schema": response}}
+	if body != nil {
+		op["parameters"] = []interface{}{
+			map[string]interface{}{"name": "body", "in": "body", "required": true, "schema": body},
+		}
+	}
+	return op
+}
+
+// openAPISchemaTyper is implemented by apimachinery types with a custom JSON
+// encoding, e.g. metav1.Time and resource.Quantity.
+type openAPISchemaTyper interface {
+	OpenAPISchemaType() []string
+	OpenAPISchemaFormat() string
+}
+
+// openAPIOneOfTyper is implemented by types encoded as one of several types,
+// e.g. intstr.IntOrString.
+type openAPIOneOfTyper interface {
+	OpenAPIV3OneOfTypes() []string
+}
+
+var (
+	quantityType           = reflect.TypeOf(resource.Quantity{})
+	openAPISchemaTyperType = reflect.TypeOf((*openAPISchemaTyper)(nil)).Elem()
+	openAPIOneOfTyperType  = reflect.TypeOf((*openAPIOneOfTyper)(nil)).Elem()
+	jsonMarshalerType      = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// schemaFor returns the schema of t, registering a definition for named
+// structs.
+func (b *openAPISchemaBuilder) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == quantityType:
+		// A Quantity is a string like "8Gi", not an int-or-string: it must
+		// not carry x-kubernetes-int-or-string.
+		return map[string]interface{}{"type": "string", "pattern": quantityPattern}
+	case implements(t, openAPIOneOfTyperType):
+		return map[string]interface{}{"x-kubernetes-int-or-string": true}
+	case implements(t, openAPISchemaTyperType):
+		typer := reflect.New(t).Interface().(openAPISchemaTyper)
+		schema := map[string]interface{}{}
+		if types := typer.OpenAPISchemaType(); len(types) == 1 {
+			schema["type"] = types[0]
+		}
+		if format := typer.OpenAPISchemaFormat(); format != "" {
+			schema["format"] = format
+		}
+		return schema
+	case t.Kind() == reflect.Struct && implements(t, jsonMarshalerType):
+		// e.g. runtime.RawExtension: arbitrary embedded JSON.
+		return map[string]interface{}{"type": "object", "x-kubernetes-preserve-unknown-fields": true}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int32, reflect.Int16, reflect.Int8, reflect.Uint16, reflect.Uint8:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return b.structRef(t)
+	default:
+		// interface{} and anything else JSON can hold.
+		return map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true}
+	}
+}
+
+// structRef registers the definition of struct t (once) and returns a $ref to
+// it.
+func (b *openAPISchemaBuilder) structRef(t reflect.Type) map[string]interface{} {
+	name := openAPIDefinitionName(t)
+	ref := map[string]interface{}{"$ref": b.refPrefix + name}
+	if _, done := b.definitions[name]; done {
+		return ref
+	}
+	// Register before recursing so self-referencing types terminate.
+	def := map[string]interface{}{"type": "object"}
+	b.definitions[name] = def
+
+	properties := map[string]interface{}{}
+	b.addProperties(t, properties)
+	if len(properties) > 0 {
+		def["properties"] = properties
+	}
+	if kind, ok := openAPIKinds[t]; ok {
+		def["x-kubernetes-group-version-kind"] = []interface{}{
+			map[string]string{"group": hcpProxyAPIGroup, "version": hcpProxyAPIVersion, "kind": kind},
+		}
+	}
+	return ref
+}
+
+// addProperties adds the JSON fields of struct t, flattening inlined embedded
+// structs the way encoding/json does.
+func (b *openAPISchemaBuilder) addProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addProperties(ft, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+	}
+}
+
+// openAPIDefinitionName returns the definition name of a struct: the
+// hcp.ocm.io name for served kinds and wrappers, otherwise the package path
+// in reverse-domain form as the kube-apiserver does, e.g.
+// io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta.
+func openAPIDefinitionName(t reflect.Type) string {
+	if _, ok := openAPIKinds[t]; ok || t == reflect.TypeOf(CreateRequest{}) || t == reflect.TypeOf(MigrationStatus{}) ||
+		t == reflect.TypeOf(CreateProgress{}) || t == reflect.TypeOf(AdoptionResult{}) {
+		return openAPIDefinitionPrefix + t.Name()
+	}
+	pkgPath := t.PkgPath()
+	host, rest, _ := strings.Cut(pkgPath, "/")
+	hostParts := strings.Split(host, ".")
+	for i, j := 0, len(hostParts)-1; i < j; i, j = i+1, j-1 {
+		hostParts[i], hostParts[j] = hostParts[j], hostParts[i]
+	}
+	name := strings.Join(hostParts, ".")
+	if rest != "" {
+		name += "." + strings.ReplaceAll(rest, "/", ".")
+	}
+	return name + "." + t.Name()
+}
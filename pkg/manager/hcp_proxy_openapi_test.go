@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func getOpenAPI(t *testing.T, path string, handler http.HandlerFunc) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	return doc
+}
+
+func Test_handleOpenAPIV2_WhenRequested_ItShouldServeKindsWithGVK(t *testing.T) {
+	p := newTestProxy(t)
+	doc := getOpenAPI(t, apiPathOpenAPIV2, p.handleOpenAPIV2)
+
+	assert.Equal(t, "2.0", doc["swagger"])
+	definitions := doc["definitions"].(map[string]interface{})
+	for _, kind := range []string{"HostedCluster", "HostedClusterList", "NodePool", "NodePoolList", "ResourceBundle"} {
+		def, ok := definitions[openAPIDefinitionPrefix+kind].(map[string]interface{})
+		require.True(t, ok, kind)
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"group": hcpProxyAPIGroup, "version": hcpProxyAPIVersion, "kind": kind},
+		}, def["x-kubernetes-group-version-kind"], kind)
+	}
+
+	createReq := definitions[openAPIDefinitionPrefix+"CreateRequest"].(map[string]interface{})
+	props := createReq["properties"].(map[string]interface{})
+	assert.Equal(t, "#/definitions/"+openAPIDefinitionPrefix+"HostedCluster", props["hostedCluster"].(map[string]interface{})["$ref"])
+	assert.Equal(t, "array", props["secrets"].(map[string]interface{})["type"])
+
+	paths := doc["paths"].(map[string]interface{})
+	assert.Contains(t, paths, "/apis/hcp.ocm.io/v1alpha1/namespaces/{namespace}/nodepools/{name}/scale")
+}
+
+func Test_handleOpenAPIV3_WhenDiscoveryFollowed_ItShouldServeGroupVersionDocument(t *testing.T) {
+	p := newTestProxy(t)
+	discovery := getOpenAPI(t, apiPathOpenAPIV3, p.handleOpenAPIV3)
+	entry := discovery["paths"].(map[string]interface{})[openAPIGroupVersionPath].(map[string]interface{})
+	url := entry["serverRelativeURL"].(string)
+	require.True(t, strings.HasPrefix(url, "/openapi/v3/apis/hcp.ocm.io/v1alpha1?hash="), url)
+
+	w := httptest.NewRecorder()
+	p.handleOpenAPIV3(w, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, immutable", w.Header().Get("Cache-Control"))
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.0", doc["openapi"])
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	hc := schemas[openAPIDefinitionPrefix+"HostedCluster"].(map[string]interface{})
+	metadata := hc["properties"].(map[string]interface{})["metadata"].(map[string]interface{})
+	assert.Equal(t, "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta", metadata["$ref"])
+
+	// A client revalidating with the ETag gets 304.
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	p.handleOpenAPIV3(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func Test_handleOpenAPIV3_WhenUnknownGroupVersion_ItShouldReturn404(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	p.handleOpenAPIV3(w, httptest.NewRequest(http.MethodGet, apiPathOpenAPIV3+"/apis/other.io/v1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_openAPISchemaBuilder_WhenSpecialTypes_ItShouldFollowTheirJSONEncoding(t *testing.T) {
+	type sample struct {
+		metav1.TypeMeta `json:",inline"`
+		When            metav1.Time          `json:"when"`
+		Port            intstr.IntOrString   `json:"port"`
+		Size            resource.Quantity    `json:"size"`
+		Raw             runtime.RawExtension `json:"raw"`
+		Data            []byte               `json:"data"`
+		Labels          map[string]string    `json:"labels"`
+		Count           *int32               `json:"count,omitempty"`
+		Skipped         string               `json:"-"`
+	}
+	b := &openAPISchemaBuilder{v3: true, refPrefix: "#/components/schemas/", definitions: map[string]interface{}{}}
+	b.schemaFor(reflect.TypeOf(sample{}))
+
+	def := b.definitions[openAPIDefinitionName(reflect.TypeOf(sample{}))].(map[string]interface{})
+	props := def["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, props["when"])
+	assert.Equal(t, map[string]interface{}{"x-kubernetes-int-or-string": true}, props["port"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "pattern": quantityPattern}, props["size"])
+	assert.Regexp(t, quantityPattern, "8Gi")
+	assert.NotRegexp(t, quantityPattern, "8 GB")
+	assert.Equal(t, true, props["raw"].(map[string]interface{})["x-kubernetes-preserve-unknown-fields"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "byte"}, props["data"])
+	assert.Equal(t, "object", props["labels"].(map[string]interface{})["type"])
+	assert.Equal(t, map[string]interface{}{"type": "integer", "format": "int32"}, props["count"])
+	assert.Contains(t, props, "apiVersion", "inline TypeMeta is flattened")
+	assert.NotContains(t, props, "Skipped")
+}
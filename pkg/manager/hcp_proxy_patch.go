@@ -0,0 +1,224 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/ghodss/yaml"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	contentTypeMergePatch     = "application/merge-patch+json"
+	contentTypeJSONPatch      = "application/json-patch+json"
+	contentTypeApplyPatchYAML = "application/apply-patch+yaml"
+	contentTypeStrategicMerge = "application/strategic-merge-patch+json"
+
+	// maxRequestBodyBytes matches the kube-apiserver's default request body limit.
+	maxRequestBodyBytes = 3 * 1024 * 1024
+)
+
+// patchQueryParams are the PATCH options forwarded to the spoke.
+var patchQueryParams = []string{"fieldManager", "force", "dryRun", "fieldValidation"}
+
+// handlePatch forwards a PATCH of a single HostedCluster or NodePool to the
+// spoke under the caller's identity, so the spoke applies it against the live
+// object instead of a stale full-replace PUT.
+//
+// Supported content types are merge patch, JSON patch and server-side apply
+// (which requires fieldManager). Strategic merge patch is rejected with 415, as
+// the spoke does for custom resources. Merge and apply bodies may use the
+// hcp.ocm.io/v1alpha1 apiVersion; it is translated to the hypershift one.
+func (p *hcpProxy) handlePatch(w http.ResponseWriter, r *http.Request, ns, resource, name, spokeName string) {
+	mediaType, query, body, ok := readPatchRequest(w, r, resource)
+	if !ok {
+		return
+	}
+	if mediaType != contentTypeJSONPatch {
+		var err error
+		if body, err = toSpokePatchBody(body, mediaType); err != nil {
+			writeJSONError(w, "invalid patch body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	apiPath, err := hsNamedAPIPath(ns, resource, name)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kind, check := "HostedCluster", checkHostedCluster
+	if resource == resourceNodePools {
+		kind, check = "NodePool", checkNodePool
+	}
+	if !p.enforcePolicyOnPatch(w, r, spokeName, kind, name, apiPath, query, mediaType, body,
+		func(rules []policyRule, obj map[string]interface{}) field.ErrorList {
+			return check(rules, obj, nil)
+		}) {
+		return
+	}
+	p.forwardToSpoke(w, r, http.MethodPatch, spokeName, apiPath, query, mediaType, body, true)
+}
+
+// readPatchRequest validates the content type and options of a PATCH and reads
+// its body. On failure the error response has been written and ok is false.
+func readPatchRequest(w http.ResponseWriter, r *http.Request, resource string) (
+	mediaType string,
+	query url.Values,
+	body []byte,
+	ok bool,
+) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil {
+		mediaType = ""
+	}
+	switch mediaType {
+	case contentTypeMergePatch, contentTypeJSONPatch, contentTypeApplyPatchYAML:
+	case contentTypeStrategicMerge:
+		writeJSONError(w, "strategic merge patch is not supported for "+resource+
+			"; use "+contentTypeMergePatch+" or "+contentTypeJSONPatch, http.StatusUnsupportedMediaType)
+		return "", nil, nil, false
+	default:
+		writeJSONError(w, fmt.Sprintf("unsupported patch content type %q", r.Header.Get(headerContentType)),
+			http.StatusUnsupportedMediaType)
+		return "", nil, nil, false
+	}
+
+	query = forwardedQuery(r, patchQueryParams)
+	if mediaType == contentTypeApplyPatchYAML && query.Get("fieldManager") == "" {
+		writeJSONError(w, "fieldManager is required for server-side apply", http.StatusBadRequest)
+		return "", nil, nil, false
+	}
+
+	if body, ok = readRequestBody(w, r); !ok {
+		return "", nil, nil, false
+	}
+	return mediaType, query, body, true
+}
+
+// readRequestBody reads a request body of at most maxRequestBodyBytes. On
+// failure the error response has been written and ok is false.
+func readRequestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes+1))
+	if err != nil {
+		writeJSONError(w, "failed to read request body: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(body) > maxRequestBodyBytes {
+		writeJSONError(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
+// forwardedQuery copies the allowlisted query parameters of r.
+func forwardedQuery(r *http.Request, keys []string) url.Values {
+	query := url.Values{}
+	for _, key := range keys {
+		if v := r.URL.Query().Get(key); v != "" {
+			query.Set(key, v)
+		}
+	}
+	return query
+}
+
+// forwardToSpoke sends one request to apiPath on the spoke under the caller's
+// identity and relays the response: as a proxy object when asProxy is set,
+// byte for byte otherwise. body may be nil.
+func (p *hcpProxy) forwardToSpoke(
+	w http.ResponseWriter,
+	r *http.Request,
+	method, spokeName, apiPath string,
+	query url.Values,
+	contentType string,
+	body []byte,
+	asProxy bool,
+) {
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := p.newSpokeRequest(r.Context(), method, spokeName, apiPath, reqBody)
+	if err != nil {
+		writeJSONError(w, "failed to build spoke request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.URL.RawQuery = query.Encode()
+	if body != nil {
+		req.Header.Set(headerContentType, contentType)
+	}
+
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		writeJSONError(w, "spoke request failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if asProxy {
+		p.forwardObjectResponse(w, resp, spokeName)
+		return
+	}
+	if ct := resp.Header.Get(headerContentType); ct != "" {
+		w.Header().Set(headerContentType, ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// toSpokePatchBody converts a merge or apply patch body to JSON and maps an
+// hcp.ocm.io apiVersion to the hypershift one the spoke understands. JSON is
+// valid YAML, so the converted body is also sent for apply.
+func toSpokePatchBody(body []byte, mediaType string) ([]byte, error) {
+	if mediaType == contentTypeApplyPatchYAML {
+		var err error
+		if body, err = yaml.YAMLToJSON(body); err != nil {
+			return nil, err
+		}
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+	if apiVersion, ok := patch["apiVersion"].(string); ok && apiVersion == hcpProxyGroupVersion {
+		patch["apiVersion"] = hypershiftv1beta1.GroupVersion.String()
+	}
+	return json.Marshal(patch)
+}
+
+// forwardObjectResponse relays a spoke response for a single object. 2xx
+// bodies are presented as proxy objects; a metav1.Status (errors, or a delete
+// that has already completed) is forwarded as-is.
+func (p *hcpProxy) forwardObjectResponse(w http.ResponseWriter, resp *http.Response, spokeName string) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		writeJSONError(w, "failed to read spoke response: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if resp.StatusCode < 300 {
+		obj := &unstructured.Unstructured{}
+		if obj.UnmarshalJSON(body) == nil && obj.GetKind() != "Status" {
+			asProxyObject(obj, spokeName)
+			if out, err := obj.MarshalJSON(); err == nil {
+				body = out
+			}
+		}
+	}
+	if ct := resp.Header.Get(headerContentType); ct != "" {
+		w.Header().Set(headerContentType, ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(body)
+}
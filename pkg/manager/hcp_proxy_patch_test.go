@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patchSpoke records the PATCH it receives and echoes back a HostedCluster.
+type patchSpoke struct {
+	method      string
+	path        string
+	contentType string
+	query       url.Values
+	body        []byte
+}
+
+func (s *patchSpoke) server(t *testing.T, status int, resp string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.method = r.Method
+		s.path = r.URL.Path
+		s.contentType = r.Header.Get(headerContentType)
+		s.query = r.URL.Query()
+		s.body, _ = io.ReadAll(r.Body)
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+const patchedHC = `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedCluster",` +
+	`"metadata":{"name":"my-hc","namespace":"clusters","labels":{"team":"a"}}}`
+
+func patchRequest(path, contentType, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+	r.Header.Set(headerContentType, contentType)
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+func Test_handleRoute_WhenMergePatch_ItShouldForwardToSpoke(t *testing.T) {
+	spoke := &patchSpoke{}
+	srv := spoke.server(t, http.StatusOK, patchedHC)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc?hostingCluster=spoke-1&dryRun=All"
+	w := httptest.NewRecorder()
+	p.handleRoute(w, patchRequest(path, contentTypeMergePatch, `{"metadata":{"labels":{"team":"a"}}}`))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.MethodPatch, spoke.method)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters/my-hc", spoke.path)
+	assert.Equal(t, contentTypeMergePatch, spoke.contentType)
+	assert.Equal(t, "All", spoke.query.Get("dryRun"))
+	assert.Empty(t, spoke.query.Get("hostingCluster"))
+	assert.JSONEq(t, `{"metadata":{"labels":{"team":"a"}}}`, string(spoke.body))
+
+	var obj map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &obj))
+	assert.Equal(t, hcpProxyGroupVersion, obj["apiVersion"])
+}
+
+func Test_handleRoute_WhenJSONPatchOnNodePool_ItShouldForwardBodyUnchanged(t *testing.T) {
+	spoke := &patchSpoke{}
+	srv := spoke.server(t, http.StatusOK, `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"NodePool",`+
+		`"metadata":{"name":"np-1","namespace":"clusters"}}`)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	body := `[{"op":"replace","path":"/spec/replicas","value":3}]`
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/nodepools/np-1?hostingCluster=spoke-1"
+	w := httptest.NewRecorder()
+	p.handleRoute(w, patchRequest(path, contentTypeJSONPatch, body))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/nodepools/np-1", spoke.path)
+	assert.Equal(t, contentTypeJSONPatch, spoke.contentType)
+	assert.Equal(t, body, string(spoke.body))
+}
+
+func Test_handlePatch_WhenApply_ItShouldConvertYAMLAndRewriteAPIVersion(t *testing.T) {
+	spoke := &patchSpoke{}
+	srv := spoke.server(t, http.StatusOK, patchedHC)
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+
+	body := "apiVersion: hcp.ocm.io/v1alpha1\nkind: HostedCluster\nmetadata:\n  name: my-hc\n  labels:\n    team: a\n"
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/?fieldManager=gitops&force=true", contentTypeApplyPatchYAML, body),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, contentTypeApplyPatchYAML, spoke.contentType)
+	assert.Equal(t, "gitops", spoke.query.Get("fieldManager"))
+	assert.Equal(t, "true", spoke.query.Get("force"))
+	var sent map[string]interface{}
+	require.NoError(t, json.Unmarshal(spoke.body, &sent))
+	assert.Equal(t, "hypershift.openshift.io/v1beta1", sent["apiVersion"])
+	assert.Equal(t, "HostedCluster", sent["kind"])
+}
+
+func Test_handlePatch_WhenApplyWithoutFieldManager_ItShouldReturn400(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/", contentTypeApplyPatchYAML, "kind: HostedCluster\n"),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "fieldManager")
+}
+
+func Test_handlePatch_WhenStrategicMerge_ItShouldReturn415(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/", contentTypeStrategicMerge, "{}"),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func Test_handlePatch_WhenUnknownContentType_ItShouldReturn415(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/", "text/plain", "{}"),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func Test_handlePatch_WhenBodyTooLarge_ItShouldReturn413(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	body := `{"metadata":{"annotations":{"a":"` + strings.Repeat("x", maxRequestBodyBytes) + `"}}}`
+	p.handlePatch(w, patchRequest("/", contentTypeMergePatch, body),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func Test_handlePatch_WhenSpokeConflicts_ItShouldForwardStatus(t *testing.T) {
+	spoke := &patchSpoke{}
+	srv := spoke.server(t, http.StatusConflict, `{"kind":"Status","apiVersion":"v1","reason":"Conflict","code":409}`)
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/?fieldManager=gitops", contentTypeApplyPatchYAML, "kind: HostedCluster\n"),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"reason":"Conflict"`)
+}
+
+func Test_handleRoute_WhenPatchOnResourcesAlias_ItShouldReturn405(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", availableManagedCluster("spoke-1"))
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc/resources?hostingCluster=spoke-1"
+	w := httptest.NewRecorder()
+	p.handleRoute(w, patchRequest(path, contentTypeMergePatch, "{}"))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,236 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// hostingClusterAuto asks the proxy to pick the hosting cluster on create.
+	hostingClusterAuto = "auto"
+
+	// queryPlacement names a Placement ("<namespace>/<name>") whose decisions
+	// limit the candidates for automatic selection.
+	queryPlacement = "placement"
+)
+
+// hostingCandidate is an eligible hosting cluster and its capacity signals.
+type hostingCandidate struct {
+	name           string
+	aboveThreshold bool
+	// hostedClusters is the agent's hostedClustersCount score; math.MaxInt32
+	// when the cluster has not reported one.
+	hostedClusters int32
+}
+
+// wantsAutoHostingCluster reports whether the hosting cluster should be chosen
+// by the proxy: hostingCluster=auto, or a placement with no hostingCluster.
+func wantsAutoHostingCluster(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Get("hostingCluster") == hostingClusterAuto ||
+		(q.Get("hostingCluster") == "" && q.Get(queryPlacement) != "")
+}
+
+// selectHostingCluster picks the hosting cluster for a create. A candidate must
+// be a ManagedCluster the caller is admin on (every cluster when the hub
+// permission check is skipped or in SubjectAccessReview mode), carry the hosting-cluster claim, be Available,
+// not be full, and — when placementRef is set — be among the Placement's
+// decisions. The Placement is read with the proxy's identity, so the caller
+// must be allowed to list its PlacementDecisions.
+//
+// Candidates below the agent's hosted-cluster threshold come first, then the
+// lowest hostedClustersCount score from the hosted-clusters-score
+// AddOnPlacementScore, then the name, so the choice is deterministic.
+//
+// On failure the returned status is the HTTP code to answer with.
+func (p *hcpProxy) selectHostingCluster(
+	ctx context.Context,
+	username string,
+	groups []string,
+	extra map[string]authorizationv1.ExtraValue,
+	placementRef string,
+) (string, int, error) {
+	allowed, all, err := p.candidateHostingClusters(ctx, username, groups)
+	if err != nil {
+		return "", http.StatusForbidden, err
+	}
+
+	var decided sets.Set[string]
+	if placementRef != "" {
+		ns, name, err := parsePlacementRef(placementRef)
+		if err != nil {
+			return "", http.StatusBadRequest, err
+		}
+		if err := p.checkPlacementAccess(ctx, username, groups, extra, ns); err != nil {
+			return "", http.StatusForbidden, err
+		}
+		if decided, err = p.placementDecisions(ctx, ns, name); err != nil {
+			return "", http.StatusBadRequest, err
+		}
+	}
+
+	mcList := &clusterv1.ManagedClusterList{}
+	if err := p.hubClient.List(ctx, mcList); err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("failed to list managed clusters: %w", err)
+	}
+
+	var candidates []hostingCandidate
+	for i := range mcList.Items {
+		mc := &mcList.Items[i]
+		switch {
+		case !all && !allowed.Has(mc.Name),
+			decided != nil && !decided.Has(mc.Name),
+			!isHostingCluster(mc),
+			!meta.IsStatusConditionTrue(mc.Status.Conditions, clusterv1.ManagedClusterConditionAvailable),
+			clusterClaimValue(mc, util.FullHostedClusterCountClaimKey) == "true":
+			continue
+		}
+		candidates = append(candidates, hostingCandidate{
+			name:           mc.Name,
+			aboveThreshold: clusterClaimValue(mc, util.AboveThresholdHostedClusterCountClaimKey) == "true",
+			hostedClusters: p.hostedClusterScore(ctx, mc),
+		})
+	}
+	if len(candidates) == 0 {
+		msg := "no eligible hosting cluster: none is available, below its hosted cluster limit, and administered by the caller"
+		if placementRef != "" {
+			msg += " among the decisions of placement " + placementRef
+		}
+		return "", http.StatusServiceUnavailable, fmt.Errorf("%s", msg)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.aboveThreshold != b.aboveThreshold {
+			return !a.aboveThreshold
+		}
+		if a.hostedClusters != b.hostedClusters {
+			return a.hostedClusters < b.hostedClusters
+		}
+		return a.name < b.name
+	})
+	chosen := candidates[0]
+	p.log.Info("selected hosting cluster",
+		"hostingCluster", chosen.name,
+		"hostedClusters", chosen.hostedClusters,
+		"aboveThreshold", chosen.aboveThreshold,
+		"candidates", len(candidates),
+		"placement", placementRef,
+	)
+	return chosen.name, http.StatusOK, nil
+}
+
+// parsePlacementRef splits a placement named "<namespace>/<name>".
+func parsePlacementRef(placementRef string) (string, string, error) {
+	ns, name, ok := strings.Cut(placementRef, "/")
+	if !ok {
+		return "", "", fmt.Errorf("placement must be <namespace>/<name>, got %q", placementRef)
+	}
+	if _, err := sanitizeProxyName(ns); err != nil {
+		return "", "", fmt.Errorf("invalid placement namespace: %w", err)
+	}
+	if _, err := sanitizeProxyName(name); err != nil {
+		return "", "", fmt.Errorf("invalid placement name: %w", err)
+	}
+	return ns, name, nil
+}
+
+// checkPlacementAccess asks the hub, with a SubjectAccessReview, whether the
+// caller may list the PlacementDecisions in ns. Without it a caller could
+// learn the decisions of any Placement on the hub through the choice of
+// hosting cluster.
+func (p *hcpProxy) checkPlacementAccess(
+	ctx context.Context,
+	username string,
+	groups []string,
+	extra map[string]authorizationv1.ExtraValue,
+	ns string,
+) error {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   username,
+			Groups: groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Group:     clusterv1beta1.GroupName,
+				Version:   clusterv1beta1.GroupVersion.Version,
+				Resource:  "placementdecisions",
+				Namespace: ns,
+				Verb:      "list",
+			},
+		},
+	}
+	if err := p.hubClient.Create(ctx, review); err != nil {
+		return fmt.Errorf("failed to review access of user %q to placement decisions: %w", username, err)
+	}
+	if !review.Status.Allowed || review.Status.Denied {
+		return fmt.Errorf("user %q cannot list resource \"placementdecisions\" in API group %q in the namespace %q",
+			username, clusterv1beta1.GroupName, ns)
+	}
+	return nil
+}
+
+// placementDecisions returns the clusters selected by the Placement ns/name.
+func (p *hcpProxy) placementDecisions(ctx context.Context, ns, name string) (sets.Set[string], error) {
+	placementRef := ns + "/" + name
+	decisions := &clusterv1beta1.PlacementDecisionList{}
+	if err := p.hubClient.List(ctx, decisions,
+		client.InNamespace(ns),
+		client.MatchingLabels{clusterv1beta1.PlacementLabel: name},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list decisions of placement %s: %w", placementRef, err)
+	}
+	clusters := sets.New[string]()
+	for _, d := range decisions.Items {
+		for _, c := range d.Status.Decisions {
+			clusters.Insert(c.ClusterName)
+		}
+	}
+	if clusters.Len() == 0 {
+		return nil, fmt.Errorf("placement %s has no decisions", placementRef)
+	}
+	return clusters, nil
+}
+
+// hostedClusterScore reads the hostedClustersCount score the agent publishes in
+// the hosted-clusters-score AddOnPlacementScore. Without one, the zero claim is
+// used; otherwise the cluster sorts last.
+func (p *hcpProxy) hostedClusterScore(ctx context.Context, mc *clusterv1.ManagedCluster) int32 {
+	score := &clusterv1alpha1.AddOnPlacementScore{}
+	key := types.NamespacedName{Namespace: mc.Name, Name: util.HostedClusterScoresResourceName}
+	if err := p.hubClient.Get(ctx, key, score); err == nil {
+		for _, s := range score.Status.Scores {
+			if s.Name == util.HostedClusterScoresScoreName {
+				return s.Value
+			}
+		}
+	}
+	if clusterClaimValue(mc, util.ZeroHostedClusterCountClaimKey) == "true" {
+		return 0
+	}
+	return math.MaxInt32
+}
+
+// clusterClaimValue returns the value of the named ClusterClaim, or "".
+func clusterClaimValue(mc *clusterv1.ManagedCluster, name string) string {
+	for _, claim := range mc.Status.ClusterClaims {
+		if claim.Name == name {
+			return claim.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
+)
+
+// withClaim appends a ClusterClaim to mc and returns it.
+func withClaim(mc *clusterv1.ManagedCluster, name, value string) *clusterv1.ManagedCluster {
+	mc.Status.ClusterClaims = append(mc.Status.ClusterClaims, clusterv1.ManagedClusterClaim{Name: name, Value: value})
+	return mc
+}
+
+func hostedClusterScore(cluster string, count int32) *clusterv1alpha1.AddOnPlacementScore {
+	return &clusterv1alpha1.AddOnPlacementScore{
+		ObjectMeta: metav1.ObjectMeta{Name: util.HostedClusterScoresResourceName, Namespace: cluster},
+		Status: clusterv1alpha1.AddOnPlacementScoreStatus{
+			Scores: []clusterv1alpha1.AddOnPlacementScoreItem{
+				{Name: util.HostedClusterScoresScoreName, Value: count},
+			},
+		},
+	}
+}
+
+// allowPlacementDecisions lets callers list PlacementDecisions only in ns.
+func allowPlacementDecisions(p *hcpProxy, ns string) *reviewingClient {
+	c := &reviewingClient{Client: p.hubClient, allow: func(spec authorizationv1.SubjectAccessReviewSpec) (bool, error) {
+		attrs := spec.ResourceAttributes
+		return attrs.Resource == "placementdecisions" && attrs.Verb == "list" && attrs.Namespace == ns, nil
+	}}
+	p.hubClient = c
+	return c
+}
+
+func Test_selectHostingCluster_WhenSeveralEligible_ItShouldPreferLowestScore(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused",
+		hostingManagedCluster("busy"), hostedClusterScore("busy", 40),
+		hostingManagedCluster("quiet"), hostedClusterScore("quiet", 3),
+		hostingManagedCluster("unscored"),
+	)
+	chosen, status, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "quiet", chosen)
+}
+
+func Test_selectHostingCluster_WhenAboveThreshold_ItShouldPreferClusterBelowIt(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused",
+		withClaim(hostingManagedCluster("hot"), util.AboveThresholdHostedClusterCountClaimKey, "true"), hostedClusterScore("hot", 1),
+		withClaim(hostingManagedCluster("cool"), util.AboveThresholdHostedClusterCountClaimKey, "false"), hostedClusterScore("cool", 9),
+	)
+	chosen, _, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "cool", chosen)
+}
+
+func Test_selectHostingCluster_WhenNoScore_ItShouldUseZeroClaim(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused",
+		hostingManagedCluster("b-scored"), hostedClusterScore("b-scored", 2),
+		withClaim(hostingManagedCluster("z-empty"), util.ZeroHostedClusterCountClaimKey, "true"),
+	)
+	chosen, _, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "z-empty", chosen)
+}
+
+func Test_selectHostingCluster_WhenFullUnavailableOrNotHosting_ItShouldReturn503(t *testing.T) {
+	down := hostingManagedCluster("down")
+	down.Status.Conditions[0].Status = metav1.ConditionFalse
+	p := newTestProxyWithSpokeURL(t, "http://unused",
+		withClaim(hostingManagedCluster("full"), util.FullHostedClusterCountClaimKey, "true"),
+		down,
+		availableManagedCluster("plain"),
+	)
+	_, status, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func Test_selectHostingCluster_WhenPlacementGiven_ItShouldOnlyConsiderDecisions(t *testing.T) {
+	decision := &clusterv1beta1.PlacementDecision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "hosting-decision-1",
+			Namespace: "hcp-placements",
+			Labels:    map[string]string{clusterv1beta1.PlacementLabel: "hosting"},
+		},
+		Status: clusterv1beta1.PlacementDecisionStatus{
+			Decisions: []clusterv1beta1.ClusterDecision{{ClusterName: "picked"}},
+		},
+	}
+	p := newTestProxyWithSpokeURL(t, "http://unused",
+		hostingManagedCluster("picked"), hostedClusterScore("picked", 50),
+		hostingManagedCluster("other"), hostedClusterScore("other", 0),
+		decision,
+	)
+	reviews := allowPlacementDecisions(p, "hcp-placements")
+	chosen, _, err := p.selectHostingCluster(context.Background(), "alice", []string{"team-a"}, nil, "hcp-placements/hosting")
+	require.NoError(t, err)
+	assert.Equal(t, "picked", chosen)
+	require.Len(t, reviews.reviews, 1)
+	assert.Equal(t, "alice", reviews.reviews[0].User)
+	assert.Equal(t, []string{"team-a"}, reviews.reviews[0].Groups)
+	assert.Equal(t, clusterv1beta1.GroupName, reviews.reviews[0].ResourceAttributes.Group)
+}
+
+func Test_selectHostingCluster_WhenCallerCannotListPlacementDecisions_ItShouldReturn403(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", hostingManagedCluster("spoke-1"))
+	allowPlacementDecisions(p, "other")
+	_, status, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "hcp-placements/hosting")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Contains(t, err.Error(), `cannot list resource "placementdecisions"`)
+}
+
+func Test_selectHostingCluster_WhenPlacementHasNoDecisions_ItShouldReturn400(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", hostingManagedCluster("spoke-1"))
+	allowPlacementDecisions(p, "hcp-placements")
+	_, status, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "hcp-placements/missing")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func Test_selectHostingCluster_WhenPlacementMalformed_ItShouldReturn400(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused")
+	_, status, err := p.selectHostingCluster(context.Background(), "alice", nil, nil, "no-slash")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func Test_selectHostingCluster_WhenUnauthenticated_ItShouldReturn403(t *testing.T) {
+	p := newTestProxy(t, hostingManagedCluster("spoke-1"))
+	_, status, err := p.selectHostingCluster(context.Background(), "", nil, nil, "")
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func Test_handleRoute_WhenHostingClusterAuto_ItShouldCreateOnChosenClusterAndReportIt(t *testing.T) {
+	var postedPaths []string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postedPaths = append(postedPaths, r.URL.Path)
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{}`)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL,
+		hostingManagedCluster("spoke-1"), hostedClusterScore("spoke-1", 7),
+		hostingManagedCluster("spoke-2"), hostedClusterScore("spoke-2", 2),
+	)
+	body, _ := json.Marshal(CreateRequest{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc"}},
+	})
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters?hostingCluster=auto"
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	assert.Equal(t, "spoke-2", bundle.HostingCluster)
+	require.NotEmpty(t, postedPaths)
+	for _, path := range postedPaths {
+		assert.Contains(t, path, "/spoke-2/")
+	}
+}
+
+func Test_handleRoute_WhenHostingClusterAutoOnGET_ItShouldReturn400(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, "http://unused", hostingManagedCluster("spoke-1"))
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc?hostingCluster=auto"
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "only supported on create")
+}
@@ -0,0 +1,426 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+)
+
+const (
+	// policyConfigMapName is the optional ConfigMap in the operator namespace
+	// that constrains what may be created on each hosting cluster.
+	policyConfigMapName = "hcp-proxy-policy"
+	policyConfigMapKey  = "policy.yaml"
+
+	// Spoke defaults for an empty availability policy.
+	defaultControllerAvailabilityPolicy     = "HighlyAvailable"
+	defaultInfrastructureAvailabilityPolicy = "SingleReplica"
+)
+
+// releaseArchSuffixes are the architecture suffixes of OCP release image tags.
+var releaseArchSuffixes = []string{"x86_64", "aarch64", "ppc64le", "s390x", "multi", "amd64", "arm64"}
+
+// hostingPolicy is the content of the policy ConfigMap.
+type hostingPolicy struct {
+	Rules []policyRule `json:"rules"`
+}
+
+// policyRule constrains HostedClusters and NodePools on the hosting clusters
+// it selects: those listed in HostingClusters, those in one of
+// ManagedClusterSets, or every hosting cluster when both are empty. An empty
+// constraint allows anything.
+type policyRule struct {
+	Name               string   `json:"name"`
+	HostingClusters    []string `json:"hostingClusters,omitempty"`
+	ManagedClusterSets []string `json:"managedClusterSets,omitempty"`
+
+	// ReleaseImages holds exact pull specs and semver ranges of the OCP version
+	// in the image tag, such as ">=4.15.0 <4.17.0".
+	ReleaseImages                      []string `json:"releaseImages,omitempty"`
+	Platforms                          []string `json:"platforms,omitempty"`
+	ControllerAvailabilityPolicies     []string `json:"controllerAvailabilityPolicies,omitempty"`
+	InfrastructureAvailabilityPolicies []string `json:"infrastructureAvailabilityPolicies,omitempty"`
+	// MaxNodePoolReplicas caps spec.replicas and spec.autoScaling.max.
+	MaxNodePoolReplicas *int64 `json:"maxNodePoolReplicas,omitempty"`
+
+	exactImages   []string
+	versionRanges []semver.Range
+}
+
+// parsePolicy parses and validates the policy YAML. Unknown fields are errors
+// so a typo cannot silently disable a rule.
+func parsePolicy(data string) (*hostingPolicy, error) {
+	raw, err := yaml.YAMLToJSON([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	policy := &hostingPolicy{}
+	if err := dec.Decode(policy); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rules[%d]: name is required", i)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rules[%d]: duplicate name %q", i, rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.MaxNodePoolReplicas != nil && *rule.MaxNodePoolReplicas < 0 {
+			return nil, fmt.Errorf("rule %q: maxNodePoolReplicas must not be negative", rule.Name)
+		}
+		for _, entry := range rule.ReleaseImages {
+			if strings.ContainsAny(entry, "/@") {
+				rule.exactImages = append(rule.exactImages, entry)
+				continue
+			}
+			versionRange, err := semver.ParseRange(entry)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: release image %q is neither a pull spec nor a version range: %w",
+					rule.Name, entry, err)
+			}
+			rule.versionRanges = append(rule.versionRanges, versionRange)
+		}
+	}
+	return policy, nil
+}
+
+// releaseVersion returns the OCP version in the tag of a release image,
+// without the architecture suffix: ...:4.16.3-x86_64 is 4.16.3.
+func releaseVersion(image string) (semver.Version, error) {
+	if strings.Contains(image, "@") {
+		return semver.Version{}, fmt.Errorf("release image %q is pinned by digest", image)
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return semver.Version{}, fmt.Errorf("release image %q has no tag", image)
+	}
+	tag := image[i+1:]
+	for _, arch := range releaseArchSuffixes {
+		tag = strings.TrimSuffix(tag, "-"+arch)
+	}
+	return semver.Parse(tag)
+}
+
+func (rule *policyRule) appliesTo(hostingCluster, clusterSet string) bool {
+	if len(rule.HostingClusters) == 0 && len(rule.ManagedClusterSets) == 0 {
+		return true
+	}
+	return slices.Contains(rule.HostingClusters, hostingCluster) ||
+		(clusterSet != "" && slices.Contains(rule.ManagedClusterSets, clusterSet))
+}
+
+func (rule *policyRule) allowsReleaseImage(image string) bool {
+	if len(rule.ReleaseImages) == 0 || slices.Contains(rule.exactImages, image) {
+		return true
+	}
+	version, err := releaseVersion(image)
+	if err != nil {
+		return false
+	}
+	for _, versionRange := range rule.versionRanges {
+		if versionRange(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOneOf reports value at path unless allowed is empty or contains it.
+func (rule *policyRule) checkOneOf(allowed []string, value string, path *field.Path, what string) *field.Error {
+	if len(allowed) == 0 || slices.Contains(allowed, value) {
+		return nil
+	}
+	return field.Invalid(path, value, fmt.Sprintf("rule %q allows only %s %s", rule.Name, what, strings.Join(allowed, ", ")))
+}
+
+func (rule *policyRule) checkReplicas(replicas int64, path *field.Path) *field.Error {
+	if rule.MaxNodePoolReplicas == nil || replicas <= *rule.MaxNodePoolReplicas {
+		return nil
+	}
+	return field.Invalid(path, replicas, fmt.Sprintf("rule %q allows at most %d replicas", rule.Name, *rule.MaxNodePoolReplicas))
+}
+
+func (rule *policyRule) checkReleaseImage(image string, path *field.Path) *field.Error {
+	if rule.allowsReleaseImage(image) {
+		return nil
+	}
+	return field.Invalid(path, image,
+		fmt.Sprintf("rule %q allows only release images %s", rule.Name, strings.Join(rule.ReleaseImages, ", ")))
+}
+
+// appendErrs appends the non-nil errors to list.
+func appendErrs(list field.ErrorList, errs ...*field.Error) field.ErrorList {
+	for _, err := range errs {
+		if err != nil {
+			list = append(list, err)
+		}
+	}
+	return list
+}
+
+// checkHostedCluster returns one error per rule and field hc violates.
+func checkHostedCluster(rules []policyRule, hc map[string]interface{}, path *field.Path) field.ErrorList {
+	spec := path.Child("spec")
+	image, _, _ := unstructured.NestedString(hc, "spec", "release", "image")
+	platform, _, _ := unstructured.NestedString(hc, "spec", "platform", "type")
+	controller, _, _ := unstructured.NestedString(hc, "spec", "controllerAvailabilityPolicy")
+	if controller == "" {
+		controller = defaultControllerAvailabilityPolicy
+	}
+	infrastructure, _, _ := unstructured.NestedString(hc, "spec", "infrastructureAvailabilityPolicy")
+	if infrastructure == "" {
+		infrastructure = defaultInfrastructureAvailabilityPolicy
+	}
+
+	var errs field.ErrorList
+	for i := range rules {
+		rule := &rules[i]
+		errs = appendErrs(errs,
+			rule.checkReleaseImage(image, spec.Child("release", "image")),
+			rule.checkOneOf(rule.Platforms, platform, spec.Child("platform", "type"), "platforms"),
+			rule.checkOneOf(rule.ControllerAvailabilityPolicies, controller,
+				spec.Child("controllerAvailabilityPolicy"), "controller availability policies"),
+			rule.checkOneOf(rule.InfrastructureAvailabilityPolicies, infrastructure,
+				spec.Child("infrastructureAvailabilityPolicy"), "infrastructure availability policies"),
+		)
+	}
+	return errs
+}
+
+// checkNodePool returns one error per rule and field np violates. Unset or
+// empty fields are left to the spoke.
+func checkNodePool(rules []policyRule, np map[string]interface{}, path *field.Path) field.ErrorList {
+	spec := path.Child("spec")
+	image, _, _ := unstructured.NestedString(np, "spec", "release", "image")
+	platform, _, _ := unstructured.NestedString(np, "spec", "platform", "type")
+	replicas, hasReplicas := nestedCount(np, "spec", "replicas")
+	maxReplicas, hasMax := nestedCount(np, "spec", "autoScaling", "max")
+
+	var errs field.ErrorList
+	for i := range rules {
+		rule := &rules[i]
+		if image != "" {
+			errs = appendErrs(errs, rule.checkReleaseImage(image, spec.Child("release", "image")))
+		}
+		if platform != "" {
+			errs = appendErrs(errs, rule.checkOneOf(rule.Platforms, platform, spec.Child("platform", "type"), "platforms"))
+		}
+		if hasReplicas {
+			errs = appendErrs(errs, rule.checkReplicas(replicas, spec.Child("replicas")))
+		}
+		if hasMax {
+			errs = appendErrs(errs, rule.checkReplicas(maxReplicas, spec.Child("autoScaling", "max")))
+		}
+	}
+	return errs
+}
+
+// checkScale returns one error per rule the replica count of an
+// autoscaling/v1 Scale violates.
+func checkScale(rules []policyRule, scale map[string]interface{}) field.ErrorList {
+	replicas, ok := nestedCount(scale, "spec", "replicas")
+	if !ok {
+		return nil
+	}
+	var errs field.ErrorList
+	for i := range rules {
+		errs = appendErrs(errs, rules[i].checkReplicas(replicas, field.NewPath("spec", "replicas")))
+	}
+	return errs
+}
+
+// nestedCount reads an integer field of an object decoded either by the
+// unstructured converter (int64) or by encoding/json (float64).
+func nestedCount(obj map[string]interface{}, fields ...string) (int64, bool) {
+	v, ok, _ := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !ok {
+		return 0, false
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// objectMap converts a typed object for the checks. A failed conversion
+// yields an empty object, which fails any release image allowlist.
+func objectMap(obj interface{}) map[string]interface{} {
+	out, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return out
+}
+
+// policyRulesFor returns the policy rules that apply to hostingCluster. The
+// ConfigMap is read on every call: writes are rare, and an edit applies to the
+// next one. A missing ConfigMap means no rules; an invalid one is an error, so
+// a broken policy blocks writes instead of allowing everything.
+func (p *hcpProxy) policyRulesFor(ctx context.Context, hostingCluster string) ([]policyRule, error) {
+	cm := &corev1.ConfigMap{}
+	err := p.hubClient.Get(ctx, types.NamespacedName{Namespace: p.operatorNamespace, Name: policyConfigMapName}, cm)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy ConfigMap: %w", err)
+	}
+	policy, err := parsePolicy(cm.Data[policyConfigMapKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy ConfigMap %s/%s: %w", p.operatorNamespace, policyConfigMapName, err)
+	}
+	if len(policy.Rules) == 0 {
+		return nil, nil
+	}
+
+	mc := &clusterv1.ManagedCluster{}
+	if err := p.hubClient.Get(ctx, types.NamespacedName{Name: hostingCluster}, mc); err != nil {
+		return nil, fmt.Errorf("failed to read managed cluster %q: %w", hostingCluster, err)
+	}
+	clusterSet := mc.Labels[clusterv1beta2.ClusterSetLabel]
+
+	var rules []policyRule
+	for _, rule := range policy.Rules {
+		if rule.appliesTo(hostingCluster, clusterSet) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// enforcePolicy runs check against the rules that apply to hostingCluster.
+// It returns false, with the response written, when the request violates the
+// policy (422 listing every violation) or the policy cannot be evaluated.
+// check is not called when no rule applies.
+func (p *hcpProxy) enforcePolicy(
+	ctx context.Context,
+	w http.ResponseWriter,
+	hostingCluster, kind, name string,
+	check func(rules []policyRule) field.ErrorList,
+) bool {
+	rules, err := p.policyRulesFor(ctx, hostingCluster)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if len(rules) == 0 {
+		return true
+	}
+	return p.rejectViolations(w, hostingCluster, kind, name, check(rules))
+}
+
+// enforcePolicyOnPatch is enforcePolicy for a PATCH: the patch is previewed
+// as a dry run on the spoke and check gets the resulting object. The preview
+// is skipped when no rule applies.
+func (p *hcpProxy) enforcePolicyOnPatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	spokeName, kind, name, apiPath string,
+	query url.Values,
+	mediaType string,
+	body []byte,
+	check func(rules []policyRule, obj map[string]interface{}) field.ErrorList,
+) bool {
+	rules, err := p.policyRulesFor(r.Context(), spokeName)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if len(rules) == 0 {
+		return true
+	}
+	obj, ok := p.previewOnSpoke(w, r, http.MethodPatch, spokeName, apiPath, query, mediaType, body)
+	if !ok {
+		return false
+	}
+	return p.rejectViolations(w, spokeName, kind, name, check(rules, obj))
+}
+
+// rejectViolations answers 422 listing errs and returns false, or returns
+// true when errs is empty.
+func (p *hcpProxy) rejectViolations(w http.ResponseWriter, hostingCluster, kind, name string, errs field.ErrorList) bool {
+	if len(errs) == 0 {
+		return true
+	}
+	p.log.Info("rejecting write that violates the hosting cluster policy",
+		"hostingCluster", hostingCluster, "kind", kind, "name", name, "violations", len(errs))
+	status := apierrors.NewInvalid(schema.GroupKind{Group: hcpProxyAPIGroup, Kind: kind}, name, errs).ErrStatus
+	writeStatus(w, &status)
+	return false
+}
+
+// previewOnSpoke sends a write to the spoke as a server-side dry run and
+// returns the object the spoke would store, so a PATCH can be checked against
+// the policy before it is applied. If the dry run fails, its error is relayed
+// (the real write would fail the same way) and ok is false.
+func (p *hcpProxy) previewOnSpoke(
+	w http.ResponseWriter,
+	r *http.Request,
+	method, spokeName, apiPath string,
+	query url.Values,
+	contentType string,
+	body []byte,
+) (obj map[string]interface{}, ok bool) {
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	req, err := p.newSpokeRequest(r.Context(), method, spokeName, apiPath, bytes.NewReader(body))
+	if err != nil {
+		writeJSONError(w, "failed to build spoke request: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	dryRunQuery := url.Values{}
+	for k, v := range query {
+		dryRunQuery[k] = v
+	}
+	dryRunQuery.Set("dryRun", dryRunAll)
+	req.URL.RawQuery = dryRunQuery.Encode()
+	req.Header.Set(headerContentType, contentType)
+
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		writeJSONError(w, "spoke request failed: "+err.Error(), http.StatusBadGateway)
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		p.forwardObjectResponse(w, resp, spokeName)
+		return nil, false
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		writeJSONError(w, "failed to decode spoke response: "+err.Error(), http.StatusBadGateway)
+		return nil, false
+	}
+	return obj, true
+}
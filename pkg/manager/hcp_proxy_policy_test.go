@@ -0,0 +1,240 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1beta2 "open-cluster-management.io/api/cluster/v1beta2"
+)
+
+const testPolicy = `
+rules:
+- name: prod-releases
+  managedClusterSets: [prod]
+  releaseImages:
+  - ">=4.16.0 <4.18.0"
+  - quay.io/openshift-release-dev/ocp-release@sha256:abc
+  controllerAvailabilityPolicies: [HighlyAvailable]
+- name: aws-only
+  hostingClusters: [spoke-1]
+  platforms: [AWS]
+  maxNodePoolReplicas: 5
+`
+
+func policyConfigMap(data string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: policyConfigMapName, Namespace: "multicluster-engine"},
+		Data:       map[string]string{policyConfigMapKey: data},
+	}
+}
+
+func managedClusterInSet(name, clusterSet string) *clusterv1.ManagedCluster {
+	mc := availableManagedCluster(name)
+	mc.Labels = map[string]string{clusterv1beta2.ClusterSetLabel: clusterSet}
+	return mc
+}
+
+func policyCreateBody(t *testing.T, image string, platform hypershiftv1beta1.PlatformType, replicas int32) []byte {
+	t.Helper()
+	body, err := json.Marshal(CreateRequest{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-hc"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				Release:  hypershiftv1beta1.Release{Image: image},
+				Platform: hypershiftv1beta1.PlatformSpec{Type: platform},
+			},
+		},
+		NodePools: []*hypershiftv1beta1.NodePool{{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool"},
+			Spec:       hypershiftv1beta1.NodePoolSpec{Replicas: &replicas},
+		}},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+func decodeStatusCauses(t *testing.T, body []byte) []string {
+	t.Helper()
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(body, &status))
+	require.NotNil(t, status.Details)
+	fields := make([]string, 0, len(status.Details.Causes))
+	for _, c := range status.Details.Causes {
+		fields = append(fields, c.Field)
+	}
+	return fields
+}
+
+func Test_parsePolicy_WhenInvalid_ItShouldFail(t *testing.T) {
+	for _, tc := range []struct{ data, err string }{
+		{"rules:\n- name: a\n  platform: [AWS]\n", "unknown field"},
+		{"rules:\n- name: a\n  releaseImages: [\"4.16\"]\n", "neither a pull spec nor a version range"},
+		{"rules:\n- name: a\n- name: a\n", "duplicate name"},
+		{"rules:\n- platforms: [AWS]\n", "name is required"},
+		{"rules:\n- name: a\n  maxNodePoolReplicas: -1\n", "must not be negative"},
+	} {
+		_, err := parsePolicy(tc.data)
+		assert.ErrorContains(t, err, tc.err, tc.data)
+	}
+
+	policy, err := parsePolicy(testPolicy)
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 2)
+	assert.Len(t, policy.Rules[0].versionRanges, 1)
+	assert.Len(t, policy.Rules[0].exactImages, 1)
+
+	policy, err = parsePolicy("")
+	require.NoError(t, err)
+	assert.Empty(t, policy.Rules)
+}
+
+func Test_releaseVersion_WhenTagged_ItShouldStripTheArchitecture(t *testing.T) {
+	v, err := releaseVersion("quay.io/openshift-release-dev/ocp-release:4.16.3-x86_64")
+	require.NoError(t, err)
+	assert.Equal(t, "4.16.3", v.String())
+
+	v, err = releaseVersion("registry:5000/ocp-release:4.17.0-rc.1-multi")
+	require.NoError(t, err)
+	assert.Equal(t, "4.17.0-rc.1", v.String())
+
+	_, err = releaseVersion("registry:5000/ocp-release")
+	assert.ErrorContains(t, err, "no tag")
+	_, err = releaseVersion("quay.io/ocp-release@sha256:abc")
+	assert.ErrorContains(t, err, "digest")
+}
+
+func Test_policyRulesFor_WhenRulesSelectClusters_ItShouldMatchNameAndClusterSet(t *testing.T) {
+	p := newTestProxy(t, policyConfigMap(testPolicy),
+		managedClusterInSet("spoke-1", "dev"), managedClusterInSet("spoke-2", "prod"), availableManagedCluster("spoke-3"))
+
+	names := func(hostingCluster string) []string {
+		rules, err := p.policyRulesFor(context.Background(), hostingCluster)
+		require.NoError(t, err)
+		var out []string
+		for _, rule := range rules {
+			out = append(out, rule.Name)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"aws-only"}, names("spoke-1"))
+	assert.Equal(t, []string{"prod-releases"}, names("spoke-2"))
+	assert.Empty(t, names("spoke-3"))
+}
+
+func Test_handleCreate_WhenPolicyViolated_ItShouldReturn422WithEveryViolation(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL,
+		policyConfigMap(testPolicy), managedClusterInSet("spoke-1", "prod"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(
+		policyCreateBody(t, "quay.io/openshift-release-dev/ocp-release:4.15.9-x86_64", hypershiftv1beta1.AzurePlatform, 6)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Empty(t, spoke.writes, "nothing reaches the spoke")
+	assert.ElementsMatch(t, []string{
+		"hostedCluster.spec.release.image",
+		"hostedCluster.spec.platform.type",
+		"nodePools[0].spec.replicas",
+	}, decodeStatusCauses(t, w.Body.Bytes()))
+	assert.Contains(t, w.Body.String(), `rule \"prod-releases\" allows only release images`)
+	assert.Contains(t, w.Body.String(), `rule \"aws-only\" allows at most 5 replicas`)
+}
+
+func Test_handleCreate_WhenPolicyAllows_ItShouldCreate(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL,
+		policyConfigMap(testPolicy), managedClusterInSet("spoke-1", "prod"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?dryRun=All", bytes.NewReader(
+		policyCreateBody(t, "quay.io/openshift-release-dev/ocp-release:4.16.3-x86_64", hypershiftv1beta1.AWSPlatform, 3)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, spoke.writes)
+}
+
+func Test_handleCreate_WhenPolicyInvalid_ItShouldFailClosed(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL,
+		policyConfigMap("rules: [{name: a, platfroms: [AWS]}]"), availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(
+		policyCreateBody(t, "quay.io/openshift-release-dev/ocp-release:4.16.3-x86_64", hypershiftv1beta1.AWSPlatform, 1)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid policy ConfigMap")
+	assert.Empty(t, spoke.writes)
+}
+
+func Test_handleNodePoolScale_WhenPutExceedsMax_ItShouldReturn422(t *testing.T) {
+	spoke := &patchSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, http.StatusOK, `{}`).URL,
+		policyConfigMap(testPolicy), availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(
+		`{"apiVersion":"autoscaling/v1","kind":"Scale","metadata":{"name":"np-1"},"spec":{"replicas":8}}`))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleNodePoolScale(w, r, "clusters", "np-1", "spoke-1")
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, []string{"spec.replicas"}, decodeStatusCauses(t, w.Body.Bytes()))
+	assert.Empty(t, spoke.method, "nothing reaches the spoke")
+}
+
+func Test_handlePatch_WhenPreviewViolatesPolicy_ItShouldNotApplyThePatch(t *testing.T) {
+	var dryRuns, applied int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("dryRun") == dryRunAll {
+			dryRuns++
+		} else {
+			applied++
+		}
+		w.Header().Set(headerContentType, contentTypeJSON)
+		_, _ = w.Write([]byte(`{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"NodePool",` +
+			`"metadata":{"name":"np-1","namespace":"clusters"},"spec":{"replicas":9}}`))
+	}))
+	t.Cleanup(srv.Close)
+	p := newTestProxyWithSpokeURL(t, srv.URL, policyConfigMap(testPolicy), availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/", contentTypeMergePatch, `{"spec":{"replicas":9}}`),
+		"clusters", resourceNodePools, "np-1", "spoke-1")
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, []string{"spec.replicas"}, decodeStatusCauses(t, w.Body.Bytes()))
+	assert.Equal(t, 1, dryRuns)
+	assert.Zero(t, applied)
+}
+
+func Test_handlePatch_WhenNoPolicy_ItShouldNotPreview(t *testing.T) {
+	spoke := &patchSpoke{}
+	srv := spoke.server(t, http.StatusOK, patchedHC)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handlePatch(w, patchRequest("/", contentTypeMergePatch, `{"spec":{"platform":{"type":"Azure"}}}`),
+		"clusters", resourceHostedClusters, "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, spoke.query.Get("dryRun"))
+}
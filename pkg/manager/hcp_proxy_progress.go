@@ -0,0 +1,307 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"github.com/stolostron/hypershift-addon-operator/pkg/util"
+)
+
+const (
+	subresourceProgress = "progress"
+
+	// queryOperationID makes GET .../progress fail with 404 unless the
+	// HostedCluster is still the one the create with that operation ID made.
+	queryOperationID = "operationID"
+
+	// annotationImportHostingCluster names the hosting cluster on the hub
+	// ManagedCluster of a hosted cluster imported in hosted mode.
+	annotationImportHostingCluster = "import.open-cluster-management.io/hosting-cluster-name"
+
+	// createRetention is how long the start of a create is remembered.
+	createRetention = 24 * time.Hour
+)
+
+// ProgressPhase is a milestone of a HostedCluster created through the proxy.
+type ProgressPhase string
+
+const (
+	ProgressSecretsApplied        ProgressPhase = "SecretsApplied"
+	ProgressHostedClusterCreated  ProgressPhase = "HostedClusterCreated"
+	ProgressControlPlaneAvailable ProgressPhase = "ControlPlaneAvailable"
+	ProgressNodePoolsReady        ProgressPhase = "NodePoolsReady"
+	ProgressImported              ProgressPhase = "ImportedAsManagedCluster"
+	ProgressCompleted             ProgressPhase = "Completed"
+)
+
+// CreateProgress is the response body of GET .../hostedclusters/{name}/progress.
+type CreateProgress struct {
+	// OperationID is the UID of the HostedCluster. It is returned by the
+	// create and changes if the HostedCluster is deleted and created again.
+	OperationID    string `json:"operationID"`
+	Namespace      string `json:"namespace"`
+	Name           string `json:"name"`
+	HostingCluster string `json:"hostingCluster"`
+	// Phase is the first phase that is not complete, or Completed.
+	Phase  ProgressPhase  `json:"phase"`
+	Phases []ProgressStep `json:"phases"`
+	// ManagedCluster is the hub ManagedCluster of the hosted cluster, once
+	// it exists.
+	ManagedCluster string `json:"managedCluster,omitempty"`
+	// Conditions are the latest conditions of the HostedCluster.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ProgressStep is one phase of a create. StartTime is set once the previous
+// phase is complete.
+type ProgressStep struct {
+	Phase          ProgressPhase `json:"phase"`
+	Completed      bool          `json:"completed"`
+	StartTime      *metav1.Time  `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time  `json:"completionTime,omitempty"`
+	// Message says what the phase is waiting for.
+	Message string `json:"message,omitempty"`
+}
+
+// createOperation is what only the proxy knows about a create: when it
+// started and when its Secrets were applied.
+type createOperation struct {
+	startTime      metav1.Time
+	secretsApplied metav1.Time
+}
+
+// createTracker holds the creates this proxy replica served, keyed by
+// HostedCluster UID. The zero value is ready to use.
+type createTracker struct {
+	mu      sync.Mutex
+	creates map[types.UID]createOperation
+}
+
+func (t *createTracker) record(uid types.UID, op createOperation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.creates == nil {
+		t.creates = map[types.UID]createOperation{}
+	}
+	for key, existing := range t.creates {
+		if time.Since(existing.startTime.Time) > createRetention {
+			delete(t.creates, key)
+		}
+	}
+	t.creates[uid] = op
+}
+
+func (t *createTracker) get(uid types.UID) (createOperation, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op, ok := t.creates[uid]
+	return op, ok
+}
+
+// handleProgress serves GET .../hostedclusters/{name}/progress. Phases after
+// the create are read from the HostedCluster and its NodePools on the spoke,
+// as the caller, and from the ManagedCluster on the hub, so any replica can
+// answer and nothing runs in the background. Their times are the transition
+// times of the conditions.
+func (p *hcpProxy) handleProgress(w http.ResponseWriter, r *http.Request, ns, name, spokeName string) {
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+
+	hc, code, msg := p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
+	if hc == nil {
+		writeJSONError(w, msg, code)
+		return
+	}
+	if id := r.URL.Query().Get(queryOperationID); id != "" && id != string(hc.UID) {
+		writeJSONError(w, fmt.Sprintf("operation %s not found: HostedCluster %s was deleted and created again", id, name),
+			http.StatusNotFound)
+		return
+	}
+
+	npPath, err := hsCollectionAPIPath(ns, resourceNodePools)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	npList := &hypershiftv1beta1.NodePoolList{}
+	if err := p.getFromSpoke(ctx, hcpClient, spokeName, npPath, nil, npList); err != nil {
+		writeJSONError(w, "listing NodePools: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	var nodePools []hypershiftv1beta1.NodePool
+	for _, np := range npList.Items {
+		if np.Spec.ClusterName == name {
+			nodePools = append(nodePools, np)
+		}
+	}
+
+	mc, err := p.importedManagedCluster(ctx, hc, spokeName)
+	if err != nil {
+		writeJSONError(w, "reading the ManagedCluster: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	op, recorded := p.creates.get(hc.UID)
+	if !recorded {
+		// Created by another replica, before a restart or without the
+		// proxy: the Secrets were applied by the time the HostedCluster was.
+		op = createOperation{startTime: hc.CreationTimestamp, secretsApplied: hc.CreationTimestamp}
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(buildProgress(hc, nodePools, mc, op, spokeName))
+}
+
+// importedManagedCluster returns the hub ManagedCluster of the hosted cluster,
+// or nil before it is imported. Its name is the managedcluster-name
+// annotation of the HostedCluster, {hostingCluster}-{name} for a discovered
+// cluster, or the HostedCluster name. A candidate only counts if it is
+// imported from spokeName, so a same-named cluster elsewhere is ignored.
+func (p *hcpProxy) importedManagedCluster(
+	ctx context.Context,
+	hc *hypershiftv1beta1.HostedCluster,
+	spokeName string,
+) (*clusterv1.ManagedCluster, error) {
+	var candidates []string
+	if name := hc.Annotations[util.ManagedClusterAnnoKey]; name != "" {
+		candidates = append(candidates, name)
+	}
+	candidates = append(candidates, spokeName+"-"+hc.Name, hc.Name)
+	for _, name := range candidates {
+		mc := &clusterv1.ManagedCluster{}
+		err := p.hubClient.Get(ctx, types.NamespacedName{Name: name}, mc)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if mc.Annotations[annotationImportHostingCluster] == spokeName {
+			return mc, nil
+		}
+	}
+	return nil, nil
+}
+
+// buildProgress derives the phases of a create from the objects it made.
+func buildProgress(
+	hc *hypershiftv1beta1.HostedCluster,
+	nodePools []hypershiftv1beta1.NodePool,
+	mc *clusterv1.ManagedCluster,
+	op createOperation,
+	spokeName string,
+) *CreateProgress {
+	progress := &CreateProgress{
+		OperationID:    string(hc.UID),
+		Namespace:      hc.Namespace,
+		Name:           hc.Name,
+		HostingCluster: spokeName,
+		Conditions:     hc.Status.Conditions,
+	}
+
+	secrets := doneStep(ProgressSecretsApplied, op.secretsApplied)
+	secrets.StartTime = &op.startTime
+	steps := []ProgressStep{
+		secrets,
+		doneStep(ProgressHostedClusterCreated, hc.CreationTimestamp),
+		conditionStep(ProgressControlPlaneAvailable,
+			meta.FindStatusCondition(hc.Status.Conditions, string(hypershiftv1beta1.HostedClusterAvailable)),
+			"waiting for the HostedCluster to report Available"),
+		nodePoolsStep(nodePools),
+	}
+	imported := ProgressStep{Phase: ProgressImported, Message: "waiting for the hosted cluster to be imported"}
+	if mc != nil {
+		progress.ManagedCluster = mc.Name
+		imported = conditionStep(ProgressImported,
+			meta.FindStatusCondition(mc.Status.Conditions, clusterv1.ManagedClusterConditionJoined),
+			fmt.Sprintf("waiting for ManagedCluster %s to join", mc.Name))
+	}
+	steps = append(steps, imported)
+
+	progress.Phase = ProgressCompleted
+	for i := range steps {
+		if i > 0 && steps[i-1].Completed {
+			steps[i].StartTime = steps[i-1].CompletionTime
+		}
+		if steps[i].Completed && steps[i].CompletionTime == nil {
+			// Nothing to wait for: done as soon as it started.
+			steps[i].CompletionTime = steps[i].StartTime
+		}
+		if !steps[i].Completed && progress.Phase == ProgressCompleted {
+			progress.Phase = steps[i].Phase
+		}
+	}
+	progress.Phases = steps
+	return progress
+}
+
+func doneStep(phase ProgressPhase, at metav1.Time) ProgressStep {
+	return ProgressStep{Phase: phase, Completed: true, CompletionTime: &at}
+}
+
+// conditionStep is complete once cond is True, at its transition time.
+// Otherwise its message is the condition message, or waiting when the
+// condition is not reported yet.
+func conditionStep(phase ProgressPhase, cond *metav1.Condition, waiting string) ProgressStep {
+	if cond != nil && cond.Status == metav1.ConditionTrue {
+		return doneStep(phase, cond.LastTransitionTime)
+	}
+	step := ProgressStep{Phase: phase, Message: waiting}
+	if cond != nil && cond.Message != "" {
+		step.Message = cond.Message
+	}
+	return step
+}
+
+// nodePoolsStep is complete once every NodePool is Ready, at the latest Ready
+// transition. A HostedCluster without NodePools has nothing to wait for.
+func nodePoolsStep(nodePools []hypershiftv1beta1.NodePool) ProgressStep {
+	if len(nodePools) == 0 {
+		return ProgressStep{Phase: ProgressNodePoolsReady, Completed: true, Message: "the HostedCluster has no NodePools"}
+	}
+	var latest metav1.Time
+	var waiting []string
+	for i := range nodePools {
+		ready := nodePoolReadyCondition(&nodePools[i])
+		if ready == nil || ready.Status != corev1.ConditionTrue {
+			waiting = append(waiting, nodePools[i].Name)
+			continue
+		}
+		if latest.Before(&ready.LastTransitionTime) {
+			latest = ready.LastTransitionTime
+		}
+	}
+	if len(waiting) > 0 {
+		return ProgressStep{Phase: ProgressNodePoolsReady,
+			Message: "waiting for NodePools to be Ready: " + strings.Join(waiting, ", ")}
+	}
+	return doneStep(ProgressNodePoolsReady, latest)
+}
+
+// nodePoolReadyCondition returns the Ready condition of np. NodePools have
+// their own condition type, so meta.FindStatusCondition does not apply.
+func nodePoolReadyCondition(np *hypershiftv1beta1.NodePool) *hypershiftv1beta1.NodePoolCondition {
+	for i := range np.Status.Conditions {
+		if np.Status.Conditions[i].Type == hypershiftv1beta1.NodePoolReadyConditionType {
+			return &np.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func progressRequest(method, query string) *http.Request {
+	path := apiPathPrefix + hcpProxyGroupVersion + "/namespaces/clusters/hostedclusters/my-hc/progress?hostingCluster=spoke-1" + query
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	return r
+}
+
+func readyNodePool(name string, at metav1.Time) hypershiftv1beta1.NodePool {
+	return hypershiftv1beta1.NodePool{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: hypershiftv1beta1.NodePoolStatus{Conditions: []hypershiftv1beta1.NodePoolCondition{{
+			Type:               hypershiftv1beta1.NodePoolReadyConditionType,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: at,
+		}}},
+	}
+}
+
+func Test_handleRoute_WhenCreatedThroughProxy_ItShouldReportProgress(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
+		"hostedCluster": {"metadata": {"name": "my-hc"}},
+		"nodePools": [{"metadata": {"name": "my-hc-pool"}}]
+	}`))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	require.NotEmpty(t, bundle.OperationID)
+	assert.True(t, spoke.has(migrateHCPath))
+
+	w = httptest.NewRecorder()
+	p.handleRoute(w, progressRequest(http.MethodGet, "&operationID="+bundle.OperationID))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var progress CreateProgress
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &progress))
+	assert.Equal(t, bundle.OperationID, progress.OperationID)
+	assert.Equal(t, "spoke-1", progress.HostingCluster)
+	assert.Equal(t, ProgressNodePoolsReady, progress.Phase)
+	require.Len(t, progress.Phases, 5)
+	assert.NotNil(t, progress.Phases[0].StartTime, "the start of the create is remembered")
+	for _, step := range progress.Phases[:3] {
+		assert.True(t, step.Completed, step.Phase)
+	}
+	assert.Equal(t, "waiting for NodePools to be Ready: my-hc-pool", progress.Phases[3].Message)
+	assert.False(t, progress.Phases[4].Completed)
+
+	w = httptest.NewRecorder()
+	p.handleRoute(w, progressRequest(http.MethodGet, "&operationID=uid-other"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	p.handleRoute(w, progressRequest(http.MethodPost, ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func Test_buildProgress_WhenEverythingIsReady_ItShouldChainThePhases(t *testing.T) {
+	at := func(minutes int) metav1.Time {
+		return metav1.NewTime(time.Date(2026, 1, 1, 0, minutes, 0, 0, time.UTC))
+	}
+	hc := &hypershiftv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-hc", Namespace: "clusters", UID: "uid-1", CreationTimestamp: at(1)},
+		Status: hypershiftv1beta1.HostedClusterStatus{Conditions: []metav1.Condition{{
+			Type: string(hypershiftv1beta1.HostedClusterAvailable), Status: metav1.ConditionTrue, LastTransitionTime: at(10),
+		}}},
+	}
+	mc := availableManagedCluster("my-hc")
+	mc.Status.Conditions = append(mc.Status.Conditions, metav1.Condition{
+		Type: clusterv1.ManagedClusterConditionJoined, Status: metav1.ConditionTrue, LastTransitionTime: at(30),
+	})
+	nodePools := []hypershiftv1beta1.NodePool{readyNodePool("a", at(20)), readyNodePool("b", at(15))}
+
+	progress := buildProgress(hc, nodePools, mc, createOperation{startTime: at(0), secretsApplied: at(1)}, "spoke-1")
+
+	assert.Equal(t, ProgressCompleted, progress.Phase)
+	assert.Equal(t, "my-hc", progress.ManagedCluster)
+	wantEnd := []metav1.Time{at(1), at(1), at(10), at(20), at(30)}
+	require.Len(t, progress.Phases, len(wantEnd))
+	start := at(0)
+	for i, step := range progress.Phases {
+		assert.True(t, step.Completed, step.Phase)
+		assert.Equal(t, start.UTC(), step.StartTime.UTC(), step.Phase)
+		assert.Equal(t, wantEnd[i].UTC(), step.CompletionTime.UTC(), step.Phase)
+		start = wantEnd[i]
+	}
+
+	progress = buildProgress(hc, nil, nil, createOperation{startTime: at(0), secretsApplied: at(1)}, "spoke-1")
+	assert.Equal(t, ProgressImported, progress.Phase)
+	assert.True(t, progress.Phases[3].Completed, "no NodePools means nothing to wait for")
+	require.NotNil(t, progress.Phases[4].StartTime)
+	assert.Equal(t, at(10).UTC(), progress.Phases[4].StartTime.UTC())
+	assert.Equal(t, "waiting for the hosted cluster to be imported", progress.Phases[4].Message)
+}
+
+func Test_importedManagedCluster_WhenImportedFromAnotherHostingCluster_ItShouldIgnoreIt(t *testing.T) {
+	elsewhere := availableManagedCluster("my-hc")
+	elsewhere.Annotations = map[string]string{annotationImportHostingCluster: "spoke-2"}
+	discovered := availableManagedCluster("spoke-1-my-hc")
+	discovered.Annotations = map[string]string{annotationImportHostingCluster: "spoke-1"}
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "my-hc", Namespace: "clusters"}}
+
+	p := newTestProxy(t, elsewhere)
+	mc, err := p.importedManagedCluster(context.Background(), hc, "spoke-1")
+	require.NoError(t, err)
+	assert.Nil(t, mc)
+
+	p = newTestProxy(t, elsewhere, discovered)
+	mc, err = p.importedManagedCluster(context.Background(), hc, "spoke-1")
+	require.NoError(t, err)
+	require.NotNil(t, mc)
+	assert.Equal(t, "spoke-1-my-hc", mc.Name)
+}
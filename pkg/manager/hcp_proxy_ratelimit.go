@@ -0,0 +1,377 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// rateLimitConfigMapName is the ConfigMap in the operator namespace that
+	// holds the proxy's admission limits. It is optional.
+	rateLimitConfigMapName = "hcp-proxy-rate-limits"
+
+	rateLimitKeyUserQPS             = "userQPS"
+	rateLimitKeyUserBurst           = "userBurst"
+	rateLimitKeyHostingClusterQPS   = "hostingClusterQPS"
+	rateLimitKeyHostingClusterBurst = "hostingClusterBurst"
+	rateLimitKeyMaxInFlight         = "maxInFlightSpokeRequests"
+
+	// rateLimiterIdleTTL is how long the bucket of a user or hosting cluster
+	// with no requests is kept. A dropped bucket starts full again.
+	rateLimiterIdleTTL = 10 * time.Minute
+)
+
+// Overridable in tests.
+var (
+	// rateLimitReloadInterval is how often the ConfigMap is re-read.
+	rateLimitReloadInterval = 30 * time.Second
+)
+
+// rateLimitConfig holds the admission limits. A zero QPS or MaxInFlight
+// disables that limit.
+type rateLimitConfig struct {
+	UserQPS             float64
+	UserBurst           int
+	HostingClusterQPS   float64
+	HostingClusterBurst int
+	MaxInFlight         int
+}
+
+// defaultRateLimitConfig applies while the ConfigMap is missing, and to any
+// key it does not set.
+var defaultRateLimitConfig = rateLimitConfig{
+	UserQPS:             10,
+	UserBurst:           20,
+	HostingClusterQPS:   50,
+	HostingClusterBurst: 100,
+	MaxInFlight:         200,
+}
+
+// parseRateLimitConfig overlays the ConfigMap data on the defaults. Any
+// invalid value rejects the whole ConfigMap.
+func parseRateLimitConfig(data map[string]string) (rateLimitConfig, error) {
+	cfg := defaultRateLimitConfig
+	floats := map[string]*float64{
+		rateLimitKeyUserQPS:           &cfg.UserQPS,
+		rateLimitKeyHostingClusterQPS: &cfg.HostingClusterQPS,
+	}
+	for key, dst := range floats {
+		raw, ok := data[key]
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return rateLimitConfig{}, fmt.Errorf("%s: %q is not a non-negative number", key, raw)
+		}
+		*dst = v
+	}
+	ints := map[string]*int{
+		rateLimitKeyUserBurst:           &cfg.UserBurst,
+		rateLimitKeyHostingClusterBurst: &cfg.HostingClusterBurst,
+		rateLimitKeyMaxInFlight:         &cfg.MaxInFlight,
+	}
+	for key, dst := range ints {
+		raw, ok := data[key]
+		if !ok {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || v < 0 {
+			return rateLimitConfig{}, fmt.Errorf("%s: %q is not a non-negative integer", key, raw)
+		}
+		*dst = v
+	}
+	if cfg.UserQPS > 0 && cfg.UserBurst == 0 {
+		return rateLimitConfig{}, fmt.Errorf("%s must be positive when %s is set", rateLimitKeyUserBurst, rateLimitKeyUserQPS)
+	}
+	if cfg.HostingClusterQPS > 0 && cfg.HostingClusterBurst == 0 {
+		return rateLimitConfig{}, fmt.Errorf("%s must be positive when %s is set",
+			rateLimitKeyHostingClusterBurst, rateLimitKeyHostingClusterQPS)
+	}
+	return cfg, nil
+}
+
+// bucket is the token bucket of one user or hosting cluster.
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter admits proxied requests against a token bucket per user, and
+// every call the proxy makes to a hosting cluster against a token bucket per
+// hosting cluster and a cap on calls in flight. A fan-out list is one request
+// but as many calls as hosting clusters it reads.
+type rateLimiter struct {
+	hubClient client.Client
+	namespace string
+	log       logr.Logger
+
+	mu       sync.Mutex
+	cfg      rateLimitConfig
+	users    map[string]*bucket
+	clusters map[string]*bucket
+	inFlight int
+}
+
+func newRateLimiter(hubClient client.Client, operatorNamespace string, log logr.Logger) *rateLimiter {
+	return &rateLimiter{
+		hubClient: hubClient,
+		namespace: operatorNamespace,
+		log:       log,
+		cfg:       defaultRateLimitConfig,
+		users:     map[string]*bucket{},
+		clusters:  map[string]*bucket{},
+	}
+}
+
+// run re-reads the ConfigMap every rateLimitReloadInterval until ctx is done,
+// and drops idle buckets.
+func (l *rateLimiter) run(ctx context.Context) {
+	l.reload(ctx)
+	ticker := time.NewTicker(rateLimitReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.reload(ctx)
+			l.prune(time.Now())
+		}
+	}
+}
+
+// reload applies the ConfigMap. A missing ConfigMap restores the defaults; an
+// unreadable or invalid one keeps the current limits.
+func (l *rateLimiter) reload(ctx context.Context) {
+	cm := &corev1.ConfigMap{}
+	err := l.hubClient.Get(ctx, types.NamespacedName{Namespace: l.namespace, Name: rateLimitConfigMapName}, cm)
+	var cfg rateLimitConfig
+	switch {
+	case apierrors.IsNotFound(err):
+		cfg = defaultRateLimitConfig
+	case err != nil:
+		l.log.Error(err, "failed to read rate limit ConfigMap, keeping current limits",
+			"namespace", l.namespace, "name", rateLimitConfigMapName)
+		return
+	default:
+		cfg, err = parseRateLimitConfig(cm.Data)
+		if err != nil {
+			l.log.Error(err, "invalid rate limit ConfigMap, keeping current limits",
+				"namespace", l.namespace, "name", rateLimitConfigMapName)
+			return
+		}
+	}
+	l.setConfig(cfg)
+}
+
+func (l *rateLimiter) setConfig(cfg rateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cfg == l.cfg {
+		return
+	}
+	l.log.Info("HCP proxy rate limits changed",
+		"userQPS", cfg.UserQPS, "userBurst", cfg.UserBurst,
+		"hostingClusterQPS", cfg.HostingClusterQPS, "hostingClusterBurst", cfg.HostingClusterBurst,
+		"maxInFlightSpokeRequests", cfg.MaxInFlight)
+	l.cfg = cfg
+	for _, b := range l.users {
+		b.limiter.SetLimit(rate.Limit(cfg.UserQPS))
+		b.limiter.SetBurst(cfg.UserBurst)
+	}
+	for _, b := range l.clusters {
+		b.limiter.SetLimit(rate.Limit(cfg.HostingClusterQPS))
+		b.limiter.SetBurst(cfg.HostingClusterBurst)
+	}
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, buckets := range []map[string]*bucket{l.users, l.clusters} {
+		for key, b := range buckets {
+			if now.Sub(b.lastSeen) > rateLimiterIdleTTL {
+				delete(buckets, key)
+			}
+		}
+	}
+}
+
+// bucketCheck is one token bucket a request must pass.
+type bucketCheck struct {
+	buckets map[string]*bucket
+	key     string
+	qps     float64
+	burst   int
+	reason  string
+}
+
+// take takes a token from the bucket of c.key, creating it if needed. If none
+// is available it returns the reason and how long to wait before retrying. A
+// disabled limit always passes.
+func (c bucketCheck) take(now time.Time) (bool, string, time.Duration) {
+	if c.qps <= 0 {
+		return true, "", 0
+	}
+	b, ok := c.buckets[c.key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(c.qps), c.burst)}
+		c.buckets[c.key] = b
+	}
+	b.lastSeen = now
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return false, c.reason, time.Second
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, c.reason, delay
+	}
+	return true, "", 0
+}
+
+// admitUser decides whether a request from user may proceed. Otherwise it
+// returns the reason and how long the caller should wait before retrying.
+func (l *rateLimiter) admitUser(user string, now time.Time) (bool, string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return bucketCheck{l.users, user, l.cfg.UserQPS, l.cfg.UserBurst,
+		fmt.Sprintf("rate limit exceeded for user %q", user)}.take(now)
+}
+
+// admitSpokeCall decides whether a call to hostingCluster may be sent. On
+// success the caller must call release once the call is done. Otherwise it
+// returns the reason and how long the caller should wait before retrying.
+func (l *rateLimiter) admitSpokeCall(hostingCluster string, now time.Time) (bool, string, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.MaxInFlight > 0 && l.inFlight >= l.cfg.MaxInFlight {
+		return false, "too many requests in flight to hosting clusters", time.Second
+	}
+	ok, reason, retryAfter := bucketCheck{l.clusters, hostingCluster, l.cfg.HostingClusterQPS,
+		l.cfg.HostingClusterBurst, fmt.Sprintf("rate limit exceeded for hosting cluster %q", hostingCluster)}.take(now)
+	if !ok {
+		return false, reason, retryAfter
+	}
+	l.inFlight++
+	return true, "", 0
+}
+
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+}
+
+// tooManyRequestsStatus is the 429 Status of a rejected request or call.
+func tooManyRequestsStatus(reason string, retryAfter time.Duration) (*metav1.Status, int) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	status := apierrors.NewTooManyRequests(reason, seconds).ErrStatus
+	status.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Status"}
+	return &status, seconds
+}
+
+// rateLimitMiddleware applies the user buckets to every request under
+// /apis/hcp.ocm.io/v1alpha1/. Discovery, OpenAPI and health probes are never
+// limited. Rejected requests get a 429 Status with Retry-After. The calls a
+// request makes to hosting clusters are limited by rateLimitedTransport.
+func (p *hcpProxy) rateLimitMiddleware(next http.Handler) http.Handler {
+	prefix := apiPathPrefix + hcpProxyGroupVersion + "/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.limiter == nil || !strings.HasPrefix(r.URL.Path, prefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, _ := whoIsTheCaller(r)
+		ok, reason, retryAfter := p.limiter.admitUser(user, time.Now())
+		if !ok {
+			status, seconds := tooManyRequestsStatus(reason, retryAfter)
+			p.log.Info("rejecting HCP proxy request", "reason", reason, "user", user,
+				"method", r.Method, "path", r.URL.Path, "retryAfterSeconds", seconds)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeStatus(w, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitedTransport admits every call to a hosting cluster, keyed by the
+// hosting cluster newSpokeRequest resolved, against the rate limiter. A
+// rejected call is answered locally with the 429 Status a throttling API
+// server would send, so callers handle it like any other hosting cluster
+// response. A call holds its in-flight slot until its response body is
+// closed; streams are admitted but do not hold one.
+type rateLimitedTransport struct {
+	wrapped http.RoundTripper
+	limiter *rateLimiter
+	stream  bool
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	hostingCluster, _ := req.Context().Value(spokeNameKey{}).(string)
+	ok, reason, retryAfter := t.limiter.admitSpokeCall(hostingCluster, time.Now())
+	if !ok {
+		status, seconds := tooManyRequestsStatus(reason, retryAfter)
+		t.limiter.log.Info("throttling hosting cluster call", "reason", reason, "hostingCluster", hostingCluster,
+			"method", req.Method, "path", req.URL.Path, "retryAfterSeconds", seconds)
+		body, err := json.Marshal(status)
+		if err != nil {
+			return nil, err
+		}
+		header := http.Header{}
+		header.Set(headerContentType, contentTypeJSON)
+		header.Set("Retry-After", strconv.Itoa(seconds))
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests)),
+			StatusCode:    http.StatusTooManyRequests,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	resp, err := t.wrapped.RoundTrip(req)
+	if err != nil || t.stream {
+		t.limiter.release()
+		return resp, err
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: t.limiter.release}
+	return resp, nil
+}
+
+// releaseOnClose frees an in-flight slot when the response body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,226 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testRateLimiter(t *testing.T, p *hcpProxy, cfg rateLimitConfig) *rateLimiter {
+	t.Helper()
+	l := newRateLimiter(p.hubClient, "multicluster-engine", p.log)
+	l.setConfig(cfg)
+	p.limiter = l
+	return l
+}
+
+// rateLimitedHandler wraps an always-200 handler in the rate limit middleware.
+func rateLimitedHandler(p *hcpProxy, block <-chan struct{}) http.Handler {
+	return p.rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if block != nil {
+			<-block
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func rateLimitRequest(user, query string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost,
+		apiPathPrefix+hcpProxyGroupVersion+"/namespaces/clusters/hostedclusters?"+query, nil)
+	r.Header.Set("X-Remote-User", user)
+	return r
+}
+
+func Test_parseRateLimitConfig_WhenKeysSet_ItShouldOverlayDefaults(t *testing.T) {
+	cfg, err := parseRateLimitConfig(map[string]string{
+		rateLimitKeyUserQPS:     "2.5",
+		rateLimitKeyMaxInFlight: "0",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, cfg.UserQPS)
+	assert.Equal(t, defaultRateLimitConfig.UserBurst, cfg.UserBurst)
+	assert.Equal(t, defaultRateLimitConfig.HostingClusterQPS, cfg.HostingClusterQPS)
+	assert.Equal(t, 0, cfg.MaxInFlight)
+}
+
+func Test_parseRateLimitConfig_WhenValueInvalid_ItShouldReturnError(t *testing.T) {
+	for name, data := range map[string]map[string]string{
+		"not a number":    {rateLimitKeyUserQPS: "fast"},
+		"negative":        {rateLimitKeyHostingClusterBurst: "-1"},
+		"fractional int":  {rateLimitKeyMaxInFlight: "1.5"},
+		"zero user burst": {rateLimitKeyUserBurst: "0"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseRateLimitConfig(data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_rateLimitMiddleware_WhenUserOverLimit_ItShouldReturn429WithRetryAfter(t *testing.T) {
+	p := newTestProxy(t)
+	testRateLimiter(t, p, rateLimitConfig{UserQPS: 0.5, UserBurst: 2})
+	h := rateLimitedHandler(p, nil)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, rateLimitRequest("alice", "hostingCluster=spoke-1"))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, rateLimitRequest("alice", "hostingCluster=spoke-1"))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, metav1.StatusReasonTooManyRequests, status.Reason)
+	assert.Contains(t, status.Message, `user "alice"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, rateLimitRequest("bob", "hostingCluster=spoke-1"))
+	assert.Equal(t, http.StatusOK, w.Code, "other users have their own bucket")
+}
+
+// spokeCall sends GET /api/v1/namespaces to hostingCluster through client.
+func spokeCall(t *testing.T, p *hcpProxy, client *http.Client, hostingCluster string) *http.Response {
+	t.Helper()
+	req, err := p.newSpokeRequest(context.Background(), http.MethodGet, hostingCluster, apiPathCoreNamespaces, nil)
+	require.NoError(t, err)
+	resp, err := doSpokeHTTP(client, req)
+	require.NoError(t, err)
+	return resp
+}
+
+func Test_rateLimitedTransport_WhenHostingClusterOverLimit_ItShouldAnswer429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+	l := testRateLimiter(t, p, rateLimitConfig{HostingClusterQPS: 0.5, HostingClusterBurst: 1})
+	client, err := p.spokeHTTPClient("alice", nil)
+	require.NoError(t, err)
+
+	resp := spokeCall(t, p, client, "spoke-1")
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = spokeCall(t, p, client, "spoke-1")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	var status metav1.Status
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	_ = resp.Body.Close()
+	assert.Equal(t, metav1.StatusReasonTooManyRequests, status.Reason)
+	assert.Contains(t, status.Message, `hosting cluster "spoke-1"`)
+
+	resp = spokeCall(t, p, client, "spoke-2")
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "other hosting clusters have their own bucket")
+	assert.Equal(t, int32(2), calls.Load(), "the throttled call should not reach the hosting cluster")
+	assert.Equal(t, 0, l.inFlight)
+}
+
+func Test_rateLimitedTransport_WhenTooManyInFlight_ItShouldAnswer429UntilABodyIsClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+	l := testRateLimiter(t, p, rateLimitConfig{MaxInFlight: 1})
+	client, err := p.spokeHTTPClient("alice", nil)
+	require.NoError(t, err)
+
+	held := spokeCall(t, p, client, "spoke-1")
+	require.Equal(t, http.StatusOK, held.StatusCode)
+	assert.Equal(t, 1, l.inFlight)
+
+	resp := spokeCall(t, p, client, "spoke-2")
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	_ = held.Body.Close()
+	_ = held.Body.Close()
+	assert.Equal(t, 0, l.inFlight, "closing the body twice should free one slot")
+
+	watchClient, err := p.spokeWatchClient("alice", nil)
+	require.NoError(t, err)
+	stream := spokeCall(t, p, watchClient, "spoke-1")
+	assert.Equal(t, http.StatusOK, stream.StatusCode)
+	assert.Equal(t, 0, l.inFlight, "a stream should not hold an in-flight slot")
+	_ = stream.Body.Close()
+}
+
+func Test_rateLimitMiddleware_WhenDiscoveryOrOpenAPI_ItShouldNotLimit(t *testing.T) {
+	p := newTestProxy(t)
+	testRateLimiter(t, p, rateLimitConfig{UserQPS: 0.001, UserBurst: 1})
+	h := rateLimitedHandler(p, nil)
+
+	for _, path := range []string{apiPathPrefix + hcpProxyGroupVersion, apiPathOpenAPIV2, "/healthz"} {
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("X-Remote-User", "alice")
+			h.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code, path)
+		}
+	}
+}
+
+func Test_rateLimiter_reload_WhenConfigMapChanges_ItShouldApplyItWithoutRestart(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: rateLimitConfigMapName, Namespace: "multicluster-engine"},
+		Data:       map[string]string{rateLimitKeyUserQPS: "1", rateLimitKeyUserBurst: "1"},
+	}
+	p := newTestProxy(t, cm)
+	l := newRateLimiter(p.hubClient, "multicluster-engine", p.log)
+	now := time.Now()
+
+	l.reload(context.Background())
+	ok, _, _ := l.admitUser("alice", now)
+	require.True(t, ok)
+	ok, _, _ = l.admitUser("alice", now)
+	assert.False(t, ok)
+
+	cm.Data[rateLimitKeyUserBurst] = "5"
+	require.NoError(t, p.hubClient.Update(context.Background(), cm))
+	l.reload(context.Background())
+	ok, _, _ = l.admitUser("alice", now.Add(2*time.Second))
+	assert.True(t, ok, "the existing bucket should pick up the new burst")
+
+	cm.Data[rateLimitKeyUserQPS] = "not-a-number"
+	require.NoError(t, p.hubClient.Update(context.Background(), cm))
+	l.reload(context.Background())
+	assert.Equal(t, 5, l.cfg.UserBurst, "an invalid ConfigMap should keep the current limits")
+
+	require.NoError(t, p.hubClient.Delete(context.Background(), cm))
+	l.reload(context.Background())
+	assert.Equal(t, defaultRateLimitConfig, l.cfg)
+}
+
+func Test_rateLimiter_prune_WhenBucketIdle_ItShouldDropIt(t *testing.T) {
+	p := newTestProxy(t)
+	l := testRateLimiter(t, p, defaultRateLimitConfig)
+	now := time.Now()
+	ok, _, _ := l.admitUser("alice", now)
+	require.True(t, ok)
+	ok, _, _ = l.admitSpokeCall("spoke-1", now)
+	require.True(t, ok)
+	l.release()
+
+	l.prune(now.Add(rateLimiterIdleTTL + time.Second))
+	assert.Empty(t, l.users)
+	assert.Empty(t, l.clusters)
+}
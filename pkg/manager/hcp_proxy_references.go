@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	kindSecret    = "Secret"
+	kindConfigMap = "ConfigMap"
+)
+
+// hostedClusterConfigMapRefs are the spec fields of a HostedCluster that name
+// a ConfigMap in its namespace.
+var hostedClusterConfigMapRefs = [][]string{
+	{"spec", "additionalTrustBundle", "name"},
+	{"spec", "configuration", "apiServer", "clientCA", "name"},
+	{"spec", "configuration", "image", "additionalTrustedCA", "name"},
+	{"spec", "configuration", "proxy", "trustedCA", "name"},
+}
+
+// identityProviderSecretFields are the fields of an OAuth identity provider
+// that name a Secret; its ca field names a ConfigMap.
+var identityProviderSecretFields = []string{"clientSecret", "fileData", "bindPassword", "tlsClientCert", "tlsClientKey"}
+
+// objectReferences returns the Secrets and ConfigMaps in their namespace that
+// the HostedCluster and its NodePools name, each once: Secrets first, in the
+// order they are applied.
+func objectReferences(
+	hc *hypershiftv1beta1.HostedCluster,
+	nodePools []hypershiftv1beta1.NodePool,
+) []corev1.TypedLocalObjectReference {
+	var refs []corev1.TypedLocalObjectReference
+	seen := map[corev1.TypedLocalObjectReference]bool{}
+	add := func(kind string, names ...string) {
+		for _, name := range names {
+			ref := corev1.TypedLocalObjectReference{Kind: kind, Name: name}
+			if name != "" && !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	var configMaps []string
+	if hc != nil {
+		obj := &unstructured.Unstructured{Object: objectMap(hc)}
+		add(kindSecret, referencedSecretNames(obj)...)
+		for _, fields := range hostedClusterConfigMapRefs {
+			name, _, _ := unstructured.NestedString(obj.Object, fields...)
+			configMaps = append(configMaps, name)
+		}
+		_, oauthConfigMaps := identityProviderReferences(obj)
+		configMaps = append(configMaps, oauthConfigMaps...)
+	}
+	for i := range nodePools {
+		for _, ref := range nodePools[i].Spec.Config {
+			configMaps = append(configMaps, ref.Name)
+		}
+		for _, ref := range nodePools[i].Spec.TuningConfig {
+			configMaps = append(configMaps, ref.Name)
+		}
+	}
+	add(kindConfigMap, configMaps...)
+	return refs
+}
+
+// identityProviderReferences returns the Secrets and ConfigMaps named by the
+// OAuth identity providers of the HostedCluster.
+func identityProviderReferences(hc *unstructured.Unstructured) (secrets, configMaps []string) {
+	providers, _, _ := unstructured.NestedSlice(hc.Object, "spec", "configuration", "oauth", "identityProviders")
+	for _, entry := range providers {
+		provider, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// The settings of the provider are under a key named after its type.
+		for _, value := range provider {
+			settings, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range identityProviderSecretFields {
+				if name, _, _ := unstructured.NestedString(settings, field, "name"); name != "" {
+					secrets = append(secrets, name)
+				}
+			}
+			if name, _, _ := unstructured.NestedString(settings, "ca", "name"); name != "" {
+				configMaps = append(configMaps, name)
+			}
+		}
+	}
+	return secrets, configMaps
+}
+
+// stampReferencedObject sets the namespace and the proxy labels of a Secret or
+// ConfigMap applied for the HostedCluster hcName.
+func stampReferencedObject(obj metav1.Object, ns, hcName string) {
+	obj.SetNamespace(ns)
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[labelCreatedVia] = labelCreatedViaValue
+	labels[labelHostedCluster] = hcName
+	obj.SetLabels(labels)
+}
+
+// unreferencedObjects returns the Secrets and ConfigMaps of a bundle that
+// refs does not name, so a create or PUT cannot write arbitrary objects to
+// the namespace.
+func unreferencedObjects(bundle *ResourceBundle, refs []corev1.TypedLocalObjectReference) []string {
+	named := map[corev1.TypedLocalObjectReference]bool{}
+	for _, ref := range refs {
+		named[ref] = true
+	}
+	var out []string
+	for i := range bundle.Secrets {
+		if !named[corev1.TypedLocalObjectReference{Kind: kindSecret, Name: bundle.Secrets[i].Name}] {
+			out = append(out, kindSecret+"/"+bundle.Secrets[i].Name)
+		}
+	}
+	for i := range bundle.ConfigMaps {
+		if !named[corev1.TypedLocalObjectReference{Kind: kindConfigMap, Name: bundle.ConfigMaps[i].Name}] {
+			out = append(out, kindConfigMap+"/"+bundle.ConfigMaps[i].Name)
+		}
+	}
+	return out
+}
+
+// unreferencedInBundle checks the Secrets and ConfigMaps of a PUT bundle
+// against the references of its HostedCluster and NodePools, or of the live
+// ones the bundle omits.
+func (p *hcpProxy) unreferencedInBundle(
+	ctx context.Context,
+	hcpClient *http.Client,
+	bundle *ResourceBundle,
+	ns, name, spokeName string,
+) []string {
+	hc := bundle.HostedCluster
+	if hc == nil {
+		hc, _, _ = p.fetchHostedCluster(ctx, hcpClient, ns, name, spokeName)
+	}
+	nodePools := bundle.NodePools
+	if len(nodePools) == 0 {
+		nodePools = p.fetchNodePoolsForHC(ctx, hcpClient, ns, name, spokeName)
+	}
+	return unreferencedObjects(bundle, objectReferences(hc, nodePools))
+}
+
+// unreferencedInCreate checks the Secrets and ConfigMaps of a create against
+// the references of its HostedCluster and NodePools.
+func unreferencedInCreate(req *CreateRequest) []string {
+	nodePools := make([]hypershiftv1beta1.NodePool, 0, len(req.NodePools))
+	for _, np := range req.NodePools {
+		if np != nil {
+			nodePools = append(nodePools, *np)
+		}
+	}
+	bundle := &ResourceBundle{Secrets: req.Secrets, ConfigMaps: req.ConfigMaps}
+	return unreferencedObjects(bundle, objectReferences(req.HostedCluster, nodePools))
+}
+
+// applyReferencedObjects creates or updates the Secrets and then the
+// ConfigMaps of a bundle, before the HostedCluster and NodePools that use
+// them. A failure is returned as the error response to write.
+func (p *hcpProxy) applyReferencedObjects(
+	ctx context.Context,
+	hcpClient *http.Client,
+	bundle *ResourceBundle,
+	ns, name, spokeName string,
+	dryRun bool,
+) (*metav1.Status, []string) {
+	type object struct {
+		kind, resource string
+		obj            metav1.Object
+	}
+	var objects []object
+	for i := range bundle.Secrets {
+		objects = append(objects, object{kindSecret, resourceSecrets, &bundle.Secrets[i]})
+	}
+	for i := range bundle.ConfigMaps {
+		objects = append(objects, object{kindConfigMap, resourceConfigMaps, &bundle.ConfigMaps[i]})
+	}
+	var dryRunErrors []string
+	for _, o := range objects {
+		stampReferencedObject(o.obj, ns, name)
+		if _, err := p.createOrUpdateOnSpoke(ctx, hcpClient, spokeName, ns, o.resource, o.obj); err != nil {
+			msg := fmt.Sprintf("%s %q update failed", o.kind, o.obj.GetName())
+			if !dryRun {
+				return spokeWriteStatus(err, msg), nil
+			}
+			dryRunErrors = append(dryRunErrors, msg+": "+err.Error())
+		}
+	}
+	return nil, dryRunErrors
+}
@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// referencingHC names Secrets and ConfigMaps from the spec fields the proxy
+// knows, including an OpenID identity provider.
+const referencingHC = `{
+  "metadata": {"name": "my-hc", "namespace": "clusters"},
+  "spec": {
+    "pullSecret": {"name": "my-hc-pull-secret"},
+    "sshKey": {"name": "my-hc-ssh-key"},
+    "additionalTrustBundle": {"name": "user-ca-bundle"},
+    "configuration": {"oauth": {"identityProviders": [{
+      "name": "sso", "type": "OpenID",
+      "openID": {"clientID": "hcp", "clientSecret": {"name": "sso-client"}, "ca": {"name": "sso-ca"}}
+    }]}}
+  }
+}`
+
+func referencingNodePool(name string, config ...string) hypershiftv1beta1.NodePool {
+	np := hypershiftv1beta1.NodePool{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	np.Spec.ClusterName = "my-hc"
+	for _, c := range config {
+		np.Spec.Config = append(np.Spec.Config, corev1.LocalObjectReference{Name: c})
+	}
+	return np
+}
+
+func Test_objectReferences_WhenObjectsNameSecretsAndConfigMaps_ItShouldListEachOnce(t *testing.T) {
+	hc := &hypershiftv1beta1.HostedCluster{}
+	require.NoError(t, json.Unmarshal([]byte(referencingHC), hc))
+	nodePools := []hypershiftv1beta1.NodePool{
+		referencingNodePool("pool-a", "machine-config"),
+		referencingNodePool("pool-b", "machine-config", "user-ca-bundle"),
+	}
+	nodePools[1].Spec.TuningConfig = []corev1.LocalObjectReference{{Name: "tuned"}}
+
+	assert.Equal(t, []corev1.TypedLocalObjectReference{
+		{Kind: kindSecret, Name: "my-hc-pull-secret"},
+		{Kind: kindSecret, Name: "my-hc-ssh-key"},
+		{Kind: kindSecret, Name: "sso-client"},
+		{Kind: kindConfigMap, Name: "user-ca-bundle"},
+		{Kind: kindConfigMap, Name: "sso-ca"},
+		{Kind: kindConfigMap, Name: "machine-config"},
+		{Kind: kindConfigMap, Name: "tuned"},
+	}, objectReferences(hc, nodePools))
+	assert.Empty(t, objectReferences(nil, nil))
+}
+
+func Test_handleCreate_WhenConfigMapsGiven_ItShouldCreateThemBeforeTheHostedCluster(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL, availableManagedCluster("spoke-1"))
+
+	hc := &hypershiftv1beta1.HostedCluster{}
+	require.NoError(t, json.Unmarshal([]byte(referencingHC), hc))
+	np := referencingNodePool("my-hc-pool", "machine-config")
+	body, err := json.Marshal(CreateRequest{
+		HostedCluster: hc,
+		NodePools:     []*hypershiftv1beta1.NodePool{&np},
+		Secrets:       []corev1.Secret{{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pull-secret"}}},
+		ConfigMaps: []corev1.ConfigMap{
+			{ObjectMeta: metav1.ObjectMeta{Name: "user-ca-bundle"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "machine-config"}},
+		},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, []string{
+		"POST /spoke-1" + apiPathCoreNamespaces,
+		"POST /spoke-1" + apiPathCoreNamespaces + "/clusters/secrets",
+		"POST /spoke-1" + apiPathCoreNamespaces + "/clusters/configmaps",
+		"POST /spoke-1" + apiPathCoreNamespaces + "/clusters/configmaps",
+		"POST /spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters",
+		"POST /spoke-1" + apiPathHSNamespaces + "/clusters/nodepools",
+	}, spoke.writes)
+
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	assert.Contains(t, bundle.References, corev1.TypedLocalObjectReference{Kind: kindConfigMap, Name: "machine-config"})
+	assert.Empty(t, bundle.ConfigMaps)
+	assert.Empty(t, bundle.Secrets)
+}
+
+func Test_handlePatchResources_WhenConfigMapReferenced_ItShouldApplyItAndListItByReference(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	hc := &hypershiftv1beta1.HostedCluster{}
+	require.NoError(t, json.Unmarshal([]byte(referencingHC), hc))
+	body, err := json.Marshal(ResourceBundle{
+		HostedCluster: hc,
+		ConfigMaps:    []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "sso-ca"}, Data: map[string]string{"ca.crt": "x"}}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handlePatchResources(w, r, "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, spoke.has("/spoke-1"+apiPathCoreNamespaces+"/clusters/configmaps/sso-ca"))
+	var live ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &live))
+	assert.Contains(t, live.References, corev1.TypedLocalObjectReference{Kind: kindConfigMap, Name: "sso-ca"})
+	assert.Empty(t, live.ConfigMaps, "referenced objects are returned by reference only")
+}
+
+func Test_handlePatchResources_WhenObjectUnreferenced_ItShouldReturn400(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	seedMigrationSource(spoke)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	body, err := json.Marshal(ResourceBundle{
+		Secrets: []corev1.Secret{{ObjectMeta: metav1.ObjectMeta{Name: "someone-elses-secret"}}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handlePatchResources(w, r, "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Secret/someone-elses-secret")
+	assert.False(t, spoke.has("/spoke-1"+apiPathCoreNamespaces+"/clusters/secrets/someone-elses-secret"))
+}
+
+func Test_handleCreate_WhenObjectUnreferenced_ItShouldReturn400(t *testing.T) {
+	spoke := &dryRunSpoke{}
+	p := newTestProxyWithSpokeURL(t, spoke.server(t, true, "").URL, availableManagedCluster("spoke-1"))
+
+	body, err := json.Marshal(CreateRequest{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-hc"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				PullSecret: corev1.LocalObjectReference{Name: "my-hc-pull-secret"},
+			},
+		},
+		Secrets: []corev1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pull-secret"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "someone-elses-secret"}},
+		},
+		ConfigMaps: []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "kube-root-ca.crt"}}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Secret/someone-elses-secret, ConfigMap/kube-root-ca.crt")
+	assert.Empty(t, spoke.writes)
+}
@@ -0,0 +1,393 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	hypershiftcluster "github.com/openshift/hypershift/cmd/cluster"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// Keys of the rendered Secrets, as hcp create cluster writes them.
+	sshKeySecretKey        = "id_rsa.pub"
+	etcdEncryptionKeyKey   = "key"
+	etcdEncryptionKeyBytes = 32
+
+	// hcp create cluster kubevirt takes --root-volume-size in GiB.
+	gibibyte = 1 << 30
+)
+
+// renderPlatformCommands maps the supported platforms to their hcp create
+// cluster subcommand.
+var renderPlatformCommands = map[hypershiftv1beta1.PlatformType]string{
+	hypershiftv1beta1.KubevirtPlatform: "kubevirt",
+	hypershiftv1beta1.AgentPlatform:    "agent",
+	hypershiftv1beta1.NonePlatform:     "none",
+}
+
+// ClusterParameters is the compact form of a create: the proxy renders the
+// HostedCluster, its NodePool and its Secrets the way hcp create cluster
+// --render does, so clients need no hcp binary.
+type ClusterParameters struct {
+	Name string `json:"name"`
+	// Platform is KubeVirt, Agent or None.
+	Platform     hypershiftv1beta1.PlatformType `json:"platform"`
+	ReleaseImage string                         `json:"releaseImage"`
+	// BaseDomain is required for Agent and None. Without it a KubeVirt
+	// cluster uses the base domain of the hosting cluster's ingress.
+	BaseDomain string `json:"baseDomain,omitempty"`
+	// AgentNamespace is the namespace of the Agents; required for Agent.
+	AgentNamespace string `json:"agentNamespace,omitempty"`
+	// APIServerAddress is the address the nodes reach the control plane
+	// NodePorts on; required for Agent and None. hcp looks it up from the
+	// nodes of the management cluster, which the hub is not.
+	APIServerAddress string             `json:"apiServerAddress,omitempty"`
+	NodePool         NodePoolParameters `json:"nodePool,omitempty"`
+	// PullSecretRef is a hub Secret of type kubernetes.io/dockerconfigjson,
+	// read as the caller. Its namespace defaults to the request namespace.
+	PullSecretRef corev1.SecretReference `json:"pullSecretRef"`
+	// SSHKeyRef is a hub Secret with the public key under id_rsa.pub.
+	SSHKeyRef *corev1.SecretReference `json:"sshKeyRef,omitempty"`
+}
+
+// NodePoolParameters sizes the NodePool named after the cluster. Unset
+// fields take the hcp create cluster defaults.
+type NodePoolParameters struct {
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Cores, Memory and RootVolumeSize size the KubeVirt VMs.
+	// RootVolumeSize must be a whole number of Gi.
+	Cores          uint32 `json:"cores,omitempty"`
+	Memory         string `json:"memory,omitempty"`
+	RootVolumeSize string `json:"rootVolumeSize,omitempty"`
+}
+
+// renderCreateRequest fills req from req.Parameters. It writes the error
+// response and returns false if the parameters are invalid or a referenced
+// Secret cannot be read.
+func (p *hcpProxy) renderCreateRequest(w http.ResponseWriter, r *http.Request, ns, spokeName string, req *CreateRequest) bool {
+	if req.HostedCluster != nil || len(req.NodePools) > 0 || len(req.Secrets) > 0 || len(req.ConfigMaps) > 0 {
+		writeJSONError(w, "parameters cannot be combined with hostedCluster, nodePools, secrets or configMaps",
+			http.StatusBadRequest)
+		return false
+	}
+	params := req.Parameters
+	if errs := validateParameters(params); len(errs) > 0 {
+		writeJSONError(w, "invalid parameters: "+errs.ToAggregate().Error(), http.StatusBadRequest)
+		return false
+	}
+
+	ctx := r.Context()
+	username, groups := whoIsTheCaller(r)
+	pullSecret, err := p.hubSecretAs(ctx, username, groups, params.PullSecretRef, ns, corev1.DockerConfigJsonKey)
+	if err != nil {
+		writeHubSecretError(w, "pullSecretRef", err)
+		return false
+	}
+	var sshKey []byte
+	if params.SSHKeyRef != nil {
+		if sshKey, err = p.hubSecretAs(ctx, username, groups, *params.SSHKeyRef, ns, sshKeySecretKey); err != nil {
+			writeHubSecretError(w, "sshKeyRef", err)
+			return false
+		}
+	}
+	encryptionKey, err := p.etcdEncryptionKey(ctx, username, groups, ns, spokeName, params.Name)
+	if err != nil {
+		writeJSONError(w, "failed to read the etcd encryption key: "+err.Error(), http.StatusBadGateway)
+		return false
+	}
+
+	rendered, err := renderCluster(ctx, ns, params, pullSecret, sshKey, encryptionKey)
+	if err != nil {
+		writeJSONError(w, "invalid parameters: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	*req = *rendered
+	return true
+}
+
+func validateParameters(params *ClusterParameters) field.ErrorList {
+	var errs field.ErrorList
+	path := field.NewPath("parameters")
+	if msgs := validation.IsDNS1123Label(params.Name); len(msgs) > 0 {
+		errs = append(errs, field.Invalid(path.Child("name"), params.Name, msgs[0]))
+	}
+	switch params.Platform {
+	case hypershiftv1beta1.KubevirtPlatform:
+	case hypershiftv1beta1.AgentPlatform:
+		if params.AgentNamespace == "" {
+			errs = append(errs, field.Required(path.Child("agentNamespace"), "required for the Agent platform"))
+		}
+		fallthrough
+	case hypershiftv1beta1.NonePlatform:
+		if params.APIServerAddress == "" {
+			errs = append(errs, field.Required(path.Child("apiServerAddress"),
+				"required unless the platform is KubeVirt"))
+		}
+	default:
+		errs = append(errs, field.NotSupported(path.Child("platform"), params.Platform, []string{
+			string(hypershiftv1beta1.KubevirtPlatform), string(hypershiftv1beta1.AgentPlatform),
+			string(hypershiftv1beta1.NonePlatform),
+		}))
+	}
+	if params.BaseDomain == "" && params.Platform != hypershiftv1beta1.KubevirtPlatform {
+		errs = append(errs, field.Required(path.Child("baseDomain"), "required unless the platform is KubeVirt"))
+	}
+	if params.ReleaseImage == "" {
+		errs = append(errs, field.Required(path.Child("releaseImage"), ""))
+	}
+	if params.PullSecretRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("pullSecretRef", "name"), ""))
+	}
+	if params.SSHKeyRef != nil && params.SSHKeyRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("sshKeyRef", "name"), ""))
+	}
+	np := path.Child("nodePool")
+	if params.NodePool.Replicas != nil && *params.NodePool.Replicas < 0 {
+		errs = append(errs, field.Invalid(np.Child("replicas"), *params.NodePool.Replicas, "must not be negative"))
+	}
+	for _, quantity := range []struct{ name, value string }{
+		{"memory", params.NodePool.Memory},
+		{"rootVolumeSize", params.NodePool.RootVolumeSize},
+	} {
+		if quantity.value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(quantity.value); err != nil {
+			errs = append(errs, field.Invalid(np.Child(quantity.name), quantity.value, err.Error()))
+		}
+	}
+	if size, err := resource.ParseQuantity(params.NodePool.RootVolumeSize); err == nil && size.Value()%gibibyte != 0 {
+		errs = append(errs, field.Invalid(np.Child("rootVolumeSize"), params.NodePool.RootVolumeSize,
+			"must be a whole number of Gi"))
+	}
+	return errs
+}
+
+// errHubSecretKey is returned by hubSecretAs when the Secret lacks the key.
+var errHubSecretKey = errors.New("key not found")
+
+// hubSecretAs returns data[key] of the hub Secret ref, read with the
+// caller's identity so the proxy never discloses a Secret the caller could
+// not read itself.
+func (p *hcpProxy) hubSecretAs(
+	ctx context.Context,
+	username string,
+	groups []string,
+	ref corev1.SecretReference,
+	defaultNamespace, key string,
+) ([]byte, error) {
+	if ref.Namespace == "" {
+		ref.Namespace = defaultNamespace
+	}
+	impConfig := rest.CopyConfig(p.hubConfig)
+	impConfig.Impersonate = rest.ImpersonationConfig{UserName: username, Groups: groups}
+	dynClient, err := dynamic.NewForConfig(impConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create impersonated client: %w", err)
+	}
+	item, err := dynClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: resourceSecrets}).
+		Namespace(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, secret); err != nil {
+		return nil, err
+	}
+	value, ok := secret.Data[key]
+	if !ok || len(value) == 0 {
+		return nil, fmt.Errorf("secret %s/%s: %w: %s", ref.Namespace, ref.Name, errHubSecretKey, key)
+	}
+	return value, nil
+}
+
+func writeHubSecretError(w http.ResponseWriter, param string, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case apierrors.IsNotFound(err), errors.Is(err, errHubSecretKey):
+		code = http.StatusBadRequest
+	case apierrors.IsForbidden(err):
+		code = http.StatusForbidden
+	}
+	writeJSONError(w, fmt.Sprintf("failed to read %s: %s", param, err.Error()), code)
+}
+
+// etcdEncryptionKey returns the key of the etcd encryption Secret of the
+// cluster on the hosting cluster, or a new random key if there is none yet.
+// A retried create must not rotate the key of a running control plane.
+func (p *hcpProxy) etcdEncryptionKey(ctx context.Context, username string, groups []string, ns, spokeName, name string) ([]byte, error) {
+	hcpClient, err := p.spokeHTTPClient(username, groups)
+	if err != nil {
+		return nil, err
+	}
+	apiPath, err := hsNamedAPIPath(ns, resourceSecrets, etcdEncryptionKeySecretName(name))
+	if err != nil {
+		return nil, err
+	}
+	existing := &corev1.Secret{}
+	err = p.getFromSpoke(ctx, hcpClient, spokeName, apiPath, nil, existing)
+	var spokeErr *spokeStatusError
+	switch {
+	case err == nil && len(existing.Data[etcdEncryptionKeyKey]) > 0:
+		return existing.Data[etcdEncryptionKeyKey], nil
+	case err == nil, errors.As(err, &spokeErr) && spokeErr.code == http.StatusNotFound:
+		key := make([]byte, etcdEncryptionKeyBytes)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	default:
+		return nil, err
+	}
+}
+
+func etcdEncryptionKeySecretName(name string) string {
+	return name + "-etcd-encryption-key"
+}
+
+// renderCluster runs hcp create cluster <platform> --render from the
+// hypershift library for params, so the objects are exactly what the CLI
+// renders, and decodes the HostedCluster, NodePools and Secrets. The etcd
+// encryption key hcp generates is replaced by encryptionKey. The Namespace is
+// dropped, handleCreate creates it, and so is any other object.
+func renderCluster(
+	ctx context.Context,
+	ns string,
+	params *ClusterParameters,
+	pullSecret, sshKey, encryptionKey []byte,
+) (*CreateRequest, error) {
+	dir, err := os.MkdirTemp("", "hcp-render-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{"pull-secret": pullSecret}
+	if sshKey != nil {
+		files["ssh-key"] = sshKey
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	manifests := filepath.Join(dir, "manifests.yaml")
+	args := renderArgs(ns, params, dir, manifests, sshKey != nil)
+
+	cmd := hypershiftcluster.NewCreateCommands()
+	output := new(bytes.Buffer)
+	cmd.SetOut(output)
+	cmd.SetErr(output)
+	cmd.SetArgs(args)
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		return nil, fmt.Errorf("hcp create cluster %s --render failed: %w", args[0], err)
+	}
+
+	f, err := os.Open(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("reading the rendered manifests: %w", err)
+	}
+	defer f.Close()
+	return decodeRendered(f, params.Name, encryptionKey)
+}
+
+// renderArgs builds the hcp create cluster arguments for params, reading the
+// pull secret and SSH key from dir and rendering into manifests. Unset
+// parameters are left to the hcp defaults.
+func renderArgs(ns string, params *ClusterParameters, dir, manifests string, withSSHKey bool) []string {
+	args := []string{
+		renderPlatformCommands[params.Platform],
+		"--name", params.Name,
+		"--namespace", ns,
+		"--release-image", params.ReleaseImage,
+		"--pull-secret", filepath.Join(dir, "pull-secret"),
+		"--render", "--render-sensitive", "--render-into", manifests,
+	}
+	if withSSHKey {
+		args = append(args, "--ssh-key", filepath.Join(dir, "ssh-key"))
+	}
+	if params.BaseDomain != "" {
+		args = append(args, "--base-domain", params.BaseDomain)
+	}
+	if params.NodePool.Replicas != nil {
+		args = append(args, "--node-pool-replicas", strconv.Itoa(int(*params.NodePool.Replicas)))
+	}
+	switch params.Platform {
+	case hypershiftv1beta1.KubevirtPlatform:
+		if params.NodePool.Cores != 0 {
+			args = append(args, "--cores", strconv.FormatUint(uint64(params.NodePool.Cores), 10))
+		}
+		if params.NodePool.Memory != "" {
+			args = append(args, "--memory", params.NodePool.Memory)
+		}
+		if params.NodePool.RootVolumeSize != "" {
+			size := resource.MustParse(params.NodePool.RootVolumeSize)
+			args = append(args, "--root-volume-size", strconv.FormatInt(size.Value()/gibibyte, 10))
+		}
+	case hypershiftv1beta1.AgentPlatform:
+		args = append(args, "--agent-namespace", params.AgentNamespace,
+			"--api-server-address", params.APIServerAddress)
+	case hypershiftv1beta1.NonePlatform:
+		args = append(args, "--api-server-address", params.APIServerAddress)
+	}
+	return args
+}
+
+// decodeRendered reads the YAML documents hcp renders into a CreateRequest.
+func decodeRendered(r io.Reader, name string, encryptionKey []byte) (*CreateRequest, error) {
+	req := &CreateRequest{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decoding the rendered manifests: %w", err)
+		}
+		var err error
+		switch kind, _ := obj["kind"].(string); kind {
+		case "HostedCluster":
+			req.HostedCluster = &hypershiftv1beta1.HostedCluster{}
+			err = fromJSONMap(obj, req.HostedCluster)
+		case "NodePool":
+			np := &hypershiftv1beta1.NodePool{}
+			err = fromJSONMap(obj, np)
+			req.NodePools = append(req.NodePools, np)
+		case kindSecret:
+			secret := corev1.Secret{}
+			err = fromJSONMap(obj, &secret)
+			if secret.Name == etcdEncryptionKeySecretName(name) {
+				secret.Data = map[string][]byte{etcdEncryptionKeyKey: encryptionKey}
+			}
+			req.Secrets = append(req.Secrets, secret)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding the rendered %s: %w", obj["kind"], err)
+		}
+	}
+	if req.HostedCluster == nil {
+		return nil, errors.New("hcp rendered no HostedCluster")
+	}
+	return req, nil
+}
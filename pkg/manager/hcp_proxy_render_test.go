@@ -0,0 +1,267 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+const renderEtcdKeyPath = "/spoke-1" + apiPathCoreNamespaces + "/clusters/secrets/my-hc-etcd-encryption-key"
+
+// renderHub serves the hub Secrets a render reads and records who read them.
+func renderHub(t *testing.T, p *hcpProxy) *[]string {
+	t.Helper()
+	var readers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readers = append(readers, r.Header.Get("Impersonate-User"))
+		w.Header().Set(headerContentType, contentTypeJSON)
+		switch r.URL.Path {
+		case "/api/v1/namespaces/clusters/secrets/pull-secret":
+			_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"pull-secret","namespace":"clusters"},` +
+				`"data":{".dockerconfigjson":"` + base64.StdEncoding.EncodeToString([]byte(`{"auths":{}}`)) + `"}}`))
+		case "/api/v1/namespaces/keys/secrets/ssh-key":
+			_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"ssh-key","namespace":"keys"},` +
+				`"data":{"id_rsa.pub":"` + base64.StdEncoding.EncodeToString([]byte("ssh-ed25519 AAAA")) + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	p.hubConfig = &rest.Config{Host: srv.URL, TLSClientConfig: rest.TLSClientConfig{Insecure: true}}
+	return &readers
+}
+
+func Test_validateParameters_WhenInvalid_ItShouldFail(t *testing.T) {
+	valid := func() *ClusterParameters {
+		return &ClusterParameters{
+			Name:          "my-hc",
+			Platform:      hypershiftv1beta1.KubevirtPlatform,
+			ReleaseImage:  "quay.io/openshift-release-dev/ocp-release:4.17.0-multi",
+			PullSecretRef: corev1.SecretReference{Name: "pull-secret"},
+		}
+	}
+	assert.Empty(t, validateParameters(valid()))
+
+	for _, tc := range []struct {
+		mutate func(*ClusterParameters)
+		field  string
+	}{
+		{func(p *ClusterParameters) { p.Name = "My_HC" }, "parameters.name"},
+		{func(p *ClusterParameters) {
+			p.Platform, p.BaseDomain = hypershiftv1beta1.AWSPlatform, "example.com"
+		}, "parameters.platform"},
+		{func(p *ClusterParameters) {
+			p.Platform, p.APIServerAddress = hypershiftv1beta1.NonePlatform, "10.0.0.10"
+		}, "parameters.baseDomain"},
+		{func(p *ClusterParameters) {
+			p.Platform, p.BaseDomain = hypershiftv1beta1.NonePlatform, "example.com"
+		}, "parameters.apiServerAddress"},
+		{func(p *ClusterParameters) {
+			p.Platform, p.BaseDomain, p.APIServerAddress = hypershiftv1beta1.AgentPlatform, "example.com", "10.0.0.10"
+		}, "parameters.agentNamespace"},
+		{func(p *ClusterParameters) { p.NodePool.RootVolumeSize = "31.5Gi" }, "parameters.nodePool.rootVolumeSize"},
+		{func(p *ClusterParameters) { p.ReleaseImage = "" }, "parameters.releaseImage"},
+		{func(p *ClusterParameters) { p.PullSecretRef.Name = "" }, "parameters.pullSecretRef.name"},
+		{func(p *ClusterParameters) { p.NodePool.Memory = "lots" }, "parameters.nodePool.memory"},
+	} {
+		params := valid()
+		tc.mutate(params)
+		errs := validateParameters(params)
+		require.Len(t, errs, 1, tc.field)
+		assert.Equal(t, tc.field, errs[0].Field)
+	}
+}
+
+func Test_renderCluster_WhenKubeVirt_ItShouldRenderWhatHcpRenders(t *testing.T) {
+	replicas := int32(3)
+	req, err := renderCluster(context.Background(), "clusters", &ClusterParameters{
+		Name:         "my-hc",
+		Platform:     hypershiftv1beta1.KubevirtPlatform,
+		ReleaseImage: "quay.io/openshift-release-dev/ocp-release:4.17.0-multi",
+		NodePool:     NodePoolParameters{Replicas: &replicas, Memory: "16Gi"},
+	}, []byte(`{"auths":{}}`), []byte("ssh-ed25519 AAAA"), []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	hc := req.HostedCluster
+	assert.Equal(t, "my-hc", hc.Name)
+	assert.Equal(t, "my-hc-pull-secret", hc.Spec.PullSecret.Name)
+	assert.Equal(t, "my-hc-ssh-key", hc.Spec.SSHKey.Name)
+	require.NotNil(t, hc.Spec.Platform.Kubevirt)
+	require.NotNil(t, hc.Spec.Platform.Kubevirt.BaseDomainPassthrough)
+	assert.True(t, *hc.Spec.Platform.Kubevirt.BaseDomainPassthrough)
+	assert.Equal(t, hypershiftv1beta1.PersistentVolumeEtcdStorage, hc.Spec.Etcd.Managed.Storage.Type)
+	require.NotNil(t, hc.Spec.SecretEncryption)
+	assert.Equal(t, "my-hc-etcd-encryption-key", hc.Spec.SecretEncryption.AESCBC.ActiveKey.Name)
+	assert.Len(t, hc.Spec.Services, 4)
+
+	require.Len(t, req.NodePools, 1)
+	np := req.NodePools[0]
+	assert.Equal(t, "my-hc", np.Spec.ClusterName)
+	assert.Equal(t, int32(3), *np.Spec.Replicas)
+	assert.Equal(t, hypershiftv1beta1.UpgradeTypeReplace, np.Spec.Management.UpgradeType)
+	require.NotNil(t, np.Spec.Platform.Kubevirt)
+	assert.Equal(t, "16Gi", np.Spec.Platform.Kubevirt.Compute.Memory.String())
+	assert.Equal(t, uint32(2), *np.Spec.Platform.Kubevirt.Compute.Cores)
+
+	secrets := map[string]corev1.Secret{}
+	for _, s := range req.Secrets {
+		secrets[s.Name] = s
+	}
+	assert.ElementsMatch(t, []string{"my-hc-pull-secret", "my-hc-etcd-encryption-key", "my-hc-ssh-key"},
+		slices.Collect(maps.Keys(secrets)))
+	assert.Equal(t, corev1.SecretTypeDockerConfigJson, secrets["my-hc-pull-secret"].Type)
+	assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"),
+		secrets["my-hc-etcd-encryption-key"].Data[etcdEncryptionKeyKey], "the key hcp generates is replaced")
+}
+
+func Test_renderArgs_WhenAgent_ItShouldPassTheAgentFlags(t *testing.T) {
+	args := renderArgs("clusters", &ClusterParameters{
+		Name:             "my-hc",
+		Platform:         hypershiftv1beta1.AgentPlatform,
+		ReleaseImage:     "quay.io/openshift-release-dev/ocp-release:4.17.0-multi",
+		BaseDomain:       "example.com",
+		AgentNamespace:   "agents",
+		APIServerAddress: "10.0.0.10",
+	}, "/tmp/render", "/tmp/render/manifests.yaml", false)
+
+	assert.Equal(t, []string{
+		"agent",
+		"--name", "my-hc",
+		"--namespace", "clusters",
+		"--release-image", "quay.io/openshift-release-dev/ocp-release:4.17.0-multi",
+		"--pull-secret", "/tmp/render/pull-secret",
+		"--render", "--render-sensitive", "--render-into", "/tmp/render/manifests.yaml",
+		"--base-domain", "example.com",
+		"--agent-namespace", "agents",
+		"--api-server-address", "10.0.0.10",
+	}, args)
+}
+
+func Test_decodeRendered_WhenManifestsGiven_ItShouldKeepWhatTheCreateApplies(t *testing.T) {
+	manifests := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: clusters
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: my-hc-etcd-encryption-key
+data:
+  key: Z2VuZXJhdGVk
+---
+apiVersion: hypershift.openshift.io/v1beta1
+kind: HostedCluster
+metadata:
+  name: my-hc
+spec:
+  services:
+  - service: APIServer
+    servicePublishingStrategy:
+      type: NodePort
+---
+apiVersion: hypershift.openshift.io/v1beta1
+kind: NodePool
+metadata:
+  name: my-hc
+spec:
+  clusterName: my-hc
+`
+	req, err := decodeRendered(strings.NewReader(manifests), "my-hc", []byte("existing-key"))
+	require.NoError(t, err)
+
+	require.NotNil(t, req.HostedCluster)
+	assert.Equal(t, hypershiftv1beta1.NodePort, req.HostedCluster.Spec.Services[0].Type)
+	require.Len(t, req.NodePools, 1)
+	require.Len(t, req.Secrets, 1)
+	assert.Equal(t, []byte("existing-key"), req.Secrets[0].Data[etcdEncryptionKeyKey])
+
+	_, err = decodeRendered(strings.NewReader("kind: Namespace\n"), "my-hc", nil)
+	assert.Error(t, err)
+}
+
+func Test_handleCreate_WhenParametersGiven_ItShouldRenderAndCreateAsTheCaller(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	spoke.put(renderEtcdKeyPath, map[string]interface{}{
+		"apiVersion": "v1", "kind": "Secret",
+		"metadata": map[string]interface{}{"name": "my-hc-etcd-encryption-key", "namespace": "clusters"},
+		"data":     map[string]interface{}{"key": base64.StdEncoding.EncodeToString([]byte("existing-key"))},
+	})
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+	readers := renderHub(t, p)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"parameters": {
+		"name": "my-hc", "platform": "Agent", "agentNamespace": "agents", "baseDomain": "example.com",
+		"apiServerAddress": "10.0.0.10",
+		"releaseImage": "quay.io/openshift-release-dev/ocp-release:4.17.0-multi",
+		"pullSecretRef": {"name": "pull-secret"}, "sshKeyRef": {"namespace": "keys", "name": "ssh-key"}
+	}}`))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, []string{"alice", "alice"}, *readers)
+	assert.True(t, spoke.has("/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters/my-hc"))
+	assert.True(t, spoke.has("/spoke-1"+apiPathHSNamespaces+"/clusters/nodepools/my-hc"))
+	assert.True(t, spoke.has("/spoke-1"+apiPathCoreNamespaces+"/clusters/secrets/my-hc-ssh-key"))
+	hc := &hypershiftv1beta1.HostedCluster{}
+	require.NoError(t, fromJSONMap(spoke.objects["/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters/my-hc"], hc))
+	for _, service := range hc.Spec.Services {
+		if service.Service == hypershiftv1beta1.APIServer {
+			assert.Equal(t, hypershiftv1beta1.NodePort, service.Type, "hcp publishes Agent clusters through NodePorts")
+		}
+	}
+	etcdKey := spoke.objects[renderEtcdKeyPath]["data"].(map[string]interface{})["key"]
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("existing-key")), etcdKey,
+		"a retried create must keep the etcd encryption key")
+	assert.NotContains(t, w.Body.String(), "auths", "Secrets are never returned")
+}
+
+func Test_handleCreate_WhenPullSecretRefMissing_ItShouldReturn400(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+	renderHub(t, p)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"parameters": {
+		"name": "my-hc", "platform": "KubeVirt",
+		"releaseImage": "quay.io/openshift-release-dev/ocp-release:4.17.0-multi",
+		"pullSecretRef": {"name": "missing"}
+	}}`))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "failed to read pullSecretRef")
+	assert.Empty(t, spoke.objects)
+}
+
+func Test_handleCreate_WhenParametersCombinedWithConfigMaps_ItShouldReturn400(t *testing.T) {
+	spoke, srv := newMigrationSpoke(t)
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{
+		"parameters": {"name": "my-hc", "platform": "KubeVirt", "pullSecretRef": {"name": "pull-secret"}},
+		"configMaps": [{"metadata": {"name": "user-ca-bundle"}}]
+	}`))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "cannot be combined")
+	assert.Empty(t, spoke.objects)
+}
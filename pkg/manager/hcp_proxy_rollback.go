@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// rollbackTimeout bounds the cleanup after a failed atomic create. It runs
+// detached from the request context so a client disconnect does not leave
+// half of the resources behind.
+const rollbackTimeout = 30 * time.Second
+
+// createdResource is one object an atomic create made on the spoke.
+type createdResource struct {
+	kind     string // for messages: Namespace, Secret, HostedCluster, NodePool
+	resource string // "namespaces" or an hsCollectionAPIPath resource
+	name     string
+	uid      types.UID
+}
+
+func (c createdResource) String() string {
+	return c.kind + "/" + c.name
+}
+
+// createFailure is the response body of an atomic create that failed and was
+// rolled back.
+type createFailure struct {
+	Error string `json:"error"`
+	// RolledBack lists the objects this request created and then deleted, as Kind/name.
+	RolledBack []string `json:"rolledBack"`
+	// RollbackErrors lists objects that could not be deleted and need manual cleanup.
+	RollbackErrors []string `json:"rollbackErrors,omitempty"`
+}
+
+// isAtomicCreate reports whether the caller asked for ?atomic=true.
+func isAtomicCreate(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("atomic")
+	if raw == "" {
+		return false, nil
+	}
+	atomic, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid atomic value %q", raw)
+	}
+	return atomic, nil
+}
+
+// rollbackCreate deletes the objects an atomic create made, newest first, and
+// writes the createFailure response. Objects that existed before the request
+// (a reused Namespace, an updated Secret) are never in created.
+//
+// Each DELETE carries a UID precondition, so an object that was replaced in the
+// meantime is left alone, and is checked for the created-via and hostedcluster
+// labels the create stamped on it.
+func (p *hcpProxy) rollbackCreate(
+	ctx context.Context,
+	w http.ResponseWriter,
+	hcpClient *http.Client,
+	spokeName, ns, hcName string,
+	created []createdResource,
+	cause string,
+) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	failure := createFailure{Error: cause, RolledBack: []string{}}
+	for i := len(created) - 1; i >= 0; i-- {
+		res := created[i]
+		if err := p.deleteCreatedResource(ctx, hcpClient, spokeName, ns, hcName, res); err != nil {
+			p.log.Error(err, "rollback failed", "resource", res.String(), "spoke", spokeName)
+			failure.RollbackErrors = append(failure.RollbackErrors, fmt.Sprintf("%s: %v", res, err))
+			continue
+		}
+		failure.RolledBack = append(failure.RolledBack, res.String())
+	}
+	p.log.Info("rolled back failed create",
+		"name", hcName, "namespace", ns, "spoke", spokeName,
+		"rolledBack", len(failure.RolledBack), "rollbackErrors", len(failure.RollbackErrors))
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(failure)
+}
+
+// deleteCreatedResource deletes one rolled-back object. A 404 counts as success.
+func (p *hcpProxy) deleteCreatedResource(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, ns, hcName string,
+	res createdResource,
+) error {
+	var apiPath string
+	var err error
+	if res.resource == "namespaces" {
+		apiPath, err = coreNamespaceAPIPath(res.name)
+	} else {
+		apiPath, err = hsNamedAPIPath(ns, res.resource, res.name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := p.checkCreatedLabels(ctx, hcpClient, spokeName, apiPath, hcName); err != nil {
+		return err
+	}
+
+	opts := metav1.DeleteOptions{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "DeleteOptions"}}
+	if res.uid != "" {
+		opts.Preconditions = &metav1.Preconditions{UID: &res.uid}
+	}
+	body, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	req, err := p.newSpokeRequest(ctx, http.MethodDelete, spokeName, apiPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerContentType, contentTypeJSON)
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("spoke returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// checkCreatedLabels refuses to roll back an object that does not carry the
+// labels this proxy stamps on everything it creates for hcName.
+func (p *hcpProxy) checkCreatedLabels(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokeName, apiPath, hcName string,
+) error {
+	req, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("spoke returned %d reading object before rollback", resp.StatusCode)
+	}
+	var obj metav1.PartialObjectMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return fmt.Errorf("failed to decode object before rollback: %w", err)
+	}
+	if obj.Labels[labelCreatedVia] != labelCreatedViaValue || obj.Labels[labelHostedCluster] != hcName {
+		return fmt.Errorf("not deleted: missing %s=%s,%s=%s labels",
+			labelCreatedVia, labelCreatedViaValue, labelHostedCluster, hcName)
+	}
+	return nil
+}
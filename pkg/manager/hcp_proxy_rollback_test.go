@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// rollbackSpoke is a minimal in-memory spoke: POST stores the object (with a
+// generated uid) unless its path contains failOn, GET returns it, DELETE
+// removes it. Tests pre-seed pre-existing objects by path.
+type rollbackSpoke struct {
+	mu      sync.Mutex
+	failOn  string
+	objects map[string][]byte
+	deletes []string
+	seq     int
+}
+
+func newRollbackSpoke(t *testing.T, failOn string) (*rollbackSpoke, *httptest.Server) {
+	t.Helper()
+	s := &rollbackSpoke{failOn: failOn, objects: map[string][]byte{}}
+	srv := httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *rollbackSpoke) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set(headerContentType, contentTypeJSON)
+	switch r.Method {
+	case http.MethodPost:
+		if s.failOn != "" && strings.Contains(r.URL.Path, s.failOn) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"kind":"Status","message":"denied"}`)
+			return
+		}
+		var obj map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&obj)
+		md := obj["metadata"].(map[string]interface{})
+		key := r.URL.Path + "/" + md["name"].(string)
+		if _, ok := s.objects[key]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		s.seq++
+		md["uid"] = fmt.Sprintf("uid-%d", s.seq)
+		raw, _ := json.Marshal(obj)
+		s.objects[key] = raw
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(raw)
+	case http.MethodPut:
+		raw, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = raw
+		_, _ = w.Write(raw)
+	case http.MethodGet:
+		raw, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(raw)
+	case http.MethodDelete:
+		var opts metav1.DeleteOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		raw, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var obj metav1.PartialObjectMetadata
+		_ = json.Unmarshal(raw, &obj)
+		if opts.Preconditions == nil || opts.Preconditions.UID == nil || *opts.Preconditions.UID != obj.UID {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		s.deletes = append(s.deletes, r.URL.Path)
+		_, _ = io.WriteString(w, `{}`)
+	}
+}
+
+func atomicCreateBody(t *testing.T) []byte {
+	t.Helper()
+	body, err := json.Marshal(CreateRequest{
+		HostedCluster: &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-hc"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				PullSecret: corev1.LocalObjectReference{Name: "my-hc-pull-secret"},
+			},
+		},
+		NodePools: []*hypershiftv1beta1.NodePool{{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pool"}}},
+		Secrets:   []corev1.Secret{{ObjectMeta: metav1.ObjectMeta{Name: "my-hc-pull-secret"}}},
+	})
+	require.NoError(t, err)
+	return body
+}
+
+func Test_handleCreate_WhenAtomicAndNodePoolFails_ItShouldRollBackEverything(t *testing.T) {
+	spoke, srv := newRollbackSpoke(t, "/nodepools")
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?atomic=true", bytes.NewReader(atomicCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	var failure createFailure
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &failure))
+	assert.Contains(t, failure.Error, `NodePool "my-hc-pool" creation failed`)
+	assert.Equal(t, []string{"HostedCluster/my-hc", "Secret/my-hc-pull-secret", "Namespace/clusters"}, failure.RolledBack)
+	assert.Empty(t, failure.RollbackErrors)
+	assert.Empty(t, spoke.objects, "everything created by the request should be gone")
+}
+
+func Test_handleCreate_WhenAtomicAndNamespaceExisted_ItShouldKeepNamespaceAndUpdatedSecret(t *testing.T) {
+	spoke, srv := newRollbackSpoke(t, "/hostedclusters")
+	secretsPath := apiPathCoreNamespaces + "/clusters/secrets/my-hc-pull-secret"
+	spoke.objects["/spoke-1"+apiPathCoreNamespaces+"/clusters"] = []byte(`{"metadata":{"name":"clusters"}}`)
+	spoke.objects["/spoke-1"+secretsPath] = []byte(`{"metadata":{"name":"my-hc-pull-secret","uid":"old"}}`)
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?atomic=true", bytes.NewReader(atomicCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	var failure createFailure
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &failure))
+	assert.Contains(t, failure.Error, "failed to create HostedCluster")
+	assert.Empty(t, failure.RolledBack)
+	assert.Empty(t, spoke.deletes)
+	assert.Contains(t, spoke.objects, "/spoke-1"+secretsPath)
+}
+
+func Test_handleCreate_WhenNotAtomicAndHostedClusterFails_ItShouldLeaveResources(t *testing.T) {
+	spoke, srv := newRollbackSpoke(t, "/hostedclusters")
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(atomicCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, spoke.deletes)
+	assert.Len(t, spoke.objects, 2)
+}
+
+func Test_handleCreate_WhenAtomicSucceeds_ItShouldReturn201(t *testing.T) {
+	spoke, srv := newRollbackSpoke(t, "")
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?atomic=true", bytes.NewReader(atomicCreateBody(t)))
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleCreate(w, r, "clusters", "spoke-1")
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, spoke.deletes)
+}
+
+func Test_handleCreate_WhenAtomicValueInvalid_ItShouldReturn400(t *testing.T) {
+	p := newTestProxy(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/?atomic=sometimes", bytes.NewReader(atomicCreateBody(t)))
+	p.handleCreate(w, r, "clusters", "spoke-1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_deleteCreatedResource_WhenLabelsMissing_ItShouldRefuse(t *testing.T) {
+	spoke, srv := newRollbackSpoke(t, "")
+	path := "/spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters/my-hc"
+	spoke.objects[path] = []byte(`{"metadata":{"name":"my-hc","uid":"u1"}}`)
+	p := newTestProxyWithSpokeURL(t, srv.URL)
+	client, err := p.spokeHTTPClient("alice", nil)
+	require.NoError(t, err)
+
+	err = p.deleteCreatedResource(context.Background(), client, "spoke-1", "clusters", "my-hc",
+		createdResource{kind: "HostedCluster", resource: resourceHostedClusters, name: "my-hc", uid: "u1"})
+	require.Error(t, err)
+	assert.Contains(t, spoke.objects, path)
+}
@@ -0,0 +1,249 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+const (
+	// queryIncludeObject selects what each Table row carries: None, Metadata
+	// (the default, as on the kube-apiserver) or Object.
+	queryIncludeObject = "includeObject"
+
+	cellUnknown = "<unknown>"
+)
+
+var hostedClusterColumns = []metav1.TableColumnDefinition{
+	{Name: "Name", Type: "string", Format: "name", Description: "Name of the HostedCluster."},
+	{Name: "Version", Type: "string", Description: "Last completed OpenShift version."},
+	{Name: "Available", Type: "string", Description: "Status of the Available condition."},
+	{Name: "Progressing", Type: "string", Description: "Status of the Progressing condition."},
+	{Name: "API Endpoint", Type: "string", Description: "Host and port of the hosted control plane API server."},
+	{Name: "NodePools", Type: "integer", Description: "Number of NodePools of the HostedCluster."},
+	{Name: "Hosting Cluster", Type: "string", Description: "ManagedCluster that runs the hosted control plane."},
+	{Name: "Age", Type: "string", Description: "Time since the HostedCluster was created."},
+	{Name: "Message", Type: "string", Priority: 1, Description: "Message of the Available condition."},
+}
+
+var nodePoolColumns = []metav1.TableColumnDefinition{
+	{Name: "Name", Type: "string", Format: "name", Description: "Name of the NodePool."},
+	{Name: "Cluster", Type: "string", Description: "HostedCluster the NodePool belongs to."},
+	{Name: "Desired Nodes", Type: "string", Description: "Requested replicas, or min-max when autoscaling."},
+	{Name: "Current Nodes", Type: "integer", Description: "Current number of nodes."},
+	{Name: "Autoscaling", Type: "boolean", Description: "Whether autoscaling is enabled."},
+	{Name: "Version", Type: "string", Description: "OpenShift version of the nodes."},
+	{Name: "Hosting Cluster", Type: "string", Description: "ManagedCluster that runs the hosted control plane."},
+	{Name: "Age", Type: "string", Description: "Time since the NodePool was created."},
+}
+
+// wantsTable reports whether the Accept header asks for a meta.k8s.io/v1
+// Table, as kubectl get does.
+func wantsTable(r *http.Request) bool {
+	for _, clause := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(clause))
+		if err != nil || mediaType != contentTypeJSON {
+			continue
+		}
+		if params["as"] == "Table" && params["g"] == metav1.GroupName && params["v"] == "v1" {
+			return true
+		}
+	}
+	return false
+}
+
+// nodePoolCounts counts NodePools per HostedCluster, keyed by nodePoolCountKey.
+type nodePoolCounts map[string]int64
+
+func nodePoolCountKey(spokeName, ns, hcName string) string {
+	return spokeName + "/" + ns + "/" + hcName
+}
+
+// add counts the NodePools listed on one hosting cluster.
+func (c nodePoolCounts) add(spokeName string, nodePools []unstructured.Unstructured) {
+	for i := range nodePools {
+		clusterName, _, _ := unstructured.NestedString(nodePools[i].Object, "spec", "clusterName")
+		c[nodePoolCountKey(spokeName, nodePools[i].GetNamespace(), clusterName)]++
+	}
+}
+
+// writeTable renders items (proxy objects of resource) as a meta.k8s.io/v1
+// Table. listMeta carries resourceVersion/continue of a list; npCounts feeds
+// the NodePools column of HostedCluster rows and may be nil when unknown.
+func writeTable(
+	w http.ResponseWriter,
+	r *http.Request,
+	resource string,
+	items []unstructured.Unstructured,
+	listMeta metav1.ListMeta,
+	npCounts nodePoolCounts,
+) {
+	includeObject := metav1.IncludeMetadata
+	if raw := r.URL.Query().Get(queryIncludeObject); raw != "" {
+		includeObject = metav1.IncludeObjectPolicy(raw)
+		switch includeObject {
+		case metav1.IncludeNone, metav1.IncludeMetadata, metav1.IncludeObject:
+		default:
+			writeJSONError(w, fmt.Sprintf("invalid %s value %q", queryIncludeObject, raw), http.StatusBadRequest)
+			return
+		}
+	}
+
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{APIVersion: metav1.SchemeGroupVersion.String(), Kind: "Table"},
+		ListMeta: listMeta,
+		Rows:     make([]metav1.TableRow, 0, len(items)),
+	}
+	switch resource {
+	case resourceNodePools:
+		table.ColumnDefinitions = nodePoolColumns
+	default:
+		table.ColumnDefinitions = hostedClusterColumns
+	}
+
+	now := time.Now()
+	for i := range items {
+		item := &items[i]
+		row := metav1.TableRow{}
+		if resource == resourceNodePools {
+			row.Cells = nodePoolCells(item, now)
+		} else {
+			row.Cells = hostedClusterCells(item, npCounts, now)
+		}
+		raw, err := tableRowObject(item, includeObject)
+		if err != nil {
+			writeJSONError(w, "failed to encode table row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		row.Object = runtime.RawExtension{Raw: raw}
+		table.Rows = append(table.Rows, row)
+	}
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(table)
+}
+
+// tableRowObject returns the object embedded in a Table row.
+func tableRowObject(item *unstructured.Unstructured, includeObject metav1.IncludeObjectPolicy) ([]byte, error) {
+	switch includeObject {
+	case metav1.IncludeNone:
+		return nil, nil
+	case metav1.IncludeObject:
+		return item.MarshalJSON()
+	}
+	partial := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{APIVersion: metav1.SchemeGroupVersion.String(), Kind: "PartialObjectMetadata"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              item.GetName(),
+			Namespace:         item.GetNamespace(),
+			UID:               item.GetUID(),
+			ResourceVersion:   item.GetResourceVersion(),
+			Generation:        item.GetGeneration(),
+			CreationTimestamp: item.GetCreationTimestamp(),
+			DeletionTimestamp: item.GetDeletionTimestamp(),
+			Labels:            item.GetLabels(),
+			Annotations:       item.GetAnnotations(),
+			OwnerReferences:   item.GetOwnerReferences(),
+			Finalizers:        item.GetFinalizers(),
+		},
+	}
+	return json.Marshal(partial)
+}
+
+func hostedClusterCells(hc *unstructured.Unstructured, npCounts nodePoolCounts, now time.Time) []interface{} {
+	hostingCluster := hc.GetAnnotations()[annotationHostingCluster]
+
+	version := ""
+	history, _, _ := unstructured.NestedSlice(hc.Object, "status", "version", "history")
+	for _, entry := range history {
+		if m, ok := entry.(map[string]interface{}); ok && m["state"] == "Completed" {
+			version, _ = m["version"].(string)
+			break
+		}
+	}
+
+	endpoint := ""
+	if host, _, _ := unstructured.NestedString(hc.Object, "status", "controlPlaneEndpoint", "host"); host != "" {
+		endpoint = host
+		if port, found, _ := unstructured.NestedInt64(hc.Object, "status", "controlPlaneEndpoint", "port"); found {
+			endpoint = fmt.Sprintf("%s:%d", host, port)
+		}
+	}
+
+	var nodePools interface{} = cellUnknown
+	if npCounts != nil {
+		nodePools = npCounts[nodePoolCountKey(hostingCluster, hc.GetNamespace(), hc.GetName())]
+	}
+
+	available, message := conditionCell(hc, "Available")
+	progressing, _ := conditionCell(hc, "Progressing")
+	return []interface{}{
+		hc.GetName(), version, available, progressing, endpoint, nodePools,
+		hostingCluster, ageCell(hc, now), message,
+	}
+}
+
+func nodePoolCells(np *unstructured.Unstructured, now time.Time) []interface{} {
+	clusterName, _, _ := unstructured.NestedString(np.Object, "spec", "clusterName")
+
+	autoscaling := false
+	desired := ""
+	if minReplicas, found, _ := unstructured.NestedInt64(np.Object, "spec", "autoScaling", "min"); found {
+		autoscaling = true
+		maxReplicas, _, _ := unstructured.NestedInt64(np.Object, "spec", "autoScaling", "max")
+		desired = fmt.Sprintf("%d-%d", minReplicas, maxReplicas)
+	} else if replicas, found, _ := unstructured.NestedInt64(np.Object, "spec", "replicas"); found {
+		desired = fmt.Sprintf("%d", replicas)
+	}
+
+	current, _, _ := unstructured.NestedInt64(np.Object, "status", "replicas")
+	version, _, _ := unstructured.NestedString(np.Object, "status", "version")
+	return []interface{}{
+		np.GetName(), clusterName, desired, current, autoscaling, version,
+		np.GetAnnotations()[annotationHostingCluster], ageCell(np, now),
+	}
+}
+
+// conditionCell returns the status and message of a status condition, or
+// <unknown> if the condition is not reported yet.
+func conditionCell(obj *unstructured.Unstructured, condType string) (string, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["type"] != condType {
+			continue
+		}
+		status, _ := m["status"].(string)
+		message, _ := m["message"].(string)
+		return status, message
+	}
+	return cellUnknown, ""
+}
+
+func ageCell(obj *unstructured.Unstructured, now time.Time) string {
+	created := obj.GetCreationTimestamp()
+	if created.IsZero() {
+		return cellUnknown
+	}
+	return duration.HumanDuration(now.Sub(created.Time))
+}
+
+// unstructuredFromObject converts a typed object to a proxy object of the
+// given hosting cluster for table rendering.
+func unstructuredFromObject(obj interface{}, spokeName string) (unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	u := unstructured.Unstructured{Object: content}
+	asProxyObject(&u, spokeName)
+	return u, nil
+}
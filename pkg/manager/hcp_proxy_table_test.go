@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// kubectlTableAccept is the Accept header kubectl get sends.
+const kubectlTableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json;as=Table;v=v1beta1;g=meta.k8s.io,application/json"
+
+const spokeHostedClusterWithStatus = `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedCluster",` +
+	`"metadata":{"name":"my-hc","namespace":"clusters","creationTimestamp":"2026-01-01T00:00:00Z"},` +
+	`"status":{"version":{"history":[{"state":"Partial","version":"4.17.2"},{"state":"Completed","version":"4.17.1"}]},` +
+	`"controlPlaneEndpoint":{"host":"api.my-hc.example.com","port":6443},` +
+	`"conditions":[{"type":"Available","status":"True","message":"The hosted control plane is available"},` +
+	`{"type":"Progressing","status":"False"}]}}`
+
+func tableSpoke(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		switch r.URL.Path {
+		case "/spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters":
+			_, _ = io.WriteString(w, `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedClusterList",`+
+				`"metadata":{"resourceVersion":"42","continue":"next"},"items":[`+spokeHostedClusterWithStatus+`]}`)
+		case "/spoke-1" + apiPathHSNamespaces + "/clusters/nodepools":
+			_, _ = io.WriteString(w, `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"NodePoolList","items":[`+
+				spokeNodePool+`,`+spokeNodePool+`]}`)
+		case "/spoke-1" + apiPathHSNamespaces + "/clusters/nodepools/np-1":
+			_, _ = io.WriteString(w, spokeNodePool)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func tableRequest(path string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, apiPathPrefix+hcpProxyGroupVersion+path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	r.Header.Set("Accept", kubectlTableAccept)
+	return r
+}
+
+func decodeTable(t *testing.T, body []byte) metav1.Table {
+	t.Helper()
+	var table metav1.Table
+	require.NoError(t, json.Unmarshal(body, &table))
+	assert.Equal(t, "Table", table.Kind)
+	assert.Equal(t, "meta.k8s.io/v1", table.APIVersion)
+	return table
+}
+
+func Test_wantsTable_WhenAcceptHeaderVaries_ItShouldOnlyMatchMetaV1Table(t *testing.T) {
+	for accept, want := range map[string]bool{
+		kubectlTableAccept: true,
+		"application/json;as=Table;g=meta.k8s.io;v=v1":      true,
+		"application/json;as=Table;g=meta.k8s.io;v=v1beta1": false,
+		"application/json": false,
+		"":                 false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, want, wantsTable(r), accept)
+	}
+}
+
+func Test_handleRoute_WhenHostedClusterListAsTable_ItShouldRenderStatusColumns(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, tableSpoke(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, tableRequest("/namespaces/clusters/hostedclusters?hostingCluster=spoke-1"))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	table := decodeTable(t, w.Body.Bytes())
+	assert.Equal(t, "42", table.ResourceVersion)
+	assert.Equal(t, "next", table.Continue)
+	require.Len(t, table.ColumnDefinitions, len(hostedClusterColumns))
+	require.Len(t, table.Rows, 1)
+	assert.Equal(t, []interface{}{
+		"my-hc", "4.17.1", "True", "False", "api.my-hc.example.com:6443", float64(2), "spoke-1",
+	}, table.Rows[0].Cells[:7])
+	assert.Equal(t, "The hosted control plane is available", table.Rows[0].Cells[8])
+
+	var partial metav1.PartialObjectMetadata
+	require.NoError(t, json.Unmarshal(table.Rows[0].Object.Raw, &partial))
+	assert.Equal(t, "PartialObjectMetadata", partial.Kind)
+	assert.Equal(t, "clusters", partial.Namespace)
+	assert.Equal(t, "spoke-1", partial.Annotations[annotationHostingCluster])
+}
+
+func Test_handleRoute_WhenHostedClusterGetAsTable_ItShouldReturnOneRow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		switch r.URL.Path {
+		case "/spoke-1" + apiPathHSNamespaces + "/clusters/hostedclusters/my-hc":
+			_, _ = io.WriteString(w, `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"HostedCluster",`+
+				`"metadata":{"name":"my-hc","namespace":"clusters"}}`)
+		case "/spoke-1" + apiPathHSNamespaces + "/clusters/nodepools":
+			_, _ = io.WriteString(w, `{"apiVersion":"hypershift.openshift.io/v1beta1","kind":"NodePoolList","items":[`+
+				spokeNodePool+`]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	p := newTestProxyWithSpokeURL(t, srv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, tableRequest("/namespaces/clusters/hostedclusters/my-hc?hostingCluster=spoke-1&includeObject=None"))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	table := decodeTable(t, w.Body.Bytes())
+	require.Len(t, table.Rows, 1)
+	assert.Equal(t, "my-hc", table.Rows[0].Cells[0])
+	assert.Equal(t, cellUnknown, table.Rows[0].Cells[2], "no Available condition yet")
+	assert.Equal(t, float64(1), table.Rows[0].Cells[5])
+	assert.Equal(t, cellUnknown, table.Rows[0].Cells[7], "no creationTimestamp")
+	assert.Nil(t, table.Rows[0].Object.Raw)
+}
+
+func Test_handleRoute_WhenNodePoolGetAsTable_ItShouldRenderNodePoolColumns(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, tableSpoke(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, tableRequest("/namespaces/clusters/nodepools/np-1?hostingCluster=spoke-1"))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	table := decodeTable(t, w.Body.Bytes())
+	require.Len(t, table.ColumnDefinitions, len(nodePoolColumns))
+	require.Len(t, table.Rows, 1)
+	assert.Equal(t, []interface{}{"np-1", "my-hc", "2", float64(0), false, "", "spoke-1"}, table.Rows[0].Cells[:7])
+}
+
+func Test_handleRoute_WhenTableIncludeObjectInvalid_ItShouldReturn400(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, tableSpoke(t).URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, tableRequest("/namespaces/clusters/nodepools?hostingCluster=spoke-1&includeObject=Everything"))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_handleRoute_WhenFanOutListAsTable_ItShouldCountNodePoolsPerHostingCluster(t *testing.T) {
+	p := newTestProxyWithSpokeURL(t, tableSpoke(t).URL, hostingManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	p.handleRoute(w, tableRequest("/namespaces/clusters/hostedclusters"))
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	table := decodeTable(t, w.Body.Bytes())
+	require.Len(t, table.Rows, 1)
+	assert.Equal(t, float64(2), table.Rows[0].Cells[5])
+	assert.Equal(t, "spoke-1", table.Rows[0].Cells[6])
+}
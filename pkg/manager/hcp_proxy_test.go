@@ -32,6 +32,8 @@ import (
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -61,6 +63,8 @@ func newTestProxy(t *testing.T, objs ...runtime.Object) *hcpProxy {
 	scheme := runtime.NewScheme()
 	require.NoError(t, corev1.AddToScheme(scheme))
 	require.NoError(t, clusterv1.AddToScheme(scheme))
+	require.NoError(t, clusterv1alpha1.AddToScheme(scheme))
+	require.NoError(t, clusterv1beta1.AddToScheme(scheme))
 	require.NoError(t, mcev1.AddToScheme(scheme))
 	require.NoError(t, hypershiftv1beta1.AddToScheme(scheme))
 
@@ -393,8 +397,9 @@ func Test_handleDiscovery_WhenVersionPath_ItShouldReturnAPIResourceList(t *testi
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
 	assert.Equal(t, "APIResourceList", doc["kind"])
 	resources := doc["resources"].([]interface{})
-	// hostedclusters + hostedclusters/resources subresource
-	assert.Len(t, resources, 2)
+	// hostedclusters + hostedclusters/resources + hostedclusters/kubeconfig + hostedclusters/migrate
+	// + hostedclusters/progress + hostedclusters/deletion + hostedclusters/adopt + nodepools + nodepools/scale
+	assert.Len(t, resources, 9)
 	first := resources[0].(map[string]interface{})
 	assert.Equal(t, hcpProxyResource, first["name"])
 	verbs := first["verbs"].([]interface{})
@@ -402,21 +407,44 @@ func Test_handleDiscovery_WhenVersionPath_ItShouldReturnAPIResourceList(t *testi
 	assert.Contains(t, verbs, "deletecollection")
 	second := resources[1].(map[string]interface{})
 	assert.Equal(t, hcpProxyResource+"/resources", second["name"])
+	kubeconfig := resources[2].(map[string]interface{})
+	assert.Equal(t, hcpProxyResource+"/kubeconfig", kubeconfig["name"])
+	assert.Equal(t, []interface{}{"get"}, kubeconfig["verbs"])
+	migrate := resources[3].(map[string]interface{})
+	assert.Equal(t, hcpProxyResource+"/migrate", migrate["name"])
+	assert.Equal(t, []interface{}{"create", "get"}, migrate["verbs"])
+	progress := resources[4].(map[string]interface{})
+	assert.Equal(t, hcpProxyResource+"/progress", progress["name"])
+	assert.Equal(t, []interface{}{"get"}, progress["verbs"])
+	deletion := resources[5].(map[string]interface{})
+	assert.Equal(t, hcpProxyResource+"/deletion", deletion["name"])
+	assert.Equal(t, []interface{}{"get"}, deletion["verbs"])
+	adopt := resources[6].(map[string]interface{})
+	assert.Equal(t, hcpProxyResource+"/adopt", adopt["name"])
+	assert.Equal(t, []interface{}{"create"}, adopt["verbs"])
+	nodePools := resources[7].(map[string]interface{})
+	assert.Equal(t, resourceNodePools, nodePools["name"])
+	assert.Contains(t, nodePools["verbs"], "patch")
+	assert.Contains(t, nodePools["verbs"], "create")
+	scale := resources[8].(map[string]interface{})
+	assert.Equal(t, resourceNodePools+"/scale", scale["name"])
+	assert.Equal(t, "autoscaling", scale["group"])
+	assert.Equal(t, "Scale", scale["kind"])
 }
 
 // --- handleRoute ---
 
-func Test_handleRoute_WhenWatchRequested_ItShouldReturn405(t *testing.T) {
+func Test_handleRoute_WhenWatchRequestedWithoutHostingCluster_ItShouldReturn400(t *testing.T) {
 	p := newTestProxy(t)
 	w := httptest.NewRecorder()
 	path := "/apis/" + hcpProxyAPIGroup + "/" + hcpProxyAPIVersion + "/namespaces/clusters/hostedclusters?watch=true"
 	r := httptest.NewRequest(http.MethodGet, path, nil)
 	p.handleRoute(w, r)
-	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 
 	var doc map[string]interface{}
 	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
-	assert.Contains(t, doc["error"], "watch is not supported")
+	assert.Contains(t, doc["error"], "hostingCluster query parameter is required")
 }
 
 func Test_handleRoute_WhenMissingHostingCluster_OnNamedEndpoint_ItShouldReturn400(t *testing.T) {
@@ -870,6 +898,38 @@ func Test_handleGetResources_WhenSpokeReturnsCluster_ItShouldReturnBundle(t *tes
 	assert.Len(t, bundle.NodePools, 1)
 }
 
+func Test_handleGetResources_WhenNamespaceUnreadable_ItShouldWarn(t *testing.T) {
+	hcJSON, _ := json.Marshal(&hypershiftv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-hc", Namespace: "clusters"},
+	})
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		switch {
+		case strings.HasSuffix(r.URL.Path, apiPathCoreNamespaces+"/clusters"):
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"kind":"Status","reason":"Forbidden","code":403}`)
+		case strings.Contains(r.URL.Path, "/nodepools"):
+			_, _ = io.WriteString(w, `{"items":[]}`)
+		default:
+			_, _ = w.Write(hcJSON)
+		}
+	}))
+	defer spokeSrv.Close()
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, availableManagedCluster("spoke-1"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleGetResources(w, r, "clusters", "my-hc", "spoke-1")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var bundle ResourceBundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bundle))
+	assert.Nil(t, bundle.Namespace)
+	require.Len(t, bundle.Warnings, 1)
+	assert.Contains(t, bundle.Warnings[0], "failed to read namespace: spoke returned 403")
+}
+
 // --- handleDelete ---
 
 func Test_handleDelete_WhenSpokeAccepts_ItShouldProxy200(t *testing.T) {
@@ -1384,14 +1444,14 @@ func Test_handleRoute_WhenPatchOnNamedResource_ItShouldDoBundleReplace(t *testin
 
 // --- handleList (ACM Search) ---
 
-func Test_handleRoute_WhenListPath_ItShouldReturn405(t *testing.T) {
+func Test_handleRoute_WhenCollectionPUT_ItShouldReturn405(t *testing.T) {
 	mc := availableManagedCluster("spoke-1")
 	p := newTestProxyWithSpokeURL(t, "http://unused", mc)
 
 	path := "/apis/" + hcpProxyAPIGroup + "/" + hcpProxyAPIVersion +
 		"/namespaces/clusters/hostedclusters?hostingCluster=spoke-1"
 	w := httptest.NewRecorder()
-	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r := httptest.NewRequest(http.MethodPut, path, nil)
 	r.Header.Set("X-Remote-User", "alice")
 	p.handleRoute(w, r)
 	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
@@ -1440,9 +1500,9 @@ func Test_handleDelete_WhenMatchingNodePoolsExist_ItShouldDeleteThem(t *testing.
 	assert.Contains(t, joined, "/hostedclusters/my-hc")
 }
 
-// --- createOrUpdateSecretOnSpoke ---
+// --- createOrUpdateOnSpoke ---
 
-func Test_createOrUpdateSecretOnSpoke_WhenConflict_ItShouldPut(t *testing.T) {
+func Test_createOrUpdateOnSpoke_WhenConflict_ItShouldPut(t *testing.T) {
 	var methods []string
 	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		methods = append(methods, r.Method)
@@ -1461,12 +1521,13 @@ func Test_createOrUpdateSecretOnSpoke_WhenConflict_ItShouldPut(t *testing.T) {
 	require.NoError(t, err)
 
 	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "clusters"}, Data: map[string][]byte{"key": []byte("val")}}
-	err = p.createOrUpdateSecretOnSpoke(context.Background(), client, "spoke-1", "clusters", secret)
+	created, err := p.createOrUpdateOnSpoke(context.Background(), client, "spoke-1", "clusters", resourceSecrets, secret)
 	require.NoError(t, err)
+	assert.False(t, created)
 	assert.Equal(t, []string{http.MethodPost, http.MethodPut}, methods)
 }
 
-func Test_createOrUpdateSecretOnSpoke_WhenCreateSucceeds_ItShouldNotPut(t *testing.T) {
+func Test_createOrUpdateOnSpoke_WhenCreateSucceeds_ItShouldNotPut(t *testing.T) {
 	var methods []string
 	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		methods = append(methods, r.Method)
@@ -1480,8 +1541,9 @@ func Test_createOrUpdateSecretOnSpoke_WhenCreateSucceeds_ItShouldNotPut(t *testi
 	require.NoError(t, err)
 
 	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "clusters"}, Data: map[string][]byte{"key": []byte("val")}}
-	err = p.createOrUpdateSecretOnSpoke(context.Background(), client, "spoke-1", "clusters", secret)
+	created, err := p.createOrUpdateOnSpoke(context.Background(), client, "spoke-1", "clusters", resourceSecrets, secret)
 	require.NoError(t, err)
+	assert.True(t, created)
 	assert.Equal(t, []string{http.MethodPost}, methods)
 }
 
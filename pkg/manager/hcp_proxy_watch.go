@@ -0,0 +1,396 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// hcpProxyWatchMaxTimeout caps a single watch stream. Clients (informers,
+	// kubectl -w) transparently re-establish the watch from the last resourceVersion.
+	hcpProxyWatchMaxTimeout = 30 * time.Minute
+
+	// watchTimeoutGrace lets the spoke close the stream itself at timeoutSeconds
+	// before the proxy-side context deadline fires.
+	watchTimeoutGrace = 5 * time.Second
+)
+
+// watchQueryParams are the only query parameters forwarded to the spoke on a watch.
+// hostingCluster and anything else proxy-specific is dropped.
+var watchQueryParams = []string{
+	"resourceVersion",
+	"resourceVersionMatch",
+	"allowWatchBookmarks",
+	"sendInitialEvents",
+	"labelSelector",
+	"fieldSelector",
+}
+
+// watchEvent is the standard Kubernetes watch framing: one JSON object per event.
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// isWatchRequest reports whether the caller asked for a watch stream (?watch=true|1).
+func isWatchRequest(r *http.Request) bool {
+	watch := r.URL.Query().Get("watch")
+	return watch == "true" || watch == "1"
+}
+
+// handleWatch opens a HostedCluster or NodePool watch on the spoke under the caller's
+// impersonated identity and streams the events back unchanged except for the
+// object apiVersion, which is rewritten to hcp.ocm.io/v1alpha1.
+//
+// When name is set (GET .../{resource}/{name}?watch=true) the watch is
+// narrowed with a metadata.name field selector, the same as client-go does.
+// resourceVersion, bookmarks and selectors are passed through, so a client
+// resuming from a stale resourceVersion gets the spoke's 410 Gone as-is.
+func (p *hcpProxy) handleWatch(w http.ResponseWriter, r *http.Request, ns, resource, name, spokeName string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, "streaming is not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+
+	query, timeout, err := buildWatchQuery(r.URL.Query(), name)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	apiPath, err := hsCollectionAPIPath(ns, resource)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, groups := whoIsTheCaller(r)
+	hcpClient, err := p.spokeWatchClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout+watchTimeoutGrace)
+	defer cancel()
+
+	req, err := p.newSpokeRequest(ctx, http.MethodGet, spokeName, apiPath, nil)
+	if err != nil {
+		writeJSONError(w, "failed to build watch request: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.URL.RawQuery = query.Encode()
+
+	resp, err := doSpokeHTTP(hcpClient, req)
+	if err != nil {
+		writeJSONError(w, "spoke request failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Non-200 (e.g. 410 Gone for an expired resourceVersion, 403 from spoke RBAC)
+	// is a metav1.Status — forward it so client-go can react (relist, back off).
+	if resp.StatusCode != http.StatusOK {
+		if ct := resp.Header.Get(headerContentType); ct != "" {
+			w.Header().Set(headerContentType, ct)
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	p.log.Info("watch stream opened", "resource", resource, "namespace", ns, "spoke", spokeName, "timeout", timeout.String())
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	dec := json.NewDecoder(resp.Body)
+	enc := json.NewEncoder(w)
+	for {
+		var evt watchEvent
+		if err := dec.Decode(&evt); err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				p.log.Error(err, "watch stream from spoke ended unexpectedly", "spoke", spokeName)
+			}
+			return
+		}
+		if err := rewriteWatchEvent(&evt, spokeName); err != nil {
+			p.log.Error(err, "dropping undecodable watch event", "type", evt.Type, "spoke", spokeName)
+			continue
+		}
+		if err := enc.Encode(&evt); err != nil {
+			// Caller went away.
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// buildWatchQuery copies the allowlisted watch parameters, forces watch=true and
+// resolves timeoutSeconds: the caller's value capped at hcpProxyWatchMaxTimeout,
+// or the cap itself when none was given.
+func buildWatchQuery(in url.Values, name string) (url.Values, time.Duration, error) {
+	out := url.Values{"watch": []string{"true"}}
+	for _, key := range watchQueryParams {
+		if v := in.Get(key); v != "" {
+			out.Set(key, v)
+		}
+	}
+
+	if name != "" {
+		nameSelector := "metadata.name=" + name
+		if fs := out.Get("fieldSelector"); fs != "" {
+			nameSelector = fs + "," + nameSelector
+		}
+		out.Set("fieldSelector", nameSelector)
+	}
+
+	timeout := hcpProxyWatchMaxTimeout
+	if raw := in.Get("timeoutSeconds"); raw != "" {
+		secs, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || secs < 0 {
+			return nil, 0, fmt.Errorf("invalid timeoutSeconds %q", raw)
+		}
+		if requested := time.Duration(secs) * time.Second; secs > 0 && requested < timeout {
+			timeout = requested
+		}
+	}
+	out.Set("timeoutSeconds", strconv.FormatInt(int64(timeout/time.Second), 10))
+	return out, timeout, nil
+}
+
+// rewriteWatchEvent presents HostedCluster and NodePool objects (including BOOKMARK
+// placeholders) under the proxy's API group. ERROR events carry a metav1.Status
+// and are passed through untouched.
+func rewriteWatchEvent(evt *watchEvent, spokeName string) error {
+	if evt.Type == "ERROR" || len(evt.Object) == 0 {
+		return nil
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(evt.Object); err != nil {
+		return err
+	}
+	if evt.Type == "BOOKMARK" {
+		// A bookmark only carries a resourceVersion; keep it that way.
+		spokeName = ""
+	}
+	asProxyObject(obj, spokeName)
+	raw, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	evt.Object = raw
+	return nil
+}
+
+// asProxyObject stamps the hcp.ocm.io apiVersion on a spoke object so clients
+// that requested hcp.ocm.io resources receive objects of the matching group.
+// When spokeName is set it is recorded in the hcp.ocm.io/hosting-cluster
+// annotation.
+func asProxyObject(obj *unstructured.Unstructured, spokeName string) {
+	obj.SetAPIVersion(hcpProxyGroupVersion)
+	if spokeName == "" {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotationHostingCluster] = spokeName
+	obj.SetAnnotations(annotations)
+}
+
+// spokeWatch is a watch stream opened on one hosting cluster.
+type spokeWatch struct {
+	spoke string
+	body  io.ReadCloser
+}
+
+// handleFanOutWatch serves a HostedCluster or NodePool watch that arrived
+// without a hostingCluster parameter, e.g. "oc get hostedclusters -A -w". It
+// opens the watch on every hosting cluster a fan-out list would query and
+// merges the streams, annotating each object with its hosting cluster. ns is
+// empty for a cluster-wide watch.
+//
+// resourceVersions are per hosting cluster, so a merged watch can only start
+// from the current state: resuming from a resourceVersion is answered with
+// 410 Gone, which makes clients relist, and bookmarks are dropped. Hosting
+// clusters whose watch cannot be opened are reported as Warning headers, and
+// the merged stream ends as soon as any of its streams does so that the
+// client re-establishes it instead of silently missing one cluster's events.
+func (p *hcpProxy) handleFanOutWatch(w http.ResponseWriter, r *http.Request, nsRaw, resource string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, "streaming is not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+
+	in := r.URL.Query()
+	if rv := in.Get("resourceVersion"); rv != "" && rv != "0" {
+		status := apierrors.NewResourceExpired(fmt.Sprintf(
+			"resourceVersion %s cannot be resumed across hosting clusters; relist without hostingCluster", rv)).ErrStatus
+		writeStatus(w, &status)
+		return
+	}
+	if sendInitial, _ := strconv.ParseBool(in.Get("sendInitialEvents")); sendInitial {
+		writeJSONError(w, "sendInitialEvents requires the hostingCluster parameter", http.StatusBadRequest)
+		return
+	}
+	query, timeout, err := buildWatchQuery(in, "")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Del("allowWatchBookmarks")
+	query.Del("resourceVersionMatch")
+	query.Del("sendInitialEvents")
+	apiPath, err := fanOutAPIPath(nsRaw, resource)
+	if err != nil {
+		writeJSONError(w, "invalid namespace: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username, groups := whoIsTheCaller(r)
+	spokes, warnings := p.fanOutSpokes(r, "watch", nsRaw, resource)
+	hcpClient, err := p.spokeWatchClient(username, groups)
+	if err != nil {
+		writeJSONError(w, errMsgFailedSpokeClient+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout+watchTimeoutGrace)
+	defer cancel()
+
+	streams, openWarnings := p.openWatches(ctx, hcpClient, spokes, apiPath, query)
+	defer func() {
+		cancel()
+		for _, s := range streams {
+			_ = s.body.Close()
+		}
+	}()
+
+	p.log.Info("fan-out watch stream opened", "resource", resource, "namespace", nsRaw,
+		"spokes", len(streams), "timeout", timeout.String())
+
+	for _, msg := range append(warnings, openWarnings...) {
+		w.Header().Add("Warning", "299 - "+strconv.Quote(msg))
+	}
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events := make(chan watchEvent)
+	ended := make(chan struct{}, len(streams))
+	for _, s := range streams {
+		go func(s spokeWatch) {
+			defer func() { ended <- struct{}{} }()
+			dec := json.NewDecoder(s.body)
+			for {
+				var evt watchEvent
+				if err := dec.Decode(&evt); err != nil {
+					if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+						p.log.Error(err, "watch stream from spoke ended unexpectedly", "spoke", s.spoke)
+					}
+					return
+				}
+				if evt.Type == "BOOKMARK" {
+					continue
+				}
+				if err := rewriteWatchEvent(&evt, s.spoke); err != nil {
+					p.log.Error(err, "dropping undecodable watch event", "type", evt.Type, "spoke", s.spoke)
+					continue
+				}
+				select {
+				case events <- evt:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(s)
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ended:
+			return
+		case evt := <-events:
+			if err := enc.Encode(&evt); err != nil {
+				// Caller went away.
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// openWatches opens the watch at apiPath on every spoke in parallel, bounded
+// by fanOutConcurrency. A 404 means the hypershift CRDs are not installed
+// there and is skipped; other failures are returned as warnings.
+func (p *hcpProxy) openWatches(
+	ctx context.Context,
+	hcpClient *http.Client,
+	spokes []string,
+	apiPath string,
+	query url.Values,
+) ([]spokeWatch, []string) {
+	opened := make([]*spokeWatch, len(spokes))
+	errs := make([]error, len(spokes))
+	sem := make(chan struct{}, fanOutConcurrency)
+	var wg sync.WaitGroup
+	for i, spoke := range spokes {
+		wg.Add(1)
+		go func(i int, spoke string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			req, err := p.newSpokeRequest(ctx, http.MethodGet, spoke, apiPath, nil)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			req.URL.RawQuery = query.Encode()
+			resp, err := doSpokeHTTP(hcpClient, req)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			switch resp.StatusCode {
+			case http.StatusOK:
+				opened[i] = &spokeWatch{spoke: spoke, body: resp.Body}
+			case http.StatusNotFound:
+				_ = resp.Body.Close()
+			default:
+				_ = resp.Body.Close()
+				errs[i] = fmt.Errorf("watch returned HTTP %d", resp.StatusCode)
+			}
+		}(i, spoke)
+	}
+	wg.Wait()
+
+	var streams []spokeWatch
+	var warnings []string
+	for i, spoke := range spokes {
+		switch {
+		case errs[i] != nil:
+			warnings = append(warnings, fmt.Sprintf("hosting cluster %q: %v", spoke, errs[i]))
+		case opened[i] != nil:
+			streams = append(streams, *opened[i])
+		}
+	}
+	return streams, warnings
+}
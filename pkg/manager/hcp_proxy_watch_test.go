@@ -0,0 +1,259 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// watchStream is a three-event spoke watch body: ADDED, BOOKMARK, DELETED.
+const watchStream = `{"type":"ADDED","object":{"apiVersion":"hypershift.openshift.io/v1beta1",` +
+	`"kind":"HostedCluster","metadata":{"name":"my-hc","namespace":"clusters","resourceVersion":"10"}}}
+{"type":"BOOKMARK","object":{"apiVersion":"hypershift.openshift.io/v1beta1",` +
+	`"kind":"HostedCluster","metadata":{"resourceVersion":"11"}}}
+{"type":"DELETED","object":{"apiVersion":"hypershift.openshift.io/v1beta1",` +
+	`"kind":"HostedCluster","metadata":{"name":"my-hc","namespace":"clusters","resourceVersion":"12"}}}
+`
+
+func decodeWatchEvents(t *testing.T, body []byte) []watchEvent {
+	t.Helper()
+	var events []watchEvent
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var evt watchEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &evt))
+		events = append(events, evt)
+	}
+	return events
+}
+
+func Test_handleRoute_WhenWatchRequested_ItShouldStreamRewrittenEvents(t *testing.T) {
+	var spokeQuery url.Values
+	var spokePath string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spokePath = r.URL.Path
+		spokeQuery = r.URL.Query()
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, watchStream)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, availableManagedCluster("spoke-1"))
+	path := apiPathPrefix + hcpProxyGroupVersion +
+		"/namespaces/clusters/hostedclusters?hostingCluster=spoke-1&watch=true" +
+		"&resourceVersion=9&allowWatchBookmarks=true&timeoutSeconds=60"
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/spoke-1"+apiPathHSNamespaces+"/clusters/hostedclusters", spokePath)
+	assert.Equal(t, "true", spokeQuery.Get("watch"))
+	assert.Equal(t, "9", spokeQuery.Get("resourceVersion"))
+	assert.Equal(t, "true", spokeQuery.Get("allowWatchBookmarks"))
+	assert.Equal(t, "60", spokeQuery.Get("timeoutSeconds"))
+	assert.Empty(t, spokeQuery.Get("hostingCluster"), "proxy-only parameters must not reach the spoke")
+
+	events := decodeWatchEvents(t, w.Body.Bytes())
+	require.Len(t, events, 3)
+	assert.Equal(t, "ADDED", events[0].Type)
+	assert.Equal(t, "BOOKMARK", events[1].Type)
+	assert.Equal(t, "DELETED", events[2].Type)
+	for _, evt := range events {
+		var obj map[string]interface{}
+		require.NoError(t, json.Unmarshal(evt.Object, &obj))
+		assert.Equal(t, hcpProxyGroupVersion, obj["apiVersion"])
+		assert.Equal(t, "HostedCluster", obj["kind"])
+	}
+
+	var added map[string]interface{}
+	require.NoError(t, json.Unmarshal(events[0].Object, &added))
+	annotations, _ := added["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	assert.Equal(t, "spoke-1", annotations[annotationHostingCluster])
+}
+
+func Test_handleWatch_WhenNamed_ItShouldAddNameFieldSelector(t *testing.T) {
+	var fieldSelector string
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fieldSelector = r.URL.Query().Get("fieldSelector")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?watch=true", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleWatch(w, r, "clusters", resourceHostedClusters, "my-hc", "spoke-1")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "metadata.name=my-hc", fieldSelector)
+}
+
+func Test_handleWatch_WhenResourceVersionExpired_ItShouldForward410(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusGone)
+		_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","status":"Failure",`+
+			`"reason":"Expired","code":410,"message":"too old resource version"}`)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?watch=true&resourceVersion=1", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleWatch(w, r, "clusters", resourceHostedClusters, "", "spoke-1")
+
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "Expired")
+}
+
+func Test_handleWatch_WhenSpokeSendsErrorEvent_ItShouldPassStatusThrough(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"type":"ERROR","object":{"kind":"Status","apiVersion":"v1","code":410}}`+"\n")
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/?watch=true", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleWatch(w, r, "clusters", resourceHostedClusters, "", "spoke-1")
+
+	events := decodeWatchEvents(t, w.Body.Bytes())
+	require.Len(t, events, 1)
+	assert.Equal(t, "ERROR", events[0].Type)
+	assert.Contains(t, string(events[0].Object), `"apiVersion":"v1"`)
+}
+
+func Test_buildWatchQuery_WhenTimeoutAboveMax_ItShouldCap(t *testing.T) {
+	q, timeout, err := buildWatchQuery(url.Values{"timeoutSeconds": []string{"999999"}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, hcpProxyWatchMaxTimeout, timeout)
+	assert.Equal(t, "1800", q.Get("timeoutSeconds"))
+}
+
+func Test_buildWatchQuery_WhenTimeoutAbsent_ItShouldUseMax(t *testing.T) {
+	_, timeout, err := buildWatchQuery(url.Values{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, hcpProxyWatchMaxTimeout, timeout)
+}
+
+func Test_buildWatchQuery_WhenTimeoutBelowMax_ItShouldKeepIt(t *testing.T) {
+	_, timeout, err := buildWatchQuery(url.Values{"timeoutSeconds": []string{"30"}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, timeout)
+}
+
+func Test_buildWatchQuery_WhenTimeoutInvalid_ItShouldError(t *testing.T) {
+	_, _, err := buildWatchQuery(url.Values{"timeoutSeconds": []string{"soon"}}, "")
+	assert.Error(t, err)
+}
+
+func Test_buildWatchQuery_WhenNamedWithFieldSelector_ItShouldCombine(t *testing.T) {
+	q, _, err := buildWatchQuery(url.Values{"fieldSelector": []string{"metadata.namespace=clusters"}}, "my-hc")
+	require.NoError(t, err)
+	assert.Equal(t, "metadata.namespace=clusters,metadata.name=my-hc", q.Get("fieldSelector"))
+}
+
+func Test_handleRoute_WhenWatchWithoutHostingCluster_ItShouldMergeEveryHostingCluster(t *testing.T) {
+	var mu sync.Mutex
+	spokeQueries := map[string]url.Values{}
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spoke := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0]
+		mu.Lock()
+		spokeQueries[spoke] = r.URL.Query()
+		mu.Unlock()
+		if spoke == "spoke-3" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set(headerContentType, contentTypeJSON)
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, `{"type":"BOOKMARK","object":{"apiVersion":"hypershift.openshift.io/v1beta1",`+
+			`"kind":"HostedCluster","metadata":{"resourceVersion":"5"}}}
+{"type":"ADDED","object":{"apiVersion":"hypershift.openshift.io/v1beta1",`+
+			`"kind":"HostedCluster","metadata":{"name":"hc-`+spoke+`","namespace":"clusters"}}}
+`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL,
+		hostingManagedCluster("spoke-1"),
+		hostingManagedCluster("spoke-2"),
+		hostingManagedCluster("spoke-3"),
+	)
+	proxySrv := httptest.NewServer(http.HandlerFunc(p.handleRoute))
+	defer proxySrv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, proxySrv.URL+apiPathPrefix+hcpProxyGroupVersion+
+		"/hostedclusters?watch=true&resourceVersion=0&allowWatchBookmarks=true&labelSelector=env%3Dprod", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Remote-User", "alice")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, resp.Header.Values("Warning"), 1)
+	assert.Contains(t, resp.Header.Get("Warning"), `hosting cluster \"spoke-3\": watch returned HTTP 403`)
+
+	hostingClusters := map[string]string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for len(hostingClusters) < 2 && scanner.Scan() {
+		var evt watchEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &evt))
+		require.Equal(t, "ADDED", evt.Type, "bookmarks must not be merged")
+		var obj map[string]interface{}
+		require.NoError(t, json.Unmarshal(evt.Object, &obj))
+		assert.Equal(t, hcpProxyGroupVersion, obj["apiVersion"])
+		metadata := obj["metadata"].(map[string]interface{})
+		annotations, _ := metadata["annotations"].(map[string]interface{})
+		hostingClusters[metadata["name"].(string)], _ = annotations[annotationHostingCluster].(string)
+	}
+	assert.Equal(t, map[string]string{"hc-spoke-1": "spoke-1", "hc-spoke-2": "spoke-2"}, hostingClusters)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, spoke := range []string{"spoke-1", "spoke-2"} {
+		query := spokeQueries[spoke]
+		require.NotNil(t, query, spoke)
+		assert.Equal(t, "true", query.Get("watch"))
+		assert.Equal(t, "env=prod", query.Get("labelSelector"))
+		assert.Empty(t, query.Get("allowWatchBookmarks"))
+	}
+}
+
+func Test_handleRoute_WhenWatchWithoutHostingClusterResumes_ItShouldReturn410(t *testing.T) {
+	spokeSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected spoke request %s", r.URL.Path)
+	}))
+	defer spokeSrv.Close()
+
+	p := newTestProxyWithSpokeURL(t, spokeSrv.URL, hostingManagedCluster("spoke-1"))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, apiPathPrefix+hcpProxyGroupVersion+
+		"/namespaces/clusters/hostedclusters?watch=true&resourceVersion=42", nil)
+	r.Header.Set("X-Remote-User", "alice")
+	p.handleRoute(w, r)
+
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "Expired")
+}
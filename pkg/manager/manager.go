@@ -48,6 +48,8 @@ import (
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	clusterv1alpha1 "open-cluster-management.io/api/cluster/v1alpha1"
+	clusterv1beta1 "open-cluster-management.io/api/cluster/v1beta1"
 )
 
 var (
@@ -69,6 +71,8 @@ func init() {
 	utilruntime.Must(mcev1.AddToScheme(genericScheme))
 	utilruntime.Must(addonapiv1alpha1.AddToScheme(genericScheme))
 	utilruntime.Must(clusterv1.AddToScheme(genericScheme))
+	utilruntime.Must(clusterv1alpha1.AddToScheme(genericScheme))
+	utilruntime.Must(clusterv1beta1.AddToScheme(genericScheme))
 }
 
 const (
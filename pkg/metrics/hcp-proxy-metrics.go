@@ -0,0 +1,75 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var HCPProxyRequestsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mce_hs_addon_hcp_proxy_requests_total",
+		Help: "HCP proxy requests by verb, resource, hosting cluster and HTTP response code",
+	},
+	[]string{"verb", "resource", "hosting_cluster", "code"},
+)
+
+var HCPProxyRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "mce_hs_addon_hcp_proxy_request_duration_seconds",
+		Help:    "HCP proxy request latency in seconds by verb, resource and hosting cluster, watches excluded",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	},
+	[]string{"verb", "resource", "hosting_cluster"},
+)
+
+var HCPProxyInFlightRequests = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "mce_hs_addon_hcp_proxy_inflight_requests",
+	Help: "Number of HCP proxy requests being served, watches included",
+})
+
+var HCPProxySpokeRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "mce_hs_addon_hcp_proxy_spoke_request_duration_seconds",
+		Help:    "Round-trip time in seconds of HCP proxy requests to a hosting cluster through cluster-proxy, until response headers",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	},
+	[]string{"hosting_cluster", "method"},
+)
+
+var HCPProxySpokeRequestsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mce_hs_addon_hcp_proxy_spoke_requests_total",
+		Help: "HCP proxy requests to a hosting cluster through cluster-proxy by HTTP response code, or error when no response was received",
+	},
+	[]string{"hosting_cluster", "method", "code"},
+)
+
+var HCPProxyAuthorizationDenials = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mce_hs_addon_hcp_proxy_authorization_denials_total",
+		Help: "HCP proxy requests denied by the hub permission check by hosting cluster and reason (not_admin, access_review_denied, unauthenticated, check_failed)",
+	},
+	[]string{"hosting_cluster", "reason"},
+)
+
+var HCPProxyPermissionCacheLookups = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mce_hs_addon_hcp_proxy_permission_cache_lookups_total",
+		Help: "HCP proxy authorization cache lookups by cache (permission, probe) and result (hit, miss)",
+	},
+	[]string{"cache", "result"},
+)
+
+var HCPProxyPermissionCacheInvalidations = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "mce_hs_addon_hcp_proxy_permission_cache_invalidations_total",
+	Help: "Number of times the HCP proxy authorization cache was flushed after a ClusterRoleBinding change",
+})
+
+func init() {
+	CollectorsForRegistration = append(CollectorsForRegistration,
+		HCPProxyRequestsTotal,
+		HCPProxyRequestDuration,
+		HCPProxyInFlightRequests,
+		HCPProxySpokeRequestDuration,
+		HCPProxySpokeRequestsTotal,
+		HCPProxyAuthorizationDenials,
+		HCPProxyPermissionCacheLookups,
+		HCPProxyPermissionCacheInvalidations)
+}
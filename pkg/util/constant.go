@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 
+	hyperv1beta1 "github.com/openshift/hypershift/api/hypershift/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -85,6 +86,13 @@ const (
 	// AddOnPlacementScore score name
 	HostedClusterScoresScoreName = "hostedClustersCount"
 
+	// ClusterClaims the addon agent publishes on the managed clusters
+	HostingClusterClaimKey                   = "hostingcluster.hypershift.openshift.io"
+	HostedClusterClaimKey                    = "hostedcluster.hypershift.openshift.io"
+	FullHostedClusterCountClaimKey           = "full.hostedclustercount.hypershift.openshift.io"
+	AboveThresholdHostedClusterCountClaimKey = "above.threshold.hostedclustercount.hypershift.openshift.io"
+	ZeroHostedClusterCountClaimKey           = "zero.hostedclustercount.hypershift.openshift.io"
+
 	// Default xaximum hosted cluster count on a hosting cluster
 	DefaultMaxHostedClusterCount = 80
 	// Default threshold hosted cluster count on a hosting cluster
@@ -116,3 +124,35 @@ func GenerateClientConfigFromSecret(secret *corev1.Secret) (*rest.Config, error)
 
 	return clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
 }
+
+// GetServingCertName returns the name of the first named serving certificate
+// of the hosted cluster API server, or "" when there is none
+func GetServingCertName(hc *hyperv1beta1.HostedCluster) string {
+	if hc.Spec.Configuration == nil || hc.Spec.Configuration.APIServer == nil {
+		return ""
+	}
+	named := hc.Spec.Configuration.APIServer.ServingCerts.NamedCertificates
+	if len(named) == 0 {
+		return ""
+	}
+	return named[0].ServingCertificate.Name
+}
+
+// ReplaceCertAuthDataInKubeConfig sets the certificate-authority-data of every
+// cluster in the kubeconfig to the tls.crt of a serving certificate secret
+func ReplaceCertAuthDataInKubeConfig(kubeconfig, tlsCrt []byte) ([]byte, error) {
+	if len(tlsCrt) == 0 {
+		return nil, fmt.Errorf("invalid serving certificate secret")
+	}
+
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range config.Clusters {
+		v.CertificateAuthorityData = tlsCrt
+	}
+
+	return clientcmd.Write(*config)
+}